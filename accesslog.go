@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// accessLogPollInterval 读取访问日志新增内容的间隔
+	accessLogPollInterval = 500 * time.Millisecond
+	// accessLogMaxEntries 内存中保留的最近请求条数上限, 扫描器刷日志时丢弃最早的请求
+	accessLogMaxEntries = 5000
+	// accessLogMaxAttach 单条告警附带的请求数上限, 超过时保留最近的请求
+	accessLogMaxAttach = 20
+)
+
+// accessLogPaths nginx和apache默认的访问日志位置, 用于-preset webserver
+var accessLogPaths = []string{
+	"/var/log/nginx/access.log",
+	"/usr/local/nginx/logs/access.log",
+	"/var/log/apache2/access.log",
+	"/var/log/httpd/access_log",
+	"/usr/local/apache2/logs/access_log",
+}
+
+// accessLogLine combined/common格式: IP - 用户 [时间] "方法 URI 协议" 状态码 大小 "Referer" "User-Agent"
+var accessLogLine = regexp.MustCompile(`^(\S+) \S+ \S+ \[([^\]]+)\] "(\S+) (\S+)[^"]*" (\d{3}) \S+(?: "[^"]*" "([^"]*)")?`)
+
+// accessRequest 访问日志中的一条请求, 随新增文件的告警一起输出和上报
+type accessRequest struct {
+	Time      string `json:"time"`
+	IP        string `json:"ip"`
+	Method    string `json:"method"`
+	URI       string `json:"uri"`
+	Status    int    `json:"status"`
+	UserAgent string `json:"user_agent,omitempty"`
+	// seen 读取到该行的时间, 日志中的时间只精确到秒且可能是请求结束时间, 按读取时间筛选
+	seen time.Time
+}
+
+func (r accessRequest) String() string {
+	return fmt.Sprintf("[%s] %s %s %s %d \"%s\"", r.Time, r.IP, r.Method, r.URI, r.Status, r.UserAgent)
+}
+
+// parseAccessLine 解析一行访问日志, 格式不符时返回false
+func parseAccessLine(line string) (accessRequest, bool) {
+	m := accessLogLine.FindStringSubmatch(line)
+	if m == nil {
+		return accessRequest{}, false
+	}
+	status, _ := strconv.Atoi(m[5])
+	return accessRequest{Time: m[2], IP: m[1], Method: m[3], URI: m[4], Status: status, UserAgent: m[6]}, true
+}
+
+// accessLogBuffer 所有访问日志最近的请求, 按读取顺序排列
+type accessLogBuffer struct {
+	mu       sync.Mutex
+	requests []accessRequest
+}
+
+func (b *accessLogBuffer) add(r accessRequest) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.requests = append(b.requests, r)
+	if len(b.requests) > accessLogMaxEntries {
+		b.requests = append(b.requests[:0], b.requests[len(b.requests)-accessLogMaxEntries:]...)
+	}
+}
+
+// requestsSince 返回since之后读取到的所有请求
+func (b *accessLogBuffer) requestsSince(since time.Time) []accessRequest {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := len(b.requests)
+	for i > 0 && b.requests[i-1].seen.After(since) {
+		i--
+	}
+	if i == len(b.requests) {
+		return nil
+	}
+	return append([]accessRequest(nil), b.requests[i:]...)
+}
+
+// prune 丢弃since之前读取到的请求
+func (b *accessLogBuffer) prune(since time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := 0
+	for i < len(b.requests) && !b.requests[i].seen.After(since) {
+		i++
+	}
+	b.requests = append(b.requests[:0], b.requests[i:]...)
+}
+
+// accessLogTail 跟踪一个访问日志文件, 日志被轮转(路径指向了另一个文件)或截断时从新文件开头读取
+type accessLogTail struct {
+	path    string
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	partial string
+}
+
+// open 打开日志文件, fromEnd为true时跳过已有内容
+func (t *accessLogTail) open(fromEnd bool) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	t.file, t.info, t.offset, t.partial = f, info, 0, ""
+	if fromEnd {
+		t.offset = info.Size()
+	}
+	return nil
+}
+
+// read 返回上次读取之后新增的完整行, 末尾不完整的行留到下次
+func (t *accessLogTail) read() []string {
+	if t.file == nil {
+		if err := t.open(false); err != nil {
+			return nil
+		}
+	}
+
+	var lines []string
+	info, err := os.Stat(t.path)
+	if err == nil {
+		if !os.SameFile(info, t.info) {
+			// 先读完旧文件中轮转前写入的内容
+			lines = t.readNew()
+			t.file.Close()
+			t.file = nil
+			if err := t.open(false); err != nil {
+				return lines
+			}
+		} else if info.Size() < t.offset {
+			t.offset, t.partial = 0, ""
+		}
+	}
+	return append(lines, t.readNew()...)
+}
+
+func (t *accessLogTail) readNew() []string {
+	data, err := io.ReadAll(io.NewSectionReader(t.file, t.offset, 1<<62))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	t.offset += int64(len(data))
+	text := t.partial + string(data)
+	end := strings.LastIndexByte(text, '\n')
+	if end < 0 {
+		t.partial = text
+		return nil
+	}
+	t.partial = text[end+1:]
+	return strings.Split(text[:end], "\n")
+}
+
+// windowRequests 返回最近accessLogWindow内读取到的所有访问日志请求, 用于关联攻击者IP
+func (dm *DirectoryMonitor) windowRequests() []accessRequest {
+	if dm.accessLogs == nil {
+		return nil
+	}
+	return dm.accessLogs.requestsSince(time.Now().Add(-dm.accessLogWindow))
+}
+
+// recentRequests 返回新增文件告警应附带的请求: 时间窗口内最近的accessLogMaxAttach条
+func (dm *DirectoryMonitor) recentRequests() []accessRequest {
+	requests := dm.windowRequests()
+	if len(requests) > accessLogMaxAttach {
+		requests = requests[len(requests)-accessLogMaxAttach:]
+	}
+	return requests
+}
+
+// startAccessLogs 跟踪nginx/apache访问日志(-access-log), 新增文件告警时附带之前accessLogWindow内的请求
+// (URI, 来源IP, User-Agent), 用于定位上传点和攻击者IP
+func (dm *DirectoryMonitor) startAccessLogs() {
+	dm.accessLogs = &accessLogBuffer{}
+	var tails []*accessLogTail
+	for _, path := range dm.accessLogPaths {
+		t := &accessLogTail{path: path}
+		if err := t.open(true); err != nil {
+			logWarn(fmt.Sprintf("打开访问日志失败, 文件出现后开始读取: %s: %v", path, err))
+		}
+		tails = append(tails, t)
+	}
+	logInfo(fmt.Sprintf("访问日志关联已启动: %s, 时间窗口: %v", strings.Join(dm.accessLogPaths, ", "), dm.accessLogWindow))
+
+	dm.runPeriodic(accessLogPollInterval, func() {
+		now := time.Now()
+		for _, t := range tails {
+			for _, line := range t.read() {
+				if r, ok := parseAccessLine(line); ok {
+					r.seen = now
+					dm.accessLogs.add(r)
+				}
+			}
+		}
+		dm.accessLogs.prune(now.Add(-dm.accessLogWindow))
+	})
+}
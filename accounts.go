@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	passwdFile = "/etc/passwd"
+	shadowFile = "/etc/shadow"
+	groupFile  = "/etc/group"
+)
+
+// authorizedKeysNames sshd默认读取的公钥文件
+var authorizedKeysNames = []string{"authorized_keys", "authorized_keys2"}
+
+// passwdEntries 解析passwd格式的内容, 返回用户名到各字段的映射
+func passwdEntries(data []byte) map[string][]string {
+	entries := make(map[string][]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 7 {
+			continue
+		}
+		entries[fields[0]] = fields
+	}
+	return entries
+}
+
+// authorizedKeysFiles 返回/etc/passwd中各用户主目录下的authorized_keys路径, 主目录不存在的用户跳过
+func authorizedKeysFiles() []string {
+	homes := map[string]bool{"/root": true}
+	if data, err := os.ReadFile(passwdFile); err == nil {
+		for _, fields := range passwdEntries(data) {
+			if home := fields[5]; home != "" && home != "/" {
+				homes[home] = true
+			}
+		}
+	}
+
+	var files []string
+	for home := range homes {
+		if info, err := os.Stat(home); err != nil || !info.IsDir() {
+			continue
+		}
+		for _, name := range authorizedKeysNames {
+			files = append(files, filepath.Join(home, ".ssh", name))
+		}
+	}
+	return files
+}
+
+// sshKeySummary 告警中显示的公钥摘要: 类型、与ssh-keygen -l相同的SHA256指纹和注释, 不输出整段公钥
+func sshKeySummary(line string) string {
+	fields := strings.Fields(line)
+	for i, field := range fields {
+		if !strings.HasPrefix(field, "ssh-") && !strings.HasPrefix(field, "ecdsa-") && !strings.HasPrefix(field, "sk-") {
+			continue
+		}
+		if i+1 >= len(fields) {
+			break
+		}
+		summary := field
+		if blob, err := base64.StdEncoding.DecodeString(fields[i+1]); err == nil {
+			sum := sha256.Sum256(blob)
+			summary += " SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+		}
+		if i+2 < len(fields) {
+			summary += " " + strings.Join(fields[i+2:], " ")
+		}
+		if i > 0 {
+			summary += " (选项: " + strings.Join(fields[:i], " ") + ")"
+		}
+		return summary
+	}
+	return redactLine(line)
+}
+
+// alertUserChanges 告警passwd中新增的用户, 以及uid或登录shell被修改的用户
+func (dm *DirectoryMonitor) alertUserChanges(before, after []byte) {
+	old := passwdEntries(before)
+	for name, fields := range passwdEntries(after) {
+		uid, home, shell := fields[2], fields[5], fields[6]
+		prev, ok := old[name]
+		switch {
+		case !ok:
+			msg := fmt.Sprintf("检测到新增用户: %s (uid=%s, home=%s, shell=%s)", name, uid, home, shell)
+			if uid == "0" {
+				msg += "，uid为0, 与root权限相同"
+			}
+			dm.alert("critical", "new_user", msg)
+		case prev[2] != uid || prev[6] != shell:
+			dm.alert("critical", "user_modified", fmt.Sprintf("检测到用户被修改: %s (uid: %s -> %s, shell: %s -> %s)",
+				name, prev[2], uid, prev[6], shell))
+		}
+	}
+}
+
+// alertNewSSHKeys 逐条告警authorized_keys中新增的公钥
+func (dm *DirectoryMonitor) alertNewSSHKeys(filePath string, before, after []byte) {
+	added, _ := diffLines(before, after)
+	count := 0
+	for _, line := range added {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		if count++; count > maxLineAlerts {
+			dm.alert("critical", "new_ssh_key", fmt.Sprintf("%s: 另有 %d 条新增公钥未列出", filePath, len(added)-maxLineAlerts))
+			return
+		}
+		dm.alert("critical", "new_ssh_key", fmt.Sprintf("检测到新增SSH公钥: %s %s", filePath, sshKeySummary(line)))
+	}
+}
+
+// startAccountMonitor 监控/etc/passwd, /etc/shadow, /etc/group和各用户的~/.ssh/authorized_keys:
+// 告警新增的用户和公钥及具体的行(口令哈希脱敏), 之后用启动时的内容复原, 新出现的authorized_keys移入隔离目录
+func (dm *DirectoryMonitor) startAccountMonitor() {
+	accounts := newSnapshotGroup("账号文件", "account_file_modified", "critical", true)
+	accounts.inspect = func(filePath string, before, after []byte) {
+		dm.alertLineChanges(filePath, before, after)
+		if filePath == passwdFile {
+			dm.alertUserChanges(before, after)
+		}
+	}
+	for _, filePath := range []string{passwdFile, shadowFile, groupFile} {
+		accounts.watchFile(dm, filePath, "account_file_modified")
+	}
+
+	keys := newSnapshotGroup("SSH公钥文件", "authorized_keys_modified", "critical", true)
+	keys.inspect = dm.alertNewSSHKeys
+	for _, filePath := range authorizedKeysFiles() {
+		keys.watchFile(dm, filePath, "new_authorized_keys")
+	}
+
+	logInfo(fmt.Sprintf("账号和SSH公钥监控已启动: %s, 当前 %d 个authorized_keys文件",
+		strings.Join(accounts.paths(), ", "), len(keys.paths())))
+
+	dm.runPeriodic(snapshotCheckInterval, func() {
+		dm.checkSnapshotGroup(accounts)
+		dm.checkSnapshotGroup(keys)
+	})
+}
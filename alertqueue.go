@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// 发送失败的告警按指数退避重试, 间隔从alertRetryMin翻倍到alertRetryMax
+const (
+	alertRetryMin = time.Second
+	alertRetryMax = time.Minute
+)
+
+// alertChannelSize 待发送告警通道的容量, 攻击期间的告警突发在此缓冲
+const alertChannelSize = 256
+
+// queuedAlert 一条待发送的告警请求, 已按上报方式(JSON POST或旧版GET)构造完成
+type queuedAlert struct {
+	Seq         uint64 `json:"seq"`
+	Method      string `json:"method"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+	Message     string `json:"message"`
+	QueuedAt    int64  `json:"queued_at"`
+}
+
+// alertQueue 发送失败的告警队列: 按顺序重试, 超出容量时丢弃最旧的告警;
+// 指定path时每次变化后写入磁盘, 重启后继续发送
+type alertQueue struct {
+	mu      sync.Mutex
+	items   []queuedAlert
+	nextSeq uint64
+	limit   int
+	path    string
+	dropped int
+	wake    chan struct{}
+}
+
+func newAlertQueue(limit int, path string) *alertQueue {
+	return &alertQueue{limit: limit, path: path, wake: make(chan struct{}, 1)}
+}
+
+// load 读取上次运行未送达的告警
+func (q *alertQueue) load() error {
+	if q.path == "" {
+		return nil
+	}
+	f, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var item queuedAlert
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			continue
+		}
+		q.nextSeq++
+		item.Seq = q.nextSeq
+		q.items = append(q.items, item)
+	}
+	if len(q.items) > 0 {
+		notify(q.wake)
+	}
+	return scanner.Err()
+}
+
+func (q *alertQueue) push(item queuedAlert) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.nextSeq++
+	item.Seq = q.nextSeq
+	q.items = append(q.items, item)
+	if len(q.items) > q.limit {
+		q.items = q.items[len(q.items)-q.limit:]
+		q.dropped++
+		logWarn(fmt.Sprintf("告警重试队列已满(%d)，丢弃最旧的告警", q.limit))
+	}
+	q.persist()
+	notify(q.wake)
+}
+
+func (q *alertQueue) head() (queuedAlert, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) == 0 {
+		return queuedAlert{}, false
+	}
+	return q.items[0], true
+}
+
+// pop 移除已送达的队首告警; 发送期间队首可能因队列已满被丢弃, 用seq确认
+func (q *alertQueue) pop(seq uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) > 0 && q.items[0].Seq == seq {
+		q.items = q.items[1:]
+		q.persist()
+	}
+}
+
+func (q *alertQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items)
+}
+
+// persist 原子地重写队列文件, 调用方持有mu
+func (q *alertQueue) persist() {
+	if q.path == "" {
+		return
+	}
+
+	var buf bytes.Buffer
+	for _, item := range q.items {
+		line, err := json.Marshal(item)
+		if err != nil {
+			continue
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	tmpPath := q.path + ".tmp"
+	if err := os.WriteFile(tmpPath, buf.Bytes(), 0600); err != nil {
+		logError(fmt.Sprintf("写入告警队列失败: %v", err))
+		return
+	}
+	if err := os.Rename(tmpPath, q.path); err != nil {
+		logError(fmt.Sprintf("写入告警队列失败: %v", err))
+	}
+}
+
+// postAlert 发送一条告警; 只有网络错误、HTTP 5xx和429返回错误(需要重试), 其他非200响应记录后放弃
+func (dm *DirectoryMonitor) postAlert(item queuedAlert) error {
+	req, err := http.NewRequest(item.Method, item.URL, bytes.NewReader(item.Body))
+	if err != nil {
+		logError(fmt.Sprintf("构造告警请求失败: %v", err))
+		return nil
+	}
+	if item.ContentType != "" {
+		req.Header.Set("Content-Type", item.ContentType)
+	}
+	// 认证头在发送时计算, 令牌不写入持久化的队列文件, 签名时间戳也不会因重试而过期
+	dm.signRequest(req, item.Body)
+
+	resp, err := dm.webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		logSuccess(fmt.Sprintf("告警发送成功: %s", item.Message))
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	default:
+		logError(fmt.Sprintf("告警响应异常: HTTP %d", resp.StatusCode))
+	}
+	return nil
+}
+
+// enqueueAlert 把告警交给发送goroutine, 检测和处置不等待HTTP; 通道已满时转入重试队列,
+// 没有重试队列时丢弃. 未启用发送goroutine时同步发送
+func (dm *DirectoryMonitor) enqueueAlert(item queuedAlert) {
+	item.QueuedAt = time.Now().Unix()
+	if dm.alertCh == nil {
+		dm.deliverAlert(item)
+		return
+	}
+
+	select {
+	case dm.alertCh <- item:
+	default:
+		if dm.alertQueue != nil {
+			logWarn("告警发送通道已满，转入重试队列")
+			dm.alertQueue.push(item)
+			return
+		}
+		logWarn(fmt.Sprintf("告警发送通道已满，丢弃告警: %s", item.Message))
+	}
+}
+
+// startAlertWorkers 启动固定数量的告警发送goroutine
+func (dm *DirectoryMonitor) startAlertWorkers(workers int) {
+	for i := 0; i < workers; i++ {
+		dm.alertWg.Add(1)
+		go func() {
+			defer dm.alertWg.Done()
+
+			for {
+				select {
+				case item := <-dm.alertCh:
+					dm.deliverAlert(item)
+				case <-dm.alertStop:
+					// 退出前发送通道中剩余的告警
+					for {
+						select {
+						case item := <-dm.alertCh:
+							dm.deliverAlert(item)
+						default:
+							return
+						}
+					}
+				}
+			}
+		}()
+	}
+}
+
+// stopAlertWorkers 在所有检测goroutine退出后调用, 等待剩余告警发送完毕
+func (dm *DirectoryMonitor) stopAlertWorkers() {
+	if dm.alertStop != nil {
+		close(dm.alertStop)
+		dm.alertWg.Wait()
+	}
+	if dm.alertQueue != nil {
+		dm.reportUndelivered()
+	}
+}
+
+// deliverAlert 发送告警; 失败时进入重试队列. 队列中已有告警时新告警直接排在后面, 保证送达顺序
+// (多个发送goroutine之间不保证顺序)
+func (dm *DirectoryMonitor) deliverAlert(item queuedAlert) {
+	if dm.alertQueue == nil {
+		if err := dm.postAlert(item); err != nil {
+			logError(fmt.Sprintf("API告警发送失败: %v", err))
+		}
+		return
+	}
+
+	if dm.alertQueue.len() > 0 {
+		dm.alertQueue.push(item)
+		return
+	}
+	if err := dm.postAlert(item); err != nil {
+		logWarn(fmt.Sprintf("API告警发送失败，稍后重试: %v", err))
+		dm.alertQueue.push(item)
+	}
+}
+
+// startAlertQueue 按顺序重试队列中的告警, 连续失败时指数退避; 退出时报告未送达的数量
+func (dm *DirectoryMonitor) startAlertQueue() {
+	q := dm.alertQueue
+	if err := q.load(); err != nil {
+		logWarn(fmt.Sprintf("读取告警队列失败: %v", err))
+	} else if n := q.len(); n > 0 {
+		logInfo(fmt.Sprintf("载入 %d 条上次未送达的告警", n))
+	}
+
+	dm.wg.Add(1)
+	go func() {
+		defer dm.wg.Done()
+
+		delay := alertRetryMin
+		for {
+			item, ok := q.head()
+			if !ok {
+				select {
+				case <-q.wake:
+					delay = alertRetryMin
+					continue
+				case <-dm.ctx.Done():
+					return
+				}
+			}
+
+			if delay > 0 {
+				select {
+				case <-time.After(delay):
+				case <-dm.ctx.Done():
+					return
+				}
+			}
+
+			if err := dm.postAlert(item); err != nil {
+				if delay *= 2; delay < alertRetryMin {
+					delay = alertRetryMin
+				} else if delay > alertRetryMax {
+					delay = alertRetryMax
+				}
+				logWarn(fmt.Sprintf("告警重试失败(队列中 %d 条)，%v后重试: %v", q.len(), delay, err))
+				continue
+			}
+			q.pop(item.Seq)
+			delay = 0
+		}
+	}()
+}
+
+func (dm *DirectoryMonitor) reportUndelivered() {
+	n := dm.alertQueue.len()
+	if n == 0 {
+		return
+	}
+	if dm.alertQueue.path != "" {
+		logWarn(fmt.Sprintf("%d 条告警未送达，已保存到 %s，下次启动时继续发送", n, dm.alertQueue.path))
+	} else {
+		logWarn(fmt.Sprintf("%d 条告警未送达", n))
+	}
+}
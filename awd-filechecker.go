@@ -1,17 +1,25 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"math"
+	"net"
 	"net/http"
-	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
 )
 
@@ -30,101 +38,851 @@ const (
 type FileInfo struct {
 	Path    string
 	Size    int64
-	ModTime int64
-	Mode    os.FileMode
-	Uid     uint32
-	Gid     uint32
+	ModTime int64 // 纳秒
+	Inode   uint64
+	// Ctime 状态变更时间(纳秒), 不能被touch伪造, 变化时重新计算Hash
+	Ctime int64
+	// Hash 内容的SHA-256, 只在基线中记录
+	Hash string
+
+	Mode os.FileMode
+	Uid  uint32
+	Gid  uint32
+	// Owner 所有者SID, 只在Windows上记录
+	Owner string
+	// Attributes Windows文件属性(只读/隐藏/系统等), Linux上为0
+	Attributes uint32
+	// Xattrs 扩展属性和ACL的摘要, 只在基线中记录
+	Xattrs string
 }
 
+// dirRule 决定目录中文件发生变化时的处理方式
+type dirRule int
+
+const (
+	ruleEnforce dirRule = iota // 监控目录: 告警, 隔离, 还原
+	ruleTemp                   // 临时目录: 只告警可执行文件和高熵文件
+	ruleSession                // PHP session目录: 只检查新建的超大session文件
+)
+
+// 除ruleEnforce外的规则都是只告警模式: 不备份, 不隔离, 不还原
+func (r dirRule) alertOnly() bool {
+	return r != ruleEnforce
+}
+
+// tempDirs 攻击者常用的工具落地目录
+var tempDirs = []string{"/tmp", "/var/tmp", "/dev/shm"}
+
+// copyBufSize 备份和还原时复制文件使用的缓冲区大小
+const copyBufSize = 32 * 1024
+
+// tempEntropyThreshold 临时目录新文件的熵阈值, 超过视为加壳/加密的可疑二进制
+const tempEntropyThreshold = 6.5
+
 type DirectoryMonitor struct {
-	watchDir      string
-	baseDir       string
-	backupDir     string
-	isolateDir    string
-	extensions    []string
-	baseline      map[string]FileInfo
-	directories   []string
-	checkInterval time.Duration
-	apiEndpoint   string
-	mu            sync.RWMutex
+	// watchDir 主监控目录, roots包含所有监控根目录(第一个即watchDir)
+	watchDir string
+	roots    []watchRoot
+
+	baseDir    string
+	backupDir  string
+	isolateDir string
+	// evidenceDir 还原前保存被篡改内容的目录, keepEvidence为false时不保存
+	evidenceDir  string
+	keepEvidence bool
+
+	extensions []string
+	// dangerousExts 可被执行的脚本扩展名, 用于识别evil.php.jpg这类双扩展名文件
+	dangerousExts []string
+	// polyglotExts 检查是否嵌入了脚本代码的图片扩展名, 不受-e限制; polyglotCache由polyglotMu保护
+	polyglotExts  []string
+	polyglotCache map[string]polyglotResult
+	polyglotMu    sync.Mutex
+	// nameHeuristics 启用的文件名启发式规则(hidden/bidi/homoglyph), 命中的新增文件告警suspicious_filename
+	nameHeuristics map[string]bool
+
+	// maxLineLength 脚本文件单行最大字节数, 超过时在告警中标记suspicious_long_line
+	maxLineLength int
+	// scoreWeights 组合评分中各指标的分值, 总分达到scoreThreshold时告警combined_indicator
+	scoreWeights map[string]int
+	scanner      *signatureScanner
+	yaraRules    []*yaraRule
+	// contentRules -content-rules中按级别和处理方式定义的内容规则
+	contentRules []contentRule
+
+	scoreThreshold int
+
+	baseline    map[string]FileInfo
+	directories []string
+	// knownDirs 已在监控中的目录, 不在其中的子目录视为运行期间新建; dirMu保护directories和knownDirs
+	knownDirs map[string]bool
+	// dirBaseline 启动时各目录的权限和所有者, 由dirMu保护; treeMu保证同一时间只重建一棵目录树
+	dirBaseline map[string]DirInfo
+	treeMu      sync.Mutex
+
+	dirMu          sync.Mutex
+	isolateNewDirs bool
+	// symlinks 基线中的符号链接及其指向, 由mu保护
+	symlinks      map[string]string
+	symlinkAction string
+	// specialFiles 基线中的命名管道/socket/设备文件及其类型, 由mu保护
+	specialFiles       map[string]os.FileMode
+	removeSpecialFiles bool
+	// dryRun 只检测和告警, 从不隔离、还原或重建目录
+	dryRun bool
+	// policies 按路径规则指定文件变化的处理方式, 第一条匹配的生效
+	policies []actionPolicy
+
+	// wg 扫描调度/worker goroutine和周期任务
+	wg sync.WaitGroup
+	// ctx 收到退出信号时取消, 所有goroutine据此退出; startTime用于退出汇总
+	ctx       context.Context
+	cancel    context.CancelFunc
+	startTime time.Time
+	// backupProgress 初始备份时在终端显示进度, bytesCopied为备份累计复制的字节数
+	backupProgress bool
+	bytesCopied    atomic.Int64
+	// latestSymlink 备份完成后更新<baseDir>/backup_latest指向本次备份
+	latestSymlink bool
+	// resumeBackup 复用上次的备份目录和基线清单, 验证失败时重新备份; manifestDirty 基线变化后待写回清单
+	resumeBackup  bool
+	manifestDirty atomic.Bool
+	// manifestFormat 基线清单格式, json或jsonl
+	manifestFormat string
+	// copyBufs 复制文件用的缓冲区池, 避免每个文件分配新的缓冲区
+	copyBufs      sync.Pool
+	skipEmptyDirs bool
+	// activeDirectories 只包含直接存放了被监控文件的目录, 按各自的检查间隔调度
+	activeDirectories []string
+	// dirRules 记录非默认处理方式的目录, 未记录的目录按ruleEnforce处理; Start启动goroutine之前写入, 之后只读
+	dirRules       map[string]dirRule
+	watchTemp      bool
+	tempScan       bool
+	cronMonitor    bool
+	ldMonitor      bool
+	procNetMonitor bool
+	procNetKill    bool
+	phpMonitor     bool
+	// lineMonitorFiles 按行比较并告警增删行的配置文件
+	lineMonitorFiles []string
+	// watchFiles 不监控所在目录, 单独监控并复原的文件(绝对路径)
+	watchFiles []string
+	// flagFiles 固定内容、属主和权限的flag文件(绝对路径)
+	flagFiles []string
+
+	// restorePHPConfig PHP配置被修改时是否复原
+	restorePHPConfig bool
+
+	restoreLd bool
+	// restoreCron 计划任务被修改时是否复原
+	restoreCron bool
+	// accountMonitor 监控并复原/etc/passwd, /etc/shadow, /etc/group和各用户的authorized_keys
+	accountMonitor bool
+
+	// suidRoots 监控SUID/SGID和capabilities的目录, 为空时关闭; stripSuid 清除新出现的特权位
+	suidRoots []string
+	stripSuid bool
+
+	// procMonitor 监控Web服务用户(procUsers)启动的可疑进程(procNames), procKill为true时结束该进程
+	procMonitor bool
+	procUsers   []string
+	procNames   []string
+	procKill    bool
+	// connMonitor 监控procUsers新发起的外连, connWhitelist中的目的地址不告警
+	connMonitor   bool
+	connWhitelist []connRule
+	// memshellProcs 检查fd和内存映射的Web worker进程名, 为空时关闭内存马检测
+	memshellProcs []string
+	// tomcatHome 监控webapps, work和conf的Tomcat目录(CATALINA_BASE), 为空时关闭
+	tomcatHome string
+	// webserverMonitor 监控nginx/apache配置, restoreWebserver为true时复原并按webserverTestCmd检查后执行webserverReloadCmd
+	webserverMonitor   bool
+	restoreWebserver   bool
+	webserverTestCmd   string
+	webserverReloadCmd string
+	// accessLogPaths 跟踪的访问日志, 新增文件告警附带accessLogWindow内的请求; accessLogs在startAccessLogs中创建
+	accessLogPaths  []string
+	accessLogWindow time.Duration
+	accessLogs      *accessLogBuffer
+	// blockIP 确认为webshell的新增文件关联到上传请求时按blockCmd封禁来源IP, blockDuration后按unblockCmd解除
+	blockIP        bool
+	blockCmd       string
+	unblockCmd     string
+	blockDuration  time.Duration
+	blockWhitelist []*net.IPNet
+	blockMu        sync.Mutex
+	blocked        map[string]time.Time
+
+	sessionDir     string
+	maxSessionSize int64
+	checkInterval  time.Duration
+	// watcher inotify模式下的目录事件源, 为nil时纯轮询
+	watcher *inotifyWatcher
+	// scheduler 目录扫描调度, 由固定数量的worker检查所有目录
+	scheduler *scanScheduler
+	watchMode string
+	// dirIntervals 按目录模式覆盖checkInterval, 第一条匹配的规则生效
+	dirIntervals []dirInterval
+	// dirExtensions 按目录模式覆盖extensions, 第一条匹配的规则生效
+	dirExtensions []dirExtensions
+	// excludes -x排除的路径, 不备份、不监控
+	excludes []excludeRule
+	// dirExcludes 配置文件中按目录追加的排除规则
+	dirExcludes []dirExcludes
+
+	// mtimeResolution 比较修改时间时的精度, FAT32为2s, ext4可设为1ns
+	mtimeResolution time.Duration
+	// inodeCheck 同时比较inode, 识别通过rename替换文件的攻击手法
+	inodeCheck bool
+
+	apiEndpoint    string
+	maxAlertMsgLen int
+	// diffMaxSize 告警中附带unified diff的文本文件大小上限, 0表示不生成
+	diffMaxSize int64
+	// obfuscationThreshold 混淆评分达到该值时告警提升为critical, 0表示不计算
+	obfuscationThreshold int
+
+	// webhookURL 告警上报地址, 默认以JSON POST发送; webhookGet为true时使用旧版GET查询参数
+	webhookURL         string
+	webhookContentType string
+	webhookGet         bool
+	// dirAPIs 配置文件中按目录额外上报告警的URL, 总是以JSON POST发送
+	dirAPIs []dirAPI
+	// webhookClient 上报告警和心跳的HTTP客户端(自定义CA/跳过证书校验);
+	// webhookToken/webhookHMACKey 非空时添加Bearer令牌和HMAC签名头
+	webhookClient  *http.Client
+	webhookToken   string
+	webhookHMACKey string
+	// streamEvents 把audit.log中的处理动作上报到apiEndpoint的/api/agent/edr-events(edr server)
+	streamEvents bool
+	// alertQueue 发送失败的告警按顺序重试, 为nil时失败的告警直接丢弃
+	alertQueue *alertQueue
+	// alertCh 待发送告警的有界通道, 由alertWorkers个goroutine发送; 为nil时在检测goroutine中同步发送
+	alertCh      chan queuedAlert
+	alertStop    chan struct{}
+	alertWg      sync.WaitGroup
+	alertWorkers int
+
+	// backupDirMode 备份/隔离目录的预期权限, 被放宽时告警并复原
+	backupDirMode        os.FileMode
+	dirPermCheckInterval time.Duration
+	// selfPath/selfHash 记录本程序可执行文件及其SHA-256, 用于自身完整性检查
+	selfPath           string
+	selfHash           atomic.Value
+	selfCheckInterval  time.Duration
+	exitOnBinaryTamper bool
+	// lockedOut 临时豁免监控的文件及其到期时间和到期定时器, 到期后以当前内容重建基线
+	lockedOut map[string]lockoutEntry
+	lockMu    sync.Mutex
+	auditMu   sync.Mutex
+	// massDeleteThreshold 批量删除阈值, 超过时汇总告警并批量还原整棵子树
+	massDeleteThreshold int
+
+	// deepScanInterval 深度扫描(重新计算所有基线文件哈希)的间隔, 0表示关闭;
+	// deepScanHits 深度扫描发现哈希不一致、等待目录检查处理的文件, 由deepMu保护
+	deepScanInterval time.Duration
+	deepScanHits     map[string]bool
+	deepMu           sync.Mutex
+
+	// floodThreshold/floodAction 新增文件洪水的阈值和批量处理方式(isolate/delete);
+	// floods 处于洪水期间的目录及最后一次超过阈值的时间, 由floodMu保护
+	floodThreshold int
+	floodAction    string
+	floods         map[string]time.Time
+	floodMu        sync.Mutex
+
+	// isolateMaxSize 隔离目录的配额(字节), isolateMaxAge 隔离样本的保留时间, 0表示不限制
+	isolateMaxSize int64
+	isolateMaxAge  time.Duration
+
+	// stats 运行统计, statsInterval为周期汇总和心跳的间隔
+	stats         monitorStats
+	statsInterval time.Duration
+	// settleTime 建立基线前要求监控目录保持无变化的时长
+	settleTime time.Duration
+	// startupGrace 基线建立后的宽限期, 期间基线建立前刚写过的文件发生变化时暂不告警
+	startupGrace    time.Duration
+	baselineBuiltAt time.Time
+
+	// repl 从标准输入读取运维命令
+	repl bool
+	// paused 检测已暂停(SIGUSR1/pause命令), pauseMu串行化暂停和恢复;
+	// rebaselineOnResume 恢复时按当前内容重建基线
+	paused             atomic.Bool
+	pauseMu            sync.Mutex
+	pausedAt           time.Time
+	rebaselineOnResume bool
+
+	// events 持久化的告警事件日志, eventLogKeep为磁盘上保留的记录数
+	events       *eventLog
+	eventLogKeep int
+
+	// restoreNotifySuffix 非空时, 每次还原后在被还原文件旁写入"文件名+后缀"的通知文件
+	restoreNotifySuffix string
+	// suppressed 不参与监控的文件路径
+	suppressed   map[string]bool
+	suppressMu   sync.RWMutex
+	suppressFile string
+	// configFile -c指定的配置文件, 与豁免列表一样受防篡改保护
+	configFile string
+
+	// preRestoreCmd 还原前执行的钩子命令, 非0退出码否决本次还原
+	preRestoreCmd string
+	// preBackupCmd/postBackupCmd 初始备份前后执行的钩子命令, 失败不影响备份
+	preBackupCmd      string
+	postBackupCmd     string
+	backupHookTimeout time.Duration
+	// eventHooks 文件新增、修改、删除和隔离后执行的命令, hookSlots限制同时执行的数量
+	eventHooks eventHooks
+	hookSlots  chan struct{}
+	// restoreHistory 每个文件最近一小时内的还原时间, 用于识别持续性攻击
+	restoreHistory     map[string][]time.Time
+	persistentAlerted  map[string]time.Time
+	historyMu          sync.Mutex
+	maxRestoresPerHour int
+	acceptPersistent   bool
+	// flapThreshold 单个文件一分钟内被处理的次数阈值, 达到后进入升级模式; flaps由flapMu保护
+	flapThreshold int
+	// immutableRules 还原后加上chattr +i的关键文件; immutable 本程序设置了不可变属性的文件, 由immutableMu保护
+	immutableRules []excludeRule
+	immutable      map[string]bool
+	immutableMu    sync.Mutex
+
+	flaps  map[string]*flapState
+	flapMu sync.Mutex
+
+	// isolatedMu 串行化隔离目标路径的选择, 原始路径记录在隔离文件旁的.origin文件中
+	isolatedMu sync.Mutex
+
+	mu sync.RWMutex
 }
 
 type MonitorConfig struct {
-	WatchDir    string
-	BaseDir     string
-	Extensions  []string
+	// WatchDirs 监控根目录, 第一个为主目录(用于心跳、审计和钩子环境变量)
+	WatchDirs []string
+
+	BaseDir       string
+	Extensions    []string
+	DangerousExts []string
+	PolyglotExts  []string
+	// NameHeuristics 启用的文件名启发式规则
+	NameHeuristics map[string]bool
+
+	MaxLineLength int
+	ScoreWeights  map[string]int
+	// Signatures webshell特征规则, 用于确认新增/被修改的文件是否为webshell
+	Signatures *signatureScanner
+	// YaraRules -yara目录中加载的规则
+	YaraRules []*yaraRule
+	// ContentRules -content-rules文件中加载的内容规则
+	ContentRules []contentRule
+
+	// ScoreThreshold 组合评分告警阈值, 0表示关闭
+	ScoreThreshold int
+
 	APIEndpoint string
+	// MaxAlertMsgLen 上报API的告警消息最大字符数, 0表示不限制
+	MaxAlertMsgLen int
+	// DiffMaxSize 告警中附带unified diff的文本文件大小上限(字节), 0表示不生成
+	DiffMaxSize int64
+	// ObfuscationThreshold 新增/被修改脚本的混淆评分达到该值时告警提升为critical, 0表示不计算
+	ObfuscationThreshold int
+
+	// WebhookURL 完整的告警上报URL, 为空时使用APIEndpoint上的/api/agent/edr-alert
+	WebhookURL         string
+	WebhookContentType string
+	WebhookGet         bool
+	// DirAPIs 配置文件中按目录额外上报告警的端点
+	DirAPIs []dirAPI
+	// WebhookClient 上报使用的HTTP客户端, WebhookToken/WebhookHMACKey 认证令牌和签名密钥
+	WebhookClient  *http.Client
+	WebhookToken   string
+	WebhookHMACKey string
+	// StreamEvents 把audit.log中的处理动作(还原、结束进程、封禁IP等)上报到APIEndpoint
+	StreamEvents bool
+	// AlertQueueSize 告警重试队列容量, 0表示不重试; AlertQueueFile 非空时队列持久化到该文件
+	AlertQueueSize int
+	AlertQueueFile string
+	// AlertWorkers 告警发送goroutine数量, 0表示在检测goroutine中同步发送
+	AlertWorkers int
+	// ScanWorkers 检查目录的worker数量, 0表示按CPU核数
+	ScanWorkers int
+
+	// SkipEmptyDirs 为true时, 不含被监控文件的目录按5倍检查间隔低频巡检
+	SkipEmptyDirs bool
+	// IsolateNewDirs 运行期间新建的目录直接移入隔离目录, 否则只告警并纳入监控
+	IsolateNewDirs bool
+	// SymlinkAction 新增符号链接的处理方式: alert, isolate 或 delete
+	SymlinkAction string
+	// RemoveSpecialFiles 删除新增的命名管道、unix socket和设备文件, 否则只告警
+	RemoveSpecialFiles bool
+	// DryRun 只告警不处理, 用于在正式启用前验证扩展名和排除规则
+	DryRun bool
+	// Policies 按路径规则覆盖默认的隔离/还原处理
+	Policies []actionPolicy
+	// KeepEvidence 还原前把被篡改的内容复制到evidence_目录
+	KeepEvidence bool
+
+	MtimeResolution time.Duration
+	InodeCheck      bool
+	// WatchMode poll为定时轮询, inotify为事件驱动(辅以低频兜底轮询)
+	WatchMode string
+	// CheckInterval 每个目录的检查间隔, 默认200ms
+	CheckInterval time.Duration
+	// DirIntervals 按目录模式(相对监控目录, 同时作用于子目录)覆盖检查间隔
+	DirIntervals []dirInterval
+	// DirExtensions 配置文件中按目录覆盖的扩展名
+	DirExtensions []dirExtensions
+	// Excludes 排除规则, 用于缓存、session、日志等应用正常写入的路径
+	Excludes []excludeRule
+	// DirExcludes 配置文件中按目录追加的排除规则
+	DirExcludes []dirExcludes
+
+	// BackupProgress 初始备份时显示进度和速率, stderr不是终端时自动关闭
+	BackupProgress bool
+	// Resume 复用基础目录下最近一次带有基线清单的备份, 不重新备份
+	Resume bool
+	// ManifestFormat 基线清单格式: json为单个对象, jsonl为每个文件一行, 恢复时逐行解析
+	ManifestFormat string
+	// LatestSymlink 备份完成后原子更新<baseDir>/backup_latest符号链接
+	LatestSymlink bool
+
+	// WatchTemp 以只告警模式额外监控/tmp, /var/tmp, /dev/shm
+	WatchTemp bool
+	// TempScan 对临时目录和session目录中新增和被修改的文件做webshell特征和YARA扫描, 只告警
+	TempScan bool
+	// CronMonitor 监控/etc/crontab, /etc/cron.d, 各用户crontab和systemd unit文件, RestoreCron为true时复原
+	CronMonitor bool
+	RestoreCron bool
+	// LdMonitor 监控/etc/ld.so.preload, /etc/ld.so.conf和/etc/ld.so.conf.d, RestoreLd为true时复原
+	LdMonitor bool
+	RestoreLd bool
+	// ProcNetMonitor 通过/proc/net/tcp(6)监控新出现的监听端口
+	ProcNetMonitor bool
+	// ProcNetKill 结束新监听端口所属的进程
+	ProcNetKill bool
+	// AccountMonitor 监控账号文件和authorized_keys, 告警新增的用户和公钥并复原
+	AccountMonitor bool
+	// SuidRoots 监控新出现的SUID/SGID文件和capabilities的目录, StripSuid为true时清除特权位
+	SuidRoots []string
+	StripSuid bool
+	// ProcMonitor 监控ProcUsers启动的ProcNames中的进程, ProcKill为true时结束该进程
+	ProcMonitor bool
+	ProcUsers   []string
+	ProcNames   []string
+	ProcKill    bool
+	// ConnMonitor 监控ProcUsers新发起的、目的地址不在ConnWhitelist中的TCP连接
+	ConnMonitor   bool
+	ConnWhitelist []connRule
+	// MemshellProcs 检查已删除的脚本文件和可疑可执行内存的Web worker进程名
+	MemshellProcs []string
+	// TomcatHome 监控新部署的应用、孤立的JSP编译类和conf变化的Tomcat目录
+	TomcatHome string
+	// WebserverMonitor 监控nginx/apache配置目录, RestoreWebserver为true时复原并重新加载
+	WebserverMonitor   bool
+	RestoreWebserver   bool
+	WebserverTestCmd   string
+	WebserverReloadCmd string
+	// AccessLogs 跟踪的nginx/apache访问日志, 新增文件告警附带AccessLogWindow内的请求
+	AccessLogs      []string
+	AccessLogWindow time.Duration
+	// BlockIP 自动封禁上传webshell的来源IP, BlockDuration为0表示永久封禁
+	BlockIP        bool
+	BlockCmd       string
+	UnblockCmd     string
+	BlockDuration  time.Duration
+	BlockWhitelist []*net.IPNet
+	// PHPMonitor 监控php --ini发现的配置文件和php-fpm配置
+	PHPMonitor       bool
+	RestorePHPConfig bool
+	// LineMonitorFiles 按行监控的文件, 告警line_added/line_removed并整体复原
+	LineMonitorFiles []string
+	// WatchFiles 单独监控的文件, 修改或删除时告警watched_file_modified并复原
+	WatchFiles []string
+	// FlagFiles flag文件, 被篡改时告警flag_tampering并立即复原
+	FlagFiles []string
+	// SessionDir PHP session目录, 只告警新建的超过MaxSessionSize的session文件
+	SessionDir     string
+	MaxSessionSize int64
+
+	BackupDirMode os.FileMode
+	// DirPermCheckInterval 备份/隔离目录权限的检查间隔, 0表示不检查
+	DirPermCheckInterval time.Duration
+	// SelfCheckInterval 自身可执行文件的完整性检查间隔, 0表示不检查
+	SelfCheckInterval  time.Duration
+	ExitOnBinaryTamper bool
+	// MassDeleteThreshold 一次检查中目录内消失的文件超过该数量时按批量删除处理, 0表示关闭
+	MassDeleteThreshold int
+	// DeepScanInterval 深度扫描间隔, 0表示关闭
+	DeepScanInterval time.Duration
+	// FloodThreshold 一次检查中目录内新增的文件超过该数量时按洪水批量处理, 0表示关闭
+	FloodThreshold int
+	FloodAction    string
+	// IsolateMaxSize 隔离目录配额(MB), IsolateMaxAge 隔离样本保留时间, 0表示不限制
+	IsolateMaxSize int64
+	IsolateMaxAge  time.Duration
+
+	// StatsInterval 周期统计汇总间隔, 0表示不汇总
+	StatsInterval time.Duration
+	SettleTime    time.Duration
+	StartupGrace  time.Duration
+
+	// REPL 启用标准输入交互命令
+	REPL bool
+	// RebaselineOnResume 恢复检测时按当前内容重建基线
+	RebaselineOnResume bool
+
+	// EventLogKeep 事件日志保留的记录数, 0表示不记录
+	EventLogKeep int
+
+	// RestoreNotifyFile 还原通知文件的后缀, 例如.edr_restored
+	RestoreNotifyFile string
+	// SuppressFile 不参与监控的文件列表, 每行一个路径
+	SuppressFile string
+	// ConfigFile 启动时读取的YAML配置文件
+	ConfigFile string
+
+	PreRestoreCmd string
+	// PreBackupCmd/PostBackupCmd 初始备份前后执行的命令, 例如刷新应用缓存到磁盘
+	PreBackupCmd      string
+	PostBackupCmd     string
+	BackupHookTimeout time.Duration
+	// EventHooks 文件新增、修改、删除和隔离后执行的命令
+	EventHooks eventHooks
+	// FlapThreshold 单个文件一分钟内被隔离/还原的次数达到该值时合并告警, 0表示关闭
+	FlapThreshold int
+	// ImmutableRules 还原后加上不可变属性的关键文件
+	ImmutableRules []excludeRule
+	// MaxRestoresPerHour 单个文件一小时内的还原次数阈值, 超过时告警persistent_attack_detected
+	MaxRestoresPerHour int
+	// AcceptPersistent 超过阈值后以当前内容重建基线, 停止还原循环
+	AcceptPersistent bool
 }
 
 func NewDirectoryMonitor(config MonitorConfig) *DirectoryMonitor {
 	timestamp := time.Now().Format("20060102_150405")
 
+	webhookURL := config.WebhookURL
+	if webhookURL == "" && config.APIEndpoint != "" {
+		webhookURL = apiBaseURL(config.APIEndpoint) + "/api/agent/edr-alert"
+	}
+
+	backupDir := filepath.Join(config.BaseDir, fmt.Sprintf("backup_%s", timestamp))
+	isolateDir := filepath.Join(config.BaseDir, fmt.Sprintf("isolate_%s", timestamp))
+	resume := false
+	if config.Resume {
+		if dir, err := resumeBackupDir(config.BaseDir); err != nil {
+			logWarn(fmt.Sprintf("没有可复用的备份, 重新备份: %v", err))
+		} else {
+			backupDir, resume = dir, true
+		}
+	}
+
+	reportAlerts := webhookURL != "" || len(config.DirAPIs) > 0
+	var queue *alertQueue
+	if reportAlerts && config.AlertQueueSize > 0 {
+		queue = newAlertQueue(config.AlertQueueSize, config.AlertQueueFile)
+	}
+	var alertCh chan queuedAlert
+	var alertStop chan struct{}
+	if reportAlerts && config.AlertWorkers > 0 {
+		alertCh = make(chan queuedAlert, alertChannelSize)
+		alertStop = make(chan struct{})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
 	return &DirectoryMonitor{
-		watchDir:      config.WatchDir,
-		baseDir:       config.BaseDir,
-		backupDir:     filepath.Join(config.BaseDir, fmt.Sprintf("backup_%s", timestamp)),
-		isolateDir:    filepath.Join(config.BaseDir, fmt.Sprintf("isolate_%s", timestamp)),
+		ctx:          ctx,
+		cancel:       cancel,
+		startTime:    time.Now(),
+		watchDir:     filepath.Clean(config.WatchDirs[0]),
+		roots:        newWatchRoots(config.WatchDirs, backupDir, isolateDir),
+		baseDir:      config.BaseDir,
+		backupDir:    backupDir,
+		isolateDir:   isolateDir,
+		evidenceDir:  filepath.Join(config.BaseDir, fmt.Sprintf("evidence_%s", timestamp)),
+		keepEvidence: config.KeepEvidence,
+
 		extensions:    config.Extensions,
-		baseline:      make(map[string]FileInfo),
-		checkInterval: 200 * time.Millisecond, // 硬编码为200ms，快速响应
-		apiEndpoint:   config.APIEndpoint,
+		dangerousExts: config.DangerousExts,
+		polyglotExts:  config.PolyglotExts,
+		polyglotCache: make(map[string]polyglotResult),
+
+		nameHeuristics: config.NameHeuristics,
+
+		maxLineLength: config.MaxLineLength,
+		scoreWeights:  config.ScoreWeights,
+		scanner:       config.Signatures,
+		yaraRules:     config.YaraRules,
+		contentRules:  config.ContentRules,
+
+		scoreThreshold: config.ScoreThreshold,
+
+		baseline:       make(map[string]FileInfo),
+		skipEmptyDirs:  config.SkipEmptyDirs,
+		backupProgress: config.BackupProgress,
+		latestSymlink:  config.LatestSymlink,
+		resumeBackup:   resume,
+		manifestFormat: config.ManifestFormat,
+		dirRules:       make(map[string]dirRule),
+		knownDirs:      make(map[string]bool),
+		dirBaseline:    make(map[string]DirInfo),
+		symlinks:       make(map[string]string),
+		symlinkAction:  config.SymlinkAction,
+		isolateNewDirs: config.IsolateNewDirs,
+		dryRun:         config.DryRun,
+		policies:       config.Policies,
+
+		specialFiles:       make(map[string]os.FileMode),
+		removeSpecialFiles: config.RemoveSpecialFiles,
+
+		lockedOut:        make(map[string]lockoutEntry),
+		watchTemp:        config.WatchTemp,
+		tempScan:         config.TempScan,
+		cronMonitor:      config.CronMonitor,
+		restoreCron:      config.RestoreCron,
+		ldMonitor:        config.LdMonitor,
+		restoreLd:        config.RestoreLd,
+		procNetMonitor:   config.ProcNetMonitor,
+		procNetKill:      config.ProcNetKill,
+		accountMonitor:   config.AccountMonitor,
+		suidRoots:        config.SuidRoots,
+		stripSuid:        config.StripSuid,
+		procMonitor:      config.ProcMonitor,
+		procUsers:        config.ProcUsers,
+		procNames:        config.ProcNames,
+		procKill:         config.ProcKill,
+		connMonitor:      config.ConnMonitor,
+		connWhitelist:    config.ConnWhitelist,
+		memshellProcs:    config.MemshellProcs,
+		tomcatHome:       config.TomcatHome,
+		phpMonitor:       config.PHPMonitor,
+		restorePHPConfig: config.RestorePHPConfig,
+		lineMonitorFiles: config.LineMonitorFiles,
+		watchFiles:       config.WatchFiles,
+		flagFiles:        config.FlagFiles,
+		sessionDir:       config.SessionDir,
+		maxSessionSize:   config.MaxSessionSize,
+
+		webserverMonitor:   config.WebserverMonitor,
+		restoreWebserver:   config.RestoreWebserver,
+		webserverTestCmd:   config.WebserverTestCmd,
+		webserverReloadCmd: config.WebserverReloadCmd,
+
+		accessLogPaths:  config.AccessLogs,
+		accessLogWindow: config.AccessLogWindow,
+
+		blockIP:        config.BlockIP,
+		blockCmd:       config.BlockCmd,
+		unblockCmd:     config.UnblockCmd,
+		blockDuration:  config.BlockDuration,
+		blockWhitelist: config.BlockWhitelist,
+		blocked:        make(map[string]time.Time),
+
+		checkInterval:   config.CheckInterval,
+		mtimeResolution: config.MtimeResolution,
+		inodeCheck:      config.InodeCheck,
+		dirIntervals:    config.DirIntervals,
+		dirExtensions:   config.DirExtensions,
+		excludes:        config.Excludes,
+		dirExcludes:     config.DirExcludes,
+		watchMode:       config.WatchMode,
+
+		apiEndpoint:    config.APIEndpoint,
+		maxAlertMsgLen: config.MaxAlertMsgLen,
+		diffMaxSize:    config.DiffMaxSize,
+
+		obfuscationThreshold: config.ObfuscationThreshold,
+
+		webhookURL:         webhookURL,
+		webhookContentType: config.WebhookContentType,
+		webhookGet:         config.WebhookGet,
+		dirAPIs:            config.DirAPIs,
+		webhookClient:      config.WebhookClient,
+		webhookToken:       config.WebhookToken,
+		webhookHMACKey:     config.WebhookHMACKey,
+		streamEvents:       config.StreamEvents,
+		alertQueue:         queue,
+
+		alertCh:      alertCh,
+		alertStop:    alertStop,
+		alertWorkers: config.AlertWorkers,
+		scheduler:    newScanScheduler(config.ScanWorkers),
+
+		backupDirMode:        config.BackupDirMode,
+		dirPermCheckInterval: config.DirPermCheckInterval,
+		selfCheckInterval:    config.SelfCheckInterval,
+		exitOnBinaryTamper:   config.ExitOnBinaryTamper,
+		statsInterval:        config.StatsInterval,
+		deepScanInterval:     config.DeepScanInterval,
+		massDeleteThreshold:  config.MassDeleteThreshold,
+		floodThreshold:       config.FloodThreshold,
+		floodAction:          config.FloodAction,
+		isolateMaxSize:       config.IsolateMaxSize << 20,
+		isolateMaxAge:        config.IsolateMaxAge,
+
+		deepScanHits: make(map[string]bool),
+		floods:       make(map[string]time.Time),
+
+		settleTime:   config.SettleTime,
+		startupGrace: config.StartupGrace,
+
+		repl:               config.REPL,
+		rebaselineOnResume: config.RebaselineOnResume,
+		eventLogKeep:       config.EventLogKeep,
+
+		restoreNotifySuffix: restoreNotifySuffix(config.RestoreNotifyFile),
+		suppressed:          make(map[string]bool),
+		suppressFile:        config.SuppressFile,
+		configFile:          config.ConfigFile,
+
+		preRestoreCmd:      config.PreRestoreCmd,
+		preBackupCmd:       config.PreBackupCmd,
+		postBackupCmd:      config.PostBackupCmd,
+		backupHookTimeout:  config.BackupHookTimeout,
+		eventHooks:         config.EventHooks,
+		hookSlots:          make(chan struct{}, eventHookConcurrency),
+		restoreHistory:     make(map[string][]time.Time),
+		persistentAlerted:  make(map[string]time.Time),
+		maxRestoresPerHour: config.MaxRestoresPerHour,
+		acceptPersistent:   config.AcceptPersistent,
+		flapThreshold:      config.FlapThreshold,
+		flaps:              make(map[string]*flapState),
+		immutableRules:     config.ImmutableRules,
+		immutable:          make(map[string]bool),
+
+		copyBufs: sync.Pool{
+			New: func() interface{} {
+				buf := make([]byte, copyBufSize)
+				return &buf
+			},
+		},
 	}
 }
 
+// copyFile 使用缓冲区池中的缓冲区复制文件内容
+func (dm *DirectoryMonitor) copyFile(dst io.Writer, src io.Reader) (int64, error) {
+	buf := dm.copyBufs.Get().(*[]byte)
+	defer dm.copyBufs.Put(buf)
+
+	return io.CopyBuffer(dst, src, *buf)
+}
+
 func logInfo(msg string) {
-	log.Printf("%s[INFO]%s %s", ColorGreen, ColorReset, msg)
+	writeLog("INFO", ColorGreen, msg)
 }
 
 func logWarn(msg string) {
-	log.Printf("%s[WARN]%s %s", ColorYellow, ColorReset, msg)
+	writeLog("WARN", ColorYellow, msg)
 }
 
 func logError(msg string) {
-	log.Printf("%s[ERROR]%s %s", ColorRed, ColorReset, msg)
+	errorCount.Add(1)
+	writeLog("ERROR", ColorRed, msg)
 }
 
 func logSuccess(msg string) {
-	log.Printf("%s[SUCCESS]%s %s", ColorGreen+ColorBold, ColorReset, msg)
+	writeLog("SUCCESS", ColorGreen+ColorBold, msg)
 }
 
 func logAlert(msg string) {
-	log.Printf("%s[ALERT]%s %s", ColorRed+ColorBold, ColorReset, msg)
+	writeLog("ALERT", ColorRed+ColorBold, msg)
 }
 
 func logDebug(msg string) {
-	log.Printf("%s[DEBUG]%s %s", ColorCyan, ColorReset, msg)
+	writeLog("DEBUG", ColorCyan, msg)
 }
 
-func (dm *DirectoryMonitor) sendAPIAlert(alertType, message string) {
-	if dm.apiEndpoint == "" {
+// audit 追加一条运维审计记录到基础目录下的audit.log
+func (dm *DirectoryMonitor) audit(action, filePath, detail string) {
+	record, _ := json.Marshal(map[string]string{
+		"time":   time.Now().Format(time.RFC3339),
+		"action": action,
+		"path":   filePath,
+		"detail": detail,
+	})
+	dm.streamEvent(action, record)
+
+	dm.auditMu.Lock()
+	defer dm.auditMu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(dm.baseDir, "audit.log"),
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		logError(fmt.Sprintf("写入审计日志失败: %v", err))
 		return
 	}
+	defer f.Close()
+
+	f.Write(append(record, '\n'))
+}
 
-	apiURL := fmt.Sprintf("http://%s/api/agent/edr-alert?type=%s&message=%s",
-		dm.apiEndpoint, alertType, url.QueryEscape(message))
+// alert 打印告警并上报API, level为告警级别(warning/critical), event为事件类型
+func (dm *DirectoryMonitor) alert(level, event, message string) {
+	dm.alertFile(level, event, message, alertDetail{})
+}
 
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get(apiURL)
-	if err != nil {
-		logError(fmt.Sprintf("API告警发送失败: %v", err))
+// alertFile 与alert相同, 同时在webhook中附带文件路径和变化前后的元数据
+func (dm *DirectoryMonitor) alertFile(level, event, message string, detail alertDetail) {
+	if dm.throttleFlapping(detail) {
 		return
 	}
-	defer resp.Body.Close()
+	dm.emitAlert(level, event, message, detail)
+}
+
+func (dm *DirectoryMonitor) emitAlert(level, event, message string, detail alertDetail) {
+	dm.stats.alerts.Add(1)
+	dm.stats.countAlert(level, event)
+	if dm.dryRun && detail.Action != "" {
+		detail.Action = actionDryRun + detail.Action
+	}
+	// 新增文件(有新元数据而没有旧元数据)附带之前的访问日志请求, 用于定位上传点和攻击者IP
+	if detail.New != nil && detail.Old == nil {
+		detail.Requests = dm.recentRequests()
+	}
+	logAlertEvent(level, event, message, detail)
+	dm.recordEvent(level, event, message)
+	dm.sendAPIAlert(level, event, message, detail)
+	dm.runAlertHook(level, event, message, detail)
+}
 
-	if resp.StatusCode == 200 {
-		logSuccess(fmt.Sprintf("告警发送成功: %s", message))
-	} else {
-		logError(fmt.Sprintf("告警响应异常: HTTP %d", resp.StatusCode))
+// truncateMessage 按字符数截断消息, 超长时以...结尾
+func truncateMessage(message string, maxLen int) string {
+	runes := []rune(message)
+	if maxLen <= 0 || len(runes) <= maxLen {
+		return message
+	}
+	if maxLen <= 3 {
+		return string(runes[:maxLen])
 	}
+	return string(runes[:maxLen-3]) + "..."
 }
 
 func (dm *DirectoryMonitor) shouldMonitorFile(filename string) bool {
-	if len(dm.extensions) == 0 {
+	if dm.isExcluded(filename) {
+		return false
+	}
+
+	extensions := dm.extensionsFor(filepath.Dir(filename))
+	if len(extensions) == 0 {
+		return true
+	}
+
+	// 双扩展名文件可能被Web服务器当作脚本执行, 不受扩展名过滤影响
+	if _, ok := dm.doubleExtension(filename); ok {
+		return true
+	}
+	// .htaccess/.user.ini等可以让任意文件作为脚本执行
+	if isServerConfigFile(filename) {
+		return true
+	}
+	// 隐藏文件和伪造显示扩展名的文件不受扩展名过滤影响
+	if _, desc := dm.suspiciousName(filename); desc != "" {
 		return true
 	}
 
 	ext := strings.ToLower(filepath.Ext(filename))
-	for _, allowedExt := range dm.extensions {
+	for _, allowedExt := range extensions {
 		if ext == strings.ToLower(allowedExt) {
 			return true
 		}
@@ -132,6 +890,17 @@ func (dm *DirectoryMonitor) shouldMonitorFile(filename string) bool {
 	return false
 }
 
+// doubleExtension 检查文件名是否为"危险扩展名+其他扩展名"的形式, 例如evil.php.jpg
+func (dm *DirectoryMonitor) doubleExtension(filename string) (string, bool) {
+	name := strings.ToLower(filepath.Base(filename))
+	for _, ext := range dm.dangerousExts {
+		if strings.Contains(name, strings.ToLower(ext)+".") {
+			return ext, true
+		}
+	}
+	return "", false
+}
+
 func (dm *DirectoryMonitor) isRegularFile(filePath string) bool {
 	info, err := os.Lstat(filePath) // 使用Lstat不跟随符号链接
 	if err != nil {
@@ -147,83 +916,343 @@ func (dm *DirectoryMonitor) getFileInfo(filePath string) (FileInfo, error) {
 		return FileInfo{}, err
 	}
 
-	sys := info.Sys().(*syscall.Stat_t)
+	sys := platformStat(filePath, info)
 
 	return FileInfo{
-		Path:    filePath,
-		Size:    info.Size(),
-		ModTime: info.ModTime().Unix(),
-		Mode:    info.Mode(),
-		Uid:     sys.Uid,
-		Gid:     sys.Gid,
+		Path:       filePath,
+		Size:       info.Size(),
+		ModTime:    info.ModTime().UnixNano(),
+		Inode:      sys.Ino,
+		Ctime:      sys.Ctime,
+		Mode:       info.Mode(),
+		Uid:        sys.Uid,
+		Gid:        sys.Gid,
+		Owner:      sys.Owner,
+		Attributes: sys.Attributes,
 	}, nil
 }
 
-func (dm *DirectoryMonitor) validatePaths() error {
-	watchAbs, err := filepath.Abs(dm.watchDir)
+func hashFile(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fileEntropy 计算文件前64KB内容的香农熵(0~8)
+func fileEntropy(filePath string) (float64, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 64*1024)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return 0, err
+	}
+	return entropy(buf[:n]), nil
+}
+
+func entropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+
+	var result float64
+	total := float64(len(data))
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / total
+		result -= p * math.Log2(p)
+	}
+	return result
+}
+
+// checkLineLengths 判断文件中是否存在超过maxLen字节的行, 混淆后的webshell通常是一整行编码数据
+func checkLineLengths(filePath string, maxLen int) bool {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	lineLen := 0
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		lineLen += len(chunk)
+		if lineLen > maxLen {
+			return true
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return false
+		}
+		lineLen = 0
+	}
+}
+
+// isScriptFile 判断文件是否为可执行脚本(危险扩展名或双扩展名)
+func (dm *DirectoryMonitor) isScriptFile(filePath string) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	for _, dangerous := range dm.dangerousExts {
+		if ext == strings.ToLower(dangerous) {
+			return true
+		}
+	}
+	_, ok := dm.doubleExtension(filePath)
+	return ok
+}
+
+// contentTags 返回附加到告警消息中的内容特征标签
+func (dm *DirectoryMonitor) contentTags(filePath string) string {
+	tags := ""
+	if dm.maxLineLength > 0 && dm.isScriptFile(filePath) &&
+		checkLineLengths(filePath, dm.maxLineLength) {
+		tags += " [suspicious_long_line]"
+	}
+	if finding := dm.polyglotFileFinding(filePath); finding != "" {
+		tags += fmt.Sprintf(" [polyglot: %s]", finding)
+	}
+	return tags
+}
+
+// initSelfIntegrity 记录本程序可执行文件的路径和哈希
+func (dm *DirectoryMonitor) initSelfIntegrity() error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	hash, err := hashFile(exePath)
+	if err != nil {
+		return err
+	}
+
+	dm.selfPath = exePath
+	dm.selfHash.Store(hash)
+	logInfo(fmt.Sprintf("自身完整性基线: %s (sha256: %s)", exePath, hash[:16]))
+	return nil
+}
+
+// checkSelfIntegrity 检查本程序可执行文件是否被替换
+func (dm *DirectoryMonitor) checkSelfIntegrity() {
+	expected := dm.selfHash.Load().(string)
+
+	current, err := hashFile(dm.selfPath)
 	if err != nil {
-		return fmt.Errorf("获取监控目录绝对路径失败: %v", err)
+		current = fmt.Sprintf("unreadable: %v", err)
+	}
+	if current == expected {
+		return
+	}
+
+	dm.alert("critical", "edr_binary_tampered",
+		fmt.Sprintf("检测到EDR程序自身被篡改: %s", dm.selfPath))
+	// 记录新哈希, 同一次替换只告警一次
+	dm.selfHash.Store(current)
+
+	if dm.exitOnBinaryTamper {
+		logError("EDR程序已被篡改，按配置退出")
+		os.Exit(2)
+	}
+}
+
+// mtimeChanged 按mtimeResolution截断后比较修改时间, 避免文件系统时间精度不同导致还原后被误判为修改
+func (dm *DirectoryMonitor) mtimeChanged(a, b FileInfo) bool {
+	resolution := dm.mtimeResolution.Nanoseconds()
+	if resolution <= 1 {
+		return a.ModTime != b.ModTime
 	}
+	return a.ModTime-a.ModTime%resolution != b.ModTime-b.ModTime%resolution
+}
+
+func formatModTime(modTime int64) string {
+	return time.Unix(0, modTime).Format("2006-01-02 15:04:05.000000000")
+}
 
+func (dm *DirectoryMonitor) validatePaths() error {
 	baseAbs, err := filepath.Abs(dm.baseDir)
 	if err != nil {
 		return fmt.Errorf("获取基础目录绝对路径失败: %v", err)
 	}
 
-	relPath, err := filepath.Rel(watchAbs, baseAbs)
-	if err == nil && !strings.HasPrefix(relPath, "..") {
-		return fmt.Errorf("错误: 备份目录不能在监控目录内\n监控目录: %s\n备份目录: %s",
-			watchAbs, baseAbs)
+	var watchDirs []string
+	for _, root := range dm.roots {
+		watchAbs, err := filepath.Abs(root.dir)
+		if err != nil {
+			return fmt.Errorf("获取监控目录绝对路径失败: %v", err)
+		}
+
+		relPath, err := filepath.Rel(watchAbs, baseAbs)
+		if err == nil && !strings.HasPrefix(relPath, "..") {
+			return fmt.Errorf("错误: 备份目录不能在监控目录内\n监控目录: %s\n备份目录: %s",
+				watchAbs, baseAbs)
+		}
+		watchDirs = append(watchDirs, watchAbs)
 	}
 
 	logSuccess("路径验证通过")
-	logInfo(fmt.Sprintf("监控目录: %s", watchAbs))
+	logInfo(fmt.Sprintf("监控目录: %s", strings.Join(watchDirs, ", ")))
 	logInfo(fmt.Sprintf("备份目录: %s", dm.backupDir))
 	logInfo(fmt.Sprintf("隔离目录: %s", dm.isolateDir))
+	if dm.keepEvidence {
+		logInfo(fmt.Sprintf("证据目录: %s", dm.evidenceDir))
+	}
 
 	return nil
 }
 
-func (dm *DirectoryMonitor) discoverDirectories() error {
-	directories := make(map[string]bool)
+// latestModTime 返回监控目录树中最新的修改时间(包括目录本身)
+func (dm *DirectoryMonitor) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, dir := range dm.rootDirs() {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			// 被排除的目录(缓存、日志等)持续写入, 不参与稳定判断
+			if info.IsDir() && dm.isExcluded(path) {
+				return filepath.SkipDir
+			}
+			if info.ModTime().After(latest) {
+				latest = info.ModTime()
+			}
+			return nil
+		})
+		if err != nil {
+			return latest, err
+		}
+	}
+	return latest, nil
+}
+
+// waitForSettle 等待监控目录在settleTime内没有任何变化, 避免部署脚本尚未完成时建立基线
+func (dm *DirectoryMonitor) waitForSettle() error {
+	logInfo(fmt.Sprintf("等待监控目录稳定 %v ...", dm.settleTime))
 
-	err := filepath.Walk(dm.watchDir, func(path string, info os.FileInfo, err error) error {
+	var observed time.Time
+	quietSince := time.Now()
+	for {
+		latest, err := dm.latestModTime()
 		if err != nil {
 			return err
 		}
+		if !latest.Equal(observed) {
+			observed = latest
+			quietSince = time.Now()
+		}
 
-		if info.IsDir() {
-			directories[path] = true
+		// 文件时间可能被伪造到未来, 同时以实际观察到的静默时长为准
+		if time.Since(latest) >= dm.settleTime || time.Since(quietSince) >= dm.settleTime {
+			logSuccess("监控目录已稳定")
+			return nil
 		}
-		return nil
-	})
+		time.Sleep(time.Second)
+	}
+}
 
-	if err != nil {
-		return err
+func (dm *DirectoryMonitor) discoverDirectories() error {
+	directories := make(map[string]bool)
+
+	for _, dir := range dm.rootDirs() {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if info.IsDir() {
+				if dm.isExcluded(path) {
+					return filepath.SkipDir
+				}
+				directories[path] = true
+				// -resume时保留清单中的目录基线, 停机期间的权限变化随后按篡改处理
+				if _, ok := dm.dirBaseline[path]; !ok {
+					dm.dirBaseline[path] = dirInfoOf(info)
+				}
+			}
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
 	}
 
 	dm.directories = make([]string, 0, len(directories))
 	for dir := range directories {
 		dm.directories = append(dm.directories, dir)
+		dm.knownDirs[dir] = true
 	}
 
-	logInfo(fmt.Sprintf("发现 %d 个目录需要监控", len(dm.directories)))
+	if !dm.skipEmptyDirs {
+		dm.activeDirectories = dm.directories
+		logInfo(fmt.Sprintf("发现 %d 个目录需要监控", len(dm.directories)))
+		return nil
+	}
+
+	// 第二遍: 只保留直接包含被监控文件的目录
+	dm.activeDirectories = make([]string, 0, len(dm.directories))
+	for _, dir := range dm.directories {
+		files, err := dm.getDirectChildren(dir)
+		if err != nil {
+			return err
+		}
+		if len(files) > 0 {
+			dm.activeDirectories = append(dm.activeDirectories, dir)
+		}
+	}
+
+	logInfo(fmt.Sprintf("发现 %d 个目录, 其中 %d 个包含被监控文件",
+		len(dm.directories), len(dm.activeDirectories)))
 	return nil
 }
 
+// idleDirectories 返回不在activeDirectories中的目录
+func (dm *DirectoryMonitor) idleDirectories() []string {
+	active := make(map[string]bool, len(dm.activeDirectories))
+	for _, dir := range dm.activeDirectories {
+		active[dir] = true
+	}
+
+	var idle []string
+	for _, dir := range dm.directories {
+		if !active[dir] {
+			idle = append(idle, dir)
+		}
+	}
+	return idle
+}
+
 func (dm *DirectoryMonitor) backupFile(srcPath string) error {
 	if !dm.isRegularFile(srcPath) {
 		logDebug(fmt.Sprintf("跳过非常规文件: %s", srcPath))
 		return nil
 	}
 
-	relPath, err := filepath.Rel(dm.watchDir, srcPath)
+	dstPath, err := dm.backupPathFor(srcPath)
 	if err != nil {
 		return err
 	}
 
-	dstPath := filepath.Join(dm.backupDir, relPath)
-
 	dstDir := filepath.Dir(dstPath)
 	if err := os.MkdirAll(dstDir, 0755); err != nil {
 		return err
@@ -246,13 +1275,19 @@ func (dm *DirectoryMonitor) backupFile(srcPath string) error {
 	}
 	defer dst.Close()
 
-	if _, err = io.Copy(dst, src); err != nil {
+	n, err := dm.copyFile(dst, src)
+	dm.bytesCopied.Add(n)
+	if err != nil {
 		return err
 	}
 
 	if err := dm.restoreFileAttributes(dstPath, srcInfo); err != nil {
 		logWarn(fmt.Sprintf("恢复备份文件属性失败 %s: %v", dstPath, err))
 	}
+	// ACL和security.*标签随备份保存, 还原时从备份复制回去
+	if err := copyXattrs(srcPath, dstPath); err != nil {
+		logDebug(fmt.Sprintf("复制扩展属性到备份失败 %s: %v", dstPath, err))
+	}
 
 	return nil
 }
@@ -262,16 +1297,21 @@ func (dm *DirectoryMonitor) restoreFileAttributes(filePath string, fileInfo File
 		return fmt.Errorf("设置权限失败: %v", err)
 	}
 
-	if err := os.Chown(filePath, int(fileInfo.Uid), int(fileInfo.Gid)); err != nil {
+	if err := setOwner(filePath, fileInfo.Uid, fileInfo.Gid, fileInfo.Owner); err != nil {
 		logDebug(fmt.Sprintf("设置文件所有者失败 %s: %v", filePath, err))
 		// 不返回错误，因为非root用户通常无法修改所有者
 	}
 
-	modTime := time.Unix(fileInfo.ModTime, 0)
+	modTime := time.Unix(0, fileInfo.ModTime)
 	if err := os.Chtimes(filePath, modTime, modTime); err != nil {
 		return fmt.Errorf("设置修改时间失败: %v", err)
 	}
 
+	// 只读属性放在最后设置, 否则会导致前面的修改失败
+	if err := setFileAttributes(filePath, fileInfo.Attributes); err != nil {
+		return fmt.Errorf("设置文件属性失败: %v", err)
+	}
+
 	return nil
 }
 
@@ -279,73 +1319,137 @@ func (dm *DirectoryMonitor) backupAllFiles() error {
 	logInfo("开始备份所有文件...")
 
 	// 创建备份目录
-	if err := os.MkdirAll(dm.backupDir, 0755); err != nil {
+	if err := dm.makeWorkspaceDir(dm.backupDir); err != nil {
 		return fmt.Errorf("创建备份目录失败: %v", err)
 	}
 
-	fileCount := 0
-	err := filepath.Walk(dm.watchDir, func(path string, info os.FileInfo, err error) error {
+	var files []string
+	for _, dir := range dm.directories {
+		children, err := dm.getDirectChildren(dir)
 		if err != nil {
 			return err
 		}
+		files = append(files, children...)
+	}
 
-		if !info.IsDir() && dm.shouldMonitorFile(path) && dm.isRegularFile(path) {
-			if err := dm.backupFile(path); err != nil {
-				logError(fmt.Sprintf("备份文件失败 %s: %v", path, err))
-				return err
+	var progress *backupProgress
+	if dm.backupProgress && stderrIsTerminal() {
+		var totalBytes int64
+		for _, path := range files {
+			if info, err := os.Stat(path); err == nil {
+				totalBytes += info.Size()
 			}
-			fileCount++
 		}
-		return nil
-	})
+		progress = newBackupProgress(len(files), totalBytes, &dm.bytesCopied)
+		progress.start()
+	}
 
-	if err != nil {
-		return err
+	fileCount := 0
+	for _, path := range files {
+		// 中断时不开始新的复制, 已复制的文件保持完整
+		if dm.stopping() {
+			break
+		}
+		if err := dm.backupFile(path); err != nil {
+			if progress != nil {
+				progress.finish()
+			}
+			logError(fmt.Sprintf("备份文件失败 %s: %v", path, err))
+			return err
+		}
+		fileCount++
+		if progress != nil {
+			progress.doneFiles.Add(1)
+		}
 	}
 
+	if progress != nil {
+		progress.finish()
+	}
 	logSuccess(fmt.Sprintf("备份完成，共备份 %d 个文件", fileCount))
 	return nil
 }
 
+// buildBaseline 逐个读取discoverDirectories发现的目录(os.ReadDir), 只对被监控文件做stat,
+// 与对整棵目录树filepath.Walk的结果相同, 但避免了对每个目录项的重复stat
 func (dm *DirectoryMonitor) buildBaseline() error {
 	baseline := make(map[string]FileInfo)
 
-	err := filepath.Walk(dm.watchDir, func(path string, info os.FileInfo, err error) error {
+	for _, dir := range dm.directories {
+		files, _, symlinks, specials, err := dm.readDirectory(dir)
 		if err != nil {
 			return err
 		}
+		dm.recordSymlinks(symlinks)
+		dm.recordSpecialFiles(specials)
 
-		if !info.IsDir() && dm.shouldMonitorFile(path) && dm.isRegularFile(path) {
-			fileInfo, err := dm.getFileInfo(path)
+		for _, path := range files {
+			fileInfo, err := dm.hashedFileInfo(path)
 			if err != nil {
 				logError(fmt.Sprintf("获取文件信息失败 %s: %v", path, err))
 				return err
 			}
 			baseline[path] = fileInfo
 		}
-		return nil
-	})
-
-	if err != nil {
-		return err
 	}
 
 	dm.mu.Lock()
 	dm.baseline = baseline
+	dm.baselineBuiltAt = time.Now()
 	dm.mu.Unlock()
 
 	logSuccess(fmt.Sprintf("基线建立完成，共 %d 个文件", len(baseline)))
 	return nil
 }
 
+// matchesBaseline 比较文件当前内容与基线的SHA-256, 基线中没有哈希时与备份比较, 无法读取时视为不一致
+func (dm *DirectoryMonitor) matchesBaseline(filePath string, info FileInfo) bool {
+	current, err := hashFile(filePath)
+	if err != nil {
+		return false
+	}
+	if info.Hash != "" {
+		return current == info.Hash
+	}
+
+	backupPath, err := dm.backupPathFor(filePath)
+	if err != nil {
+		return false
+	}
+	original, err := hashFile(backupPath)
+	return err == nil && current == original
+}
+
+// hashedFileInfo 获取文件属性并计算内容哈希, 用于建立基线
+func (dm *DirectoryMonitor) hashedFileInfo(filePath string) (FileInfo, error) {
+	info, err := dm.getFileInfo(filePath)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	info.Hash, err = hashFile(filePath)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	info.Xattrs = fileXattrDigest(filePath)
+	return info, nil
+}
+
+// backupPathFor 返回被监控文件在备份目录中对应的路径
+func (dm *DirectoryMonitor) backupPathFor(filePath string) (string, error) {
+	root, relPath, err := dm.relToRoot(filePath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root.backupDir, relPath), nil
+}
+
 func (dm *DirectoryMonitor) restoreFile(filePath string) error {
-	relPath, err := filepath.Rel(dm.watchDir, filePath)
+	backupPath, err := dm.backupPathFor(filePath)
 	if err != nil {
 		return err
 	}
 
-	backupPath := filepath.Join(dm.backupDir, relPath)
-
 	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
 		return fmt.Errorf("备份文件不存在: %s", backupPath)
 	}
@@ -358,94 +1462,375 @@ func (dm *DirectoryMonitor) restoreFile(filePath string) error {
 		return fmt.Errorf("基线中未找到文件信息: %s", filePath)
 	}
 
+	if dm.preRestoreCmd != "" && dm.vetoRestore(filePath) {
+		return fmt.Errorf("还原被钩子命令否决: %s", filePath)
+	}
+
+	if dm.keepEvidence {
+		dm.preserveEvidence(filePath, baselineInfo)
+	}
+
 	src, err := os.Open(backupPath)
 	if err != nil {
 		return err
 	}
 	defer src.Close()
 
+	// 本程序设置的不可变属性先清除, Windows上被设为只读/隐藏/系统的文件无法直接覆盖
+	dm.unhardenFile(filePath)
+	if err := makeWritable(filePath); err != nil {
+		logDebug(fmt.Sprintf("清除文件只读属性失败 %s: %v", filePath, err))
+	}
+
 	dst, err := os.Create(filePath)
 	if err != nil {
 		return err
 	}
 	defer dst.Close()
 
-	if _, err = io.Copy(dst, src); err != nil {
+	if _, err = dm.copyFile(dst, src); err != nil {
 		return err
 	}
 
+	if err := copyXattrs(backupPath, filePath); err != nil {
+		logWarn(fmt.Sprintf("恢复扩展属性失败 %s: %v", filePath, err))
+	}
 	if err := dm.restoreFileAttributes(filePath, baselineInfo); err != nil {
 		return fmt.Errorf("恢复文件属性失败: %v", err)
 	}
+	dm.hardenFile(filePath)
 
+	// 还原会改变ctime, 文件被删除或隔离后还原还会生成新的inode, 更新基线避免下次检查误报
+	if info, err := dm.getFileInfo(filePath); err == nil {
+		baselineInfo.Inode = info.Inode
+		baselineInfo.Ctime = info.Ctime
+		dm.setBaseline(filePath, baselineInfo)
+	}
+
+	dm.stats.restores.Add(1)
 	logSuccess(fmt.Sprintf("文件已完整还原: %s", filePath))
+	dm.recordRestore(filePath)
+	dm.recordFlap(filePath)
+
+	if dm.restoreNotifySuffix != "" {
+		dm.writeRestoreNotify(filePath, baselineInfo)
+	}
 	return nil
 }
 
-func (dm *DirectoryMonitor) isolateFile(filePath string) error {
-	// 创建隔离目录
-	if err := os.MkdirAll(dm.isolateDir, 0755); err != nil {
-		return fmt.Errorf("创建隔离目录失败: %v", err)
+// vetoRestore 执行还原前钩子, 命令以非0退出码结束时否决还原
+func (dm *DirectoryMonitor) vetoRestore(filePath string) bool {
+	stderr, err := runHook(dm.preRestoreCmd, preRestoreTimeout, "EDR_FILE="+filePath)
+	if err == nil {
+		return false
 	}
 
-	timestamp := time.Now().Format("20060102_150405_000")
-	filename := fmt.Sprintf("%s_%s_%s",
-		timestamp,
-		filepath.Base(filePath),
-		strings.ReplaceAll(filepath.Dir(filePath), "/", "_"))
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		// 命令无法执行或超时, 还原优先
+		logWarn(fmt.Sprintf("还原前钩子执行失败，继续还原 %s: %v", filePath, err))
+		return false
+	}
 
-	isolatedPath := filepath.Join(dm.isolateDir, filename)
+	dm.alert("warning", "restore_vetoed",
+		fmt.Sprintf("还原被钩子命令否决: %s (退出码: %d, stderr: %s)",
+			filePath, exitErr.ExitCode(), stderr))
+	return true
+}
 
-	if err := os.Rename(filePath, isolatedPath); err != nil {
-		return fmt.Errorf("移动文件到隔离目录失败: %v", err)
+// recordRestore 记录一次还原, 一小时内还原次数超过阈值说明攻击者有持续回写手段
+func (dm *DirectoryMonitor) recordRestore(filePath string) {
+	if dm.maxRestoresPerHour <= 0 {
+		return
 	}
 
-	logSuccess(fmt.Sprintf("可疑文件已隔离: %s", filepath.Base(filePath)))
-	return nil
+	now := time.Now()
+	dm.historyMu.Lock()
+	history := pruneBefore(append(dm.restoreHistory[filePath], now), now.Add(-time.Hour))
+	dm.restoreHistory[filePath] = history
+	count := len(history)
+
+	shouldAlert := count > dm.maxRestoresPerHour &&
+		now.Sub(dm.persistentAlerted[filePath]) > time.Hour
+	if shouldAlert {
+		dm.persistentAlerted[filePath] = now
+	}
+	dm.historyMu.Unlock()
+
+	if shouldAlert {
+		dm.alert("critical", "persistent_attack_detected",
+			fmt.Sprintf("检测到持续性攻击: %s 一小时内已被还原 %d 次，攻击者可能存在持续回写手段(不死马/计划任务)",
+				filePath, count))
+	}
 }
 
-func (dm *DirectoryMonitor) getDirectChildren(dirPath string) ([]string, error) {
-	entries, err := os.ReadDir(dirPath)
-	if err != nil {
-		return nil, err
+// pruneBefore 去掉早于cutoff的时间戳, times按时间顺序排列
+func pruneBefore(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
 	}
+	return times[i:]
+}
 
-	var files []string
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			fullPath := filepath.Join(dirPath, entry.Name())
-			if dm.shouldMonitorFile(fullPath) && dm.isRegularFile(fullPath) {
-				files = append(files, fullPath)
-			}
+// acceptPersistentChange 开启-accept-persistent时, 对还原次数已超过阈值的文件
+// 直接以当前内容重建基线, 打断还原循环, 由运维人员人工处理
+func (dm *DirectoryMonitor) acceptPersistentChange(filePath string) bool {
+	if !dm.acceptPersistent || dm.maxRestoresPerHour <= 0 {
+		return false
+	}
+
+	dm.historyMu.Lock()
+	count := len(pruneBefore(dm.restoreHistory[filePath], time.Now().Add(-time.Hour)))
+	dm.historyMu.Unlock()
+
+	if count <= dm.maxRestoresPerHour {
+		return false
+	}
+
+	logWarn(fmt.Sprintf("文件持续被篡改，暂时接受当前内容作为基线，请人工处理: %s", filePath))
+	if err := dm.rebaselineFile(filePath); err != nil {
+		logError(fmt.Sprintf("更新基线失败 %s: %v", filePath, err))
+	}
+	dm.audit("accept_persistent", filePath, fmt.Sprintf("一小时内还原 %d 次", count))
+
+	dm.historyMu.Lock()
+	delete(dm.restoreHistory, filePath)
+	dm.historyMu.Unlock()
+	return true
+}
+
+func restoreNotifySuffix(name string) string {
+	if name == "" || strings.HasPrefix(name, ".") {
+		return name
+	}
+	return "." + name
+}
+
+// writeRestoreNotify 在被还原文件旁写入包含还原时间的通知文件, 供应用清理缓存
+func (dm *DirectoryMonitor) writeRestoreNotify(filePath string, fileInfo FileInfo) {
+	notifyPath := filePath + dm.restoreNotifySuffix
+	dm.suppress(notifyPath)
+
+	content := time.Now().Format(time.RFC3339) + "\n"
+	if err := os.WriteFile(notifyPath, []byte(content), 0644); err != nil {
+		logError(fmt.Sprintf("写入还原通知文件失败 %s: %v", notifyPath, err))
+		return
+	}
+	// 与原文件属主一致, 便于应用读取后删除
+	setOwner(notifyPath, fileInfo.Uid, fileInfo.Gid, fileInfo.Owner)
+}
+
+func (dm *DirectoryMonitor) suppress(filePath string) {
+	dm.suppressMu.Lock()
+	dm.suppressed[filePath] = true
+	dm.suppressMu.Unlock()
+}
+
+// loadSuppressFile 读取豁免列表文件, 每行一个路径, #开头为注释
+func (dm *DirectoryMonitor) loadSuppressFile() error {
+	f, err := os.Open(dm.suppressFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		filePath, err := dm.monitoredPath(line)
+		if err != nil {
+			logWarn(fmt.Sprintf("忽略豁免列表中的路径: %v", err))
+			continue
 		}
+		dm.suppress(filePath)
+		count++
 	}
 
-	return files, nil
+	logInfo(fmt.Sprintf("已载入豁免列表 %s，共 %d 个文件", dm.suppressFile, count))
+	return scanner.Err()
 }
 
-func (dm *DirectoryMonitor) monitorDirectory(dirPath string, wg *sync.WaitGroup) {
-	defer wg.Done()
+func (dm *DirectoryMonitor) isSuppressed(filePath string) bool {
+	dm.suppressMu.RLock()
+	defer dm.suppressMu.RUnlock()
 
-	ticker := time.NewTicker(dm.checkInterval)
-	defer ticker.Stop()
+	return dm.suppressed[filePath]
+}
 
-	for {
-		select {
-		case <-ticker.C:
-			dm.checkDirectoryChanges(dirPath)
+func (dm *DirectoryMonitor) isolateFile(filePath string, reason isolateReason) error {
+	isolatedPath, err := dm.moveToIsolation(filePath, reason)
+	if err != nil {
+		return err
+	}
+
+	dm.stats.isolations.Add(1)
+	logSuccess(fmt.Sprintf("可疑文件已隔离: %s", filepath.Base(filePath)))
+	dm.recordFlap(filePath)
+	dm.runIsolatedHook(filePath, isolatedPath, reason)
+	return nil
+}
+
+// moveToIsolation 把文件移入隔离目录并写入.meta.json, 返回隔离后的路径
+func (dm *DirectoryMonitor) moveToIsolation(filePath string, reason isolateReason) (string, error) {
+	if err := dm.makeWorkspaceDir(dm.isolateDir); err != nil {
+		return "", fmt.Errorf("创建隔离目录失败: %v", err)
+	}
+
+	// 同一路径可能被并发隔离, 选择目标路径和移动需要串行
+	dm.isolatedMu.Lock()
+	defer dm.isolatedMu.Unlock()
+
+	meta, err := newIsolateMeta(filePath, reason)
+	if err != nil {
+		return "", fmt.Errorf("读取文件属性失败: %v", err)
+	}
+
+	isolatedPath := dm.isolatedTarget(filePath)
+	if err := dm.makeWorkspaceDir(filepath.Dir(isolatedPath)); err != nil {
+		return "", fmt.Errorf("创建隔离目录失败: %v", err)
+	}
+
+	if err := moveFile(filePath, isolatedPath); err != nil {
+		return "", fmt.Errorf("移动文件到隔离目录失败: %v", err)
+	}
+	if err := writeIsolateMeta(isolatedPath, meta); err != nil {
+		logWarn(fmt.Sprintf("写入隔离元数据失败 %s: %v", isolatedPath, err))
+	}
+	return isolatedPath, nil
+}
+
+// makeWorkspaceDir 创建备份/隔离目录, 并强制设置为预期权限(不受umask影响)
+func (dm *DirectoryMonitor) makeWorkspaceDir(dir string) error {
+	if err := os.MkdirAll(dir, dm.backupDirMode); err != nil {
+		return err
+	}
+	return os.Chmod(dir, dm.backupDirMode)
+}
+
+// checkWorkspacePermissions 检查备份/隔离/证据目录权限是否被放宽, 防止攻击者借此读取源码备份
+func (dm *DirectoryMonitor) checkWorkspacePermissions() {
+	dirs := []string{dm.backupDir, dm.isolateDir}
+	if dm.keepEvidence {
+		dirs = append(dirs, dm.evidenceDir)
+	}
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			logError(fmt.Sprintf("检查目录权限失败 %s: %v", dir, err))
+			continue
+		}
+
+		current := info.Mode().Perm()
+		if current&^dm.backupDirMode == 0 {
+			continue
+		}
+
+		dm.alert("critical", "backup_dir_permissions_weakened",
+			fmt.Sprintf("检测到工作目录权限被放宽: %s (预期: %04o, 当前: %04o)",
+				dir, dm.backupDirMode, current))
+
+		if err := os.Chmod(dir, dm.backupDirMode); err != nil {
+			logError(fmt.Sprintf("恢复目录权限失败 %s: %v", dir, err))
+		} else {
+			logSuccess(fmt.Sprintf("目录权限已恢复: %s -> %04o", dir, dm.backupDirMode))
+		}
+	}
+}
+
+// runPeriodic 启动按固定间隔执行的后台检查任务, 退出时由wg等待当前一轮完成
+func (dm *DirectoryMonitor) runPeriodic(interval time.Duration, task func()) {
+	dm.wg.Add(1)
+	go func() {
+		defer dm.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				task()
+			case <-dm.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (dm *DirectoryMonitor) getDirectChildren(dirPath string) ([]string, error) {
+	files, _, _, _, err := dm.readDirectory(dirPath)
+	return files, err
+}
+
+// readDirectory 读取目录第一层, 返回需要监控的文件、子目录、符号链接(不跟随符号链接)
+// 和命名管道/socket/设备等特殊文件
+func (dm *DirectoryMonitor) readDirectory(dirPath string) ([]string, []string, []string, []string, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	// 只告警目录中的落地文件往往没有扩展名, 不使用扩展名过滤
+	alertOnly := dm.dirRules[dirPath].alertOnly()
+
+	var files, subdirs, symlinks, specials []string
+	for _, entry := range entries {
+		fullPath := filepath.Join(dirPath, entry.Name())
+		if entry.IsDir() {
+			subdirs = append(subdirs, fullPath)
+			continue
+		}
+		if entry.Type()&os.ModeSymlink != 0 {
+			symlinks = append(symlinks, fullPath)
+			continue
+		}
+		if entry.Type()&specialFileTypes != 0 {
+			specials = append(specials, fullPath)
+			continue
+		}
+		if (alertOnly || dm.shouldMonitorFile(fullPath)) && dm.isRegularFile(fullPath) {
+			files = append(files, fullPath)
+		} else if !alertOnly && dm.isPolyglotCandidate(fullPath) && !dm.isExcluded(fullPath) {
+			// 不在-e中的图片只在嵌入了脚本代码时纳入检查
+			if info, err := entry.Info(); err == nil && info.Mode().IsRegular() && dm.polyglotFinding(fullPath, info) != "" {
+				files = append(files, fullPath)
+			}
 		}
 	}
+
+	return files, subdirs, symlinks, specials, nil
 }
 
 func (dm *DirectoryMonitor) checkDirectoryChanges(dirPath string) {
-	currentFiles, err := dm.getDirectChildren(dirPath)
+	if dm.paused.Load() {
+		return
+	}
+	dm.stats.checks.Add(1)
+	defer dm.stats.observeCheck(time.Now())
+
+	currentFiles, subdirs, symlinks, specials, err := dm.readDirectory(dirPath)
+	if os.IsNotExist(err) && !dm.dirRules[dirPath].alertOnly() {
+		dm.handleMissingDirectory(dirPath)
+		return
+	}
 	if err != nil {
 		logError(fmt.Sprintf("读取目录失败 %s: %v", dirPath, err))
 		return
 	}
 
 	dm.mu.RLock()
-	baseline := dm.baseline
+	baseline := make(map[string]FileInfo)
+	for filePath, info := range dm.baseline {
+		if filepath.Dir(filePath) == dirPath {
+			baseline[filePath] = info
+		}
+	}
 	dm.mu.RUnlock()
 
 	currentFileMap := make(map[string]FileInfo)
@@ -458,34 +1843,196 @@ func (dm *DirectoryMonitor) checkDirectoryChanges(dirPath string) {
 		currentFileMap[filePath] = fileInfo
 	}
 
+	if rule := dm.dirRules[dirPath]; rule.alertOnly() {
+		dm.checkAlertOnlyChanges(rule, baseline, currentFileMap)
+		return
+	}
+
+	dm.checkNewSubdirectories(subdirs)
+	dm.checkSymlinks(dirPath, symlinks)
+	dm.checkSpecialFiles(dirPath, specials)
+
+	flooding := dm.checkCreationFlood(dirPath, baseline, currentFileMap)
+
 	for filePath, currentInfo := range currentFileMap {
-		if baselineInfo, exists := baseline[filePath]; !exists {
-			alertMsg := fmt.Sprintf("检测到新增可疑文件: %s (大小: %d bytes)",
-				filepath.Base(filePath), currentInfo.Size)
-			logAlert(alertMsg)
+		if dm.isLockedOut(filePath) || dm.isSuppressed(filePath) {
+			continue
+		}
 
-			dm.sendAPIAlert("warning", alertMsg)
+		if baselineInfo, exists := baseline[filePath]; !exists {
+			// 洪水期间新增文件已批量处理, 只告警策略的文件仍逐个接受
+			if flooding && dm.policyFor(filePath) != policyAlert {
+				continue
+			}
+			tags := dm.contentTags(filePath)
+			policy := dm.policyFor(filePath)
+			reason := isolateReason{Event: "file_created"}
+			if ext, ok := dm.doubleExtension(filePath); ok {
+				reason.Event = "double_extension_php"
+				dm.alertFile("critical", "double_extension_php",
+					fmt.Sprintf("检测到新增双扩展名文件: %s (危险扩展名: %s)，可能被当作脚本执行%s",
+						filePath, ext, tags), alertDetail{Path: filePath, New: &currentInfo, Action: policyDetailAction(policy, true)})
+			} else if finding := dm.polyglotFileFinding(filePath); finding != "" {
+				reason.Event = "polyglot_upload"
+				dm.alertFile("critical", "polyglot_upload",
+					fmt.Sprintf("检测到图片马: %s，%s", filePath, finding),
+					alertDetail{Path: filePath, New: &currentInfo, Action: policyDetailAction(policy, true)})
+			} else if isServerConfigFile(filePath) {
+				reason.Event = "server_config_dropped"
+				dm.alertFile("critical", "server_config_dropped",
+					fmt.Sprintf("检测到新增Web服务器/PHP配置文件: %s，可能用于让任意文件作为脚本执行%s",
+						filePath, serverConfigTags(filePath)), alertDetail{Path: filePath, New: &currentInfo, Action: policyDetailAction(policy, true)})
+			} else if level, desc := dm.suspiciousName(filePath); desc != "" {
+				reason.Event = "suspicious_filename"
+				dm.alertFile(level, "suspicious_filename",
+					fmt.Sprintf("检测到新增可疑文件名: %s，%s%s", filePath, desc, tags),
+					alertDetail{Path: filePath, New: &currentInfo, Action: policyDetailAction(policy, true)})
+			} else {
+				obf := dm.obfuscationOf(filePath)
+				alertMsg := fmt.Sprintf("检测到新增可疑文件: %s (大小: %d bytes)%s%s",
+					filepath.Base(filePath), currentInfo.Size, tags, obf.tag())
+				dm.alertFile(dm.obfuscationLevel(obf, "warning"), "file_created", alertMsg, alertDetail{Path: filePath, New: &currentInfo,
+					Action: policyDetailAction(policy, true), Obfuscation: obf.score, Entropy: obf.entropy})
+			}
+			dm.stats.countChange(changeCreated)
+			dm.checkCombinedScore(filePath, currentInfo, true)
+			reason.Rules = append(dm.confirmWebshell(filePath), dm.checkYara(filePath)...)
+			contentRules, ruleAction := dm.checkContentRules(filePath)
+			reason.Rules = append(reason.Rules, contentRules...)
+			if ruleAction != "" {
+				policy = ruleAction
+			}
 
-			if err := dm.isolateFile(filePath); err != nil {
-				logError(fmt.Sprintf("隔离新增文件失败: %v", err))
+			switch {
+			case policy == policyAlert:
+				dm.acceptChange(filePath)
+			case dm.dryRun:
+				dm.acceptDryRun(filePath, policy)
+			case policy == policyIsolate && !dm.isFlapping(filePath):
+				if err := dm.isolateFile(filePath, reason); err != nil {
+					logError(fmt.Sprintf("隔离新增文件失败: %v", err))
+				}
+			default:
+				// 反复出现的文件已有隔离样本, 抖动期间直接删除
+				if err := dm.deleteFile(filePath); err != nil {
+					logError(err.Error())
+				}
+			}
+			if len(reason.Rules) > 0 {
+				dm.blockAttackers(filePath)
 			}
 		} else {
-			if currentInfo.Size != baselineInfo.Size ||
-				currentInfo.ModTime != baselineInfo.ModTime ||
-				currentInfo.Mode != baselineInfo.Mode {
+			attrsChanged := currentInfo.Size != baselineInfo.Size ||
+				dm.mtimeChanged(currentInfo, baselineInfo) ||
+				currentInfo.Mode != baselineInfo.Mode ||
+				currentInfo.Attributes != baselineInfo.Attributes
+			inodeChanged := dm.inodeCheck && currentInfo.Inode != baselineInfo.Inode
+
+			// 扩展属性和ACL的修改(setfattr/setfacl)只改变ctime
+			xattrsChanged := false
+			if !inodeChanged && currentInfo.Ctime != baselineInfo.Ctime && baselineInfo.Hash != "" {
+				currentInfo.Xattrs = fileXattrDigest(filePath)
+				xattrsChanged = currentInfo.Xattrs != baselineInfo.Xattrs
+			}
 
-				alertMsg := fmt.Sprintf("检测到文件被修改: %s", filepath.Base(filePath))
-				logAlert(alertMsg)
+			if !inodeChanged && dm.checkPermissionChange(filePath, baselineInfo, currentInfo, xattrsChanged) {
+				continue
+			}
 
-				dm.sendAPIAlert("warning", alertMsg)
+			// 大小和修改时间可以用touch -r伪造, 但ctime无法伪造: ctime变化或深度扫描发现哈希不一致时重新计算哈希
+			deepHit := dm.takeDeepScanHit(filePath)
+			contentChanged := false
+			if !attrsChanged && !inodeChanged && (currentInfo.Ctime != baselineInfo.Ctime || deepHit) && baselineInfo.Hash != "" {
+				if dm.matchesBaseline(filePath, baselineInfo) {
+					baselineInfo.Ctime = currentInfo.Ctime
+					dm.setBaseline(filePath, baselineInfo)
+					continue
+				}
+				contentChanged = true
+			}
 
-				logInfo(fmt.Sprintf("修改详情 - 原始: 大小=%d, 时间=%d, 权限=%v",
-					baselineInfo.Size, baselineInfo.ModTime, baselineInfo.Mode))
-				logInfo(fmt.Sprintf("修改详情 - 当前: 大小=%d, 时间=%d, 权限=%v",
-					currentInfo.Size, currentInfo.ModTime, currentInfo.Mode))
+			if attrsChanged || inodeChanged || contentChanged {
+				if dm.acceptPersistentChange(filePath) {
+					continue
+				}
+
+				// 宽限期内只是暂不告警, 基线和备份保持不变, 宽限期结束后仍按原基线比较
+				if dm.withinStartupGrace(baselineInfo) {
+					logInfo(fmt.Sprintf("启动宽限期内暂不处理文件变化: %s", filePath))
+					continue
+				}
+
+				// inode变化说明文件被另一个文件rename覆盖, 用哈希区分是否真的换了内容
+				replaced := false
+				if inodeChanged {
+					if dm.matchesBaseline(filePath, baselineInfo) {
+						if !attrsChanged {
+							logInfo(fmt.Sprintf("文件inode变化但内容未变: %s (inode: %d -> %d)",
+								filePath, baselineInfo.Inode, currentInfo.Inode))
+							baselineInfo.Inode = currentInfo.Inode
+							dm.setBaseline(filePath, baselineInfo)
+							continue
+						}
+					} else {
+						replaced = true
+					}
+				}
+
+				policy := dm.policyFor(filePath)
+				detail := alertDetail{Path: filePath, Old: &baselineInfo, New: &currentInfo,
+					Action: policyDetailAction(policy, false), Diff: dm.textChangeDiff(filePath)}
+				reason := isolateReason{Event: "file_modified"}
+				if replaced {
+					reason.Event = "file_replaced_via_rename"
+					dm.alertFile("critical", "file_replaced_via_rename",
+						fmt.Sprintf("检测到文件被替换(rename覆盖): %s (inode: %d -> %d)%s%s",
+							filepath.Base(filePath), baselineInfo.Inode, currentInfo.Inode,
+							dm.contentTags(filePath), dm.binaryChangeSummary(filePath)), detail)
+				} else if isServerConfigFile(filePath) {
+					dm.alertFile("critical", "server_config_modified",
+						fmt.Sprintf("检测到Web服务器/PHP配置文件被修改: %s%s",
+							filePath, serverConfigTags(filePath)), detail)
+				} else if contentChanged {
+					dm.alertFile("critical", "file_modified",
+						fmt.Sprintf("检测到文件内容被篡改(大小和修改时间未变, 哈希不一致): %s%s%s",
+							filepath.Base(filePath), dm.contentTags(filePath), dm.binaryChangeSummary(filePath)), detail)
+				} else {
+					obf := dm.obfuscationOf(filePath)
+					detail.Obfuscation, detail.Entropy = obf.score, obf.entropy
+					alertMsg := fmt.Sprintf("检测到文件被修改: %s%s%s%s",
+						filepath.Base(filePath), dm.contentTags(filePath), dm.binaryChangeSummary(filePath), obf.tag())
+					dm.alertFile(dm.obfuscationLevel(obf, "warning"), "file_modified", alertMsg, detail)
+				}
+				if !replaced && !contentChanged &&
+					currentInfo.Size == baselineInfo.Size && !dm.mtimeChanged(currentInfo, baselineInfo) {
+					dm.stats.countChange(changePermission)
+				} else {
+					dm.stats.countChange(changeModified)
+				}
+				dm.checkCombinedScore(filePath, currentInfo, false)
+				reason.Rules = append(dm.confirmWebshell(filePath), dm.checkYara(filePath)...)
+				contentRules, ruleAction := dm.checkContentRules(filePath)
+				reason.Rules = append(reason.Rules, contentRules...)
+				if ruleAction != "" {
+					policy = ruleAction
+				}
 
-				if err := dm.isolateFile(filePath); err != nil {
-					logError(fmt.Sprintf("隔离被修改文件失败: %v", err))
+				logInfo(fmt.Sprintf("修改详情 - 原始: 大小=%d, 时间=%s, 权限=%v",
+					baselineInfo.Size, formatModTime(baselineInfo.ModTime), baselineInfo.Mode))
+				logInfo(fmt.Sprintf("修改详情 - 当前: 大小=%d, 时间=%s, 权限=%v",
+					currentInfo.Size, formatModTime(currentInfo.ModTime), currentInfo.Mode))
+
+				switch {
+				case policy == policyAlert:
+					dm.acceptChange(filePath)
+					continue
+				case dm.dryRun:
+					dm.acceptDryRun(filePath, policy)
+					continue
+				case policy == policyIsolate && !dm.isFlapping(filePath):
+					if err := dm.isolateFile(filePath, reason); err != nil {
+						logError(fmt.Sprintf("隔离被修改文件失败: %v", err))
+					}
 				}
 
 				if err := dm.restoreFile(filePath); err != nil {
@@ -495,17 +2042,297 @@ func (dm *DirectoryMonitor) checkDirectoryChanges(dirPath string) {
 		}
 	}
 
+	if dm.checkMassDeletion(dirPath, baseline, currentFileMap) {
+		return
+	}
+
+	for filePath, baselineInfo := range baseline {
+		if dm.isLockedOut(filePath) || dm.isSuppressed(filePath) {
+			continue
+		}
+
+		if _, exists := currentFileMap[filePath]; !exists {
+			if dm.acceptPersistentChange(filePath) {
+				continue
+			}
+
+			policy := dm.policyFor(filePath)
+			detail := alertDetail{Path: filePath, Old: &baselineInfo, Action: actionRestore}
+			if policy == policyAlert {
+				detail.Action = ""
+			}
+			alertMsg := fmt.Sprintf("检测到文件被删除: %s", filepath.Base(filePath))
+			dm.alertFile("warning", "file_deleted", alertMsg, detail)
+			dm.stats.countChange(changeDeleted)
+
+			if policy == policyAlert {
+				dm.deleteBaseline(filePath)
+			} else if dm.dryRun {
+				dm.acceptDryRun(filePath, policy)
+			} else if err := dm.restoreFile(filePath); err != nil {
+				logError(fmt.Sprintf("还原被删除的文件失败: %v", err))
+			}
+		}
+	}
+}
+
+// withinStartupGrace 判断是否处于启动宽限期, 且文件在基线建立前不久刚被写过;
+// 这类文件的变化通常是启动时尚未完成的正常写入, 宽限期结束后如果仍与基线不同再按篡改处理
+func (dm *DirectoryMonitor) withinStartupGrace(baselineInfo FileInfo) bool {
+	if dm.startupGrace <= 0 {
+		return false
+	}
+
+	dm.mu.RLock()
+	builtAt := dm.baselineBuiltAt
+	dm.mu.RUnlock()
+
+	if time.Since(builtAt) > dm.startupGrace {
+		return false
+	}
+	// 基线建立之后才写入的记录(例如豁免到期后重建的)不属于宽限范围
+	return baselineInfo.ModTime > builtAt.Add(-dm.startupGrace).UnixNano() &&
+		baselineInfo.ModTime <= builtAt.UnixNano()
+}
+
+// checkAlertOnlyChanges 处理只告警目录的变化: 不隔离不还原, 基线随目录内容同步更新
+func (dm *DirectoryMonitor) checkAlertOnlyChanges(rule dirRule, baseline, current map[string]FileInfo) {
+	inspect := dm.inspectTempFile
+	if rule == ruleSession {
+		inspect = dm.inspectSessionFile
+	}
+
+	for filePath, currentInfo := range current {
+		baselineInfo, exists := baseline[filePath]
+		if !exists {
+			inspect(filePath, currentInfo, nil)
+		} else if currentInfo != baselineInfo {
+			inspect(filePath, currentInfo, &baselineInfo)
+		} else {
+			continue
+		}
+		// session文件投毒和落地的脚本没有基线内容可以比较, 只能按内容判断
+		if dm.tempScan {
+			dm.confirmWebshell(filePath)
+			dm.checkYara(filePath)
+		}
+		dm.setBaseline(filePath, currentInfo)
+	}
+
 	for filePath := range baseline {
-		if filepath.Dir(filePath) == dirPath {
-			if _, exists := currentFileMap[filePath]; !exists {
-				alertMsg := fmt.Sprintf("检测到文件被删除: %s", filepath.Base(filePath))
-				logAlert(alertMsg)
+		if _, exists := current[filePath]; !exists {
+			dm.deleteBaseline(filePath)
+		}
+	}
+}
 
-				dm.sendAPIAlert("warning", alertMsg)
+// inspectTempFile 检查临时目录中新增或变化的文件, previous为nil表示新增
+func (dm *DirectoryMonitor) inspectTempFile(filePath string, info FileInfo, previous *FileInfo) {
+	// 下载后再chmod +x的情况同样需要告警
+	if info.Mode&0111 != 0 && (previous == nil || previous.Mode&0111 == 0) {
+		dm.alert("critical", "temp_executable",
+			fmt.Sprintf("检测到临时目录出现可执行文件: %s (大小: %d bytes)", filePath, info.Size))
+		return
+	}
 
-				if err := dm.restoreFile(filePath); err != nil {
-					logError(fmt.Sprintf("还原被删除的文件失败: %v", err))
-				}
+	if previous != nil {
+		return
+	}
+
+	score, err := fileEntropy(filePath)
+	if err != nil {
+		return
+	}
+	if score > tempEntropyThreshold {
+		dm.alert("critical", "temp_suspicious_binary",
+			fmt.Sprintf("检测到临时目录出现高熵文件: %s (熵: %.2f)", filePath, score))
+	}
+}
+
+// inspectSessionFile 只检查新建的session文件; session会不断轮换, 修改和删除不告警
+func (dm *DirectoryMonitor) inspectSessionFile(filePath string, info FileInfo, previous *FileInfo) {
+	// PHP可能先创建空文件, 请求结束时才写入, 此时补查一次
+	if previous != nil && previous.Size != 0 {
+		return
+	}
+
+	if info.Size > dm.maxSessionSize {
+		dm.alert("critical", "oversized_session",
+			fmt.Sprintf("检测到超大session文件: %s (大小: %d bytes, 阈值: %d bytes)，可能包含反序列化攻击载荷",
+				filePath, info.Size, dm.maxSessionSize))
+	}
+}
+
+func (dm *DirectoryMonitor) setBaseline(filePath string, info FileInfo) {
+	dm.mu.Lock()
+	dm.baseline[filePath] = info
+	dm.mu.Unlock()
+	dm.markManifestDirty()
+}
+
+func (dm *DirectoryMonitor) deleteBaseline(filePath string) {
+	dm.mu.Lock()
+	delete(dm.baseline, filePath)
+	dm.mu.Unlock()
+	dm.markManifestDirty()
+}
+
+// monitoredPath 把用户输入的路径转换为与基线一致的形式, 路径必须位于监控目录内
+func (dm *DirectoryMonitor) monitoredPath(input string) (string, error) {
+	if input == "" {
+		return "", errors.New("路径不能为空")
+	}
+
+	inputAbs, err := filepath.Abs(input)
+	if err != nil {
+		return "", err
+	}
+
+	for _, dir := range dm.rootDirs() {
+		watchAbs, err := filepath.Abs(dir)
+		if err != nil {
+			return "", err
+		}
+		relPath, err := filepath.Rel(watchAbs, inputAbs)
+		if err == nil && relPath != ".." && !strings.HasPrefix(relPath, "../") {
+			return filepath.Join(dir, relPath), nil
+		}
+	}
+	return "", fmt.Errorf("路径不在监控目录内: %s", input)
+}
+
+// lockoutEntry 一个临时豁免: 到期时间和到期后重建基线的定时器
+type lockoutEntry struct {
+	until time.Time
+	timer *time.Timer
+}
+
+// lockoutFile 在duration内豁免文件的监控, 供授权人员修补漏洞
+func (dm *DirectoryMonitor) lockoutFile(input string, duration time.Duration) (string, error) {
+	filePath, err := dm.monitoredPath(input)
+	if err != nil {
+		return "", err
+	}
+
+	until := time.Now().Add(duration)
+	dm.lockMu.Lock()
+	// 重新豁免时以新的到期时间为准, 旧的定时器不再需要
+	if previous, ok := dm.lockedOut[filePath]; ok {
+		previous.timer.Stop()
+	}
+	dm.lockedOut[filePath] = lockoutEntry{
+		until: until,
+		timer: time.AfterFunc(duration, func() { dm.expireLockout(filePath, until) }),
+	}
+	dm.lockMu.Unlock()
+
+	logWarn(fmt.Sprintf("文件已临时豁免监控: %s (%v)", filePath, duration))
+	dm.audit("lockout", filePath, duration.String())
+	return filePath, nil
+}
+
+func (dm *DirectoryMonitor) expireLockout(filePath string, until time.Time) {
+	// 退出过程中到期的不再重建基线, 避免与退出时的清单保存和解除immutable交错
+	if dm.ctx.Err() != nil {
+		return
+	}
+
+	dm.lockMu.Lock()
+	// 期间被重新豁免过则以新的到期时间为准
+	if current, ok := dm.lockedOut[filePath]; !ok || !current.until.Equal(until) {
+		dm.lockMu.Unlock()
+		return
+	}
+	delete(dm.lockedOut, filePath)
+	dm.lockMu.Unlock()
+
+	if err := dm.rebaselineFile(filePath); err != nil {
+		logError(fmt.Sprintf("豁免到期后重建基线失败 %s: %v", filePath, err))
+		return
+	}
+	logInfo(fmt.Sprintf("豁免到期，已按当前内容重建基线: %s", filePath))
+	dm.audit("lockout_expired", filePath, "")
+}
+
+func (dm *DirectoryMonitor) isLockedOut(filePath string) bool {
+	dm.lockMu.Lock()
+	defer dm.lockMu.Unlock()
+
+	_, ok := dm.lockedOut[filePath]
+	return ok
+}
+
+func (dm *DirectoryMonitor) listLockouts() map[string]string {
+	dm.lockMu.Lock()
+	defer dm.lockMu.Unlock()
+
+	result := make(map[string]string, len(dm.lockedOut))
+	for filePath, entry := range dm.lockedOut {
+		result[filePath] = entry.until.Format(time.RFC3339)
+	}
+	return result
+}
+
+// stopLockouts 退出时停止所有豁免的到期定时器, 未到期的豁免不再重建基线
+func (dm *DirectoryMonitor) stopLockouts() {
+	dm.lockMu.Lock()
+	defer dm.lockMu.Unlock()
+
+	for _, entry := range dm.lockedOut {
+		entry.timer.Stop()
+	}
+}
+
+// rebaselineFile 以文件当前内容更新备份和基线, 文件已不存在则从基线中移除
+func (dm *DirectoryMonitor) rebaselineFile(filePath string) error {
+	dm.unhardenFile(filePath)
+
+	if !dm.isRegularFile(filePath) || !dm.shouldMonitorFile(filePath) {
+		dm.deleteBaseline(filePath)
+		return nil
+	}
+
+	if err := dm.backupFile(filePath); err != nil {
+		return err
+	}
+
+	info, err := dm.hashedFileInfo(filePath)
+	if err != nil {
+		return err
+	}
+	dm.setBaseline(filePath, info)
+	return nil
+}
+
+// addAlertOnlyRules 为可读的目录记录只告警规则, 返回加入的目录;
+// 必须在Start启动任何goroutine之前调用, 之后dirRules只读, 不需要加锁
+func (dm *DirectoryMonitor) addAlertOnlyRules(dirs []string, rule dirRule) []string {
+	var added []string
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		if _, err := os.ReadDir(dir); err != nil {
+			logWarn(fmt.Sprintf("读取目录失败 %s: %v", dir, err))
+			continue
+		}
+		dm.dirRules[dir] = rule
+		added = append(added, dir)
+	}
+	return added
+}
+
+// baselineAlertOnlyDirs 只告警目录(仅第一层)中已有的文件直接记入基线
+func (dm *DirectoryMonitor) baselineAlertOnlyDirs(dirs []string) {
+	for _, dir := range dirs {
+		files, err := dm.getDirectChildren(dir)
+		if err != nil {
+			logWarn(fmt.Sprintf("读取目录失败 %s: %v", dir, err))
+			continue
+		}
+		for _, filePath := range files {
+			if info, err := dm.getFileInfo(filePath); err == nil {
+				dm.setBaseline(filePath, info)
 			}
 		}
 	}
@@ -516,43 +2343,312 @@ func (dm *DirectoryMonitor) Start() error {
 		return err
 	}
 
+	// 只告警目录的规则在启动任何goroutine之前写入, 基线在备份完成后再记录
+	var temps, sessions []string
+	if dm.watchTemp {
+		temps = dm.addAlertOnlyRules(tempDirs, ruleTemp)
+	}
+	if dm.sessionDir != "" {
+		sessions = dm.addAlertOnlyRules([]string{dm.sessionDir}, ruleSession)
+	}
+
+	dm.handleShutdownSignals()
+	dm.handlePauseSignals()
+	dm.handleRebaselineSignal()
+
+	if dm.eventLogKeep > 0 {
+		events, err := openEventLog(dm.baseDir, dm.eventLogKeep)
+		if err != nil {
+			return fmt.Errorf("打开事件日志失败: %v", err)
+		}
+		dm.events = events
+		logInfo(fmt.Sprintf("事件日志: %s (已载入 %d 条历史事件)", events.path, len(events.offsets)))
+	}
+
+	// 在建立基线和启动各项监控之前开始跟踪, 使最早的告警也能附带请求
+	if len(dm.accessLogPaths) > 0 {
+		dm.startAccessLogs()
+	}
+	if dm.blockIP {
+		dm.startIPBlocker()
+	}
+
+	var configFiles []string
+	if dm.configFile != "" {
+		configFiles = append(configFiles, dm.configFile)
+	}
+	if dm.suppressFile != "" {
+		if err := dm.loadSuppressFile(); err != nil {
+			return fmt.Errorf("读取豁免列表失败: %v", err)
+		}
+		configFiles = append(configFiles, dm.suppressFile)
+	}
+
+	if len(configFiles) > 0 {
+		group, err := dm.protectConfigFiles(configFiles)
+		if err != nil {
+			return fmt.Errorf("保护配置文件失败: %v", err)
+		}
+		logInfo(fmt.Sprintf("配置文件防篡改: %v", configFiles))
+		dm.runPeriodic(snapshotCheckInterval, func() { dm.checkSnapshotGroup(group) })
+	}
+
+	if dm.settleTime > 0 {
+		if err := dm.waitForSettle(); err != nil {
+			return fmt.Errorf("等待目录稳定失败: %v", err)
+		}
+	}
+
+	if dm.resumeBackup {
+		if err := dm.resumeFromManifest(); err != nil {
+			logWarn(fmt.Sprintf("无法复用备份 %s, 重新备份: %v", dm.backupDir, err))
+			dm.useFreshBackupDir()
+		}
+	}
+
 	if err := dm.discoverDirectories(); err != nil {
 		return fmt.Errorf("发现目录失败: %v", err)
 	}
 
-	if err := dm.backupAllFiles(); err != nil {
-		return fmt.Errorf("备份文件失败: %v", err)
+	if !dm.resumeBackup {
+		dm.runBackupHook("备份前", dm.preBackupCmd)
+		if err := dm.backupAllFiles(); err != nil {
+			return fmt.Errorf("备份文件失败: %v", err)
+		}
+		if dm.stopping() {
+			logWarn("初始备份被中断，未启动监控")
+			dm.printSummary()
+			return nil
+		}
+		dm.runBackupHook("备份后", dm.postBackupCmd)
+
+		if dm.latestSymlink {
+			if err := dm.updateLatestBackupLink(); err != nil {
+				logWarn(fmt.Sprintf("更新最新备份链接失败: %v", err))
+			}
+		}
+
+		if err := dm.buildBaseline(); err != nil {
+			return fmt.Errorf("建立基线失败: %v", err)
+		}
 	}
 
-	if err := dm.buildBaseline(); err != nil {
-		return fmt.Errorf("建立基线失败: %v", err)
+	if err := dm.saveManifest(); err != nil {
+		logWarn(fmt.Sprintf("保存基线清单失败, 下次无法使用-resume: %v", err))
 	}
+	dm.runPeriodic(manifestSaveInterval, dm.saveManifestIfDirty)
 
-	if err := os.MkdirAll(dm.isolateDir, 0755); err != nil {
+	if err := dm.makeWorkspaceDir(dm.isolateDir); err != nil {
 		return fmt.Errorf("创建隔离目录失败: %v", err)
 	}
+	if dm.keepEvidence {
+		if err := dm.makeWorkspaceDir(dm.evidenceDir); err != nil {
+			return fmt.Errorf("创建证据目录失败: %v", err)
+		}
+	}
 
-	logInfo(fmt.Sprintf("启动 %d 个监控goroutine，检测间隔: %v",
-		len(dm.directories), dm.checkInterval))
-
-	if dm.apiEndpoint != "" {
-		logInfo(fmt.Sprintf("API端点: http://%s", dm.apiEndpoint))
+	if dm.dryRun {
+		logWarn("DRY-RUN模式: 只检测和告警, 不隔离、不还原、不重建目录")
+	}
+	logInfo(fmt.Sprintf("监控 %d 个目录，检测间隔: %v",
+		len(dm.activeDirectories), dm.checkInterval))
+
+	if dm.webhookURL != "" || len(dm.dirAPIs) > 0 {
+		if dm.webhookURL != "" {
+			logInfo(fmt.Sprintf("告警上报: %s", dm.webhookURL))
+			if dm.webhookToken != "" && dm.webhookHMACKey == "" && strings.HasPrefix(dm.webhookURL, "http://") {
+				logWarn("webhook令牌通过明文HTTP发送, 同网段选手可以截获, 建议使用https或-webhook-hmac-key")
+			}
+		}
+		for _, api := range dm.dirAPIs {
+			logInfo(fmt.Sprintf("目录告警上报: %s -> %s", api.Pattern, strings.Join(api.URLs, ", ")))
+		}
+		if dm.alertQueue != nil {
+			dm.startAlertQueue()
+		}
+		if dm.alertCh != nil {
+			dm.startAlertWorkers(dm.alertWorkers)
+		}
 	} else {
 		logInfo("API端点: 未配置（仅本地日志）")
 	}
 
-	var wg sync.WaitGroup
-	for _, dir := range dm.directories {
-		wg.Add(1)
-		go dm.monitorDirectory(dir, &wg)
+	if dm.dirPermCheckInterval > 0 {
+		logInfo(fmt.Sprintf("工作目录权限检查间隔: %v，预期权限: %04o",
+			dm.dirPermCheckInterval, dm.backupDirMode))
+		dm.runPeriodic(dm.dirPermCheckInterval, dm.checkWorkspacePermissions)
+	}
+
+	if dm.selfCheckInterval > 0 {
+		if err := dm.initSelfIntegrity(); err != nil {
+			logWarn(fmt.Sprintf("无法建立自身完整性基线，跳过自检: %v", err))
+		} else {
+			dm.runPeriodic(dm.selfCheckInterval, dm.checkSelfIntegrity)
+		}
+	}
+
+	if dm.statsInterval > 0 {
+		dm.runPeriodic(dm.statsInterval, dm.reportStats)
 	}
 
+	if dm.isolateMaxSize > 0 || dm.isolateMaxAge > 0 {
+		logInfo(fmt.Sprintf("隔离目录配额: %d MB, 样本保留时间: %v (0表示不限制)", dm.isolateMaxSize>>20, dm.isolateMaxAge))
+		dm.runPeriodic(isolateQuotaInterval, dm.enforceIsolateQuota)
+	}
+
+	if dm.deepScanInterval > 0 {
+		logInfo(fmt.Sprintf("深度扫描间隔: %v", dm.deepScanInterval))
+		dm.runPeriodic(dm.deepScanInterval, dm.deepScan)
+	}
+
+	if dm.cronMonitor {
+		dm.startCronMonitor()
+	}
+
+	if dm.ldMonitor {
+		dm.startLdPreloadMonitor()
+	}
+
+	if dm.procNetMonitor {
+		dm.startProcNetMonitor()
+	}
+
+	if dm.accountMonitor {
+		dm.startAccountMonitor()
+	}
+
+	if len(dm.suidRoots) > 0 {
+		dm.startSuidMonitor()
+	}
+
+	if dm.procMonitor {
+		dm.startProcMonitor()
+	}
+
+	if dm.connMonitor {
+		dm.startConnMonitor()
+	}
+
+	if len(dm.memshellProcs) > 0 {
+		dm.startMemshellMonitor()
+	}
+
+	if dm.tomcatHome != "" {
+		dm.startTomcatMonitor()
+	}
+
+	if dm.webserverMonitor {
+		dm.startWebserverMonitor()
+	}
+
+	if dm.phpMonitor {
+		dm.startPHPConfigMonitor()
+	}
+
+	if len(dm.lineMonitorFiles) > 0 {
+		dm.startLineMonitor()
+	}
+
+	if len(dm.flagFiles) > 0 {
+		dm.startFlagGuard()
+	}
+
+	if len(dm.watchFiles) > 0 {
+		dm.startFileMonitor()
+	}
+
+	if dm.watchMode == "inotify" {
+		watcher, err := newInotifyWatcher(dm.scheduler.wake, dm.scheduler.wakeAll)
+		if err != nil {
+			logWarn(fmt.Sprintf("inotify不可用, 退回轮询模式: %v", err))
+		} else {
+			dm.watcher = watcher
+			dm.wg.Add(1)
+			go func() {
+				defer dm.wg.Done()
+				watcher.run(dm.ctx)
+			}()
+			logInfo(fmt.Sprintf("事件驱动监控已启用, 兜底轮询间隔: %v", inotifySafetyInterval))
+		}
+	}
+
+	for _, dir := range dm.activeDirectories {
+		if interval := dm.intervalFor(dir); interval != dm.checkInterval {
+			logInfo(fmt.Sprintf("目录检查间隔覆盖: %s -> %v", dir, interval))
+		}
+		dm.scheduleDirectory(dir, dm.intervalFor(dir))
+	}
+
+	if dm.watchTemp {
+		dm.baselineAlertOnlyDirs(temps)
+		logInfo(fmt.Sprintf("临时目录只告警监控: %v", temps))
+		for _, dir := range temps {
+			dm.scheduleDirectory(dir, dm.intervalFor(dir))
+		}
+	}
+
+	if dm.sessionDir != "" {
+		if len(sessions) > 0 {
+			dm.baselineAlertOnlyDirs(sessions)
+			logInfo(fmt.Sprintf("session目录只告警监控: %s，大小阈值: %d bytes",
+				dm.sessionDir, dm.maxSessionSize))
+			dm.scheduleDirectory(dm.sessionDir, dm.intervalFor(dm.sessionDir))
+		} else {
+			logWarn(fmt.Sprintf("session目录不可用，跳过: %s", dm.sessionDir))
+		}
+	}
+
+	if dm.tempScan && (dm.watchTemp || dm.sessionDir != "") {
+		logInfo("临时目录和session目录中新增和被修改的文件将做webshell特征和YARA扫描(只告警)")
+	}
+
+	if idle := dm.idleDirectories(); len(idle) > 0 {
+		logInfo(fmt.Sprintf("%d 个空目录低频巡检，间隔: %v",
+			len(idle), dm.checkInterval*5))
+		for _, dir := range idle {
+			dm.scheduler.add(dir, dm.checkInterval*5)
+		}
+	}
+	dm.startScanWorkers()
+
 	logSuccess("EDR监控已启动，正在监控文件变化...")
-	wg.Wait()
+	if dm.repl {
+		dm.startREPL()
+	}
+	dm.wg.Wait()
+	dm.stopLockouts()
+	dm.releaseImmutable()
+	dm.saveManifestIfDirty()
+	dm.stopAlertWorkers()
+	dm.printSummary()
 
 	return nil
 }
 
+// parseList 解析逗号分隔的列表, 忽略空项
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// absPaths 把逗号分隔的路径列表转换为绝对路径, name为出错时提示的参数名
+func absPaths(name, value string) ([]string, error) {
+	var paths []string
+	for _, path := range parseList(value) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("无效的-%s路径 %s: %v", name, path, err)
+		}
+		paths = append(paths, abs)
+	}
+	return paths, nil
+}
+
 func parseExtensions(extStr string) []string {
 	if extStr == "" {
 		return nil
@@ -575,22 +2671,186 @@ func parseExtensions(extStr string) []string {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "unisolate" {
+		os.Exit(runUnisolate(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "rollback" {
+		os.Exit(runRollback(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "server" {
+		os.Exit(runServer(os.Args[2:]))
+	}
+
 	var (
-		monitorDir  = flag.String("m", "", "监控目录路径 (必需)")
-		baseDir     = flag.String("b", "", "基础目录路径，将在此目录下创建backup_和isolate_子目录 (必需)")
-		extensions  = flag.String("e", "", "监控的文件扩展名，用逗号分隔 (例如: .php,.js,.html)")
-		apiEndpoint = flag.String("a", "", "API端点地址 (例如: 192.168.1.100:8080), 不指定则不发送")
-		help        = flag.Bool("h", false, "显示帮助信息")
+		interval     = flag.Duration("i", 200*time.Millisecond, "每个目录的检查间隔, 范围10ms~1m; 弱性能靶机可适当调大")
+		exclude      = flag.String("x", "", "排除的路径, 逗号分隔: glob(不含/时匹配任意一级名称, 例如cache,*.log; 含/时匹配相对路径, 例如runtime/cache) 或 re:正则")
+		monitorDir   = flag.String("m", "", "监控目录路径, 多个目录用逗号分隔, 各自使用独立的备份/隔离子目录 (必需)")
+		baseDir      = flag.String("b", "", "基础目录路径，将在此目录下创建backup_和isolate_子目录 (必需)")
+		extensions   = flag.String("e", "", "监控的文件扩展名，用逗号分隔 (例如: .php,.js,.html)")
+		apiEndpoint  = flag.String("a", "", "API端点地址 (例如: 192.168.1.100:8080), 不指定则不发送")
+		webhook      = flag.String("webhook", "", "告警上报的完整URL, 默认为 http://<-a>/api/agent/edr-alert")
+		webhookType  = flag.String("webhook-content-type", "application/json", "JSON POST告警的Content-Type")
+		queueSize    = flag.Int("alert-queue-size", 1000, "发送失败的告警按顺序指数退避重试, 队列容量(超出丢弃最旧的), 0表示不重试")
+		scanWorkers  = flag.Int("scan-workers", 0, "检查目录的worker数量, 所有目录共用一个按到期时间排序的扫描队列; 0表示按CPU核数")
+		alertWorkers = flag.Int("alert-workers", 4, "异步发送告警的goroutine数量, 检测和处置不等待HTTP; 0表示同步发送(多个goroutine之间不保证告警顺序)")
+		queueFile    = flag.String("alert-queue-file", "", "告警重试队列持久化文件, 重启后继续发送未送达的告警")
+		whToken      = flag.String("webhook-token", "", "上报告警和心跳时添加 Authorization: Bearer <令牌>, @文件 表示从文件读取")
+		whHMAC       = flag.String("webhook-hmac-key", "", "用该密钥对请求体做HMAC-SHA256签名(X-EDR-Timestamp/X-EDR-Signature头), @文件 表示从文件读取")
+		whCA         = flag.String("webhook-ca", "", "校验https上报地址时额外信任的CA证书(PEM)")
+		whInsecure   = flag.Bool("webhook-insecure", false, "不校验https上报地址的证书(自签名证书)")
+		apiGet       = flag.Bool("api-get", false, "使用旧版GET查询参数上报告警(消息会被截断并出现在代理日志中), 兼容旧接收端")
+		streamEvts   = flag.Bool("stream-events", false, "把audit.log中的处理动作(还原、结束进程、封禁IP、暂停/恢复等)实时上报到-a的/api/agent/edr-events, 用于edr server汇总")
+		obfThreshold = flag.Int("obfuscation-threshold", 6, "新增/被修改的脚本文件计算熵和混淆评分(长base64块、gzinflate解码链、chr()拼接等)并附在告警中, 达到该分值时告警提升为critical, 0表示关闭")
+		diffMaxKB    = flag.Int64("diff-max-size", 256, "被修改的文本文件不超过该大小(KB)时, 在告警日志和上报API中附带与备份的unified diff, 0表示关闭")
+		maxMsgLen    = flag.Int("max-alert-msg-len", 1024, "上报API的告警消息最大字符数, 超出部分截断, 0表示不限制")
+		mtimeRes     = flag.Duration("mtime-resolution", time.Second, "比较修改时间的精度, FAT32建议2s, ext4可设为1ns")
+		resumeBackup = flag.Bool("resume", false, "复用基础目录下最近一次的备份和基线清单(manifest.json), 验证备份哈希一致后不再重新备份; 停机期间的修改按篡改还原")
+		manifestFmt  = flag.String("manifest-format", "json", "基线清单格式: json 或 jsonl(每个文件一行, 逐行解析, 文件很多时峰值内存更低)")
+		latestLink   = flag.Bool("backup-latest-symlink", false, "备份完成后把<基础目录>/backup_latest指向本次备份目录")
+		progress     = flag.Bool("backup-progress", true, "初始备份时显示进度和速率, stderr不是终端时自动关闭")
+		watchMode    = flag.String("watch-mode", "poll", "监控方式: poll(按-i间隔轮询) 或 inotify(事件驱动, 不支持的目录自动退回轮询)")
+		dirInterval  = flag.String("dir-interval", "", "按目录模式覆盖检查间隔, 格式: 模式=间隔, 逗号分隔, 模式相对监控目录且同时作用于子目录 (例如: vendor=5s,static/*=2s)")
+		inodeCheck   = flag.Bool("inode-check", true, "比较文件inode, 内容不同的rename替换告警file_replaced_via_rename")
+		rmSpecial    = flag.Bool("remove-special-files", false, "删除监控目录中新增的命名管道(FIFO)、unix socket和设备文件, 默认只告警special_file")
+		symlinkAct   = flag.String("symlink-action", "isolate", "新增或指向被修改的符号链接的处理方式: alert(只告警), isolate(移入隔离目录) 或 delete(删除)")
+		isolateDirs  = flag.Bool("isolate-new-dirs", false, "运行期间新建的目录整体移入隔离目录, 默认只告警并纳入监控")
+		policy       = flag.String("policy", "", "按路径规则指定处理方式, 格式: 规则=alert|restore|isolate|delete, 规则写法与-x相同, 第一条匹配的生效, 例如 *.log=alert,uploads/*.php=delete,index.php=restore")
+		evidence     = flag.Bool("evidence", true, "还原前把攻击者修改后的内容连同.meta.json复制到基础目录下的evidence_<时间戳>/, 供反打分析; -evidence=false关闭")
+		dryRun       = flag.Bool("dry-run", false, "只检测和告警, 从不隔离、还原或重建目录; 用于正式启用前在线上服务验证扩展名和排除规则")
+
+		skipEmpty    = flag.Bool("skip-empty-dirs", false, "不含被监控文件的目录按5倍检查间隔低频巡检")
+		dirMode      = flag.String("backup-dir-mode", "0700", "备份/隔离目录权限 (八进制)")
+		permCheck    = flag.Duration("dir-perm-check", 10*time.Second, "备份/隔离目录权限检查间隔, 0表示不检查")
+		selfCheck    = flag.Duration("self-check", 30*time.Second, "EDR自身可执行文件完整性检查间隔, 0表示不检查")
+		exitTamper   = flag.Bool("exit-on-binary-tamper", false, "检测到EDR自身被篡改时退出")
+		ldMon        = flag.Bool("ldpreload-monitor", false, "监控/etc/ld.so.preload, /etc/ld.so.conf, /etc/ld.so.conf.d和Web服务环境变量文件的变化, 以及Web服务用户进程环境中的LD_PRELOAD")
+		restoreLd    = flag.Bool("restore-ld", false, "动态链接器配置被修改时复原, 新增的文件移入隔离目录")
+		flagFiles    = flag.String("flag-files", "", "flag文件, 逗号分隔 (例如: /flag,/var/www/html/flag.txt), 内容、属主和权限被篡改或文件被移走时告警flag_tampering并立即复原")
+		watchFiles   = flag.String("file", "", "单独监控的文件, 逗号分隔, 不监控其所在目录 (例如: /etc/nginx/nginx.conf,/var/spool/cron/root), 修改或删除时告警并复原")
+		lineMon      = flag.String("line-monitor", "", "按行监控的文件, 逗号分隔 (例如: /etc/hosts,/etc/sudoers), 告警增删的具体行并整体复原")
+		phpMon       = flag.Bool("php-monitor", false, "监控php --ini发现的PHP配置文件和php-fpm配置, 引入危险设置时告警php_dangerous_setting")
+		restorePHP   = flag.Bool("restore-php-config", false, "PHP配置被修改时复原, 新增的配置文件移入隔离目录")
+		procNet      = flag.Bool("proc-net-monitor", false, "每5s读取/proc/net/tcp和/proc/net/tcp6, 出现新的监听端口时告警并给出监听的进程")
+		procNetKill  = flag.Bool("proc-net-kill", false, "结束-proc-net-monitor发现的新监听端口所属的进程(bind shell), 默认只告警")
+		accountMon   = flag.Bool("account-monitor", false, "监控/etc/passwd, /etc/shadow, /etc/group和各用户的~/.ssh/authorized_keys, 告警新增的用户和公钥并复原")
+		suidRoots    = flag.String("suid-roots", "", "监控新出现的SUID/SGID文件和带capabilities(setcap)的文件的目录, 逗号分隔 (例如: /usr,/bin,/tmp), 为空表示关闭")
+		stripSuid    = flag.Bool("strip-suid", false, "清除-suid-roots下新出现的SUID/SGID位和capabilities, 默认只告警")
+		procMon      = flag.Bool("proc-monitor", false, "每2s遍历/proc, Web服务用户启动shell、解释器或网络工具时告警, 附带命令行和父进程链")
+		procUsers    = flag.String("proc-users", "www-data,apache,nginx,tomcat,http,nobody", "-proc-monitor, -conn-monitor和-ldpreload-monitor检查的Web服务用户, 逗号分隔, 可以是用户名或uid")
+		procNames    = flag.String("proc-names", "bash,sh,dash,zsh,ash,python,perl,ruby,php,nc,ncat,netcat,socat,curl,wget,telnet,busybox", "-proc-monitor告警的进程名, 逗号分隔, 忽略末尾的版本号(python3, php8.1)")
+		procKill     = flag.Bool("proc-kill", false, "结束-proc-monitor发现的可疑进程, 默认只告警")
+		connMon      = flag.Bool("conn-monitor", false, "每2s读取/proc/net/tcp(6), -proc-users中的用户新发起外连时告警(反弹shell), 附带所属进程")
+		memshell     = flag.String("memshell-procs", "", "检测内存马的Web worker进程名, 逗号分隔 (例如: php-fpm,php-cgi,apache2,httpd,java), 为空表示关闭")
+		tomcatHome   = flag.String("tomcat-home", "", "Tomcat目录(CATALINA_BASE, 例如: /usr/local/tomcat), 监控webapps下新部署的应用、work下孤立的JSP编译类和conf的变化, 为空表示关闭")
+		webMon       = flag.Bool("webserver-monitor", false, "监控/etc/nginx, /etc/apache2, /etc/httpd等nginx/apache配置目录, 告警变化和新增的proxy_pass, location, CGI等危险指令")
+		restoreWeb   = flag.Bool("restore-webserver", false, "Web服务器配置被修改时复原, 新增的配置文件移入隔离目录")
+		webTestCmd   = flag.String("webserver-test-cmd", "", "复原Web服务器配置后、重新加载前执行的配置检查命令 (例如: nginx -t), 失败时不重新加载")
+		webReload    = flag.String("webserver-reload-cmd", "", "复原Web服务器配置后执行的重新加载命令 (例如: nginx -s reload), 为空表示不重新加载")
+		accessLogs   = flag.String("access-log", "", "nginx/apache访问日志(combined格式), 逗号分隔 (例如: /var/log/nginx/access.log), 新增文件告警时附带之前的请求(URI, 来源IP, User-Agent)")
+		logWindow    = flag.Duration("access-log-window", 10*time.Second, "新增文件告警附带的访问日志请求的时间范围, 应不小于目录检查间隔")
+		blockIP      = flag.Bool("block-ip", false, "确认为webshell的新增文件通过-access-log关联到上传请求时, 执行-block-cmd封禁来源IP")
+		blockCmd     = flag.String("block-cmd", defaultBlockCmd, "封禁命令, IP通过EDR_BLOCK_IP传入 (例如: nft add element inet filter blacklist { $EDR_BLOCK_IP })")
+		unblockCmd   = flag.String("unblock-cmd", defaultUnblockCmd, "封禁到期后执行的解封命令, IP通过EDR_BLOCK_IP传入")
+		blockFor     = flag.Duration("block-duration", 10*time.Minute, "封禁时长, 0表示永久封禁")
+		blockAllow   = flag.String("block-whitelist", "", "从不封禁的IP或CIDR, 逗号分隔, 应包含裁判机和check服务器的地址 (例如: 10.10.0.0/16,172.16.0.1)")
+		connAllow    = flag.String("conn-whitelist", "", "-conn-monitor不告警的目的地址, 逗号分隔, 可以是IP, CIDR, :端口, IP:端口或CIDR:端口 (例如: 10.0.0.0/8,:53,1.2.3.4:443)")
+		cronMon      = flag.Bool("cron-monitor", false, "监控/etc/crontab, /etc/cron.d, /etc/cron.hourly等, 各用户crontab(/var/spool/cron)和systemd unit文件的新增和修改")
+		restoreCron  = flag.Bool("restore-cron", false, "计划任务被修改时复原, 新增的cron文件和systemd unit移入隔离目录")
+		watchTemp    = flag.Bool("watch-temp", false, "只告警模式监控/tmp, /var/tmp, /dev/shm中的可执行文件和高熵文件")
+		tempScan     = flag.Bool("temp-scan", false, "对-watch-temp和-session-dir目录中新增和被修改的文件做webshell特征和YARA扫描, 只告警")
+		presetList   = flag.String("preset", "", "内置的参数组合, 逗号分隔, 只填充命令行和配置文件中没有指定的参数 (可选: session-tmp, tomcat, webserver)")
+		settleTime   = flag.Duration("settle-time", 0, "备份前等待监控目录持续无变化的时长, 用于等待部署完成 (例如: 10s)")
+		grace        = flag.Duration("startup-grace", 5*time.Second, "基线建立后的宽限期, 期间基线建立前刚写过的文件发生变化时暂不告警, 结束后仍与原基线比较, 0表示关闭")
+		eventKeep    = flag.Int("event-log-keep", 10000, "基础目录下events.jsonl保留的告警事件条数, 0表示不记录")
+		massDelete   = flag.Int("mass-delete-threshold", 20, "一次检查中同一目录内消失的文件超过该数量时按批量删除(rm -rf)处理: 一条汇总告警, 批量重建子目录树并还原, 0表示关闭")
+		floodLimit   = flag.Int("flood-threshold", 50, "一次检查中同一目录内新增的文件超过该数量时按洪水处理: 一条creation_flood汇总告警, 之后分批隔离或删除, 不再逐个告警, 0表示关闭")
+		floodAction  = flag.String("flood-action", policyIsolate, "新增文件洪水的批量处理方式: isolate或delete")
+		isoMaxSize   = flag.Int64("isolate-max-size", 0, "隔离目录配额(MB), 超过时从最早隔离的样本开始删除并告警isolate_quota_purged (例如: 500), 0表示不限制")
+		isoMaxAge    = flag.Duration("isolate-max-age", 0, "隔离样本的保留时间, 超过后自动删除 (例如: 24h), 0表示永久保留")
+		deepScan     = flag.Duration("deep-scan-interval", 10*time.Minute, "深度扫描间隔: 重新计算所有被监控文件的哈希, 发现大小/修改时间/ctime都被伪造的篡改, 0表示关闭")
+		statsEvery   = flag.Duration("stats-interval", time.Minute, "周期统计汇总间隔, 配置了API时同时发送心跳, 0表示关闭")
+		notifyFile   = flag.String("restore-notify-file", "", "还原后在文件旁写入的通知文件后缀 (例如: .edr_restored)")
+		immutable    = flag.String("immutable", "", "Linux: 还原后给匹配的关键文件加上不可变属性(chattr +i), 与-x相同的写法 (例如: index.php,config.php), 重建基线和退出时自动清除")
+		flapLimit    = flag.Int("flap-threshold", 5, "单个文件一分钟内被隔离/还原的次数达到该值时进入升级模式: 继续还原但不再重复隔离, 告警合并为每分钟一条persistent_tampering, 0表示关闭")
+		maxRestores  = flag.Int("max-restores-per-hour", 10, "单个文件一小时内的还原次数阈值, 超过时告警persistent_attack_detected, 0表示不检查")
+		acceptPers   = flag.Bool("accept-persistent", false, "还原次数超过阈值后以当前内容重建该文件基线, 停止还原循环")
+		suppressLst  = flag.String("suppress-file", "", "不参与监控的文件列表, 每行一个路径; 该文件本身受防篡改保护")
+		preBackup    = flag.String("pre-backup-cmd", "", "初始备份前执行的命令 (例如: redis-cli bgsave), 可使用EDR_BACKUP_DIR, EDR_WATCH_DIR环境变量, 失败只告警")
+		postBackup   = flag.String("post-backup-cmd", "", "初始备份完成后执行的命令, 环境变量同-pre-backup-cmd")
+		backupHookT  = flag.Duration("pre-backup-timeout", 30*time.Second, "备份前/后命令的最长执行时间")
+		preRestore   = flag.String("pre-restore-cmd", "", "还原前执行的命令, 文件路径通过EDR_FILE环境变量传入, 非0退出码否决还原")
+		onNewFile    = flag.String("on-new-file", "", "检测到新增文件时在后台执行的命令, 事件详情通过EDR_EVENT, EDR_FILE, EDR_MESSAGE等环境变量传入")
+		onModified   = flag.String("on-modified", "", "检测到文件被修改时在后台执行的命令, 环境变量同-on-new-file")
+		onDeleted    = flag.String("on-deleted", "", "检测到文件被删除时在后台执行的命令, 环境变量同-on-new-file")
+		onIsolated   = flag.String("on-isolated", "", "文件被移入隔离目录后在后台执行的命令, 隔离后的路径通过EDR_ISOLATED_PATH传入")
+		polyglotExts = flag.String("polyglot-exts", ".jpg,.jpeg,.png,.gif,.bmp,.webp,.ico", "检查文件头和内容的图片扩展名, 嵌入了PHP/JSP代码(图片马)时无论-e如何都会告警polyglot_upload并隔离, 为空表示关闭")
+		nameRules    = flag.String("name-heuristics", "hidden,bidi,homoglyph", "新增文件的文件名启发式规则, 命中时无论-e如何都会告警suspicious_filename并按-policy处理: hidden(点文件), bidi(Unicode方向控制字符), homoglyph(形近字符/零宽字符), 为空表示关闭")
+		dangerExts   = flag.String("dangerous-ext-list", ".php,.php5,.phtml,.asp,.aspx", "危险脚本扩展名, 新增的双扩展名文件(例如: evil.php.jpg)无论-e如何都会告警并隔离")
+		contentFile  = flag.String("content-rules", "", "自定义内容规则文件, 每行: 正则 => 级别[+处理方式] [规则名] (例如: (?i)eval\\s*\\(\\s*\\$_(POST|GET) => critical+isolate), 命中时告警content_rule_match并按处理方式覆盖-policy")
+		sigFile      = flag.String("signatures", "", "自定义webshell特征规则文件, 每行: 语言 规则名 正则 (语言: php/jsp/asp/generic), 追加到内置规则之后")
+		yaraDir      = flag.String("yara", "", "YARA规则目录(.yar/.yara), 新增或被修改的文件逐一匹配, 支持常用语法子集")
+		scoreWeight  = flag.String("score-weights", "", "组合评分各指标分值, 格式: 指标=分值, 逗号分隔, 未指定的使用默认值 (例如: new_file=2,webshell_pattern=8)")
+		scoreLimit   = flag.Int("score-threshold", 10, "组合评分告警阈值, 同一文件命中的指标总分达到时告警combined_indicator, 0表示关闭")
+		maxLineLen   = flag.Int("max-line-length", 1000, "脚本文件单行最大字节数, 新增/修改的文件超过时告警中标记suspicious_long_line, 0表示不检查")
+		sessionDir   = flag.String("session-dir", "", "PHP session目录 (例如: /var/lib/php/sessions), 只告警新建的超大session文件")
+		maxSession   = flag.Int64("max-session-size", 10240, "session文件大小阈值 (bytes)")
+		repl         = flag.Bool("repl", false, "从标准输入读取交互命令 (status, rebuild, rebaseline, pause, resume, suppress, unsuppress, lockout, list-quarantine, restore)")
+		resumeRebase = flag.Bool("resume-rebaseline", true, "恢复检测(SIGUSR2/resume)时按当前内容重建基线, 接受暂停期间的修改; 设为false则恢复后还原这些修改")
+		metricsAddr  = flag.String("metrics", "", "单独监听Prometheus指标接口/metrics的地址 (例如: 0.0.0.0:9100), 控制API上同样提供/metrics")
+		controlAddr  = flag.String("control", "", "本地控制API监听地址 (例如: 127.0.0.1:9090, 只写端口时监听127.0.0.1), 不指定则不启动")
+		controlToken = flag.String("control-token", "", "控制API的令牌, 请求需带 Authorization: Bearer <令牌>, 指定-control时必须设置, @文件 表示从文件读取")
+		lockout      = flag.String("lockout", "", "启动后临时豁免的文件, 格式: 路径=时长, 逗号分隔 (例如: /var/www/html/index.php=10m)")
+		logFile      = flag.String("log-file", "", "同时把日志写入该文件(去掉颜色码), 控制台输出保持不变")
+		logMaxSize   = flag.Int("log-max-size", 50, "日志文件超过该大小(MB)时轮转, 0表示不按大小轮转")
+		logRotate    = flag.Duration("log-rotate-interval", 0, "日志文件按时间轮转的间隔 (例如: 1h), 0表示不按时间轮转")
+		logKeep      = flag.Int("log-keep", 10, "保留的轮转日志文件个数, 0表示全部保留")
+		logFormat    = flag.String("log-format", "text", "日志格式: text(带颜色的可读格式), json(每行一个JSON对象, 告警附带类型、路径、前后元数据和处理动作)")
+		configPath   = flag.String("c", "", "YAML配置文件, 键与参数同名(另支持watch_dir/base_dir/extensions/api), 命令行参数优先")
+		help         = flag.Bool("h", false, "显示帮助信息")
 	)
 
 	flag.Parse()
 
+	var dirConfigs []dirConfig
+	if *configPath != "" {
+		var err error
+		if dirConfigs, err = loadConfigFile(*configPath); err != nil {
+			logError(fmt.Sprintf("读取配置文件失败 %s: %v", *configPath, err))
+			os.Exit(1)
+		}
+		if abs, err := filepath.Abs(*configPath); err == nil {
+			*configPath = abs
+		}
+	}
+
+	if err := applyPresets(parseList(*presetList)); err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+
+	if err := setLogFormat(*logFormat); err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+
+	if *logFile != "" {
+		closer, err := setupLogFile(*logFile, *logMaxSize, *logRotate, *logKeep)
+		if err != nil {
+			logError(err.Error())
+			os.Exit(1)
+		}
+		defer closer.Close()
+	}
+
 	if *help {
 		fmt.Printf("%sEDR 文件完整性监控器 v2.1%s\n", ColorBold, ColorReset)
 		fmt.Println("")
 		fmt.Printf("%s用法:%s\n", ColorYellow, ColorReset)
 		fmt.Println("  ./edr -m /var/www/html -b /tmp/edr_workspace -e .php,.jsp")
 		fmt.Println("  ./edr -m /var/www/html -b /tmp/edr_workspace -e .php -a 192.168.1.100:8080")
+		fmt.Println("  ./edr unisolate [-control 127.0.0.1:9090 -control-token <令牌>] <隔离文件>   # 把误报的隔离文件移回原路径")
+		fmt.Println("  ./edr rollback -b /tmp/edr_workspace/backup_xxx -m /var/www/html   # 按备份快照整体还原监控目录")
+
 		fmt.Println("")
 		fmt.Printf("%s参数:%s\n", ColorYellow, ColorReset)
 		flag.PrintDefaults()
@@ -608,8 +2868,15 @@ func main() {
 		os.Exit(1)
 	}
 
-	if _, err := os.Stat(*monitorDir); os.IsNotExist(err) {
-		logError(fmt.Sprintf("监控目录不存在: %s", *monitorDir))
+	watchDirs := parseList(*monitorDir)
+	for _, dir := range watchDirs {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			logError(fmt.Sprintf("监控目录不存在: %s", dir))
+			os.Exit(1)
+		}
+	}
+	if err := validateRoots(watchDirs); err != nil {
+		logError(err.Error())
 		os.Exit(1)
 	}
 
@@ -618,12 +2885,299 @@ func main() {
 		os.Exit(1)
 	}
 
+	switch *symlinkAct {
+	case "alert", "isolate", "delete":
+	default:
+		logError(fmt.Sprintf("无效的符号链接处理方式: %s", *symlinkAct))
+		os.Exit(1)
+	}
+
+	if *watchMode != "poll" && *watchMode != "inotify" {
+		logError(fmt.Sprintf("无效的监控方式: %s", *watchMode))
+		os.Exit(1)
+	}
+	if *manifestFmt != "json" && *manifestFmt != "jsonl" {
+		logError(fmt.Sprintf("无效的基线清单格式: %s", *manifestFmt))
+		os.Exit(1)
+	}
+
+	if *mtimeRes <= 0 {
+		logError(fmt.Sprintf("无效的修改时间精度: %v", *mtimeRes))
+		os.Exit(1)
+	}
+
+	backupDirMode, err := strconv.ParseUint(*dirMode, 8, 32)
+	if err != nil || backupDirMode > 0777 {
+		logError(fmt.Sprintf("无效的目录权限: %s", *dirMode))
+		os.Exit(1)
+	}
+
+	if err := validateInterval(*interval); err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+
+	dirIntervals, err := parseDirIntervals(*dirInterval)
+	if err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+
+	policies, err := parsePolicies(*policy)
+	if err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+	immutableRules, err := parseImmutableRules(*immutable)
+	if err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+	files, err := absPaths("file", *watchFiles)
+	if err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+	flags, err := absPaths("flag-files", *flagFiles)
+	if err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+	logs, err := absPaths("access-log", *accessLogs)
+	if err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+
+	nameHeuristics, err := parseNameHeuristics(*nameRules)
+	if err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+
+	connWhitelist, err := parseConnWhitelist(parseList(*connAllow))
+	if err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+	blockWhitelist, err := parseIPNets("block-whitelist", parseList(*blockAllow))
+	if err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+	if *blockIP && len(logs) == 0 {
+		logError("-block-ip需要通过-access-log关联上传请求的来源IP")
+		os.Exit(1)
+	}
+
+	if *floodAction != policyIsolate && *floodAction != policyDelete {
+		logError(fmt.Sprintf("无效的-flood-action: %s (可选: isolate, delete)", *floodAction))
+		os.Exit(1)
+	}
+
+	webhookClient, err := newWebhookClient(*whCA, *whInsecure)
+	if err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+	token, err := readSecret(*whToken)
+	if err != nil {
+		logError(fmt.Sprintf("读取webhook令牌失败: %v", err))
+		os.Exit(1)
+	}
+	hmacKey, err := readSecret(*whHMAC)
+	if err != nil {
+		logError(fmt.Sprintf("读取webhook签名密钥失败: %v", err))
+		os.Exit(1)
+	}
+	ctlToken, err := readSecret(*controlToken)
+	if err != nil {
+		logError(fmt.Sprintf("读取控制API令牌失败: %v", err))
+		os.Exit(1)
+	}
+	if *controlAddr != "" && ctlToken == "" {
+		logError("指定-control时必须设置-control-token, 控制API不接受未认证的请求")
+		os.Exit(1)
+	}
+	excludes, err := parseExcludes(*exclude)
+
+	if err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+
+	overrides, err := applyDirConfigs(dirConfigs, dirIntervals)
+	if err != nil {
+		logError(fmt.Sprintf("配置文件无效: %v", err))
+		os.Exit(1)
+	}
+
+	scoreWeights, err := parseScoreWeights(*scoreWeight)
+	if err != nil {
+		logError(fmt.Sprintf("无效的组合评分配置: %v", err))
+		os.Exit(1)
+	}
+
+	signatures, err := newSignatureScanner(*sigFile)
+	if err != nil {
+		logError(err.Error())
+		os.Exit(1)
+	}
+
+	var yaraRules []*yaraRule
+	if *yaraDir != "" {
+		if yaraRules, err = loadYaraRules(*yaraDir); err != nil {
+			logError(fmt.Sprintf("加载YARA规则失败: %v", err))
+			os.Exit(1)
+		}
+	}
+
+	var contentRules []contentRule
+	if *contentFile != "" {
+		if contentRules, err = loadContentRules(*contentFile); err != nil {
+			logError(err.Error())
+			os.Exit(1)
+		}
+	}
+
 	extList := parseExtensions(*extensions)
 	config := MonitorConfig{
-		WatchDir:    *monitorDir,
-		BaseDir:     *baseDir,
-		Extensions:  extList,
-		APIEndpoint: *apiEndpoint,
+		WatchDirs:     watchDirs,
+		BaseDir:       *baseDir,
+		Extensions:    extList,
+		DangerousExts: parseExtensions(*dangerExts),
+		PolyglotExts:  parseExtensions(*polyglotExts),
+
+		NameHeuristics: nameHeuristics,
+
+		MaxLineLength: *maxLineLen,
+		ScoreWeights:  scoreWeights,
+		Signatures:    signatures,
+		YaraRules:     yaraRules,
+		ContentRules:  contentRules,
+
+		ScoreThreshold: *scoreLimit,
+
+		APIEndpoint:    *apiEndpoint,
+		MaxAlertMsgLen: *maxMsgLen,
+		DiffMaxSize:    *diffMaxKB * 1024,
+
+		ObfuscationThreshold: *obfThreshold,
+
+		WebhookURL:         *webhook,
+		WebhookContentType: *webhookType,
+		WebhookGet:         *apiGet,
+		DirAPIs:            overrides.APIs,
+		WebhookClient:      webhookClient,
+		WebhookToken:       token,
+		WebhookHMACKey:     hmacKey,
+		StreamEvents:       *streamEvts,
+		AlertQueueSize:     *queueSize,
+		AlertQueueFile:     *queueFile,
+		AlertWorkers:       *alertWorkers,
+		ScanWorkers:        *scanWorkers,
+
+		SkipEmptyDirs:  *skipEmpty,
+		IsolateNewDirs: *isolateDirs,
+		SymlinkAction:  *symlinkAct,
+		DryRun:         *dryRun,
+		Policies:       policies,
+		KeepEvidence:   *evidence,
+
+		RemoveSpecialFiles: *rmSpecial,
+
+		MtimeResolution: *mtimeRes,
+		InodeCheck:      *inodeCheck,
+		CheckInterval:   *interval,
+		DirIntervals:    overrides.Intervals,
+		DirExtensions:   overrides.Extensions,
+		Excludes:        excludes,
+		DirExcludes:     overrides.Excludes,
+		WatchMode:       *watchMode,
+		BackupProgress:  *progress,
+		Resume:          *resumeBackup,
+		ManifestFormat:  *manifestFmt,
+		LatestSymlink:   *latestLink,
+
+		WatchTemp:        *watchTemp,
+		TempScan:         *tempScan,
+		CronMonitor:      *cronMon,
+		RestoreCron:      *restoreCron,
+		LdMonitor:        *ldMon,
+		RestoreLd:        *restoreLd,
+		ProcNetMonitor:   *procNet,
+		ProcNetKill:      *procNetKill,
+		AccountMonitor:   *accountMon,
+		SuidRoots:        parseList(*suidRoots),
+		StripSuid:        *stripSuid,
+		ProcMonitor:      *procMon,
+		ProcUsers:        parseList(*procUsers),
+		ProcNames:        parseList(*procNames),
+		ProcKill:         *procKill,
+		ConnMonitor:      *connMon,
+		ConnWhitelist:    connWhitelist,
+		MemshellProcs:    parseList(*memshell),
+		TomcatHome:       *tomcatHome,
+		PHPMonitor:       *phpMon,
+		RestorePHPConfig: *restorePHP,
+		LineMonitorFiles: parseList(*lineMon),
+		WatchFiles:       files,
+		FlagFiles:        flags,
+		SessionDir:       *sessionDir,
+		MaxSessionSize:   *maxSession,
+
+		WebserverMonitor:   *webMon,
+		RestoreWebserver:   *restoreWeb,
+		WebserverTestCmd:   *webTestCmd,
+		WebserverReloadCmd: *webReload,
+
+		AccessLogs:      logs,
+		AccessLogWindow: *logWindow,
+
+		BlockIP:        *blockIP,
+		BlockCmd:       *blockCmd,
+		UnblockCmd:     *unblockCmd,
+		BlockDuration:  *blockFor,
+		BlockWhitelist: blockWhitelist,
+
+		EventHooks: eventHooks{
+			NewFile:  *onNewFile,
+			Modified: *onModified,
+			Deleted:  *onDeleted,
+			Isolated: *onIsolated,
+		},
+
+		BackupDirMode:        os.FileMode(backupDirMode),
+		DirPermCheckInterval: *permCheck,
+		SelfCheckInterval:    *selfCheck,
+		ExitOnBinaryTamper:   *exitTamper,
+		StatsInterval:        *statsEvery,
+		DeepScanInterval:     *deepScan,
+		MassDeleteThreshold:  *massDelete,
+		FloodThreshold:       *floodLimit,
+		FloodAction:          *floodAction,
+		IsolateMaxSize:       *isoMaxSize,
+		IsolateMaxAge:        *isoMaxAge,
+
+		SettleTime:   *settleTime,
+		StartupGrace: *grace,
+
+		REPL:               *repl,
+		RebaselineOnResume: *resumeRebase,
+		EventLogKeep:       *eventKeep,
+
+		RestoreNotifyFile:  *notifyFile,
+		PreRestoreCmd:      *preRestore,
+		PreBackupCmd:       *preBackup,
+		PostBackupCmd:      *postBackup,
+		BackupHookTimeout:  *backupHookT,
+		SuppressFile:       *suppressLst,
+		ConfigFile:         *configPath,
+		MaxRestoresPerHour: *maxRestores,
+		FlapThreshold:      *flapLimit,
+		ImmutableRules:     immutableRules,
+
+		AcceptPersistent: *acceptPers,
 	}
 
 	logo := `   ___  _____        __     _______         __          _______  
@@ -638,15 +3192,20 @@ func main() {
 	fmt.Printf("%s========================================%s\n", ColorBlue, ColorReset)
 	fmt.Printf("%s0RAYS EDR 文件完整性监控器%s\n", ColorBold, ColorReset)
 	fmt.Printf("%s========================================%s\n", ColorBlue, ColorReset)
-	logInfo(fmt.Sprintf("监控目录: %s", config.WatchDir))
+	logInfo(fmt.Sprintf("监控目录: %s", strings.Join(config.WatchDirs, ", ")))
 	logInfo(fmt.Sprintf("基础目录: %s", config.BaseDir))
 	if len(extList) > 0 {
 		logInfo(fmt.Sprintf("监控扩展名: %v", extList))
 	} else {
 		logInfo("监控扩展名: 所有文件")
 	}
+	logInfo(fmt.Sprintf("webshell特征规则: %d 条", signatures.count()))
+	if *yaraDir != "" {
+		logInfo(fmt.Sprintf("YARA规则: %d 条 (%s)", len(yaraRules), *yaraDir))
+	}
+
 	if *apiEndpoint != "" {
-		logInfo(fmt.Sprintf("API端点: http://%s", *apiEndpoint))
+		logInfo(fmt.Sprintf("API端点: %s", apiBaseURL(*apiEndpoint)))
 	} else {
 		logInfo("API端点: 未配置")
 	}
@@ -654,6 +3213,32 @@ func main() {
 
 	monitor := NewDirectoryMonitor(config)
 
+	if *lockout != "" {
+		for _, item := range strings.Split(*lockout, ",") {
+			sep := strings.LastIndex(item, "=")
+			if sep <= 0 {
+				logError(fmt.Sprintf("无效的豁免参数: %s", item))
+				os.Exit(1)
+			}
+			duration, err := time.ParseDuration(item[sep+1:])
+			if err != nil || duration <= 0 {
+				logError(fmt.Sprintf("无效的豁免时长: %s", item))
+				os.Exit(1)
+			}
+			if _, err := monitor.lockoutFile(strings.TrimSpace(item[:sep]), duration); err != nil {
+				logError(fmt.Sprintf("豁免文件失败: %v", err))
+				os.Exit(1)
+			}
+		}
+	}
+
+	if *controlAddr != "" {
+		monitor.startControlServer(*controlAddr, ctlToken)
+	}
+	if *metricsAddr != "" {
+		monitor.startMetricsServer(*metricsAddr)
+	}
+
 	if err := monitor.Start(); err != nil {
 		logError(fmt.Sprintf("启动监控失败: %v", err))
 		os.Exit(1)
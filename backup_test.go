@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// BenchmarkBackupFile 对比备份复制文件时使用缓冲区池和每次分配新缓冲区的开销:
+// go test -run '^$' -bench BackupFile -benchmem
+func BenchmarkBackupFile(b *testing.B) {
+	dir := b.TempDir()
+	srcPath := filepath.Join(dir, "index.php")
+	content := bytes.Repeat([]byte("<?php echo 'hello'; ?>\n"), 4096)
+	if err := os.WriteFile(srcPath, content, 0644); err != nil {
+		b.Fatal(err)
+	}
+	dstPath := filepath.Join(dir, "backup.php")
+
+	dm := NewDirectoryMonitor(MonitorConfig{WatchDirs: []string{dir}, BaseDir: dir})
+	defer dm.cancel()
+
+	copyOnce := func(b *testing.B, copy func(dst io.Writer, src io.Reader) (int64, error)) {
+		src, err := os.Open(srcPath)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer src.Close()
+		dst, err := os.Create(dstPath)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer dst.Close()
+
+		// 只暴露Read/Write, 避免os.File的ReadFrom/WriteTo绕过缓冲区
+		if _, err := copy(struct{ io.Writer }{dst}, struct{ io.Reader }{src}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.Run("pool", func(b *testing.B) {
+		b.SetBytes(int64(len(content)))
+		for i := 0; i < b.N; i++ {
+			copyOnce(b, dm.copyFile)
+		}
+	})
+	b.Run("nopool", func(b *testing.B) {
+		b.SetBytes(int64(len(content)))
+		for i := 0; i < b.N; i++ {
+			copyOnce(b, func(dst io.Writer, src io.Reader) (int64, error) {
+				return io.CopyBuffer(dst, src, make([]byte, copyBufSize))
+			})
+		}
+	})
+}
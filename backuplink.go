@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// latestBackupLink 指向最近一次备份目录的符号链接名
+const latestBackupLink = "backup_latest"
+
+// updateLatestBackupLink 原子地把<baseDir>/backup_latest指向本次的备份目录:
+// 先以临时名创建符号链接再rename覆盖, 读取方不会看到链接不存在的中间状态
+func (dm *DirectoryMonitor) updateLatestBackupLink() error {
+	dm.cleanDanglingLinks()
+
+	linkPath := filepath.Join(dm.baseDir, latestBackupLink)
+	tmpPath := fmt.Sprintf("%s.tmp%d", linkPath, os.Getpid())
+	os.Remove(tmpPath)
+
+	// 使用相对路径, 整个基础目录被移动后链接仍然有效
+	if err := os.Symlink(filepath.Base(dm.backupDir), tmpPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, linkPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	logInfo(fmt.Sprintf("已更新最新备份链接: %s -> %s", linkPath, filepath.Base(dm.backupDir)))
+	return nil
+}
+
+// cleanDanglingLinks 删除基础目录下指向已删除备份的backup_*符号链接
+func (dm *DirectoryMonitor) cleanDanglingLinks() {
+	entries, err := os.ReadDir(dm.baseDir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.Type()&os.ModeSymlink == 0 || !strings.HasPrefix(entry.Name(), "backup_") {
+			continue
+		}
+
+		linkPath := filepath.Join(dm.baseDir, entry.Name())
+		if _, err := os.Stat(linkPath); os.IsNotExist(err) {
+			if err := os.Remove(linkPath); err == nil {
+				logInfo(fmt.Sprintf("已删除失效的备份链接: %s", linkPath))
+			}
+		}
+	}
+}
+
+// latestBackupDir 返回基础目录下最近的备份目录, 优先使用backup_latest链接,
+// 不存在时按目录名中的时间戳查找; 指向已删除备份的backup_latest链接会被删除
+func latestBackupDir(baseDir string) (string, error) {
+	linkPath := filepath.Join(baseDir, latestBackupLink)
+	if info, err := os.Stat(linkPath); err == nil && info.IsDir() {
+		target, err := filepath.EvalSymlinks(linkPath)
+		if err == nil {
+			return target, nil
+		}
+	} else if os.IsNotExist(err) {
+		if link, lerr := os.Lstat(linkPath); lerr == nil && link.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(linkPath); err == nil {
+				logInfo(fmt.Sprintf("已删除失效的备份链接: %s", linkPath))
+			}
+		}
+	}
+
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		return "", err
+	}
+
+	var dirs []string
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), "backup_") {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	if len(dirs) == 0 {
+		return "", fmt.Errorf("基础目录下没有备份: %s", baseDir)
+	}
+
+	// backup_20060102_150405格式的目录名按字典序即时间顺序
+	sort.Strings(dirs)
+	return filepath.Join(baseDir, dirs[len(dirs)-1]), nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// diffBlockSize 滚动哈希匹配的块大小
+	diffBlockSize = 32
+	// diffHashBase 多项式滚动哈希的基数
+	diffHashBase = 257
+	// maxBinaryDiffSize 参与二进制比较的文件大小上限
+	maxBinaryDiffSize = 16 * 1024 * 1024
+)
+
+// ByteRange 二进制文件中的一段变化区域, Offset为在新文件中的偏移
+type ByteRange struct {
+	Offset int64
+	Old    []byte
+	New    []byte
+}
+
+// byteRangeView ByteRange的JSON表示, 字节内容以hex编码
+type byteRangeView struct {
+	Offset string `json:"offset"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+// isBinaryContent 含有NUL字节或不是合法UTF-8的内容视为二进制
+func isBinaryContent(data []byte) bool {
+	return bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data)
+}
+
+func commonPrefix(a, b []byte) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+func commonSuffix(a, b []byte) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[len(a)-1-n] == b[len(b)-1-n] {
+		n++
+	}
+	return n
+}
+
+// trimmedRange 去掉两段数据的公共前后缀, 得到精确的变化区域; 完全相同时返回false
+func trimmedRange(offset int64, old, new []byte) (ByteRange, bool) {
+	prefix := commonPrefix(old, new)
+	old, new = old[prefix:], new[prefix:]
+	suffix := commonSuffix(old, new)
+	old, new = old[:len(old)-suffix], new[:len(new)-suffix]
+
+	if len(old) == 0 && len(new) == 0 {
+		return ByteRange{}, false
+	}
+	return ByteRange{Offset: offset + int64(prefix), Old: old, New: new}, true
+}
+
+func rollingHash(data []byte) uint32 {
+	var h uint32
+	for _, b := range data {
+		h = h*diffHashBase + uint32(b)
+	}
+	return h
+}
+
+// binaryDiff 用滚动哈希(类似rsync)找出两段二进制数据之间变化的区域, 时间复杂度O(n)
+func binaryDiff(old, new []byte) []ByteRange {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+
+	// 按块建立旧数据的哈希索引
+	blocks := make(map[uint32][]int)
+	for pos := 0; pos+diffBlockSize <= len(old); pos += diffBlockSize {
+		h := rollingHash(old[pos : pos+diffBlockSize])
+		blocks[h] = append(blocks[h], pos)
+	}
+
+	var pow uint32 = 1
+	for i := 0; i < diffBlockSize-1; i++ {
+		pow *= diffHashBase
+	}
+
+	var ranges []ByteRange
+	addGap := func(oldStart, oldEnd, newStart, newEnd int) {
+		if r, ok := trimmedRange(int64(newStart), old[oldStart:oldEnd], new[newStart:newEnd]); ok {
+			ranges = append(ranges, r)
+		}
+	}
+
+	oldCursor, gapStart := 0, 0
+	i := 0
+	var h uint32
+	if len(new) >= diffBlockSize {
+		h = rollingHash(new[:diffBlockSize])
+	}
+
+	for i+diffBlockSize <= len(new) {
+		matched := -1
+		for _, pos := range blocks[h] {
+			// 只接受位于游标之后的匹配, 保证区域按顺序排列
+			if pos >= oldCursor && bytes.Equal(old[pos:pos+diffBlockSize], new[i:i+diffBlockSize]) {
+				matched = pos
+				break
+			}
+		}
+
+		if matched < 0 {
+			if i+diffBlockSize < len(new) {
+				h = (h-uint32(new[i])*pow)*diffHashBase + uint32(new[i+diffBlockSize])
+			}
+			i++
+			continue
+		}
+
+		addGap(oldCursor, matched, gapStart, i)
+
+		// 尽量向后延伸匹配区域
+		length := diffBlockSize + commonPrefix(old[matched+diffBlockSize:], new[i+diffBlockSize:])
+		oldCursor = matched + length
+		i += length
+		gapStart = i
+		if i+diffBlockSize <= len(new) {
+			h = rollingHash(new[i : i+diffBlockSize])
+		}
+	}
+
+	addGap(oldCursor, len(old), gapStart, len(new))
+	return ranges
+}
+
+// summarizeByteRanges 生成告警中的二进制变化摘要
+func summarizeByteRanges(ranges []ByteRange) string {
+	modified := 0
+	offsets := make([]string, 0, len(ranges))
+	for i, r := range ranges {
+		if len(r.Old) > len(r.New) {
+			modified += len(r.Old)
+		} else {
+			modified += len(r.New)
+		}
+		if i < 5 {
+			offsets = append(offsets, fmt.Sprintf("0x%x", r.Offset))
+		}
+	}
+	if len(ranges) > 5 {
+		offsets = append(offsets, "...")
+	}
+
+	return fmt.Sprintf("[BINARY CHANGES: %d regions, %d bytes modified at offsets %s]",
+		len(ranges), modified, strings.Join(offsets, ", "))
+}
+
+// readForDiff 读取参与比较的文件, 超过大小上限时返回错误
+func readForDiff(filePath string) ([]byte, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxBinaryDiffSize {
+		return nil, fmt.Errorf("文件过大: %d bytes", info.Size())
+	}
+	return os.ReadFile(filePath)
+}
+
+// binaryChangeSummary 对被修改的二进制文件与备份做字节级比较, 文本文件返回空字符串
+func (dm *DirectoryMonitor) binaryChangeSummary(filePath string) string {
+	backupPath, err := dm.backupPathFor(filePath)
+	if err != nil {
+		return ""
+	}
+
+	current, err := readForDiff(filePath)
+	if err != nil {
+		return ""
+	}
+	original, err := readForDiff(backupPath)
+	if err != nil {
+		return ""
+	}
+
+	if !isBinaryContent(current) && !isBinaryContent(original) {
+		return ""
+	}
+	return " " + summarizeByteRanges(binaryDiff(original, current))
+}
+
+// handleQuarantineDiff GET /api/quarantine/{filename}/diff 返回二进制隔离文件相对备份的变化区域
+func (dm *DirectoryMonitor) handleQuarantineDiff(w http.ResponseWriter, name string) {
+	isolatedPath, err := dm.quarantinePath(name)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	meta, err := readIsolateMeta(isolatedPath)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "未找到隔离文件的原始路径")
+		return
+	}
+	backupPath, err := dm.backupPathFor(meta.OriginalPath)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	current, err := readForDiff(isolatedPath)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	original, err := readForDiff(backupPath)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("读取备份失败: %v", err))
+		return
+	}
+
+	if !isBinaryContent(current) && !isBinaryContent(original) {
+		writeJSONError(w, http.StatusBadRequest, "文本文件请使用preview接口")
+		return
+	}
+
+	ranges := binaryDiff(original, current)
+	views := make([]byteRangeView, 0, len(ranges))
+	for _, r := range ranges {
+		views = append(views, byteRangeView{
+			Offset: fmt.Sprintf("0x%x", r.Offset),
+			Old:    hex.EncodeToString(r.Old),
+			New:    hex.EncodeToString(r.New),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"file":    name,
+		"origin":  meta.OriginalPath,
+		"summary": summarizeByteRanges(ranges),
+		"ranges":  views,
+	})
+}
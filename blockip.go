@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// blockHookTimeout 封禁和解封命令的最长执行时间
+	blockHookTimeout = 10 * time.Second
+	// blockCheckInterval 检查封禁是否到期的间隔
+	blockCheckInterval = time.Second
+	// blockMaxIPs 一次上传关联到的来源IP超过该数量时无法确定攻击者, 不封禁
+	blockMaxIPs = 3
+
+	defaultBlockCmd   = `iptables -I INPUT -s "$EDR_BLOCK_IP" -j DROP`
+	defaultUnblockCmd = `iptables -D INPUT -s "$EDR_BLOCK_IP" -j DROP`
+)
+
+// uploadMethods 可以上传文件的请求方法, 只有这些请求的来源IP会被封禁
+var uploadMethods = map[string]bool{"POST": true, "PUT": true, "PATCH": true}
+
+// parseIPNets 解析逗号分隔的IP和CIDR列表, name为出错时提示的参数名
+func parseIPNets(name string, items []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, item := range items {
+		if !strings.Contains(item, "/") {
+			if strings.Contains(item, ":") {
+				item += "/128"
+			} else {
+				item += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的-%s地址: %s", name, item)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// blockCandidates 从关联的访问日志请求中选出上传请求的来源IP, 跳过回环地址和-block-whitelist
+func (dm *DirectoryMonitor) blockCandidates(requests []accessRequest) []string {
+	seen := make(map[string]bool)
+	var ips []string
+	for _, r := range requests {
+		if !uploadMethods[strings.ToUpper(r.Method)] || seen[r.IP] {
+			continue
+		}
+		seen[r.IP] = true
+		ip := net.ParseIP(r.IP)
+		if ip == nil || ip.IsLoopback() || ip.IsUnspecified() || dm.blockWhitelisted(ip) {
+			continue
+		}
+		ips = append(ips, r.IP)
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+func (dm *DirectoryMonitor) blockWhitelisted(ip net.IP) bool {
+	for _, network := range dm.blockWhitelist {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// blockAttackers 确认为webshell的新增文件通过访问日志关联到来源IP时, 执行-block-cmd封禁这些IP
+func (dm *DirectoryMonitor) blockAttackers(filePath string) {
+	if !dm.blockIP {
+		return
+	}
+	// 不受告警附带条数的限制, 扫描器刷日志时上传请求可能不在最近的几十条中
+	ips := dm.blockCandidates(dm.windowRequests())
+	switch {
+	case len(ips) == 0:
+		logWarn(fmt.Sprintf("访问日志中没有关联到可封禁的上传请求来源IP: %s", filePath))
+		return
+	case len(ips) > blockMaxIPs:
+		logWarn(fmt.Sprintf("关联到 %d 个上传请求来源IP, 无法确定攻击者, 不自动封禁: %s (%s)",
+			len(ips), filePath, strings.Join(ips, ", ")))
+		return
+	}
+	for _, ip := range ips {
+		dm.blockAddress(ip, filePath)
+	}
+}
+
+// blockAddress 封禁一个IP并记录到audit.log和事件日志, 已封禁的IP只延长到期时间; dry-run模式下只记录日志
+func (dm *DirectoryMonitor) blockAddress(ip, filePath string) {
+	var expiry time.Time
+	expires := "永久"
+	if dm.blockDuration > 0 {
+		expiry = time.Now().Add(dm.blockDuration)
+		expires = expiry.Format("15:04:05")
+	}
+	if dm.dryRun {
+		logInfo(fmt.Sprintf("[dry-run] 将封禁攻击者IP: %s (上传 %s)", ip, filePath))
+		return
+	}
+
+	dm.blockMu.Lock()
+	defer dm.blockMu.Unlock()
+	if _, ok := dm.blocked[ip]; ok {
+		dm.blocked[ip] = expiry
+		logInfo(fmt.Sprintf("攻击者IP已封禁, 延长到 %s: %s", expires, ip))
+		return
+	}
+
+	stderr, err := runHook(dm.blockCmd, blockHookTimeout, "EDR_BLOCK_IP="+ip, "EDR_FILE="+filePath,
+		fmt.Sprintf("EDR_BLOCK_SECONDS=%d", int(dm.blockDuration.Seconds())))
+	if err != nil {
+		logError(fmt.Sprintf("封禁攻击者IP失败 %s: %v (%s)", ip, err, stderr))
+		return
+	}
+	dm.blocked[ip] = expiry
+	message := fmt.Sprintf("已封禁攻击者IP: %s (上传 %s), 到期: %s", ip, filePath, expires)
+	logSuccess(message)
+	dm.audit("ip_blocked", filePath, fmt.Sprintf("ip=%s expires=%s", ip, expires))
+	dm.recordEvent("warning", "ip_blocked", message)
+}
+
+// expireBlocks 执行-unblock-cmd解除到期的封禁, all为true时解除所有有期限的封禁; 永久封禁不解除
+func (dm *DirectoryMonitor) expireBlocks(all bool) {
+	dm.blockMu.Lock()
+	defer dm.blockMu.Unlock()
+	now := time.Now()
+	for ip, expiry := range dm.blocked {
+		if expiry.IsZero() || (!all && now.Before(expiry)) {
+			continue
+		}
+		if dm.unblockCmd != "" {
+			if stderr, err := runHook(dm.unblockCmd, blockHookTimeout, "EDR_BLOCK_IP="+ip); err != nil {
+				logError(fmt.Sprintf("解除封禁失败 %s: %v (%s)", ip, err, stderr))
+				continue
+			}
+		}
+		delete(dm.blocked, ip)
+		message := fmt.Sprintf("封禁到期, 已解除: %s", ip)
+		logInfo(message)
+		dm.audit("ip_unblocked", "", "ip="+ip)
+		dm.recordEvent("info", "ip_unblocked", message)
+	}
+}
+
+// startIPBlocker 定期解除到期的封禁; 正常退出时解除所有有期限的封禁, 以免EDR停止后封禁永不到期
+func (dm *DirectoryMonitor) startIPBlocker() {
+	duration := "永久"
+	if dm.blockDuration > 0 {
+		duration = dm.blockDuration.String()
+	}
+	logInfo(fmt.Sprintf("攻击者IP自动封禁已启用, 封禁时长: %s, 白名单 %d 项", duration, len(dm.blockWhitelist)))
+
+	dm.wg.Add(1)
+	go func() {
+		defer dm.wg.Done()
+
+		ticker := time.NewTicker(blockCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				dm.expireBlocks(false)
+			case <-dm.ctx.Done():
+				dm.expireBlocks(true)
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configAliases 配置文件中可读性更好的键名, 对应单字母的命令行参数
+var configAliases = map[string]string{
+	"watch_dir":  "m",
+	"base_dir":   "b",
+	"extensions": "e",
+	"api":        "a",
+	"exclude":    "x",
+	"interval":   "i",
+}
+
+// dirConfig 配置文件中按目录的覆盖配置, path为相对监控目录的模式, 与-dir-interval相同
+type dirConfig struct {
+	Path       string   `yaml:"path"`
+	Extensions []string `yaml:"extensions"`
+	Interval   string   `yaml:"interval"`
+	// Exclude 追加的排除规则, 写法与-x相同, 含/的glob相对该目录
+	Exclude []string `yaml:"exclude"`
+	// API 该目录下的告警额外上报的端点, 写法与-a相同
+	API []string `yaml:"api"`
+}
+
+// dirExtensions 按目录模式覆盖的扩展名列表
+type dirExtensions struct {
+	Pattern    string
+	Extensions []string
+}
+
+// dirExcludes 按目录模式追加的排除规则, 规则匹配相对该目录的路径
+type dirExcludes struct {
+	Pattern string
+	Rules   []excludeRule
+}
+
+// dirAPI 按目录模式额外上报告警的URL
+type dirAPI struct {
+	Pattern string
+	URLs    []string
+}
+
+// dirOverrides directories段转换后的按目录覆盖配置
+type dirOverrides struct {
+	Extensions []dirExtensions
+	Intervals  []dirInterval
+	Excludes   []dirExcludes
+	APIs       []dirAPI
+}
+
+// nodeValue 把YAML值转换为命令行参数的字符串形式: 列表用逗号连接, 映射转换为"键=值"列表
+func nodeValue(node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Value, nil
+	case yaml.SequenceNode:
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", fmt.Errorf("第%d行: 列表元素必须是标量", item.Line)
+			}
+			items = append(items, item.Value)
+		}
+		return strings.Join(items, ","), nil
+	case yaml.MappingNode:
+		items := make([]string, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			items = append(items, node.Content[i].Value+"="+node.Content[i+1].Value)
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", fmt.Errorf("第%d行: 不支持的值", node.Line)
+}
+
+// loadConfigFile 读取YAML配置文件: 顶层键与命令行参数同名(去掉前导-, 下划线等同于-),
+// 只填充命令行中没有显式指定的参数; directories段返回给调用方单独处理
+func loadConfigFile(path string) ([]dirConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	var dirs []dirConfig
+	for key, node := range raw {
+		if key == "directories" {
+			if err := node.Decode(&dirs); err != nil {
+				return nil, fmt.Errorf("directories配置无效: %v", err)
+			}
+			continue
+		}
+
+		name, ok := configAliases[key]
+		if !ok {
+			name = strings.ReplaceAll(key, "_", "-")
+		}
+		if name == "c" || flag.Lookup(name) == nil {
+			return nil, fmt.Errorf("未知的配置项: %s", key)
+		}
+		if explicit[name] {
+			continue
+		}
+
+		value, err := nodeValue(&node)
+		if err != nil {
+			return nil, fmt.Errorf("配置项%s: %v", key, err)
+		}
+		if err := flag.Set(name, value); err != nil {
+			return nil, fmt.Errorf("配置项%s的值无效: %v", key, err)
+		}
+	}
+	return dirs, nil
+}
+
+// applyDirConfigs 把directories段转换为按目录的扩展名、检查间隔、排除规则和告警端点;
+// 间隔追加在-dir-interval之后, 命令行指定的规则优先匹配
+func applyDirConfigs(dirs []dirConfig, intervals []dirInterval) (dirOverrides, error) {
+	overrides := dirOverrides{Intervals: intervals}
+	for _, d := range dirs {
+		pattern := strings.Trim(d.Path, "/")
+		if pattern == "" {
+			return dirOverrides{}, fmt.Errorf("directories中的path不能为空")
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return dirOverrides{}, fmt.Errorf("无效的目录模式 %s: %v", pattern, err)
+		}
+
+		if len(d.Extensions) > 0 {
+			overrides.Extensions = append(overrides.Extensions, dirExtensions{
+				Pattern:    pattern,
+				Extensions: parseExtensions(strings.Join(d.Extensions, ",")),
+			})
+		}
+		if d.Interval != "" {
+			interval, err := time.ParseDuration(d.Interval)
+			if err != nil {
+				return dirOverrides{}, fmt.Errorf("目录%s的检查间隔无效: %s", d.Path, d.Interval)
+			}
+			if err := validateInterval(interval); err != nil {
+				return dirOverrides{}, fmt.Errorf("目录%s: %v", d.Path, err)
+			}
+			overrides.Intervals = append(overrides.Intervals, dirInterval{Pattern: pattern, Interval: interval})
+		}
+		if len(d.Exclude) > 0 {
+			rules, err := parseExcludes(strings.Join(d.Exclude, ","))
+			if err != nil {
+				return dirOverrides{}, fmt.Errorf("目录%s: %v", d.Path, err)
+			}
+			overrides.Excludes = append(overrides.Excludes, dirExcludes{Pattern: pattern, Rules: rules})
+		}
+		if len(d.API) > 0 {
+			api := dirAPI{Pattern: pattern}
+			for _, endpoint := range d.API {
+				api.URLs = append(api.URLs, apiBaseURL(endpoint)+"/api/agent/edr-alert")
+			}
+			overrides.APIs = append(overrides.APIs, api)
+		}
+	}
+	return overrides, nil
+}
+
+// extensionsFor 返回目录适用的扩展名列表: 第一条匹配的目录配置, 没有匹配时使用-e
+func (dm *DirectoryMonitor) extensionsFor(dirPath string) []string {
+	_, relDir, err := dm.relToRoot(dirPath)
+	if err != nil {
+		return dm.extensions
+	}
+
+	for _, rule := range dm.dirExtensions {
+		if matchDirPattern(rule.Pattern, relDir) {
+			return rule.Extensions
+		}
+	}
+	return dm.extensions
+}
+
+// dirAlertURLs 返回路径所在目录的directories配置中额外的告警上报URL, 第一条匹配的规则生效
+func (dm *DirectoryMonitor) dirAlertURLs(path string) []string {
+	if len(dm.dirAPIs) == 0 || path == "" {
+		return nil
+	}
+	_, rel, err := dm.relToRoot(path)
+	if err != nil {
+		return nil
+	}
+
+	for _, api := range dm.dirAPIs {
+		if matchDirPattern(api.Pattern, rel) {
+			return api.URLs
+		}
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// connScanInterval 外连检查间隔, 反弹shell连接建立后往往立即开始交互, 间隔不宜过长
+const connScanInterval = 2 * time.Second
+
+// tcpOutboundStates /proc/net/tcp中已建立(01)和正在发起(SYN_SENT, 02)的连接
+var tcpOutboundStates = map[string]string{"01": "ESTABLISHED", "02": "SYN_SENT"}
+
+// tcpConn /proc/net/tcp中的一条连接
+type tcpConn struct {
+	Proto      string
+	LocalAddr  string
+	LocalPort  int
+	RemoteAddr string
+	RemotePort int
+	State      string
+	Uid        string
+	Inode      string
+}
+
+func (c tcpConn) key() string {
+	return fmt.Sprintf("%s %s:%d->%s:%d", c.Proto, c.LocalAddr, c.LocalPort, c.RemoteAddr, c.RemotePort)
+}
+
+// connRule -conn-whitelist中的一项, network为nil时匹配任意地址, port为0时匹配任意端口
+type connRule struct {
+	network *net.IPNet
+	port    int
+}
+
+func (r connRule) match(ip net.IP, port int) bool {
+	return (r.network == nil || r.network.Contains(ip)) && (r.port == 0 || r.port == port)
+}
+
+// parseConnWhitelist 解析-conn-whitelist: 每项可以是IP, CIDR, ":端口", "IP:端口"或"CIDR:端口",
+// IPv6地址带端口时写为[::1]:80
+func parseConnWhitelist(items []string) ([]connRule, error) {
+	var rules []connRule
+	for _, item := range items {
+		host, portStr := item, ""
+		if strings.HasPrefix(item, ":") {
+			host, portStr = "", item[1:]
+		} else if h, p, err := net.SplitHostPort(item); err == nil {
+			host, portStr = h, p
+		}
+
+		var rule connRule
+		if portStr != "" {
+			port, err := strconv.Atoi(portStr)
+			if err != nil || port <= 0 || port > 65535 {
+				return nil, fmt.Errorf("无效的-conn-whitelist端口: %s", item)
+			}
+			rule.port = port
+		}
+		if host != "" {
+			if !strings.Contains(host, "/") {
+				if strings.Contains(host, ":") {
+					host += "/128"
+				} else {
+					host += "/32"
+				}
+			}
+			_, network, err := net.ParseCIDR(host)
+			if err != nil {
+				return nil, fmt.Errorf("无效的-conn-whitelist地址: %s", item)
+			}
+			rule.network = network
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// readTCPConns 读取/proc/net/tcp格式的文件, 返回已建立和正在发起的连接以及所有处于LISTEN状态的本地端口
+func readTCPConns(path, proto string) ([]tcpConn, map[int]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var conns []tcpConn
+	listening := make(map[int]bool)
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // 跳过表头
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		localAddr, localPort, err := parseProcNetAddr(fields[1])
+		if err != nil {
+			continue
+		}
+		if fields[3] == tcpListenState {
+			listening[localPort] = true
+			continue
+		}
+		state, ok := tcpOutboundStates[fields[3]]
+		if !ok {
+			continue
+		}
+		remoteAddr, remotePort, err := parseProcNetAddr(fields[2])
+		if err != nil {
+			continue
+		}
+		conns = append(conns, tcpConn{
+			Proto: proto, LocalAddr: localAddr, LocalPort: localPort,
+			RemoteAddr: remoteAddr, RemotePort: remotePort,
+			State: state, Uid: fields[7], Inode: fields[9],
+		})
+	}
+	return conns, listening, scanner.Err()
+}
+
+// currentOutboundConns 汇总tcp和tcp6中由本机发起的连接: 本地端口正在监听的是外部连入的连接, 不计入
+func currentOutboundConns() (map[string]tcpConn, error) {
+	var all []tcpConn
+	listening := make(map[int]bool)
+	for _, source := range []struct{ path, proto string }{
+		{"/proc/net/tcp", "tcp"},
+		{"/proc/net/tcp6", "tcp6"},
+	} {
+		conns, ports, err := readTCPConns(source.path, source.proto)
+		if err != nil {
+			if source.proto == "tcp6" && os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		all = append(all, conns...)
+		for port := range ports {
+			listening[port] = true
+		}
+	}
+
+	outbound := make(map[string]tcpConn)
+	for _, c := range all {
+		if !listening[c.LocalPort] {
+			outbound[c.key()] = c
+		}
+	}
+	return outbound, nil
+}
+
+// socketOwners 遍历/proc/<pid>/fd, 返回socket inode到所属进程的映射
+func socketOwners(inodes map[string]bool) map[string]int {
+	owners := make(map[string]int)
+	pids, err := listPids()
+	if err != nil {
+		return owners
+	}
+	for _, pid := range pids {
+		fdDir := fmt.Sprintf("/proc/%d/fd", pid)
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+			if inodes[inode] {
+				owners[inode] = pid
+			}
+		}
+		if len(owners) == len(inodes) {
+			break
+		}
+	}
+	return owners
+}
+
+// connWhitelisted 回环地址和-conn-whitelist中的地址不告警
+func (dm *DirectoryMonitor) connWhitelisted(c tcpConn) bool {
+	ip := net.ParseIP(c.RemoteAddr)
+	if ip == nil || ip.IsLoopback() || ip.IsUnspecified() {
+		return true
+	}
+	// IPv4映射的IPv6地址(::ffff:1.2.3.4)按IPv4匹配
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	for _, rule := range dm.connWhitelist {
+		if rule.match(ip, c.RemotePort) {
+			return true
+		}
+	}
+	return false
+}
+
+// startConnMonitor 以启动时的外连为基线, 之后Web服务用户(-proc-users)新发起的、目的地址不在白名单中的
+// TCP连接告警outbound_connection, 消息中给出所属进程的pid和可执行文件路径
+func (dm *DirectoryMonitor) startConnMonitor() {
+	baseline, err := currentOutboundConns()
+	if err != nil {
+		logWarn(fmt.Sprintf("读取/proc/net/tcp失败, 跳过外连监控: %v", err))
+		return
+	}
+	uids := resolveUids(dm.procUsers)
+	if len(uids) == 0 {
+		logWarn(fmt.Sprintf("-proc-users中的用户都不存在, 跳过外连监控: %s", strings.Join(dm.procUsers, ", ")))
+		return
+	}
+
+	users := make([]string, 0, len(uids))
+	for uid, user := range uids {
+		users = append(users, fmt.Sprintf("%s(%s)", user, uid))
+	}
+	sort.Strings(users)
+	logInfo(fmt.Sprintf("外连监控已启动, 用户: %s, 当前 %d 个外连, 白名单 %d 项, 检查间隔: %v",
+		strings.Join(users, ", "), len(baseline), len(dm.connWhitelist), connScanInterval))
+
+	// alerted 已告警且仍存在的连接, SYN_SENT变为ESTABLISHED时不重复告警
+	alerted := make(map[string]bool)
+
+	dm.runPeriodic(connScanInterval, func() {
+		current, err := currentOutboundConns()
+		if err != nil {
+			logError(fmt.Sprintf("读取/proc/net/tcp失败: %v", err))
+			return
+		}
+
+		for key := range alerted {
+			if _, ok := current[key]; !ok {
+				delete(alerted, key)
+			}
+		}
+
+		var found []tcpConn
+		inodes := make(map[string]bool)
+		for key, c := range current {
+			if _, ok := baseline[key]; ok || alerted[key] {
+				continue
+			}
+			if _, ok := uids[c.Uid]; !ok || dm.connWhitelisted(c) {
+				continue
+			}
+			alerted[key] = true
+			found = append(found, c)
+			inodes[c.Inode] = true
+		}
+		if len(found) == 0 {
+			return
+		}
+
+		owners := socketOwners(inodes)
+		for _, c := range found {
+			owner := "未知(进程已退出或无权限读取)"
+			if pid, ok := owners[c.Inode]; ok {
+				exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+				if err != nil {
+					exe = "未知"
+				}
+				owner = fmt.Sprintf("pid=%d %s, 命令行: %s", pid, exe, procCmdline(pid))
+			}
+			dm.alert("critical", "outbound_connection",
+				fmt.Sprintf("检测到Web服务用户%s发起外连: %s:%d -> %s:%d (%s %s)，可能是反弹shell, 进程: %s",
+					uids[c.Uid], c.LocalAddr, c.LocalPort, c.RemoteAddr, c.RemotePort, c.Proto, c.State, owner))
+		}
+	})
+}
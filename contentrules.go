@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// contentRule 一条自定义内容规则: 命中时按级别告警, action非空时覆盖文件的处理策略
+type contentRule struct {
+	name    string
+	pattern *regexp.Regexp
+	level   string
+	action  string
+}
+
+// loadContentRules 读取-content-rules规则文件, 每行"正则 => 级别[+处理方式] [规则名]", 例如:
+//
+//	(?i)eval\s*\(\s*\$_(POST|GET) => critical+isolate php_eval
+//
+// 级别为warning/critical, 处理方式为alert/restore/isolate/delete; 没有规则名时使用行号; #开头为注释
+func loadContentRules(path string) ([]contentRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开内容规则文件失败: %v", err)
+	}
+	defer f.Close()
+
+	var rules []contentRule
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// 正则中可能含有=>, 以最后一个为准
+		sep := strings.LastIndex(line, "=>")
+		if sep <= 0 {
+			return nil, fmt.Errorf("内容规则第%d行格式错误, 应为: 正则 => 级别[+处理方式] [规则名]", lineNo)
+		}
+		re, err := regexp.Compile(strings.TrimSpace(line[:sep]))
+		if err != nil {
+			return nil, fmt.Errorf("内容规则第%d行正则无效: %v", lineNo, err)
+		}
+
+		fields := strings.Fields(line[sep+2:])
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("内容规则第%d行格式错误, 应为: 正则 => 级别[+处理方式] [规则名]", lineNo)
+		}
+		rule := contentRule{name: fmt.Sprintf("line%d", lineNo), pattern: re}
+		if len(fields) == 2 {
+			rule.name = fields[1]
+		}
+
+		level, action, _ := strings.Cut(fields[0], "+")
+		switch level {
+		case "warning", "critical":
+		default:
+			return nil, fmt.Errorf("内容规则第%d行级别无效: %s (可选: warning, critical)", lineNo, level)
+		}
+		switch action {
+		case "", policyAlert, policyRestore, policyIsolate, policyDelete:
+		default:
+			return nil, fmt.Errorf("内容规则第%d行处理方式无效: %s (可选: alert, restore, isolate, delete)", lineNo, action)
+		}
+		rule.level, rule.action = level, action
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// checkContentRules 用自定义内容规则检查新增/被修改的文件, 所有命中的规则合并为一条content_rule_match告警,
+// 级别取最高的一条. 返回命中的规则和第一条指定了处理方式的规则的处理方式
+func (dm *DirectoryMonitor) checkContentRules(filePath string) ([]string, string) {
+	if len(dm.contentRules) == 0 {
+		return nil, ""
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, ""
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, scanLimit))
+	if err != nil {
+		return nil, ""
+	}
+
+	var matched, names []string
+	level, action := "warning", ""
+	for _, rule := range dm.contentRules {
+		if !rule.pattern.Match(data) {
+			continue
+		}
+		names = append(names, rule.name)
+		matched = append(matched, "content:"+rule.name)
+		if rule.level == "critical" {
+			level = "critical"
+		}
+		if action == "" {
+			action = rule.action
+		}
+	}
+	if len(matched) == 0 {
+		return nil, ""
+	}
+
+	detail := alertDetail{Path: filePath}
+	if action != policyAlert {
+		detail.Action = action
+	}
+	dm.alertFile(level, "content_rule_match",
+		fmt.Sprintf("命中自定义内容规则: %s (规则: %s)", filePath, strings.Join(names, ", ")), detail)
+	return matched, action
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// controlListenAddr 只给出端口(9090或:9090)时默认只监听127.0.0.1, 避免控制API暴露给其他队伍
+func controlListenAddr(addr string) string {
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+	if strings.HasPrefix(addr, ":") {
+		return "127.0.0.1" + addr
+	}
+	return addr
+}
+
+// controlAuth 所有控制API都需要Bearer令牌; 浏览器查看隔离文件时也可以用token查询参数
+func controlAuth(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given := r.URL.Query().Get("token")
+		if given == "" {
+			given = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		}
+		if !hmac.Equal([]byte(given), []byte(token)) {
+			writeJSONError(w, http.StatusUnauthorized, "需要令牌")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// startControlServer 启动本地控制API, 供运维人员在比赛中临时调整监控行为; 每个请求都要带上token
+func (dm *DirectoryMonitor) startControlServer(addr, token string) {
+	addr = controlListenAddr(addr)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", dm.handleStatus)
+	mux.HandleFunc("/api/status", dm.handleStatus)
+	mux.HandleFunc("/events", dm.handleEvents)
+	mux.HandleFunc("/api/pause", dm.handlePause)
+	mux.HandleFunc("/api/resume", dm.handleResume)
+	mux.HandleFunc("/api/lockout", dm.handleLockout)
+	mux.HandleFunc("/api/events", dm.handleEvents)
+	mux.HandleFunc("/api/rebaseline", dm.handleRebaseline)
+	mux.HandleFunc("/api/unisolate", dm.handleUnisolate)
+	mux.HandleFunc("/metrics", dm.handleMetrics)
+	mux.HandleFunc("/api/quarantine", dm.handleQuarantineAPI)
+	mux.HandleFunc("/api/quarantine/", dm.handleQuarantineAPI)
+	mux.HandleFunc("/quarantine/", dm.handleQuarantinePage)
+
+	go func() {
+		logInfo(fmt.Sprintf("控制API已启动: http://%s", addr))
+		if err := http.ListenAndServe(addr, controlAuth(token, mux)); err != nil {
+			logError(fmt.Sprintf("控制API启动失败: %v", err))
+		}
+	}()
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{
+		"status":  "error",
+		"message": message,
+	})
+}
+
+// handleLockout POST /api/lockout?path=<path>&duration=30s 临时豁免文件, GET 列出当前豁免
+func (dm *DirectoryMonitor) handleLockout(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, dm.listLockouts())
+	case http.MethodPost:
+		duration, err := time.ParseDuration(r.URL.Query().Get("duration"))
+		if err != nil || duration <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "无效的duration参数")
+			return
+		}
+
+		filePath, err := dm.lockoutFile(r.URL.Query().Get("path"), duration)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]string{
+			"status": "success",
+			"path":   filePath,
+			"until":  time.Now().Add(duration).Format(time.RFC3339),
+		})
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+// handleRebaseline POST /api/rebaseline?path=<path>&path=<path> 按当前内容更新指定路径的基线,
+// 不带path时重建整棵目录树
+func (dm *DirectoryMonitor) handleRebaseline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	count, err := dm.rebaseline(r.URL.Query()["path"])
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status": "success",
+		"files":  count,
+	})
+}
+
+// handleStatus GET /status 运行状态: 基线规模, 监控目录, 计数和最近10条告警
+func (dm *DirectoryMonitor) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	dm.mu.RLock()
+	files := len(dm.baseline)
+	dm.mu.RUnlock()
+
+	state := "running"
+	if dm.paused.Load() {
+		state = "paused"
+	}
+	status := map[string]interface{}{
+		"status":         state,
+		"uptime_seconds": int64(time.Since(dm.startTime).Seconds()),
+		"watch_dirs":     dm.rootDirs(),
+		"backup_dir":     dm.backupDir,
+		"isolate_dir":    dm.isolateDir,
+		"baseline_files": files,
+		"directories":    len(dm.directoryList()),
+		"checks":         dm.stats.checks.Load(),
+		"alerts":         dm.stats.alerts.Load(),
+		"restores":       dm.stats.restores.Load(),
+		"isolations":     dm.stats.isolations.Load(),
+		"lockouts":       len(dm.listLockouts()),
+	}
+	if dm.alertQueue != nil {
+		status["alert_queue"] = dm.alertQueue.len()
+	}
+	if dm.events != nil {
+		if events, err := dm.events.Recent(10); err == nil {
+			status["recent_events"] = events
+		}
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handlePause POST /api/pause 暂停检测, 与SIGUSR1相同
+func (dm *DirectoryMonitor) handlePause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	changed := dm.pause()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "changed": changed})
+}
+
+// handleResume POST /api/resume?rebaseline=true|false 恢复检测, 默认按-resume-rebaseline决定是否重建基线
+func (dm *DirectoryMonitor) handleResume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	rebaseline := dm.rebaselineOnResume
+	if value := r.URL.Query().Get("rebaseline"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "无效的rebaseline参数")
+			return
+		}
+		rebaseline = parsed
+	}
+
+	changed, err := dm.resume(rebaseline)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "changed": changed})
+}
+
+// handleEvents GET /api/events?limit=100 返回最近的告警事件
+func (dm *DirectoryMonitor) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if dm.events == nil {
+		writeJSONError(w, http.StatusNotFound, "事件日志未启用")
+		return
+	}
+
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "无效的limit参数")
+			return
+		}
+		limit = parsed
+	}
+
+	events, err := dm.events.Recent(limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, events)
+}
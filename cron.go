@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	// systemCrontab 系统crontab
+	systemCrontab = "/etc/crontab"
+	// cronDir 系统级cron配置目录
+	cronDir = "/etc/cron.d"
+	// userCrontabDir 各用户crontab所在目录, 通常只有root可读
+	userCrontabDir = "/var/spool/cron/crontabs"
+	// rhelCrontabDir RHEL/CentOS上各用户crontab直接位于/var/spool/cron
+	rhelCrontabDir = "/var/spool/cron"
+)
+
+// cronPeriodicDirs run-parts按周期执行的脚本目录
+var cronPeriodicDirs = []string{"/etc/cron.hourly", "/etc/cron.daily", "/etc/cron.weekly", "/etc/cron.monthly"}
+
+// systemdUnitDirs 管理员和用户级systemd unit目录, 新建.timer/.service是crontab之外常见的持久化方式
+var systemdUnitDirs = []string{"/etc/systemd/system", "/etc/systemd/user"}
+
+// startCronMonitor 监控计划任务: /etc/crontab, /etc/cron.d和cron.hourly等目录中的文件, 各用户的crontab,
+// 以及systemd定时器/服务unit文件; 比赛中新建的用户产生的crontab同样会被发现.
+// 变化时逐行告警增删的任务, restoreCron为true时复原被修改的文件并隔离新增的文件
+func (dm *DirectoryMonitor) startCronMonitor() {
+	inspect := func(filePath string, before, after []byte) {
+		dm.alertLineChanges(filePath, before, after)
+	}
+
+	system := newSnapshotGroup("cron配置", "cron_modified", "critical", dm.restoreCron)
+	system.inspect = inspect
+	system.watchFile(dm, systemCrontab, "new_cron_file")
+	system.watchDir(dm, cronDir, "new_cron_file")
+	for _, dir := range cronPeriodicDirs {
+		system.watchDir(dm, dir, "new_cron_file")
+	}
+
+	users := newSnapshotGroup("用户crontab", "user_crontab_modified", "critical", dm.restoreCron)
+	users.inspect = inspect
+	users.watchDir(dm, userCrontabDir, "new_user_crontab")
+	users.watchDir(dm, rhelCrontabDir, "new_user_crontab")
+
+	units := newSnapshotGroup("systemd unit文件", "systemd_unit_modified", "critical", dm.restoreCron)
+	units.inspect = inspect
+	for _, dir := range systemdUnitDirs {
+		units.watchDir(dm, dir, "new_systemd_unit")
+	}
+
+	for _, dir := range []string{cronDir, userCrontabDir} {
+		if _, err := os.Stat(dir); err != nil && !os.IsPermission(err) {
+			logWarn(fmt.Sprintf("cron目录不可用, 出现后开始监控: %s", dir))
+		}
+	}
+	mode := "只告警"
+	if dm.restoreCron {
+		mode = "告警并复原"
+	}
+	logInfo(fmt.Sprintf("计划任务监控已启动(%s), 当前共 %d 个cron文件, %d 个systemd unit文件",
+		mode, len(system.paths())+len(users.paths()), len(units.paths())))
+
+	dm.runPeriodic(snapshotCheckInterval, func() {
+		dm.checkSnapshotGroup(system)
+		dm.checkSnapshotGroup(users)
+		dm.checkSnapshotGroup(units)
+	})
+}
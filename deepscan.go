@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// deepScan 周期性重新计算所有基线文件的哈希, 不依赖大小、修改时间和ctime:
+// touch -r伪造修改时间并填充到相同大小, 再配合修改系统时间等手段让ctime也不变时, 只有哈希能发现篡改.
+// 哈希不一致的文件交给所在目录的下一次检查, 按内容篡改告警和处理
+func (dm *DirectoryMonitor) deepScan() {
+	if dm.paused.Load() {
+		return
+	}
+	start := time.Now()
+
+	dm.mu.RLock()
+	hashes := make(map[string]string, len(dm.baseline))
+	for filePath, info := range dm.baseline {
+		if info.Hash != "" {
+			hashes[filePath] = info.Hash
+		}
+	}
+	dm.mu.RUnlock()
+
+	mismatched := 0
+	for filePath, expected := range hashes {
+		if dm.stopping() || dm.paused.Load() {
+			return
+		}
+		if dm.isLockedOut(filePath) || dm.isSuppressed(filePath) {
+			continue
+		}
+
+		// 文件已被删除时由目录检查处理
+		hash, err := hashFile(filePath)
+		if err != nil || hash == expected {
+			continue
+		}
+		// 扫描期间基线可能已被还原或重建更新
+		dm.mu.RLock()
+		current, ok := dm.baseline[filePath]
+		dm.mu.RUnlock()
+		if !ok || current.Hash != expected {
+			continue
+		}
+
+		mismatched++
+		dm.deepMu.Lock()
+		dm.deepScanHits[filePath] = true
+		dm.deepMu.Unlock()
+		dm.scheduler.wake(filepath.Dir(filePath))
+	}
+
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if mismatched > 0 {
+		logWarn(fmt.Sprintf("深度扫描完成: %d 个文件, 耗时 %v, 发现 %d 个文件哈希与基线不一致", len(hashes), elapsed, mismatched))
+	} else {
+		logDebug(fmt.Sprintf("深度扫描完成: %d 个文件, 耗时 %v", len(hashes), elapsed))
+	}
+}
+
+// takeDeepScanHit 返回深度扫描是否发现该文件哈希不一致, 并清除标记
+func (dm *DirectoryMonitor) takeDeepScanHit(filePath string) bool {
+	dm.deepMu.Lock()
+	defer dm.deepMu.Unlock()
+
+	if !dm.deepScanHits[filePath] {
+		return false
+	}
+	delete(dm.deepScanHits, filePath)
+	return true
+}
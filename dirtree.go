@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DirInfo 目录基线: 权限和所有者, 用于rm -rf之后重建目录树
+type DirInfo struct {
+	Mode os.FileMode
+	Uid  uint32
+	Gid  uint32
+}
+
+// dirInfoOf 从stat结果中提取目录基线, 保留setgid/sticky等特殊位
+func dirInfoOf(info os.FileInfo) DirInfo {
+	d := DirInfo{Mode: info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)}
+	d.Uid, d.Gid = ownerIDs(info)
+	return d
+}
+
+func (dm *DirectoryMonitor) recordDirInfo(dir string) {
+	info, err := os.Lstat(dir)
+	if err != nil || !info.IsDir() {
+		return
+	}
+
+	dm.dirMu.Lock()
+	dm.dirBaseline[dir] = dirInfoOf(info)
+	dm.dirMu.Unlock()
+	dm.markManifestDirty()
+}
+
+func (dm *DirectoryMonitor) forgetDirectory(dir string) {
+	dm.dirMu.Lock()
+	defer dm.dirMu.Unlock()
+
+	delete(dm.knownDirs, dir)
+	for i, d := range dm.directories {
+		if d == dir {
+			dm.directories = append(dm.directories[:i], dm.directories[i+1:]...)
+			break
+		}
+	}
+	dm.unwatchDirEvents(dir)
+}
+
+// withinDir 判断path是否为root本身或root下的路径
+func withinDir(path, root string) bool {
+	return path == root || strings.HasPrefix(path, root+string(filepath.Separator))
+}
+
+// handleMissingDirectory 处理监控中的目录消失: 基线中的目录重建整棵目录树,
+// 运行期间新建的目录不在基线中, 停止监控, 重新创建时再次按新增目录告警
+func (dm *DirectoryMonitor) handleMissingDirectory(dirPath string) {
+	dm.dirMu.Lock()
+	_, inBaseline := dm.dirBaseline[dirPath]
+	dm.dirMu.Unlock()
+
+	if !inBaseline {
+		logInfo(fmt.Sprintf("新增目录已被删除, 停止监控: %s", dirPath))
+		dm.forgetDirectory(dirPath)
+		return
+	}
+	if dm.dryRun {
+		dm.dryRunMissingDirectory(dirPath)
+		return
+	}
+
+	// 从最上层缺失的目录开始重建, 子目录的监控goroutine会同时发现缺失, 只需重建一次
+	top := dm.rootFor(dirPath)
+	if top == nil {
+		return
+	}
+	root := dirPath
+	for root != top.dir {
+		if _, err := os.Stat(filepath.Dir(root)); err == nil {
+			break
+		}
+		root = filepath.Dir(root)
+	}
+
+	if err := dm.restoreTree(root); err != nil {
+		logError(fmt.Sprintf("重建目录树失败 %s: %v", root, err))
+	}
+}
+
+// recreateDirs 按目录基线创建目录并恢复权限和所有者, dirs须已排序(父目录在前); 已存在的目录同样恢复属性
+func (dm *DirectoryMonitor) recreateDirs(dirs []string) error {
+	for _, dir := range dirs {
+		dm.dirMu.Lock()
+		info := dm.dirBaseline[dir]
+		dm.dirMu.Unlock()
+
+		if err := os.Mkdir(dir, info.Mode.Perm()); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("创建目录失败: %v", err)
+		}
+		// Mkdir受umask影响且不设置特殊位, 显式设置一次
+		if err := os.Chmod(dir, info.Mode); err != nil {
+			return fmt.Errorf("设置目录权限失败: %v", err)
+		}
+		if err := setOwner(dir, info.Uid, info.Gid, ""); err != nil {
+			logDebug(fmt.Sprintf("设置目录所有者失败 %s: %v", dir, err))
+		}
+	}
+	return nil
+}
+
+// restoreTree 按目录基线重建root下的目录层级(权限和所有者), 再从备份还原其中的所有文件
+func (dm *DirectoryMonitor) restoreTree(root string) error {
+	dm.treeMu.Lock()
+	defer dm.treeMu.Unlock()
+
+	if _, err := os.Stat(root); err == nil {
+		return nil
+	}
+
+	dm.dirMu.Lock()
+	var dirs []string
+	for dir := range dm.dirBaseline {
+		if withinDir(dir, root) {
+			dirs = append(dirs, dir)
+		}
+	}
+	dm.dirMu.Unlock()
+	// 按路径排序保证父目录先于子目录创建
+	sort.Strings(dirs)
+
+	dm.alert("critical", "directory_deleted",
+		fmt.Sprintf("检测到目录被删除: %s (包含 %d 个目录)，按备份重建目录树", root, len(dirs)))
+	dm.stats.countChange(changeDeleted)
+
+	if err := dm.recreateDirs(dirs); err != nil {
+		return err
+	}
+
+	dm.mu.RLock()
+	var files []string
+	for filePath := range dm.baseline {
+		if withinDir(filePath, root) {
+			files = append(files, filePath)
+		}
+	}
+	dm.mu.RUnlock()
+
+	restored := 0
+	for _, filePath := range files {
+		if err := dm.restoreFile(filePath); err != nil {
+			logError(fmt.Sprintf("还原文件失败 %s: %v", filePath, err))
+			continue
+		}
+		restored++
+	}
+
+	logSuccess(fmt.Sprintf("目录树已重建: %s (%d 个目录, %d/%d 个文件)", root, len(dirs), restored, len(files)))
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// actionDryRun -dry-run模式下告警中的处理方式前缀, 例如dry_run:isolate表示本应隔离
+const actionDryRun = "dry_run:"
+
+// acceptDryRun -dry-run模式下代替隔离、还原和删除: 记录本应执行的处理方式, 并把文件当前状态记入基线
+func (dm *DirectoryMonitor) acceptDryRun(filePath, policy string) {
+	logInfo(fmt.Sprintf("[DRY-RUN] 未执行处理(%s): %s", policy, filePath))
+	dm.acceptChange(filePath)
+}
+
+// dryRunMissingDirectory -dry-run模式下目录被删除时不重建, 停止监控该目录并移除其中文件的基线;
+// 目录重新出现时按新增目录告警
+func (dm *DirectoryMonitor) dryRunMissingDirectory(dirPath string) {
+	dm.alert("critical", "directory_deleted", fmt.Sprintf("检测到目录被删除: %s (dry-run, 未重建)", dirPath))
+	dm.stats.countChange(changeDeleted)
+	dm.forgetDirectory(dirPath)
+
+	dm.mu.Lock()
+	for filePath := range dm.baseline {
+		if filepath.Dir(filePath) == dirPath {
+			delete(dm.baseline, filePath)
+		}
+	}
+	dm.mu.Unlock()
+	dm.markManifestDirty()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// eventHookTimeout 事件钩子命令的最长执行时间
+	eventHookTimeout = 30 * time.Second
+	// eventHookConcurrency 同时执行的事件钩子数量上限, 超过时排队
+	eventHookConcurrency = 4
+)
+
+// eventHooks 检测到文件事件时执行的用户命令(-on-new-file等), 为空表示不执行
+type eventHooks struct {
+	NewFile  string
+	Modified string
+	Deleted  string
+	Isolated string
+}
+
+// hookFor 按告警附带的元数据判断文件事件类型: 只有新元数据为新增, 只有旧元数据为删除, 都有为修改
+func (h eventHooks) hookFor(detail alertDetail) (string, string) {
+	switch {
+	case detail.Path == "":
+		return "", ""
+	case detail.New != nil && detail.Old == nil:
+		return "on_new_file", h.NewFile
+	case detail.New != nil:
+		return "on_modified", h.Modified
+	case detail.Old != nil:
+		return "on_deleted", h.Deleted
+	}
+	return "", ""
+}
+
+// fileMetaEnv 把文件元数据转换为钩子的环境变量, prefix为EDR_OLD_或EDR_NEW_
+func fileMetaEnv(prefix string, info *FileInfo) []string {
+	if info == nil {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("%sSIZE=%d", prefix, info.Size),
+		fmt.Sprintf("%sMODE=%04o", prefix, info.Mode.Perm()),
+		fmt.Sprintf("%sUID=%d", prefix, info.Uid),
+		fmt.Sprintf("%sINODE=%d", prefix, info.Inode),
+		prefix + "HASH=" + info.Hash,
+	}
+}
+
+// runAlertHook 文件告警发出后执行对应的-on-new-file/-on-modified/-on-deleted命令, 告警详情通过环境变量传入
+func (dm *DirectoryMonitor) runAlertHook(level, event, message string, detail alertDetail) {
+	name, command := dm.eventHooks.hookFor(detail)
+	if command == "" {
+		return
+	}
+
+	env := []string{
+		"EDR_HOOK=" + name, "EDR_EVENT=" + event, "EDR_LEVEL=" + level,
+		"EDR_FILE=" + detail.Path, "EDR_MESSAGE=" + message, "EDR_ACTION=" + detail.Action,
+	}
+	env = append(env, fileMetaEnv("EDR_OLD_", detail.Old)...)
+	env = append(env, fileMetaEnv("EDR_NEW_", detail.New)...)
+	// 钩子异步执行, 新增的文件此时可能已被隔离, 先计算哈希
+	if detail.New != nil {
+		if hash, err := hashFile(detail.Path); err == nil {
+			env = append(env, "EDR_HASH="+hash)
+		}
+	}
+	if len(detail.Requests) > 0 {
+		ips := make([]string, 0, len(detail.Requests))
+		for _, r := range detail.Requests {
+			ips = append(ips, r.IP)
+		}
+		env = append(env, "EDR_SOURCE_IPS="+strings.Join(ips, ","))
+	}
+	dm.runEventHook(name, command, env)
+}
+
+// runIsolatedHook 文件移入隔离目录后执行-on-isolated命令
+func (dm *DirectoryMonitor) runIsolatedHook(filePath, isolatedPath string, reason isolateReason) {
+	if dm.eventHooks.Isolated == "" {
+		return
+	}
+	dm.runEventHook("on_isolated", dm.eventHooks.Isolated, []string{
+		"EDR_HOOK=on_isolated", "EDR_EVENT=" + reason.Event, "EDR_FILE=" + filePath,
+		"EDR_ISOLATED_PATH=" + isolatedPath, "EDR_RULES=" + strings.Join(reason.Rules, ","),
+	})
+}
+
+// runEventHook 在后台执行钩子命令, 不阻塞检查; 失败只记录警告
+func (dm *DirectoryMonitor) runEventHook(name, command string, env []string) {
+	if dm.dryRun {
+		env = append(env, "EDR_DRY_RUN=1")
+	}
+	go func() {
+		dm.hookSlots <- struct{}{}
+		defer func() { <-dm.hookSlots }()
+
+		stderr, err := runHook(command, eventHookTimeout, env...)
+		if err != nil {
+			if stderr != "" {
+				err = fmt.Errorf("%v (stderr: %s)", err, stderr)
+			}
+			logWarn(fmt.Sprintf("%s钩子执行失败: %v", name, err))
+		}
+	}()
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// eventMemoryLimit 内存中保留的最近事件数
+	eventMemoryLimit = 1000
+	// eventCompactSize 事件文件超过该大小时压缩, 只保留最近keep条
+	eventCompactSize = 10 * 1024 * 1024
+)
+
+// Event 一条告警事件
+type Event struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Event   string `json:"event"`
+	Message string `json:"message"`
+}
+
+// eventLog 磁盘+内存的事件环形缓冲: 事件同步追加到events.jsonl,
+// 内存保留最近eventMemoryLimit条, offsets记录磁盘上最近keep条记录的偏移
+type eventLog struct {
+	path    string
+	keep    int
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	offsets []int64
+	recent  []Event
+}
+
+// openEventLog 打开(或创建)事件文件, 并载入上次运行留下的最近事件
+func openEventLog(baseDir string, keep int) (*eventLog, error) {
+	el := &eventLog{
+		path: filepath.Join(baseDir, "events.jsonl"),
+		keep: keep,
+	}
+	if err := el.load(); err != nil {
+		return nil, err
+	}
+	if err := el.reopen(); err != nil {
+		return nil, err
+	}
+	return el, nil
+}
+
+func (el *eventLog) load() error {
+	f, err := os.Open(el.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	el.offsets, el.recent, el.size = nil, nil, 0
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			var event Event
+			if json.Unmarshal(line, &event) == nil {
+				el.index(el.size, event)
+			}
+			el.size += int64(len(line))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// reopen 以追加+同步写入方式打开事件文件, 丢弃末尾不完整的记录
+func (el *eventLog) reopen() error {
+	if el.file != nil {
+		el.file.Close()
+	}
+
+	f, err := os.OpenFile(el.path, os.O_CREATE|os.O_WRONLY|os.O_SYNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(el.size); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(el.size, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	el.file = f
+	return nil
+}
+
+// index 记录一条事件的偏移并放入内存缓冲, 超出上限时丢弃最旧的
+func (el *eventLog) index(offset int64, event Event) {
+	el.offsets = append(el.offsets, offset)
+	if len(el.offsets) > 2*el.keep {
+		el.offsets = append([]int64(nil), el.offsets[len(el.offsets)-el.keep:]...)
+	}
+
+	el.recent = append(el.recent, event)
+	if len(el.recent) > 2*eventMemoryLimit {
+		el.recent = append([]Event(nil), el.recent[len(el.recent)-eventMemoryLimit:]...)
+	}
+}
+
+func (el *eventLog) Append(event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	if _, err := el.file.Write(line); err != nil {
+		return err
+	}
+	el.index(el.size, event)
+	el.size += int64(len(line))
+
+	if el.size > eventCompactSize {
+		return el.compact()
+	}
+	return nil
+}
+
+// compact 只保留最近keep条记录重写事件文件
+func (el *eventLog) compact() error {
+	if len(el.offsets) <= el.keep {
+		return nil
+	}
+	start := el.offsets[len(el.offsets)-el.keep]
+
+	src, err := os.Open(el.path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if _, err := src.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+
+	tmpPath := el.path + ".tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	dst.Close()
+
+	if err := os.Rename(tmpPath, el.path); err != nil {
+		return err
+	}
+
+	offsets := el.offsets[len(el.offsets)-el.keep:]
+	el.offsets = make([]int64, len(offsets))
+	for i, offset := range offsets {
+		el.offsets[i] = offset - start
+	}
+	el.size -= start
+	return el.reopen()
+}
+
+// Recent 返回最近limit条事件(按时间顺序), 内存不足时从磁盘读取
+func (el *eventLog) Recent(limit int) ([]Event, error) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
+	inMemory := len(el.recent)
+	if inMemory > eventMemoryLimit {
+		inMemory = eventMemoryLimit
+	}
+	if limit <= inMemory {
+		return append([]Event(nil), el.recent[len(el.recent)-limit:]...), nil
+	}
+
+	if limit > len(el.offsets) {
+		limit = len(el.offsets)
+	}
+	if limit == 0 {
+		return nil, nil
+	}
+	return el.readFrom(el.offsets[len(el.offsets)-limit], limit)
+}
+
+func (el *eventLog) readFrom(offset int64, limit int) ([]Event, error) {
+	f, err := os.Open(el.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, 0, limit)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() && len(events) < limit {
+		var event Event
+		if json.Unmarshal(scanner.Bytes(), &event) == nil {
+			events = append(events, event)
+		}
+	}
+	return events, scanner.Err()
+}
+
+// recordEvent 把告警写入事件日志, 未启用事件日志时忽略
+func (dm *DirectoryMonitor) recordEvent(level, event, message string) {
+	if dm.events == nil {
+		return
+	}
+
+	err := dm.events.Append(Event{
+		Time:    time.Now().Format(time.RFC3339),
+		Level:   level,
+		Event:   event,
+		Message: message,
+	})
+	if err != nil {
+		logError(fmt.Sprintf("写入事件日志失败: %v", err))
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// evidenceTarget 证据文件的路径: 证据目录下保持相对监控目录的路径, 文件名带时间戳, 同一文件多次被篡改时各保留一份
+func (dm *DirectoryMonitor) evidenceTarget(filePath string) string {
+	target := filepath.Join(dm.evidenceDir, filepath.Base(filePath))
+	if root, rel, err := dm.relToRoot(filePath); err == nil {
+		target = filepath.Join(dm.evidenceDir, root.label, rel)
+	}
+
+	ext := filepath.Ext(target)
+	stamp := time.Now().Format("20060102_150405.000000")
+	return strings.TrimSuffix(target, ext) + "." + stamp + ext
+}
+
+// preserveEvidence 还原前把攻击者写入的内容复制到证据目录, 旁边写入与隔离文件相同格式的.meta.json;
+// 文件已被删除、已被隔离或只有属性变化时没有需要保留的内容
+func (dm *DirectoryMonitor) preserveEvidence(filePath string, baselineInfo FileInfo) {
+	info, err := os.Lstat(filePath)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	if hash, err := hashFile(filePath); err == nil && hash == baselineInfo.Hash {
+		return
+	}
+
+	meta, err := newIsolateMeta(filePath, isolateReason{Event: "restored"})
+	if err != nil {
+		logError(fmt.Sprintf("读取文件属性失败 %s: %v", filePath, err))
+		return
+	}
+
+	target := dm.evidenceTarget(filePath)
+	if err := dm.makeWorkspaceDir(filepath.Dir(target)); err != nil {
+		logError(fmt.Sprintf("创建证据目录失败: %v", err))
+		return
+	}
+	if err := copyTree(filePath, target); err != nil {
+		logError(fmt.Sprintf("保存证据失败 %s: %v", filePath, err))
+		return
+	}
+	if err := writeIsolateMeta(target, meta); err != nil {
+		logWarn(fmt.Sprintf("写入证据元数据失败 %s: %v", target, err))
+	}
+	logInfo(fmt.Sprintf("篡改后的内容已保存为证据: %s", target))
+}
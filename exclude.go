@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// excludeRule 一条排除规则: glob或正则(re:前缀)
+type excludeRule struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+// parseExcludes 解析逗号分隔的排除规则. 不含/的glob匹配路径中的任意一级名称(例如*.log、cache),
+// 含/的glob匹配相对监控目录的路径及其上级目录(例如runtime/cache、data/*.json), re:开头的为正则
+func parseExcludes(value string) ([]excludeRule, error) {
+	var rules []excludeRule
+	for _, item := range parseList(value) {
+		rule, err := parsePathRule(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的排除规则: %v", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// parsePathRule 解析一条路径规则(glob或re:正则), 排除规则和处理策略共用同一种写法
+func parsePathRule(item string) (excludeRule, error) {
+	if pattern, ok := cutPrefix(item, "re:"); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return excludeRule{}, fmt.Errorf("%s: %v", pattern, err)
+		}
+		return excludeRule{re: re}, nil
+	}
+
+	glob := strings.Trim(item, "/")
+	if _, err := filepath.Match(glob, ""); err != nil || glob == "" {
+		return excludeRule{}, errors.New(item)
+	}
+	return excludeRule{glob: glob}, nil
+}
+
+func cutPrefix(s, prefix string) (string, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
+
+func (r excludeRule) match(rel string) bool {
+	if r.re != nil {
+		return r.re.MatchString(rel)
+	}
+	if strings.Contains(r.glob, "/") {
+		return matchDirPattern(r.glob, rel)
+	}
+	for _, name := range strings.Split(rel, "/") {
+		if ok, _ := filepath.Match(r.glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isExcluded 判断监控目录内的文件或目录是否被-x排除, 排除的目录连同其内容都不备份、不监控
+func (dm *DirectoryMonitor) isExcluded(path string) bool {
+	if len(dm.excludes) == 0 && len(dm.dirExcludes) == 0 {
+		return false
+	}
+
+	_, rel, err := dm.relToRoot(path)
+	if err != nil || rel == "." {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, rule := range dm.excludes {
+		if rule.match(rel) {
+			return true
+		}
+	}
+	for _, d := range dm.dirExcludes {
+		sub, ok := belowDirPattern(d.Pattern, rel)
+		if !ok {
+			continue
+		}
+		for _, rule := range d.Rules {
+			if rule.match(sub) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// belowDirPattern 判断rel是否位于匹配pattern的目录之下, 返回相对该目录的路径
+func belowDirPattern(pattern, rel string) (string, bool) {
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		if ok, _ := path.Match(pattern, dir); ok {
+			return rel[len(dir)+1:], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 文件名启发式规则, 由-name-heuristics选择
+const (
+	// nameHidden 新增的点文件(.shell.php, .cache), .htaccess等配置文件另有告警
+	nameHidden = "hidden"
+	// nameBidi 包含Unicode方向控制字符, 例如gpj.php显示为php.jpg
+	nameBidi = "bidi"
+	// nameHomoglyph 包含与ASCII形近的字符或零宽字符, 例如西里尔字母р冒充p
+	nameHomoglyph = "homoglyph"
+)
+
+// parseNameHeuristics 解析-name-heuristics
+func parseNameHeuristics(value string) (map[string]bool, error) {
+	enabled := make(map[string]bool)
+	for _, item := range parseList(value) {
+		switch item {
+		case nameHidden, nameBidi, nameHomoglyph:
+			enabled[item] = true
+		default:
+			return nil, fmt.Errorf("无效的-name-heuristics: %s (可选: hidden, bidi, homoglyph)", item)
+		}
+	}
+	return enabled, nil
+}
+
+// bidiControls 改变文字显示方向的Unicode控制字符
+var bidiControls = map[rune]bool{
+	'\u061c': true, '\u200e': true, '\u200f': true,
+	'\u202a': true, '\u202b': true, '\u202c': true, '\u202d': true, '\u202e': true,
+	'\u2066': true, '\u2067': true, '\u2068': true, '\u2069': true,
+}
+
+// homoglyphs 与ASCII字母和点号形近的字符, 映射为显示上等同的ASCII字符; 零宽字符映射为空
+var homoglyphs = map[rune]string{
+	// 西里尔字母
+	'а': "a", 'е': "e", 'о': "o", 'р': "p", 'с': "c", 'у': "y", 'х': "x", 'і': "i", 'ј': "j", 'ѕ': "s",
+	'һ': "h", 'ԁ': "d", 'ԛ': "q", 'ԝ': "w", 'А': "A", 'В': "B", 'Е': "E", 'К': "K", 'М': "M", 'Н': "H",
+	'О': "O", 'Р': "P", 'С': "C", 'Т': "T", 'Х': "X",
+	// 希腊字母
+	'α': "a", 'ο': "o", 'ρ': "p", 'ν': "v", 'Α': "A", 'Β': "B", 'Ε': "E", 'Η': "H", 'Ι': "I", 'Κ': "K",
+	'Μ': "M", 'Ν': "N", 'Ο': "O", 'Ρ': "P", 'Τ': "T", 'Χ': "X", 'Ζ': "Z",
+	// 点号
+	'\u2024': ".", '\ufe52': ".", '\uff0e': ".", '\u3002': ".",
+	// 零宽字符
+	'\u200b': "", '\u200c': "", '\u200d': "", '\u2060': "", '\ufeff': "",
+}
+
+// nameSkeleton 把文件名中的形近字符替换为对应的ASCII字符, 返回替换后的名字和是否有替换;
+// 全角ASCII(U+FF01-U+FF5E)按对应的半角字符处理
+func nameSkeleton(name string) (string, bool) {
+	var b strings.Builder
+	replaced := false
+	for _, r := range name {
+		if ascii, ok := homoglyphs[r]; ok {
+			b.WriteString(ascii)
+			replaced = true
+		} else if r >= '\uff01' && r <= '\uff5e' {
+			b.WriteRune(r - 0xFEE0)
+			replaced = true
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String(), replaced
+}
+
+// suspiciousName 按启用的启发式规则检查新增文件的文件名, 返回告警级别和描述; 没有命中时描述为空
+func (dm *DirectoryMonitor) suspiciousName(filePath string) (string, string) {
+	name := filepath.Base(filePath)
+
+	if dm.nameHeuristics[nameBidi] {
+		for _, r := range name {
+			if bidiControls[r] {
+				return "critical", fmt.Sprintf("文件名包含Unicode方向控制字符(U+%04X)，显示的扩展名是伪造的, 实际文件名: %s",
+					r, strconv.QuoteToASCII(name))
+			}
+		}
+	}
+
+	if dm.nameHeuristics[nameHomoglyph] {
+		if skeleton, ok := nameSkeleton(name); ok {
+			return "critical", fmt.Sprintf("文件名包含形近字符或零宽字符，显示为 %s, 实际文件名: %s",
+				skeleton, strconv.QuoteToASCII(name))
+		}
+	}
+
+	if dm.nameHeuristics[nameHidden] && strings.HasPrefix(name, ".") && !isServerConfigFile(filePath) {
+		if dm.isScriptFile(filePath) {
+			return "critical", "隐藏的脚本文件"
+		}
+		return "warning", "隐藏文件"
+	}
+	return "", ""
+}
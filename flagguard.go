@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// flagCheckInterval flag文件的检查间隔, 比其他快照分组更短, 尽量在checker下一次读取前复原
+const flagCheckInterval = 200 * time.Millisecond
+
+// startFlagGuard 固定-flag-files指定的flag文件: 启动时的内容、属主和权限作为基线,
+// 被覆盖、chmod/chown、移走或删除时告警flag_tampering并在下一次检查时复原.
+// 启动时不存在的文件只警告, 不会在之后出现时被隔离(flag可能由比赛平台稍后写入)
+func (dm *DirectoryMonitor) startFlagGuard() {
+	group := newSnapshotGroup("flag文件(flag tampering)", "flag_tampering", "critical", true)
+	for _, filePath := range dm.flagFiles {
+		if err := group.add(dm, filePath); err != nil {
+			logWarn(fmt.Sprintf("读取flag文件失败, 跳过: %s: %v", filePath, err))
+		}
+	}
+	if len(group.paths()) == 0 {
+		logWarn("没有可读取的flag文件, 跳过flag文件保护")
+		return
+	}
+
+	logInfo(fmt.Sprintf("flag文件保护已启动: %s, 检查间隔: %v", strings.Join(group.paths(), ", "), flagCheckInterval))
+
+	dm.runPeriodic(flagCheckInterval, func() { dm.checkSnapshotGroup(group) })
+}
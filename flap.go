@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// flapWindow 统计单个文件处理次数的时间窗口
+	flapWindow = time.Minute
+	// flapAlertInterval 抖动期间同一文件persistent_tampering告警的最小间隔
+	flapAlertInterval = time.Minute
+	// flapSweepSize 记录的文件数超过该值时清理窗口内没有处理记录的文件
+	flapSweepSize = 1024
+)
+
+// flapState 单个文件最近的处理(隔离/还原/删除)时间和抖动期间被抑制的告警数
+type flapState struct {
+	events     []time.Time
+	suppressed int
+	lastAlert  time.Time
+}
+
+// recordFlap 记录一次对文件的处理; 攻击脚本回写的速度快于还原时会形成隔离→还原→隔离的循环
+func (dm *DirectoryMonitor) recordFlap(filePath string) {
+	if dm.flapThreshold <= 0 {
+		return
+	}
+
+	now := time.Now()
+	dm.flapMu.Lock()
+	defer dm.flapMu.Unlock()
+
+	state := dm.flaps[filePath]
+	if state == nil {
+		if len(dm.flaps) >= flapSweepSize {
+			dm.sweepFlapsLocked(now)
+		}
+		state = &flapState{}
+		dm.flaps[filePath] = state
+	}
+	state.events = pruneBefore(append(state.events, now), now.Add(-flapWindow))
+}
+
+func (dm *DirectoryMonitor) sweepFlapsLocked(now time.Time) {
+	for path, state := range dm.flaps {
+		if len(pruneBefore(state.events, now.Add(-flapWindow))) == 0 && state.suppressed == 0 {
+			delete(dm.flaps, path)
+		}
+	}
+}
+
+// isFlapping 文件在flapWindow内被处理的次数达到-flap-threshold, 进入升级模式:
+// 继续还原, 但不再重复隔离相同的样本, 逐个文件的告警合并为每分钟一条persistent_tampering
+func (dm *DirectoryMonitor) isFlapping(filePath string) bool {
+	if dm.flapThreshold <= 0 {
+		return false
+	}
+
+	dm.flapMu.Lock()
+	defer dm.flapMu.Unlock()
+
+	state := dm.flaps[filePath]
+	return state != nil && len(pruneBefore(state.events, time.Now().Add(-flapWindow))) >= dm.flapThreshold
+}
+
+// throttleFlapping 抖动中的文件的告警只计数, 每flapAlertInterval发出一条汇总告警; 返回true表示原告警已被抑制
+func (dm *DirectoryMonitor) throttleFlapping(detail alertDetail) bool {
+	if detail.Path == "" || !dm.isFlapping(detail.Path) {
+		return false
+	}
+
+	now := time.Now()
+	dm.flapMu.Lock()
+	state := dm.flaps[detail.Path]
+	state.suppressed++
+	suppressed, count := state.suppressed, len(state.events)
+	emit := now.Sub(state.lastAlert) >= flapAlertInterval
+	if emit {
+		state.lastAlert = now
+		state.suppressed = 0
+	}
+	dm.flapMu.Unlock()
+
+	if emit {
+		detail.Diff = ""
+		dm.emitAlert("critical", "persistent_tampering",
+			fmt.Sprintf("文件持续被篡改: %s 最近 %v 内处理 %d 次，攻击脚本回写快于还原; 继续还原但不再重复隔离，每分钟只告警一次 (已合并 %d 条告警)",
+				detail.Path, flapWindow, count, suppressed), detail)
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	// floodBatchSize 洪水期间每次检查最多处理的新增文件数, 其余留到之后的检查, 避免一次占满磁盘IO
+	floodBatchSize = 100
+	// floodCooldown 最后一次超过阈值之后仍按洪水处理新增文件的时间, 期间不重复告警
+	floodCooldown = 30 * time.Second
+)
+
+// checkCreationFlood 一次检查中目录内的新增文件超过-flood-threshold时(投放大量垃圾文件塞满隔离目录和告警API),
+// 只发出一条汇总的critical告警, 之后按-flood-action分批隔离或删除, 不再逐个文件告警和扫描内容.
+// 返回true表示本目录的新增文件已由洪水处理接管
+func (dm *DirectoryMonitor) checkCreationFlood(dirPath string, baseline, current map[string]FileInfo) bool {
+	if dm.floodThreshold <= 0 {
+		return false
+	}
+
+	var created []string
+	for filePath := range current {
+		if _, exists := baseline[filePath]; exists {
+			continue
+		}
+		if dm.isLockedOut(filePath) || dm.isSuppressed(filePath) || dm.policyFor(filePath) == policyAlert {
+			continue
+		}
+		created = append(created, filePath)
+	}
+
+	now := time.Now()
+	dm.floodMu.Lock()
+	last, active := dm.floods[dirPath]
+	active = active && now.Sub(last) < floodCooldown
+	if len(created) > dm.floodThreshold {
+		dm.floods[dirPath] = now
+	} else if !active {
+		delete(dm.floods, dirPath)
+	}
+	dm.floodMu.Unlock()
+
+	if len(created) <= dm.floodThreshold && !active {
+		return false
+	}
+	if len(created) == 0 {
+		return true
+	}
+
+	verb := "隔离"
+	if dm.floodAction == policyDelete {
+		verb = "删除"
+	}
+
+	if !active {
+		dm.alert("critical", "creation_flood",
+			fmt.Sprintf("检测到大量新增文件: %s 中 %d 个文件在一次检查内出现，分批%s, 不再逐个告警",
+				dirPath, len(created), verb))
+	}
+
+	sort.Strings(created)
+	batch := created
+	if len(batch) > floodBatchSize {
+		batch = batch[:floodBatchSize]
+	}
+
+	handled := 0
+	for _, filePath := range batch {
+		dm.stats.countChange(changeCreated)
+		var err error
+		switch {
+		case dm.dryRun:
+			dm.acceptDryRun(filePath, dm.floodAction)
+			continue
+		case dm.floodAction == policyDelete:
+			err = os.Remove(filePath)
+		default:
+			if _, err = dm.moveToIsolation(filePath, isolateReason{Event: "creation_flood"}); err == nil {
+				dm.stats.isolations.Add(1)
+			}
+		}
+		if err != nil {
+			logError(fmt.Sprintf("处理新增文件失败 %s: %v", filePath, err))
+			continue
+		}
+		handled++
+	}
+
+	if !dm.dryRun {
+		logSuccess(fmt.Sprintf("批量%s新增文件: %s (%d 个, 剩余 %d 个留到下次检查)",
+			verb, dirPath, handled, len(created)-len(batch)))
+		dm.audit("creation_flood", dirPath, fmt.Sprintf("新增 %d 个文件; 本次%s %d 个, 剩余 %d 个",
+			len(created), verb, handled, len(created)-len(batch)))
+	}
+	// 剩余的文件在本次检查结束后立即补查
+	if len(created) > len(batch) {
+		dm.scheduler.wake(dirPath)
+	}
+	return true
+}
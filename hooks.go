@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// preRestoreTimeout 还原前钩子命令的最长执行时间
+const preRestoreTimeout = 10 * time.Second
+
+// runHook 通过sh -c(Windows上为cmd /C)执行钩子命令, env为追加的环境变量, 返回命令的stderr.
+// 超时后终止命令及其所有子进程
+func runHook(command string, timeout time.Duration, env ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := hookCommand(command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	var timedOut atomic.Bool
+	timer := time.AfterFunc(timeout, func() {
+		timedOut.Store(true)
+		killHook(cmd)
+	})
+	err := cmd.Wait()
+	timer.Stop()
+
+	if timedOut.Load() {
+		err = fmt.Errorf("执行超时 (%v)", timeout)
+	}
+	return strings.TrimSpace(stderr.String()), err
+}
+
+// runBackupHook 执行备份前/后的钩子命令, 失败只记录警告, 不影响备份
+func (dm *DirectoryMonitor) runBackupHook(stage, command string) {
+	if command == "" {
+		return
+	}
+
+	logInfo(fmt.Sprintf("执行%s命令: %s", stage, command))
+	stderr, err := runHook(command, dm.backupHookTimeout,
+		"EDR_BACKUP_DIR="+dm.backupDir, "EDR_WATCH_DIR="+dm.watchDir,
+		"EDR_WATCH_DIRS="+strings.Join(dm.rootDirs(), ":"))
+	if err != nil {
+		if stderr != "" {
+			err = fmt.Errorf("%v (stderr: %s)", err, stderr)
+		}
+		logWarn(fmt.Sprintf("%s命令执行失败(不影响备份): %v", stage, err))
+	}
+}
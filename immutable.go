@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// parseImmutableRules 解析-immutable: 与-x相同写法的路径规则, 例如 index.php,config.php,re:^include/
+func parseImmutableRules(value string) ([]excludeRule, error) {
+	var rules []excludeRule
+	for _, item := range parseList(value) {
+		rule, err := parsePathRule(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的-immutable规则: %v", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// shouldHarden 文件是否匹配-immutable规则
+func (dm *DirectoryMonitor) shouldHarden(filePath string) bool {
+	if len(dm.immutableRules) == 0 {
+		return false
+	}
+
+	_, rel, err := dm.relToRoot(filePath)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, rule := range dm.immutableRules {
+		if rule.match(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// hardenFile 还原后给关键文件加上不可变属性, 之后的篡改在内核层面被拒绝
+func (dm *DirectoryMonitor) hardenFile(filePath string) {
+	if !dm.shouldHarden(filePath) || dm.dryRun {
+		return
+	}
+
+	if err := setImmutable(filePath, true); err != nil {
+		logWarn(fmt.Sprintf("设置不可变属性失败 %s: %v", filePath, err))
+		return
+	}
+
+	dm.immutableMu.Lock()
+	dm.immutable[filePath] = true
+	dm.immutableMu.Unlock()
+	logSuccess(fmt.Sprintf("已设置不可变属性(chattr +i): %s", filePath))
+	dm.audit("immutable", filePath, "set")
+}
+
+// unhardenFile 清除本程序设置的不可变属性; 还原前和重建基线前调用, 否则写入会失败
+func (dm *DirectoryMonitor) unhardenFile(filePath string) {
+	dm.immutableMu.Lock()
+	hardened := dm.immutable[filePath]
+	delete(dm.immutable, filePath)
+	dm.immutableMu.Unlock()
+
+	if !hardened {
+		return
+	}
+	if err := setImmutable(filePath, false); err != nil {
+		logDebug(fmt.Sprintf("清除不可变属性失败 %s: %v", filePath, err))
+		return
+	}
+	dm.audit("immutable", filePath, "cleared")
+}
+
+// releaseImmutable 清除本程序设置的所有不可变属性: 退出时调用, 避免程序停止后合法的部署和修补无法写入;
+// 重建基线时由rebaselineFile逐个文件清除, 不经过这里
+func (dm *DirectoryMonitor) releaseImmutable() {
+	dm.immutableMu.Lock()
+	paths := make([]string, 0, len(dm.immutable))
+	for path := range dm.immutable {
+		paths = append(paths, path)
+	}
+	dm.immutableMu.Unlock()
+
+	if len(paths) == 0 {
+		return
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		dm.unhardenFile(path)
+	}
+	logInfo(fmt.Sprintf("已清除 %d 个文件的不可变属性", len(paths)))
+}
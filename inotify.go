@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// inotifySafetyInterval inotify模式下的兜底轮询间隔, 覆盖事件丢失(队列溢出)的情况
+const inotifySafetyInterval = 5 * time.Second
+
+// notify 非阻塞地发送一次通知, 通道中已有未处理的通知时合并
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// watchDirEvents 在inotify模式下为目录注册事件监听, 失败时该目录退回纯轮询
+func (dm *DirectoryMonitor) watchDirEvents(dirPath string) bool {
+	if dm.watcher == nil {
+		return false
+	}
+
+	if err := dm.watcher.add(dirPath); err != nil {
+		logWarn(fmt.Sprintf("无法监听目录事件, 退回轮询 %s: %v", dirPath, err))
+		return false
+	}
+	return true
+}
+
+// unwatchDirEvents 停止监控目录时移除其inotify watch
+func (dm *DirectoryMonitor) unwatchDirEvents(dirPath string) {
+	if dm.watcher != nil {
+		dm.watcher.remove(dirPath)
+	}
+}
@@ -0,0 +1,154 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask 需要关注的目录事件
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ATTRIB |
+	syscall.IN_CLOSE_WRITE | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// inotifyWatcher 基于inotify的目录事件源, 收到事件时通过wake唤醒调度器立即检查对应目录,
+// 检查完成前的多个事件合并为一次检查
+type inotifyWatcher struct {
+	fd int
+	// file 以非阻塞方式包装fd, 读取由运行时的poller等待, 关闭时run中的读取立即返回
+	file *os.File
+	wake func(dir string)
+	// wakeAll 事件队列溢出时调用
+	wakeAll func()
+
+	mu     sync.Mutex
+	dirs   map[int32]string
+	wds    map[string]int32
+	closed bool
+}
+
+func newInotifyWatcher(wake func(dir string), wakeAll func()) (*inotifyWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	return &inotifyWatcher{
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		wake:    wake,
+		wakeAll: wakeAll,
+		dirs:    make(map[int32]string),
+		wds:     make(map[string]int32),
+	}, nil
+}
+
+// add 监听目录; 文件系统不支持或watch数量达到上限时返回错误
+func (w *inotifyWatcher) add(dir string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, inotifyMask)
+	if err != nil {
+		return err
+	}
+	w.dirs[int32(wd)] = dir
+	w.wds[dir] = int32(wd)
+	return nil
+}
+
+// remove 移除目录的watch, 停止监控的目录不再占用inotify watch配额
+func (w *inotifyWatcher) remove(dir string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wd, ok := w.wds[dir]
+	if !ok {
+		return
+	}
+	delete(w.wds, dir)
+	delete(w.dirs, wd)
+	if !w.closed {
+		// 目录已被删除时内核已自动移除watch, 返回EINVAL, 忽略
+		syscall.InotifyRmWatch(w.fd, uint32(wd))
+	}
+}
+
+// released 内核移除了watch(目录被删除或watch被移除), 清理对应的记录
+func (w *inotifyWatcher) released(wd int32) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if dir, ok := w.dirs[wd]; ok {
+		delete(w.dirs, wd)
+		if w.wds[dir] == wd {
+			delete(w.wds, dir)
+		}
+	}
+}
+
+func (w *inotifyWatcher) notifyDir(wd int32) {
+	w.mu.Lock()
+	dir, ok := w.dirs[wd]
+	w.mu.Unlock()
+
+	if ok {
+		w.wake(dir)
+	}
+}
+
+func (w *inotifyWatcher) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.closed {
+		w.closed = true
+		w.file.Close()
+	}
+}
+
+// run 读取inotify事件, 唤醒对应目录的检查; ctx取消时关闭inotify实例并返回
+func (w *inotifyWatcher) run(ctx context.Context) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		w.close()
+	}()
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil || n <= 0 {
+			logError(fmt.Sprintf("读取inotify事件失败, 事件监听停止(兜底轮询继续): %v", err))
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			switch {
+			case event.Mask&syscall.IN_Q_OVERFLOW != 0:
+				logWarn("inotify事件队列溢出, 重新检查所有目录")
+				w.wakeAll()
+			case event.Mask&syscall.IN_IGNORED != 0:
+				w.released(event.Wd)
+			default:
+				w.notifyDir(event.Wd)
+			}
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+		}
+	}
+}
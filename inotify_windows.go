@@ -0,0 +1,23 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// inotifyWatcher Windows上没有inotify, -watch-mode inotify时退回轮询
+type inotifyWatcher struct{}
+
+func newInotifyWatcher(wake func(dir string), wakeAll func()) (*inotifyWatcher, error) {
+	return nil, errors.New("Windows不支持inotify")
+}
+
+func (w *inotifyWatcher) add(dir string) error {
+	return errors.New("Windows不支持inotify")
+}
+
+func (w *inotifyWatcher) remove(dir string) {}
+
+func (w *inotifyWatcher) run(ctx context.Context) {}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// minCheckInterval 检查间隔下限, 过小的间隔会让扫描worker空转占满CPU
+	minCheckInterval = 10 * time.Millisecond
+	// maxCheckInterval 检查间隔上限, 过大的间隔失去实时还原的意义
+	maxCheckInterval = time.Minute
+)
+
+// validateInterval 检查间隔必须在[minCheckInterval, maxCheckInterval]之间
+func validateInterval(interval time.Duration) error {
+	if interval < minCheckInterval || interval > maxCheckInterval {
+		return fmt.Errorf("检查间隔 %v 超出范围 [%v, %v]", interval, minCheckInterval, maxCheckInterval)
+	}
+	return nil
+}
+
+// dirInterval 按目录模式覆盖的检查间隔
+type dirInterval struct {
+	Pattern  string
+	Interval time.Duration
+}
+
+// parseDirIntervals 解析"模式=间隔"的逗号分隔列表, 例如 vendor=5s,static/*=2s
+func parseDirIntervals(value string) ([]dirInterval, error) {
+	var rules []dirInterval
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		sep := strings.LastIndex(item, "=")
+		if sep <= 0 {
+			return nil, fmt.Errorf("无效的目录间隔: %s", item)
+		}
+		pattern := strings.Trim(strings.TrimSpace(item[:sep]), "/")
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("无效的目录模式 %s: %v", pattern, err)
+		}
+		interval, err := time.ParseDuration(strings.TrimSpace(item[sep+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("无效的检查间隔: %s", item)
+		}
+		if err := validateInterval(interval); err != nil {
+			return nil, fmt.Errorf("%s: %v", item, err)
+		}
+		rules = append(rules, dirInterval{Pattern: pattern, Interval: interval})
+	}
+	return rules, nil
+}
+
+// matchDirPattern 模式按相对监控目录的路径匹配, 匹配某个目录的模式同样作用于其子目录
+func matchDirPattern(pattern, relDir string) bool {
+	for dir := relDir; ; dir = filepath.Dir(dir) {
+		if ok, _ := filepath.Match(pattern, dir); ok {
+			return true
+		}
+		if dir == "." || dir == "/" {
+			return false
+		}
+	}
+}
+
+// intervalFor 返回目录的检查间隔: 第一条匹配的覆盖规则, 没有匹配时使用全局间隔
+func (dm *DirectoryMonitor) intervalFor(dirPath string) time.Duration {
+	_, relDir, err := dm.relToRoot(dirPath)
+	if err != nil {
+		return dm.checkInterval
+	}
+
+	for _, rule := range dm.dirIntervals {
+		if matchDirPattern(rule.Pattern, relDir) {
+			return rule.Interval
+		}
+	}
+	return dm.checkInterval
+}
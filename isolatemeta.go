@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// metaSuffix 隔离文件旁元数据文件的后缀
+const metaSuffix = ".meta.json"
+
+// isolateReason 触发隔离的告警事件和命中的检测规则
+type isolateReason struct {
+	Event string
+	Rules []string
+}
+
+// isolateMeta 隔离文件旁.meta.json的内容: 原始位置和属性用于un-isolate还原, 原因和规则用于攻击分析
+type isolateMeta struct {
+	OriginalPath string   `json:"original_path"`
+	IsolatedAt   string   `json:"isolated_at"`
+	Type         string   `json:"type"`
+	LinkTarget   string   `json:"link_target,omitempty"`
+	Size         int64    `json:"size"`
+	Hash         string   `json:"hash,omitempty"`
+	Uid          uint32   `json:"uid"`
+	Gid          uint32   `json:"gid"`
+	Owner        string   `json:"owner,omitempty"`
+	Attributes   uint32   `json:"attributes,omitempty"`
+	Mode         string   `json:"mode"`
+	ModTime      string   `json:"mtime"`
+	Reason       string   `json:"reason"`
+	Rules        []string `json:"rules,omitempty"`
+}
+
+// newIsolateMeta 在移动之前记录文件的原始属性
+func newIsolateMeta(filePath string, reason isolateReason) (*isolateMeta, error) {
+	info, err := os.Lstat(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &isolateMeta{
+		OriginalPath: filePath,
+		IsolatedAt:   time.Now().Format(time.RFC3339),
+		Type:         "file",
+		Size:         info.Size(),
+		Mode:         fmt.Sprintf("%04o", unixMode(info.Mode())),
+		ModTime:      info.ModTime().Format(time.RFC3339Nano),
+		Reason:       reason.Event,
+		Rules:        reason.Rules,
+	}
+	sys := platformStat(filePath, info)
+	meta.Uid, meta.Gid = sys.Uid, sys.Gid
+	meta.Owner, meta.Attributes = sys.Owner, sys.Attributes
+
+	switch {
+	case info.IsDir():
+		meta.Type = "directory"
+	case info.Mode()&os.ModeSymlink != 0:
+		meta.Type = "symlink"
+		meta.LinkTarget, _ = os.Readlink(filePath)
+	}
+	return meta, nil
+}
+
+// writeIsolateMeta 在隔离文件旁写入元数据, 普通文件补充移动后的哈希
+func writeIsolateMeta(isolatedPath string, meta *isolateMeta) error {
+	if meta.Type == "file" {
+		if hash, err := hashFile(isolatedPath); err == nil {
+			meta.Hash = hash
+		}
+	}
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(isolatedPath+metaSuffix, append(data, '\n'), 0600)
+}
+
+// readIsolateMeta 读取隔离文件的元数据
+func readIsolateMeta(isolatedPath string) (*isolateMeta, error) {
+	data, err := os.ReadFile(isolatedPath + metaSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta isolateMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("解析隔离元数据失败: %v", err)
+	}
+	if meta.OriginalPath == "" {
+		return nil, fmt.Errorf("隔离元数据缺少原始路径")
+	}
+	return &meta, nil
+}
+
+// isSidecar 判断是否为隔离文件旁的元数据文件, 而不是被隔离的文件本身
+func isSidecar(path string) bool {
+	if !strings.HasSuffix(path, metaSuffix) {
+		return false
+	}
+	_, err := os.Lstat(strings.TrimSuffix(path, metaSuffix))
+	return err == nil
+}
+
+// unixMode 把os.FileMode转换为chmod使用的数字权限, 保留setuid/setgid/sticky位
+func unixMode(mode os.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= syscall.S_ISUID
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= syscall.S_ISGID
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= syscall.S_ISVTX
+	}
+	return bits
+}
+
+// parseUnixMode 把元数据中的八进制权限转换回os.FileMode
+func parseUnixMode(value string) (os.FileMode, error) {
+	bits, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || bits > 07777 {
+		return 0, fmt.Errorf("无效的权限: %s", value)
+	}
+
+	mode := os.FileMode(bits & 0777)
+	if bits&syscall.S_ISUID != 0 {
+		mode |= os.ModeSetuid
+	}
+	if bits&syscall.S_ISGID != 0 {
+		mode |= os.ModeSetgid
+	}
+	if bits&syscall.S_ISVTX != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
+}
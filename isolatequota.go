@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// isolateQuotaInterval 隔离目录配额和过期清理的检查间隔
+const isolateQuotaInterval = 30 * time.Second
+
+// isolatedSample 隔离目录中的一个样本: 被隔离的文件/目录/符号链接及其.meta.json
+type isolatedSample struct {
+	path       string
+	size       int64
+	isolatedAt time.Time
+}
+
+// treeSize 目录树中普通文件的总大小, 不跟随符号链接
+func treeSize(root string) int64 {
+	var size int64
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// isolatedSamples 列出隔离目录中的样本, 隔离时间取.meta.json的isolated_at, 没有元数据时取文件的修改时间
+func (dm *DirectoryMonitor) isolatedSamples() ([]isolatedSample, error) {
+	var samples []isolatedSample
+	err := filepath.Walk(dm.isolateDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if path == dm.isolateDir || isSidecar(path) {
+			return nil
+		}
+
+		meta, metaErr := readIsolateMeta(path)
+		if metaErr != nil && !info.Mode().IsRegular() {
+			// 按根目录/相对路径排列的中间目录
+			return nil
+		}
+
+		sample := isolatedSample{path: path, size: info.Size(), isolatedAt: info.ModTime()}
+		if info.IsDir() {
+			sample.size = treeSize(path)
+		}
+		if metaErr == nil {
+			if t, err := time.Parse(time.RFC3339, meta.IsolatedAt); err == nil {
+				sample.isolatedAt = t
+			}
+			if sidecar, err := os.Lstat(path + metaSuffix); err == nil {
+				sample.size += sidecar.Size()
+			}
+		}
+		samples = append(samples, sample)
+
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i].isolatedAt.Before(samples[j].isolatedAt) })
+	return samples, nil
+}
+
+// purgeSample 删除隔离样本及其元数据
+func (dm *DirectoryMonitor) purgeSample(sample isolatedSample) error {
+	if err := os.RemoveAll(sample.path); err != nil {
+		return err
+	}
+	os.Remove(sample.path + metaSuffix)
+	return nil
+}
+
+// enforceIsolateQuota 周期任务: 删除超过-isolate-max-age的样本; 隔离目录总大小仍超过-isolate-max-size时
+// 从最早隔离的样本开始删除, 并告警isolate_quota_purged, 避免投放大量文件塞满磁盘导致服务宕机
+func (dm *DirectoryMonitor) enforceIsolateQuota() {
+	samples, err := dm.isolatedSamples()
+	if err != nil {
+		logWarn(fmt.Sprintf("读取隔离目录失败: %v", err))
+		return
+	}
+
+	var total int64
+	kept := samples[:0]
+	expired := 0
+	for _, sample := range samples {
+		if dm.isolateMaxAge > 0 && time.Since(sample.isolatedAt) > dm.isolateMaxAge {
+			if err := dm.purgeSample(sample); err != nil {
+				logWarn(fmt.Sprintf("清理过期隔离样本失败 %s: %v", sample.path, err))
+			} else {
+				expired++
+				dm.audit("isolate_expired", sample.path, fmt.Sprintf("隔离于 %s", sample.isolatedAt.Format(time.RFC3339)))
+				continue
+			}
+		}
+		total += sample.size
+		kept = append(kept, sample)
+	}
+	if expired > 0 {
+		logInfo(fmt.Sprintf("已清理 %d 个超过 %v 的隔离样本", expired, dm.isolateMaxAge))
+	}
+
+	if dm.isolateMaxSize <= 0 || total <= dm.isolateMaxSize {
+		return
+	}
+
+	var purged []string
+	var freed int64
+	for _, sample := range kept {
+		if total-freed <= dm.isolateMaxSize {
+			break
+		}
+		if err := dm.purgeSample(sample); err != nil {
+			logWarn(fmt.Sprintf("清理隔离样本失败 %s: %v", sample.path, err))
+			continue
+		}
+		freed += sample.size
+		rel, _ := filepath.Rel(dm.isolateDir, sample.path)
+		purged = append(purged, rel)
+		dm.audit("isolate_quota_purged", sample.path, fmt.Sprintf("隔离于 %s, 大小 %d bytes", sample.isolatedAt.Format(time.RFC3339), sample.size))
+	}
+	if len(purged) == 0 {
+		return
+	}
+
+	shown := purged
+	if len(shown) > 10 {
+		shown = shown[:10]
+	}
+	dm.alert("warning", "isolate_quota_purged",
+		fmt.Sprintf("隔离目录超过配额 %d MB，已删除最早的 %d 个隔离样本 (释放 %d KB): %s",
+			dm.isolateMaxSize>>20, len(purged), freed>>10, strings.Join(shown, ", ")))
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	ldPreloadFile = "/etc/ld.so.preload"
+	ldConfFile    = "/etc/ld.so.conf"
+	ldConfDir     = "/etc/ld.so.conf.d"
+)
+
+// ldEnvFiles Web服务启动时读取的环境变量文件, 在其中加入LD_PRELOAD可以只注入Web服务进程
+var ldEnvFiles = []string{
+	"/etc/environment",
+	"/etc/apache2/envvars",
+	"/etc/sysconfig/httpd",
+	"/etc/default/nginx",
+	"/etc/default/tomcat9",
+}
+
+// ldEnvVars 进程环境中让动态链接器加载额外共享库的变量
+var ldEnvVars = []string{"LD_PRELOAD", "LD_AUDIT"}
+
+// preloadEnv 返回/proc/<pid>/environ中的LD_PRELOAD等变量, 没有时返回空
+func preloadEnv(pid int) []string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+	if err != nil {
+		return nil
+	}
+	var found []string
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		for _, name := range ldEnvVars {
+			if value := strings.TrimPrefix(string(entry), name+"="); value != string(entry) && value != "" {
+				found = append(found, name+"="+value)
+			}
+		}
+	}
+	return found
+}
+
+// startLdPreloadMonitor 监控动态链接器的预加载和库搜索路径配置, 这些文件被篡改后
+// 任意进程都会加载攻击者的共享库; restoreLd为false时只告警.
+// 同时检查Web服务的环境变量文件和Web服务用户(-proc-users)进程的环境中注入的LD_PRELOAD
+func (dm *DirectoryMonitor) startLdPreloadMonitor() {
+	if data, err := os.ReadFile(ldPreloadFile); err == nil && len(strings.TrimSpace(string(data))) > 0 {
+		dm.alert("warning", "ldpreload_active",
+			fmt.Sprintf("启动时检测到%s非空, 所有进程都会预加载: %s",
+				ldPreloadFile, strings.Join(strings.Fields(string(data)), ", ")))
+	}
+
+	group := newSnapshotGroup("动态链接器配置", "ldpreload_modified", "critical", dm.restoreLd)
+	group.inspect = func(filePath string, before, after []byte) {
+		dm.alertLineChanges(filePath, before, after)
+	}
+	group.watchFile(dm, ldPreloadFile, "ldpreload_modified")
+	group.watchFile(dm, ldConfFile, "ldpreload_modified")
+	group.watchDir(dm, ldConfDir, "ldpreload_modified")
+	for _, filePath := range ldEnvFiles {
+		group.watchFile(dm, filePath, "ldpreload_modified")
+	}
+
+	mode := "只告警"
+	if dm.restoreLd {
+		mode = "告警并复原"
+	}
+	logInfo(fmt.Sprintf("动态链接器配置监控已启动(%s), 当前共 %d 个文件", mode, len(group.paths())))
+
+	dm.runPeriodic(snapshotCheckInterval, func() { dm.checkSnapshotGroup(group) })
+
+	if _, err := listPids(); err != nil {
+		logWarn(fmt.Sprintf("无法读取/proc, 跳过进程环境变量检查: %v", err))
+		return
+	}
+	uids := resolveUids(dm.procUsers)
+	if len(uids) == 0 {
+		return
+	}
+
+	// alerted 已告警的进程, 以pid和启动时间区分复用的pid
+	alerted := make(map[int]string)
+
+	dm.runPeriodic(procScanInterval, func() {
+		pids, err := listPids()
+		if err != nil {
+			return
+		}
+
+		alive := make(map[int]bool, len(pids))
+		for _, pid := range pids {
+			alive[pid] = true
+			info, err := readProcInfo(pid)
+			if err != nil {
+				continue
+			}
+			user, ok := uids[info.uid]
+			if !ok {
+				continue
+			}
+			if start, ok := alerted[pid]; ok && start == info.start {
+				continue
+			}
+			vars := preloadEnv(pid)
+			if len(vars) == 0 {
+				continue
+			}
+			alerted[pid] = info.start
+
+			exe := procExeName(info)
+			detail := alertDetail{}
+			if dm.procKill {
+				detail.Action = actionKill
+			}
+			dm.alertFile("critical", "ldpreload_env",
+				fmt.Sprintf("检测到Web服务用户%s的进程环境中注入了预加载库: pid=%d %s, %s, 父进程链: %s",
+					user, pid, exe, strings.Join(vars, ", "), parentChain(info)), detail)
+			if dm.procKill {
+				dm.killProcess(pid, exe, fmt.Sprintf("user=%s %s", user, strings.Join(vars, " ")))
+			}
+		}
+
+		for pid := range alerted {
+			if !alive[pid] {
+				delete(alerted, pid)
+			}
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxLineAlerts 单次变化最多逐行告警的行数, 超出部分只汇总数量
+const maxLineAlerts = 20
+
+// sensitiveLinePatterns 日志和告警中需要脱敏的内容
+var sensitiveLinePatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)-----BEGIN [A-Z ]*PRIVATE KEY-----.*`), "[REDACTED PRIVATE KEY]"},
+	{regexp.MustCompile(`(?i)\b(password|passwd|pwd|secret|token|api[_-]?key)(\s*[=:]\s*)\S+`), "${1}${2}[REDACTED]"},
+	{regexp.MustCompile(`\$(1|2[aby]?|5|6|y)\$[^:\s]+`), "[REDACTED HASH]"},
+	{regexp.MustCompile(`^[A-Za-z0-9+/=]{40,}$`), "[REDACTED]"},
+}
+
+// redactLine 脱敏密码, 私钥, 口令哈希等敏感内容
+func redactLine(line string) string {
+	for _, rule := range sensitiveLinePatterns {
+		line = rule.pattern.ReplaceAllString(line, rule.replacement)
+	}
+	return line
+}
+
+// lineHashes 把内容按行拆分, 返回每行的哈希和行内容, 忽略空行
+func lineHashes(data []byte) ([][32]byte, []string) {
+	var hashes [][32]byte
+	var lines []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		hashes = append(hashes, sha256.Sum256([]byte(line)))
+		lines = append(lines, line)
+	}
+	return hashes, lines
+}
+
+// diffLines 比较两个版本的行哈希多重集合, 返回新增和删除的行(按各自文件中的顺序)
+func diffLines(before, after []byte) ([]string, []string) {
+	beforeHashes, beforeLines := lineHashes(before)
+	afterHashes, afterLines := lineHashes(after)
+
+	counts := make(map[[32]byte]int, len(beforeHashes))
+	for _, h := range beforeHashes {
+		counts[h]++
+	}
+
+	var added []string
+	for i, h := range afterHashes {
+		if counts[h] > 0 {
+			counts[h]--
+			continue
+		}
+		added = append(added, afterLines[i])
+	}
+
+	var removed []string
+	for i, h := range beforeHashes {
+		if counts[h] > 0 {
+			counts[h]--
+			removed = append(removed, beforeLines[i])
+		}
+	}
+	return added, removed
+}
+
+// alertLineChanges 逐行告警新增和删除的行, 超过maxLineAlerts的部分只汇总数量
+func (dm *DirectoryMonitor) alertLineChanges(filePath string, before, after []byte) {
+	added, removed := diffLines(before, after)
+
+	emit := func(event, level string, lines []string) {
+		for i, line := range lines {
+			if i == maxLineAlerts {
+				dm.alert(level, event, fmt.Sprintf("%s %s: 另有 %d 行未列出", filePath, event, len(lines)-maxLineAlerts))
+				return
+			}
+			dm.alert(level, event, fmt.Sprintf("%s %s: %s", filePath, event, redactLine(line)))
+		}
+	}
+	emit("line_added", "critical", added)
+	emit("line_removed", "warning", removed)
+}
+
+// startLineMonitor 按行监控指定的配置文件(例如/etc/hosts, /etc/sudoers),
+// 告警具体增删的行, 之后整个文件用启动时的内容复原
+func (dm *DirectoryMonitor) startLineMonitor() {
+	group := newSnapshotGroup("按行监控文件", "line_file_modified", "warning", true)
+	group.inspect = func(filePath string, before, after []byte) {
+		dm.alertLineChanges(filePath, before, after)
+	}
+
+	for _, filePath := range dm.lineMonitorFiles {
+		group.watchFile(dm, filePath, "line_file_modified")
+	}
+
+	logInfo(fmt.Sprintf("按行监控已启动, 共 %d 个文件: %s",
+		len(group.paths()), strings.Join(group.paths(), ", ")))
+
+	dm.runPeriodic(snapshotCheckInterval, func() { dm.checkSnapshotGroup(group) })
+}
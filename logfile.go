@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ansiEscape 控制台颜色码, 写入日志文件前去掉
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// rotatingLog 按大小和时间轮转的日志文件: 当前文件超过maxSize或打开时间超过interval时,
+// 重命名为 文件名.时间戳 并新建文件, 只保留最近keep个轮转文件
+type rotatingLog struct {
+	path     string
+	maxSize  int64
+	interval time.Duration
+	keep     int
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+func openRotatingLog(path string, maxSize int64, interval time.Duration, keep int) (*rotatingLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	rl := &rotatingLog{
+		path:     path,
+		maxSize:  maxSize,
+		interval: interval,
+		keep:     keep,
+	}
+	if err := rl.open(); err != nil {
+		return nil, err
+	}
+	return rl, nil
+}
+
+func (rl *rotatingLog) open() error {
+	f, err := os.OpenFile(rl.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rl.file = f
+	rl.size = info.Size()
+	rl.openedAt = time.Now()
+	return nil
+}
+
+func (rl *rotatingLog) Write(p []byte) (int, error) {
+	line := ansiEscape.ReplaceAll(p, nil)
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.shouldRotate(int64(len(line))) {
+		if err := rl.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "轮转日志文件失败: %v\n", err)
+		}
+	}
+	if rl.file == nil {
+		return len(p), nil
+	}
+
+	n, err := rl.file.Write(line)
+	rl.size += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (rl *rotatingLog) shouldRotate(next int64) bool {
+	if rl.size == 0 {
+		return false
+	}
+	if rl.maxSize > 0 && rl.size+next > rl.maxSize {
+		return true
+	}
+	return rl.interval > 0 && time.Since(rl.openedAt) >= rl.interval
+}
+
+// rotate 关闭当前文件并按时间戳重命名, 然后新建日志文件并清理多余的旧文件
+func (rl *rotatingLog) rotate() error {
+	if rl.file != nil {
+		rl.file.Close()
+		rl.file = nil
+	}
+
+	rotated := rl.path + "." + time.Now().Format("20060102_150405.000000")
+	if err := os.Rename(rl.path, rotated); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := rl.open(); err != nil {
+		return err
+	}
+	return rl.prune()
+}
+
+// prune 只保留最近keep个轮转文件, keep为0时全部保留
+func (rl *rotatingLog) prune() error {
+	if rl.keep <= 0 {
+		return nil
+	}
+	matches, err := filepath.Glob(rl.path + ".*")
+	if err != nil {
+		return err
+	}
+
+	var rotated []string
+	prefix := filepath.Base(rl.path) + "."
+	for _, match := range matches {
+		if suffix := strings.TrimPrefix(filepath.Base(match), prefix); isRotationStamp(suffix) {
+			rotated = append(rotated, match)
+		}
+	}
+	// 时间戳格式定长, 按文件名排序即按时间排序
+	sort.Strings(rotated)
+	for len(rotated) > rl.keep {
+		if err := os.Remove(rotated[0]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		rotated = rotated[1:]
+	}
+	return nil
+}
+
+func isRotationStamp(s string) bool {
+	_, err := time.Parse("20060102_150405.000000", s)
+	return err == nil
+}
+
+func (rl *rotatingLog) Close() error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.file == nil {
+		return nil
+	}
+	err := rl.file.Close()
+	rl.file = nil
+	return err
+}
+
+// setupLogFile 在控制台输出之外同时写入轮转日志文件
+func setupLogFile(path string, maxSizeMB int, interval time.Duration, keep int) (io.Closer, error) {
+	if maxSizeMB < 0 || keep < 0 || interval < 0 {
+		return nil, fmt.Errorf("无效的日志轮转参数: 大小=%dMB, 间隔=%v, 保留=%d", maxSizeMB, interval, keep)
+	}
+	rl, err := openRotatingLog(path, int64(maxSizeMB)*1024*1024, interval, keep)
+	if err != nil {
+		return nil, fmt.Errorf("打开日志文件失败 %s: %v", path, err)
+	}
+	log.SetOutput(io.MultiWriter(os.Stderr, rl))
+	return rl, nil
+}
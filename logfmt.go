@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// jsonLogs 为true时每条日志输出为一行JSON对象(-log-format=json), 便于导入ELK或脚本解析
+var jsonLogs bool
+
+// 告警后采取的处理动作, 记录在JSON日志的action字段
+const (
+	actionIsolate        = "isolate"
+	actionRestore        = "restore"
+	actionIsolateRestore = "isolate+restore"
+	actionDelete         = "delete"
+	actionResetPerms     = "reset_permissions"
+	actionStripSuid      = "strip_privileges"
+	actionKill           = "kill"
+)
+
+// logRecord JSON日志格式下的一条记录, 告警额外带有事件类型、文件路径、前后元数据和处理动作
+type logRecord struct {
+	Time     string    `json:"time"`
+	Level    string    `json:"level"`
+	Severity string    `json:"severity,omitempty"`
+	Type     string    `json:"type,omitempty"`
+	Message  string    `json:"message"`
+	Path     string    `json:"path,omitempty"`
+	Old      *fileMeta `json:"old,omitempty"`
+	New      *fileMeta `json:"new,omitempty"`
+	Action   string    `json:"action,omitempty"`
+	Diff     string    `json:"diff,omitempty"`
+	// Obfuscation/Entropy 脚本文件的混淆评分和熵
+	Obfuscation int     `json:"obfuscation_score,omitempty"`
+	Entropy     float64 `json:"entropy,omitempty"`
+	// Requests 新增文件之前访问日志中的请求
+	Requests []accessRequest `json:"requests,omitempty"`
+}
+
+// setLogFormat 设置日志输出格式: text为带颜色的可读格式, json为每行一个JSON对象
+func setLogFormat(format string) error {
+	switch format {
+	case "text":
+		jsonLogs = false
+		log.SetFlags(log.LstdFlags)
+	case "json":
+		jsonLogs = true
+		log.SetFlags(0)
+	default:
+		return fmt.Errorf("无效的日志格式: %s (可选: text, json)", format)
+	}
+	return nil
+}
+
+func writeJSONLog(record logRecord) {
+	record.Time = time.Now().Format(time.RFC3339Nano)
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	log.Print(string(line))
+}
+
+// writeLog 按当前日志格式输出一条普通日志
+func writeLog(level, color, msg string) {
+	if jsonLogs {
+		writeJSONLog(logRecord{Level: level, Message: msg})
+		return
+	}
+	log.Printf("%s[%s]%s %s", color, level, ColorReset, msg)
+}
+
+// logAlertEvent 输出一条告警日志, JSON格式下附带告警级别、事件类型、文件元数据和处理动作
+func logAlertEvent(level, event, msg string, detail alertDetail) {
+	if !jsonLogs {
+		logAlert(msg)
+		if detail.Diff != "" {
+			log.Print("\n" + colorizeDiff(detail.Diff))
+		}
+		if len(detail.Requests) > 0 {
+			lines := make([]string, 0, len(detail.Requests))
+			for _, r := range detail.Requests {
+				lines = append(lines, "  "+r.String())
+			}
+			log.Print("\n之前的访问日志请求:\n" + strings.Join(lines, "\n"))
+		}
+		return
+	}
+	writeJSONLog(logRecord{
+		Level:    "ALERT",
+		Severity: level,
+		Type:     event,
+		Message:  msg,
+		Path:     detail.Path,
+		Old:      newFileMeta(detail.Old),
+		New:      newFileMeta(detail.New),
+		Action:   detail.Action,
+		Diff:     detail.Diff,
+
+		Obfuscation: detail.Obfuscation,
+		Entropy:     detail.Entropy,
+		Requests:    detail.Requests,
+	})
+}
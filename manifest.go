@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+)
+
+const (
+	// manifestName 备份目录中基线清单的文件名
+	manifestName = "manifest.json"
+	// manifestJSONLName -manifest-format jsonl时的清单文件名: 第一行为清单头, 之后每个文件一行
+	manifestJSONLName = "manifest.jsonl"
+	// manifestSaveInterval 基线变化后写回清单的间隔
+	manifestSaveInterval = 10 * time.Second
+)
+
+// manifestScope 决定哪些文件进入基线的参数, 与清单记录的不一致时不能复用备份
+type manifestScope struct {
+	WatchDirs  []string `json:"watch_dirs"`
+	Extensions []string `json:"extensions"`
+	Excludes   []string `json:"excludes"`
+}
+
+// manifestFile 清单中的一个文件, 即基线中的FileInfo
+type manifestFile struct {
+	Size       int64  `json:"size"`
+	ModTime    int64  `json:"mtime"`
+	Inode      uint64 `json:"inode"`
+	Ctime      int64  `json:"ctime"`
+	Hash       string `json:"hash"`
+	Mode       uint32 `json:"mode"`
+	Uid        uint32 `json:"uid"`
+	Gid        uint32 `json:"gid"`
+	Owner      string `json:"owner,omitempty"`
+	Attributes uint32 `json:"attributes,omitempty"`
+	Xattrs     string `json:"xattrs,omitempty"`
+}
+
+// manifestLine JSONL清单中的一行文件记录
+type manifestLine struct {
+	Path string `json:"path"`
+	manifestFile
+}
+
+// manifestDir 清单中的一个目录, 即目录基线
+type manifestDir struct {
+	Mode uint32 `json:"mode"`
+	Uid  uint32 `json:"uid"`
+	Gid  uint32 `json:"gid"`
+}
+
+// baselineManifest 基线清单: 与备份目录一起保存, 重启时用-resume验证后复用备份和基线.
+// JSONL格式的清单头中没有files, 文件逐行保存为manifestLine
+type baselineManifest struct {
+	Scope    manifestScope           `json:"scope"`
+	SavedAt  string                  `json:"saved_at"`
+	Files    map[string]manifestFile `json:"files,omitempty"`
+	Dirs     map[string]manifestDir  `json:"dirs"`
+	Symlinks map[string]string       `json:"symlinks,omitempty"`
+	// FileCount JSONL清单头中记录的文件数, 用于发现被截断的清单
+	FileCount int `json:"file_count,omitempty"`
+	// SpecialFiles 基线中的命名管道/socket/设备文件及其类型(os.FileMode)
+	SpecialFiles map[string]uint32 `json:"special_files,omitempty"`
+}
+
+func (dm *DirectoryMonitor) manifestScope() manifestScope {
+	scope := manifestScope{
+		WatchDirs:  dm.rootDirs(),
+		Extensions: append([]string{}, dm.extensions...),
+		Excludes:   []string{},
+	}
+	for _, rule := range dm.excludes {
+		if rule.re != nil {
+			scope.Excludes = append(scope.Excludes, "re:"+rule.re.String())
+		} else {
+			scope.Excludes = append(scope.Excludes, rule.glob)
+		}
+	}
+	sort.Strings(scope.Extensions)
+	return scope
+}
+
+func manifestFileOf(info FileInfo) manifestFile {
+	return manifestFile{
+		Size:       info.Size,
+		ModTime:    info.ModTime,
+		Inode:      info.Inode,
+		Ctime:      info.Ctime,
+		Hash:       info.Hash,
+		Mode:       uint32(info.Mode),
+		Uid:        info.Uid,
+		Gid:        info.Gid,
+		Owner:      info.Owner,
+		Attributes: info.Attributes,
+		Xattrs:     info.Xattrs,
+	}
+}
+
+func (f manifestFile) fileInfo(path string) FileInfo {
+	return FileInfo{
+		Path:       path,
+		Size:       f.Size,
+		ModTime:    f.ModTime,
+		Inode:      f.Inode,
+		Ctime:      f.Ctime,
+		Hash:       f.Hash,
+		Mode:       os.FileMode(f.Mode),
+		Uid:        f.Uid,
+		Gid:        f.Gid,
+		Owner:      f.Owner,
+		Attributes: f.Attributes,
+		Xattrs:     f.Xattrs,
+	}
+}
+
+// markManifestDirty 基线变化后调用, 由周期任务写回清单
+func (dm *DirectoryMonitor) markManifestDirty() {
+	dm.manifestDirty.Store(true)
+}
+
+// saveManifest 把当前基线、目录基线和符号链接写入备份目录中的清单(临时文件+rename)
+func (dm *DirectoryMonitor) saveManifest() error {
+	dm.manifestDirty.Store(false)
+
+	manifest := baselineManifest{
+		Scope:        dm.manifestScope(),
+		SavedAt:      time.Now().Format(time.RFC3339),
+		Files:        make(map[string]manifestFile),
+		Dirs:         make(map[string]manifestDir),
+		Symlinks:     make(map[string]string),
+		SpecialFiles: make(map[string]uint32),
+	}
+
+	// 只告警目录(临时目录/session目录)不备份, 不写入清单
+	dm.mu.RLock()
+	for path, info := range dm.baseline {
+		if dm.backedUp(filepath.Dir(path)) {
+			manifest.Files[path] = manifestFileOf(info)
+		}
+	}
+	for link, target := range dm.symlinks {
+		if dm.backedUp(filepath.Dir(link)) {
+			manifest.Symlinks[link] = target
+		}
+	}
+	for path, mode := range dm.specialFiles {
+		if dm.backedUp(filepath.Dir(path)) {
+			manifest.SpecialFiles[path] = uint32(mode)
+		}
+	}
+	dm.mu.RUnlock()
+
+	dm.dirMu.Lock()
+	for dir, info := range dm.dirBaseline {
+		if dm.backedUp(dir) {
+			manifest.Dirs[dir] = manifestDir{Mode: uint32(info.Mode), Uid: info.Uid, Gid: info.Gid}
+		}
+	}
+	dm.dirMu.Unlock()
+
+	name, stale := manifestName, manifestJSONLName
+	if dm.manifestFormat == "jsonl" {
+		name, stale = manifestJSONLName, manifestName
+	}
+	path := filepath.Join(dm.backupDir, name)
+	tmpPath := path + ".tmp"
+	if err := writeManifest(tmpPath, &manifest, dm.manifestFormat == "jsonl"); err != nil {
+		os.Remove(tmpPath)
+		dm.markManifestDirty()
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		dm.markManifestDirty()
+		return err
+	}
+	// 切换格式后删除另一种格式的旧清单, 否则读取时会优先使用过期的JSONL清单
+	os.Remove(filepath.Join(dm.backupDir, stale))
+	return nil
+}
+
+// writeManifest 写入清单文件; jsonl为true时第一行写清单头, 之后每个文件一行
+func writeManifest(path string, manifest *baselineManifest, jsonl bool) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	if !jsonl {
+		if err := enc.Encode(manifest); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+
+	header := *manifest
+	header.Files = nil
+	header.FileCount = len(manifest.Files)
+	if err := enc.Encode(&header); err != nil {
+		return err
+	}
+	for path, file := range manifest.Files {
+		if err := enc.Encode(manifestLine{Path: path, manifestFile: file}); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// backedUp 目录位于监控根目录内且不是只告警目录
+func (dm *DirectoryMonitor) backedUp(dir string) bool {
+	return dm.rootFor(dir) != nil && !dm.dirRules[dir].alertOnly()
+}
+
+// saveManifestIfDirty 周期任务: 基线有变化时写回清单
+func (dm *DirectoryMonitor) saveManifestIfDirty() {
+	if !dm.manifestDirty.Load() {
+		return
+	}
+	if err := dm.saveManifest(); err != nil {
+		logError(fmt.Sprintf("保存基线清单失败: %v", err))
+	}
+}
+
+// readManifest 读取备份目录中的清单, 优先使用JSONL格式; 都不存在时返回manifest.json的os.IsNotExist错误
+func readManifest(backupDir string) (*baselineManifest, error) {
+	if f, err := os.Open(filepath.Join(backupDir, manifestJSONLName)); err == nil {
+		defer f.Close()
+		manifest, err := decodeManifestJSONL(f)
+		if err != nil {
+			return nil, fmt.Errorf("解析基线清单失败: %v", err)
+		}
+		return manifest, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(backupDir, manifestName))
+	if err != nil {
+		return nil, err
+	}
+	var manifest baselineManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("解析基线清单失败: %v", err)
+	}
+	if manifest.Files == nil {
+		manifest.Files = make(map[string]manifestFile)
+	}
+	return &manifest, nil
+}
+
+// decodeManifestJSONL 逐行解析JSONL清单: 第一行为清单头, 其余每行一个文件, 不需要把整个清单读入内存.
+// 文件数与清单头中的file_count不符时说明清单被截断
+func decodeManifestJSONL(r io.Reader) (*baselineManifest, error) {
+	br := bufio.NewReader(r)
+	header, err := br.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	var manifest baselineManifest
+	if err := json.Unmarshal(header, &manifest); err != nil {
+		return nil, fmt.Errorf("清单头: %v", err)
+	}
+
+	manifest.Files = make(map[string]manifestFile, manifest.FileCount)
+	for lineNo := 2; ; lineNo++ {
+		data, err := br.ReadBytes('\n')
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			var line manifestLine
+			if err := json.Unmarshal(data, &line); err != nil {
+				return nil, fmt.Errorf("第%d行: %v", lineNo, err)
+			}
+			if line.Path == "" {
+				return nil, fmt.Errorf("第%d行: 文件记录缺少path", lineNo)
+			}
+			manifest.Files[line.Path] = line.manifestFile
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(manifest.Files) != manifest.FileCount {
+		return nil, fmt.Errorf("清单记录了 %d 个文件, 实际读取到 %d 个, 清单可能被截断", manifest.FileCount, len(manifest.Files))
+	}
+	return &manifest, nil
+}
+
+// hasManifest 备份目录中是否有任一格式的清单
+func hasManifest(dir string) bool {
+	for _, name := range []string{manifestJSONLName, manifestName} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// resumeBackupDir 返回-resume可以复用的备份目录: 基础目录下最近一次带有清单的备份
+func resumeBackupDir(baseDir string) (string, error) {
+	dir, err := latestBackupDir(baseDir)
+	if err != nil {
+		return "", err
+	}
+	if !hasManifest(dir) {
+		return "", fmt.Errorf("最近的备份没有基线清单: %s", dir)
+	}
+	return dir, nil
+}
+
+// verifyManifest 检查清单与当前参数一致, 且备份中每个文件的哈希都与清单相符
+func (dm *DirectoryMonitor) verifyManifest(manifest *baselineManifest) error {
+	if scope := dm.manifestScope(); !reflect.DeepEqual(scope, manifest.Scope) {
+		return fmt.Errorf("监控范围与上次不同 (上次: %v, 本次: %v)", manifest.Scope, scope)
+	}
+
+	for path, file := range manifest.Files {
+		backupPath, err := dm.backupPathFor(path)
+		if err != nil {
+			return err
+		}
+		hash, err := hashFile(backupPath)
+		if err != nil {
+			return fmt.Errorf("读取备份失败: %v", err)
+		}
+		if hash != file.Hash {
+			return fmt.Errorf("备份文件与清单不一致: %s", backupPath)
+		}
+	}
+	return nil
+}
+
+// useFreshBackupDir 放弃复用, 改用本次启动时间戳命名的新备份目录
+func (dm *DirectoryMonitor) useFreshBackupDir() {
+	dm.resumeBackup = false
+	dm.backupDir = filepath.Join(dm.baseDir, "backup_"+dm.startTime.Format("20060102_150405"))
+	dm.roots = newWatchRoots(dm.rootDirs(), dm.backupDir, dm.isolateDir)
+}
+
+// resumeFromManifest 复用上次的备份目录: 验证通过后从清单载入基线, 停机期间被删除的目录按备份重建.
+// 停机期间对文件的修改在随后的检查中按篡改处理并还原
+func (dm *DirectoryMonitor) resumeFromManifest() error {
+	manifest, err := readManifest(dm.backupDir)
+	if err != nil {
+		return err
+	}
+	if err := dm.verifyManifest(manifest); err != nil {
+		return err
+	}
+
+	baseline := make(map[string]FileInfo, len(manifest.Files))
+	for path, file := range manifest.Files {
+		baseline[path] = file.fileInfo(path)
+	}
+
+	dm.mu.Lock()
+	dm.baseline = baseline
+	dm.baselineBuiltAt = time.Now()
+	for link, target := range manifest.Symlinks {
+		dm.symlinks[link] = target
+	}
+	for path, mode := range manifest.SpecialFiles {
+		dm.specialFiles[path] = os.FileMode(mode)
+	}
+	dm.mu.Unlock()
+
+	dm.dirMu.Lock()
+	for dir, info := range manifest.Dirs {
+		dm.dirBaseline[dir] = DirInfo{Mode: os.FileMode(info.Mode), Uid: info.Uid, Gid: info.Gid}
+	}
+	dm.dirMu.Unlock()
+
+	var missing []string
+	for dir := range manifest.Dirs {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			missing = append(missing, dir)
+		}
+	}
+	// 父目录先于子目录, restoreTree会一并重建其下的子目录
+	sort.Strings(missing)
+	if dm.dryRun && len(missing) > 0 {
+		logWarn(fmt.Sprintf("DRY-RUN模式: 停机期间被删除的 %d 个目录不重建: %v", len(missing), missing))
+		missing = nil
+	}
+	for _, dir := range missing {
+		if err := dm.restoreTree(dir); err != nil {
+			logError(fmt.Sprintf("重建目录树失败 %s: %v", dir, err))
+		}
+	}
+
+	logSuccess(fmt.Sprintf("已复用备份 %s: %d 个文件, %d 个目录 (清单保存于 %s)",
+		dm.backupDir, len(baseline), len(manifest.Dirs), manifest.SavedAt))
+	return nil
+}
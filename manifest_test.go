@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testManifest() *baselineManifest {
+	return &baselineManifest{
+		Scope:   manifestScope{WatchDirs: []string{"/var/www/html"}, Extensions: []string{".php"}, Excludes: []string{}},
+		SavedAt: "2025-08-21T14:30:22+08:00",
+		Files: map[string]manifestFile{
+			"/var/www/html/index.php":    {Size: 120, ModTime: 1755757822, Inode: 42, Hash: "e3b0c442", Mode: 0644, Uid: 33, Gid: 33},
+			"/var/www/html/upload/a.php": {Size: 7, ModTime: 1755757823, Inode: 43, Hash: "5d41402a", Mode: 0600},
+			"/var/www/html/含空格 的文件.php":  {Size: 1, Hash: "0cc175b9", Mode: 0644, Owner: "www-data"},
+		},
+		Dirs:     map[string]manifestDir{"/var/www/html": {Mode: 0755, Uid: 33, Gid: 33}},
+		Symlinks: map[string]string{"/var/www/html/latest": "upload"},
+	}
+}
+
+func writeTestManifest(t *testing.T, dir string, jsonl bool) string {
+	name := manifestName
+	if jsonl {
+		name = manifestJSONLName
+	}
+	path := filepath.Join(dir, name)
+	if err := writeManifest(path, testManifest(), jsonl); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	for _, jsonl := range []bool{false, true} {
+		dir := t.TempDir()
+		writeTestManifest(t, dir, jsonl)
+
+		got, err := readManifest(dir)
+		if err != nil {
+			t.Fatalf("jsonl=%v: %v", jsonl, err)
+		}
+		want := testManifest()
+		if !reflect.DeepEqual(got.Scope, want.Scope) || got.SavedAt != want.SavedAt ||
+			!reflect.DeepEqual(got.Files, want.Files) || !reflect.DeepEqual(got.Dirs, want.Dirs) ||
+			!reflect.DeepEqual(got.Symlinks, want.Symlinks) {
+			t.Errorf("jsonl=%v: 读回的清单不一致:\n got %+v\nwant %+v", jsonl, got, want)
+		}
+	}
+}
+
+func TestReadManifestPrefersJSONL(t *testing.T) {
+	dir := t.TempDir()
+	writeTestManifest(t, dir, true)
+	if err := os.WriteFile(filepath.Join(dir, manifestName), []byte(`{"files":{}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Files) != len(testManifest().Files) {
+		t.Errorf("应读取manifest.jsonl, 实际读到 %d 个文件", len(got.Files))
+	}
+}
+
+func TestReadManifestMissing(t *testing.T) {
+	if _, err := readManifest(t.TempDir()); !os.IsNotExist(err) {
+		t.Errorf("没有清单时应返回IsNotExist错误, 实际: %v", err)
+	}
+}
+
+// TestResumeRejectsCorruptManifest 被截断或损坏的清单不能用于-resume, 否则缺少的文件会被当作新增文件隔离
+func TestResumeRejectsCorruptManifest(t *testing.T) {
+	cases := []struct {
+		name    string
+		jsonl   bool
+		corrupt func(data []byte) []byte
+	}{
+		{"json截断", false, func(data []byte) []byte { return data[:len(data)/2] }},
+		{"json损坏", false, func(data []byte) []byte { return append([]byte("{x"), data...) }},
+		{"jsonl行内截断", true, func(data []byte) []byte { return data[:len(data)-10] }},
+		{"jsonl缺少最后一行", true, func(data []byte) []byte {
+			end := len(data) - 1
+			for end > 0 && data[end-1] != '\n' {
+				end--
+			}
+			return data[:end]
+		}},
+		{"jsonl清单头损坏", true, func(data []byte) []byte { return append([]byte("not json"), data...) }},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			base, watch := t.TempDir(), t.TempDir()
+			backup := filepath.Join(base, "backup_20250821_143022")
+			if err := os.Mkdir(backup, 0700); err != nil {
+				t.Fatal(err)
+			}
+			path := writeTestManifest(t, backup, c.jsonl)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, c.corrupt(data), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			dm := NewDirectoryMonitor(MonitorConfig{WatchDirs: []string{watch}, BaseDir: base, Resume: true})
+			defer dm.cancel()
+			if dm.backupDir != backup {
+				t.Fatalf("应复用 %s, 实际: %s", backup, dm.backupDir)
+			}
+			if err := dm.resumeFromManifest(); err == nil {
+				t.Fatal("损坏的清单应导致复用失败")
+			}
+			if len(dm.baseline) != 0 {
+				t.Errorf("复用失败时不应载入基线, 实际 %d 个文件", len(dm.baseline))
+			}
+		})
+	}
+}
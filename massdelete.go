@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// checkMassDeletion 一次检查中目录内消失的文件超过-mass-delete-threshold时按批量删除(rm -rf)处理:
+// 只发出一条汇总的critical告警, 然后批量重建整棵子目录树并还原其中所有缺失的文件; 返回true表示已处理
+func (dm *DirectoryMonitor) checkMassDeletion(dirPath string, baseline, current map[string]FileInfo) bool {
+	if dm.massDeleteThreshold <= 0 {
+		return false
+	}
+
+	var missing []string
+	for filePath := range baseline {
+		if _, exists := current[filePath]; exists {
+			continue
+		}
+		if dm.isLockedOut(filePath) || dm.isSuppressed(filePath) || dm.policyFor(filePath) == policyAlert {
+			continue
+		}
+		missing = append(missing, filePath)
+	}
+	if len(missing) <= dm.massDeleteThreshold {
+		return false
+	}
+	sort.Strings(missing)
+
+	dm.alert("critical", "mass_deletion",
+		fmt.Sprintf("检测到批量删除: %s 中 %d 个文件在一次检查内消失 (%s 等)，按备份批量还原整棵目录树",
+			dirPath, len(missing), filepath.Base(missing[0])))
+	for range missing {
+		dm.stats.countChange(changeDeleted)
+	}
+
+	if dm.dryRun {
+		for _, filePath := range missing {
+			dm.acceptDryRun(filePath, policyRestore)
+		}
+		return true
+	}
+
+	dirs, restored, failed := dm.bulkRestore(dirPath)
+	logSuccess(fmt.Sprintf("批量还原完成: %s (重建 %d 个目录, 还原 %d 个文件, 失败 %d 个)", dirPath, dirs, restored, failed))
+	dm.audit("mass_deletion", dirPath,
+		fmt.Sprintf("消失 %d 个文件; 重建 %d 个目录, 还原 %d 个文件, 失败 %d 个", len(missing), dirs, restored, failed))
+	return true
+}
+
+// bulkRestore 重建root下所有缺失的目录(恢复权限和所有者), 再从备份还原子树中所有缺失的文件;
+// 持有treeMu, 子目录的检查发现目录缺失时不会重复重建
+func (dm *DirectoryMonitor) bulkRestore(root string) (int, int, int) {
+	dm.treeMu.Lock()
+	defer dm.treeMu.Unlock()
+
+	dm.dirMu.Lock()
+	var dirs []string
+	for dir := range dm.dirBaseline {
+		if withinDir(dir, root) && dir != root {
+			if _, err := os.Lstat(dir); os.IsNotExist(err) {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	dm.dirMu.Unlock()
+	sort.Strings(dirs)
+
+	if err := dm.recreateDirs(dirs); err != nil {
+		logError(fmt.Sprintf("重建目录树失败 %s: %v", root, err))
+	}
+
+	dm.mu.RLock()
+	var files []string
+	for filePath := range dm.baseline {
+		if withinDir(filePath, root) {
+			files = append(files, filePath)
+		}
+	}
+	dm.mu.RUnlock()
+	sort.Strings(files)
+
+	restored, failed := 0, 0
+	for _, filePath := range files {
+		if _, err := os.Lstat(filePath); !os.IsNotExist(err) {
+			continue
+		}
+		if dm.isLockedOut(filePath) || dm.isSuppressed(filePath) || dm.policyFor(filePath) == policyAlert {
+			continue
+		}
+		if err := dm.restoreFile(filePath); err != nil {
+			logError(fmt.Sprintf("还原文件失败 %s: %v", filePath, err))
+			failed++
+			continue
+		}
+		restored++
+	}
+	return len(dirs), restored, failed
+}
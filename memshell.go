@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// memshellScanInterval 遍历Web worker进程fd和内存映射的间隔, 每次都要读取所有worker的fd, 间隔较长
+const memshellScanInterval = 10 * time.Second
+
+// memshellAgentExts Java内存马常用已删除的agent jar或class注入, 与-e和-dangerous-ext-list一起检查
+var memshellAgentExts = []string{".jar", ".class"}
+
+// execMapping /proc/<pid>/maps中一段可执行的映射
+type execMapping struct {
+	addr  string
+	perms string
+	path  string
+}
+
+// readExecMappings 返回进程的可执行映射中的匿名映射数量, 以及由memfd或已删除文件支撑的映射
+func readExecMappings(pid int) (int, []execMapping, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	anon := 0
+	var suspicious []execMapping
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 地址 权限 偏移 设备 inode 路径, 路径可能为空或含空格
+		fields := strings.SplitN(scanner.Text(), " ", 6)
+		if len(fields) < 5 || !strings.Contains(fields[1], "x") {
+			continue
+		}
+		path := ""
+		if len(fields) == 6 {
+			path = strings.TrimSpace(fields[5])
+		}
+		switch {
+		case path == "":
+			anon++
+		case strings.HasPrefix(path, "/memfd:") || strings.HasSuffix(path, " (deleted)"):
+			suspicious = append(suspicious, execMapping{addr: fields[0], perms: fields[1], path: path})
+		}
+	}
+	return anon, suspicious, scanner.Err()
+}
+
+// deletedScripts 返回进程打开的、已被删除的脚本文件, 键为fd编号
+func deletedScripts(pid int, exts map[string]bool) map[string]string {
+	fdDir := fmt.Sprintf("/proc/%d/fd", pid)
+	fds, err := os.ReadDir(fdDir)
+	if err != nil {
+		return nil
+	}
+	found := make(map[string]string)
+	for _, fd := range fds {
+		link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+		if err != nil || !strings.HasSuffix(link, " (deleted)") {
+			continue
+		}
+		path := strings.TrimSuffix(link, " (deleted)")
+		if exts[strings.ToLower(filepath.Ext(path))] {
+			found[fd.Name()] = path
+		}
+	}
+	return found
+}
+
+// startMemshellMonitor 定期检查php-fpm/apache/java等Web worker进程(-memshell-procs):
+// 打开着已删除的脚本文件(自删除的不死马), 由memfd或已删除文件支撑的可执行映射(无文件落地的ELF)告警critical;
+// 匿名可执行映射数量超过启动时同名进程的最大值(注入的shellcode)告警warning. 磁盘检查看不到这些内存马, 只告警
+func (dm *DirectoryMonitor) startMemshellMonitor() {
+	if _, err := listPids(); err != nil {
+		logWarn(fmt.Sprintf("无法读取/proc, 跳过内存马检测: %v", err))
+		return
+	}
+
+	names := make(map[string]bool)
+	for _, name := range dm.memshellProcs {
+		names[baseProcName(name)] = true
+	}
+	exts := make(map[string]bool)
+	for _, list := range [][]string{dm.extensions, dm.dangerousExts, memshellAgentExts} {
+		for _, ext := range list {
+			exts[strings.ToLower(ext)] = true
+		}
+	}
+
+	// workers 返回当前的Web worker进程及其规范化后的进程名
+	workers := func() map[int]procInfo {
+		result := make(map[int]procInfo)
+		pids, err := listPids()
+		if err != nil {
+			return result
+		}
+		for _, pid := range pids {
+			info, err := readProcInfo(pid)
+			if err != nil {
+				continue
+			}
+			if names[baseProcName(procExeName(info))] || names[baseProcName(info.name)] {
+				result[pid] = info
+			}
+		}
+		return result
+	}
+
+	// anonBaseline 启动时各程序单个进程的匿名可执行映射数量的最大值; PHP的pcre.jit和JVM的JIT本身就会产生匿名可执行映射
+	anonBaseline := make(map[string]int)
+	initial := workers()
+	for pid, info := range initial {
+		if anon, _, err := readExecMappings(pid); err == nil {
+			name := baseProcName(procExeName(info))
+			if anon > anonBaseline[name] {
+				anonBaseline[name] = anon
+			}
+		}
+	}
+	logInfo(fmt.Sprintf("内存马检测已启动, 当前 %d 个Web worker进程, 检查间隔: %v", len(initial), memshellScanInterval))
+
+	// alerted 各进程已告警的对象, 以pid和启动时间区分复用的pid, 进程退出后清理
+	alerted := make(map[string]map[string]bool)
+	seen := func(info procInfo, item string) bool {
+		key := fmt.Sprintf("%d/%s", info.pid, info.start)
+		if alerted[key] == nil {
+			alerted[key] = make(map[string]bool)
+		}
+		if alerted[key][item] {
+			return true
+		}
+		alerted[key][item] = true
+		return false
+	}
+
+	dm.runPeriodic(memshellScanInterval, func() {
+		current := workers()
+		live := make(map[string]bool, len(current))
+		for _, info := range current {
+			live[fmt.Sprintf("%d/%s", info.pid, info.start)] = true
+		}
+		for key := range alerted {
+			if !live[key] {
+				delete(alerted, key)
+			}
+		}
+
+		for pid, info := range current {
+			exe := procExeName(info)
+
+			for fd, path := range deletedScripts(pid, exts) {
+				if seen(info, "fd:"+path) {
+					continue
+				}
+				dm.alertFile("critical", "memshell_deleted_script",
+					fmt.Sprintf("检测到Web worker进程打开着已删除的脚本文件: pid=%d %s, %s (可从/proc/%d/fd/%s读取原内容)，可能是自删除的不死马",
+						pid, exe, path, pid, fd), alertDetail{Path: path})
+			}
+
+			anon, mappings, err := readExecMappings(pid)
+			if err != nil {
+				continue
+			}
+			for _, m := range mappings {
+				if seen(info, "map:"+m.path) {
+					continue
+				}
+				dm.alert("critical", "memshell_exec_mapping",
+					fmt.Sprintf("检测到Web worker进程中由memfd或已删除文件支撑的可执行内存: pid=%d %s, %s %s %s，可能是无文件落地的后门",
+						pid, exe, m.addr, m.perms, m.path))
+			}
+
+			// 启动时没有运行的程序以第一次见到的进程为准
+			name := baseProcName(exe)
+			limit, ok := anonBaseline[name]
+			if !ok {
+				anonBaseline[name] = anon
+				continue
+			}
+			if anon > limit && !seen(info, "anon") {
+				dm.alert("warning", "memshell_anon_exec",
+					fmt.Sprintf("检测到Web worker进程的匿名可执行内存映射异常: pid=%d %s, %d 段(启动时同名进程最多 %d 段)，可能被注入了shellcode",
+						pid, exe, anon, limit))
+			}
+		}
+	})
+}
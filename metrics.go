@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// checkLatencyBuckets 单个目录一次检查耗时的直方图分桶(秒)
+var checkLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// errorCount logError的调用次数, 作为错误计数导出
+var errorCount atomic.Int64
+
+// alertKey 按级别和事件类型分组的告警计数键
+type alertKey struct {
+	level string
+	event string
+}
+
+// checkLatency 目录检查耗时的直方图, 由monitorStats.mu保护
+type checkLatency struct {
+	buckets []int64
+	sum     float64
+	count   int64
+}
+
+func (s *monitorStats) countAlert(level, event string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.alertsByType == nil {
+		s.alertsByType = make(map[alertKey]int64)
+	}
+	s.alertsByType[alertKey{level, event}]++
+}
+
+// observeCheck 记录一次目录检查的耗时, 用法: defer dm.stats.observeCheck(time.Now())
+func (s *monitorStats) observeCheck(start time.Time) {
+	seconds := time.Since(start).Seconds()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.latency.buckets == nil {
+		s.latency.buckets = make([]int64, len(checkLatencyBuckets))
+	}
+	for i, bound := range checkLatencyBuckets {
+		if seconds <= bound {
+			s.latency.buckets[i]++
+		}
+	}
+	s.latency.sum += seconds
+	s.latency.count++
+}
+
+// metricsWriter 按Prometheus文本格式输出指标
+type metricsWriter struct {
+	b strings.Builder
+}
+
+func (m *metricsWriter) header(name, kind, help string) {
+	fmt.Fprintf(&m.b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (m *metricsWriter) metric(name, kind, help string, value interface{}) {
+	m.header(name, kind, help)
+	fmt.Fprintf(&m.b, "%s %v\n", name, value)
+}
+
+// handleMetrics GET /metrics Prometheus格式的运行指标
+func (dm *DirectoryMonitor) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	dm.mu.RLock()
+	files := len(dm.baseline)
+	dm.mu.RUnlock()
+
+	var m metricsWriter
+	m.metric("edr_checks_total", "counter", "目录检查次数(每次检查目录中的所有文件)", dm.stats.checks.Load())
+	m.metric("edr_restores_total", "counter", "还原的文件数", dm.stats.restores.Load())
+	m.metric("edr_isolations_total", "counter", "隔离的文件数", dm.stats.isolations.Load())
+	m.metric("edr_errors_total", "counter", "错误日志条数", errorCount.Load())
+	m.metric("edr_baseline_files", "gauge", "基线中的文件数", files)
+	m.metric("edr_watched_directories", "gauge", "监控中的目录数", len(dm.directoryList()))
+	m.metric("edr_uptime_seconds", "gauge", "运行时长", int64(time.Since(dm.startTime).Seconds()))
+	lastCycle, _, _ := dm.scheduler.cycleStats()
+	m.metric("edr_scan_cycle_seconds", "gauge", "最近一次所有目录各检查一次的耗时", lastCycle.Seconds())
+
+	paused := 0
+	if dm.paused.Load() {
+		paused = 1
+	}
+	m.metric("edr_paused", "gauge", "检测是否暂停", paused)
+	if dm.alertQueue != nil {
+		m.metric("edr_alert_queue_length", "gauge", "等待重试的告警数", dm.alertQueue.len())
+	}
+
+	dm.stats.mu.Lock()
+	keys := make([]alertKey, 0, len(dm.stats.alertsByType))
+	for key := range dm.stats.alertsByType {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].event != keys[j].event {
+			return keys[i].event < keys[j].event
+		}
+		return keys[i].level < keys[j].level
+	})
+
+	m.header("edr_alerts_total", "counter", "按级别和事件类型统计的告警数")
+	for _, key := range keys {
+		fmt.Fprintf(&m.b, "edr_alerts_total{level=%q,event=%q} %d\n",
+			key.level, key.event, dm.stats.alertsByType[key])
+	}
+
+	m.header("edr_check_duration_seconds", "histogram", "单个目录一次检查的耗时")
+	for i, bound := range checkLatencyBuckets {
+		var count int64
+		if dm.stats.latency.buckets != nil {
+			count = dm.stats.latency.buckets[i]
+		}
+		fmt.Fprintf(&m.b, "edr_check_duration_seconds_bucket{le=\"%g\"} %d\n", bound, count)
+	}
+	fmt.Fprintf(&m.b, "edr_check_duration_seconds_bucket{le=\"+Inf\"} %d\n", dm.stats.latency.count)
+	fmt.Fprintf(&m.b, "edr_check_duration_seconds_sum %g\n", dm.stats.latency.sum)
+	fmt.Fprintf(&m.b, "edr_check_duration_seconds_count %d\n", dm.stats.latency.count)
+	dm.stats.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(m.b.String()))
+}
+
+// startMetricsServer 单独监听/metrics, 便于只向Prometheus开放指标而不暴露控制API
+func (dm *DirectoryMonitor) startMetricsServer(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", dm.handleMetrics)
+
+	go func() {
+		logInfo(fmt.Sprintf("指标接口已启动: http://%s/metrics", addr))
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			logError(fmt.Sprintf("指标接口启动失败: %v", err))
+		}
+	}()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// moveFile 移动文件、符号链接或目录树; 源和目标不在同一文件系统时(EXDEV, 例如-b指向tmpfs上的/tmp)
+// 退回为复制+fsync+删除源文件, 复制完成前不删除源文件
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	if err := copyTree(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return fmt.Errorf("跨文件系统复制失败: %v", err)
+	}
+	if err := os.RemoveAll(src); err != nil {
+		return fmt.Errorf("已复制到 %s, 但删除源文件失败: %v", dst, err)
+	}
+	return nil
+}
+
+// copyTree 复制src到dst, 保留权限、所有者和修改时间
+func copyTree(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(target, dst); err != nil {
+			return err
+		}
+	case info.IsDir():
+		if err := os.Mkdir(dst, 0700); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := copyTree(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+				return err
+			}
+		}
+	case info.Mode().IsRegular():
+		if err := copyRegular(src, dst); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("不支持的文件类型: %s (%v)", src, info.Mode().Type())
+	}
+
+	return copyAttributes(dst, info)
+}
+
+func copyRegular(src, dst string) error {
+	in, err := os.OpenFile(src, os.O_RDONLY|oNoFollow, 0)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// copyAttributes 先chown再chmod(chown会清除setuid/setgid位), 符号链接只恢复所有者
+func copyAttributes(dst string, info os.FileInfo) error {
+	uid, gid := ownerIDs(info)
+	if err := setOwner(dst, uid, gid, ""); err != nil {
+		logDebug(fmt.Sprintf("设置文件所有者失败 %s: %v", dst, err))
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+
+	if err := os.Chmod(dst, info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// procNetInterval 监听端口的检查间隔
+const procNetInterval = 5 * time.Second
+
+// tcpListenState /proc/net/tcp中LISTEN状态的编码
+const tcpListenState = "0A"
+
+// listeningPort 一个处于LISTEN状态的socket
+type listeningPort struct {
+	Proto string
+	Addr  string
+	Port  int
+	Inode string
+}
+
+func (p listeningPort) key() string {
+	return fmt.Sprintf("%s %s:%d", p.Proto, p.Addr, p.Port)
+}
+
+// parseProcNetAddr 解析/proc/net/tcp中"地址:端口"形式的十六进制字段, 地址按32位小端存储
+func parseProcNetAddr(field string) (string, int, error) {
+	parts := strings.Split(field, ":")
+	if len(parts) != 2 {
+		return "", 0, fmt.Errorf("无效的地址: %s", field)
+	}
+
+	raw, err := hex.DecodeString(parts[0])
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return "", 0, fmt.Errorf("无效的地址: %s", field)
+	}
+	for i := 0; i+4 <= len(raw); i += 4 {
+		raw[i], raw[i+1], raw[i+2], raw[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("无效的端口: %s", field)
+	}
+	return net.IP(raw).String(), int(port), nil
+}
+
+// readListeningPorts 读取/proc/net/tcp格式的文件, 返回其中处于LISTEN状态的socket
+func readListeningPorts(path, proto string) ([]listeningPort, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ports []listeningPort
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // 跳过表头
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != tcpListenState {
+			continue
+		}
+
+		addr, port, err := parseProcNetAddr(fields[1])
+		if err != nil {
+			continue
+		}
+		ports = append(ports, listeningPort{Proto: proto, Addr: addr, Port: port, Inode: fields[9]})
+	}
+	return ports, scanner.Err()
+}
+
+// currentListeningPorts 汇总tcp和tcp6的监听端口, 不支持IPv6的系统忽略tcp6
+func currentListeningPorts() (map[string]listeningPort, error) {
+	ports := make(map[string]listeningPort)
+	for _, source := range []struct{ path, proto string }{
+		{"/proc/net/tcp", "tcp"},
+		{"/proc/net/tcp6", "tcp6"},
+	} {
+		list, err := readListeningPorts(source.path, source.proto)
+		if err != nil {
+			if source.proto == "tcp6" && os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, p := range list {
+			ports[p.key()] = p
+		}
+	}
+	return ports, nil
+}
+
+// startProcNetMonitor 以启动时的监听端口为基线, 之后出现的新监听端口(bind shell, 代理)告警new_listening_port
+// 并给出监听的进程, procNetKill为true时结束该进程
+func (dm *DirectoryMonitor) startProcNetMonitor() {
+	baseline, err := currentListeningPorts()
+	if err != nil {
+		logWarn(fmt.Sprintf("读取监听端口失败，跳过端口监控: %v", err))
+		return
+	}
+	logInfo(fmt.Sprintf("监听端口监控已启动，当前 %d 个监听端口，检查间隔: %v", len(baseline), procNetInterval))
+
+	// alerted 已告警且仍在监听的端口, 关闭后再次监听会重新告警
+	alerted := make(map[string]bool)
+
+	dm.runPeriodic(procNetInterval, func() {
+		current, err := currentListeningPorts()
+		if err != nil {
+			logError(fmt.Sprintf("读取监听端口失败: %v", err))
+			return
+		}
+
+		for key := range alerted {
+			if _, ok := current[key]; !ok {
+				delete(alerted, key)
+			}
+		}
+
+		var found []listeningPort
+		inodes := make(map[string]bool)
+		for key, p := range current {
+			if _, ok := baseline[key]; ok || alerted[key] {
+				continue
+			}
+			alerted[key] = true
+			found = append(found, p)
+			inodes[p.Inode] = true
+		}
+		if len(found) == 0 {
+			return
+		}
+
+		owners := socketOwners(inodes)
+		for _, p := range found {
+			owner, exe := "未知(进程已退出或无权限读取)", ""
+			pid, ok := owners[p.Inode]
+			if ok {
+				exe, _ = os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+				owner = fmt.Sprintf("pid=%d %s, 命令行: %s", pid, exe, procCmdline(pid))
+			}
+			detail := alertDetail{}
+			if ok && dm.procNetKill {
+				detail.Action = actionKill
+			}
+			dm.alertFile("critical", "new_listening_port",
+				fmt.Sprintf("检测到新的监听端口: %d (%s %s, inode: %s)，可能是后门, 进程: %s", p.Port, p.Proto, p.Addr, p.Inode, owner), detail)
+			if ok && dm.procNetKill {
+				dm.killProcess(pid, exe, fmt.Sprintf("listen=%s", p.key()))
+			}
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func (dm *DirectoryMonitor) isKnownDir(dir string) bool {
+	dm.dirMu.Lock()
+	defer dm.dirMu.Unlock()
+
+	return dm.knownDirs[dir]
+}
+
+// directoryList 返回当前监控的目录列表的副本
+func (dm *DirectoryMonitor) directoryList() []string {
+	dm.dirMu.Lock()
+	defer dm.dirMu.Unlock()
+
+	return append([]string(nil), dm.directories...)
+}
+
+// checkNewSubdirectories 发现运行期间新建的子目录: 告警new_directory,
+// 然后按配置隔离整个目录, 或把目录树纳入监控
+func (dm *DirectoryMonitor) checkNewSubdirectories(subdirs []string) {
+	for _, dir := range subdirs {
+		if dm.isKnownDir(dir) || dm.isExcluded(dir) {
+			continue
+		}
+
+		entries, _ := os.ReadDir(dir)
+		dm.alert("critical", "new_directory",
+			fmt.Sprintf("检测到新增目录: %s (包含 %d 项)", dir, len(entries)))
+		dm.stats.countChange(changeCreated)
+
+		if dm.isolateNewDirs && !dm.dryRun {
+			if err := dm.isolateFile(dir, isolateReason{Event: "new_directory"}); err != nil {
+				logError(fmt.Sprintf("隔离新增目录失败: %v", err))
+				dm.addDirectoryTree(dir)
+			}
+			continue
+		}
+		dm.addDirectoryTree(dir)
+	}
+}
+
+// addDirectoryTree 把新目录及其已有的子目录加入扫描调度, 由共用的扫描worker立即检查一次;
+// 新目录的基线为空, 其中已有的文件会在第一次检查时按新增文件处理
+func (dm *DirectoryMonitor) addDirectoryTree(root string) {
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if dm.isExcluded(path) {
+			return filepath.SkipDir
+		}
+
+		dm.dirMu.Lock()
+		if dm.knownDirs[path] {
+			dm.dirMu.Unlock()
+			return nil
+		}
+		dm.knownDirs[path] = true
+		dm.directories = append(dm.directories, path)
+		dm.dirMu.Unlock()
+
+		logInfo(fmt.Sprintf("新目录已纳入监控: %s", path))
+		dm.scheduleNewDirectory(path, dm.intervalFor(path))
+		return nil
+	})
+}
@@ -2,6 +2,8 @@
 # -*- coding: utf-8 -*-
 
 import argparse
+import hashlib
+import hmac
 import json
 import logging
 import threading
@@ -38,8 +40,10 @@ logging.basicConfig(
 logger = logging.getLogger(__name__)
 
 class EDRNotifier:
-    def __init__(self, sound_enabled=True, log_to_file=True):
+    def __init__(self, sound_enabled=True, log_to_file=True, token=None, hmac_key=None):
         self.sound_enabled = sound_enabled
+        self.token = token
+        self.hmac_key = hmac_key
         self.alert_count = 0
         self.system = platform.system()
         logger.info(f"EDR告警提醒器启动 - 系统: {self.system}")
@@ -139,6 +143,9 @@ class EDRAlertHandler(BaseHTTPRequestHandler):
         parsed_url = urlparse(self.path)
         
         if parsed_url.path == "/api/agent/edr-alert":
+            if not self._authorized(b""):
+                self._send_error_response(401, "认证失败")
+                return
             self._handle_edr_alert(parsed_url)
         elif parsed_url.path == "/health":
             self._handle_health_check()
@@ -150,11 +157,40 @@ class EDRAlertHandler(BaseHTTPRequestHandler):
     def do_POST(self):
         """处理POST请求"""
         parsed_url = urlparse(self.path)
-        
-        if parsed_url.path == "/api/agent/edr-alert":
-            self._handle_edr_alert_post()
-        else:
+        content_length = int(self.headers.get('Content-Length', 0))
+        body = self.rfile.read(content_length)
+
+        if parsed_url.path not in ("/api/agent/edr-alert", "/api/agent/edr-heartbeat"):
             self._send_error_response(404, "Not Found")
+        elif not self._authorized(body):
+            self._send_error_response(401, "认证失败")
+        elif parsed_url.path == "/api/agent/edr-alert":
+            self._handle_edr_alert_post(body)
+        else:
+            self._handle_heartbeat(body)
+
+    def _authorized(self, body):
+        """校验Bearer令牌和HMAC签名(X-EDR-Timestamp/X-EDR-Signature), 未配置时不校验"""
+        token = self.notifier.token
+        if token and not hmac.compare_digest(self.headers.get('Authorization', ''), f"Bearer {token}"):
+            logger.warning(f"拒绝令牌错误的请求: {self.address_string()}")
+            return False
+
+        key = self.notifier.hmac_key
+        if key:
+            timestamp = self.headers.get('X-EDR-Timestamp', '')
+            try:
+                # 拒绝5分钟之前的签名, 防止重放
+                if abs(time.time() - int(timestamp)) > 300:
+                    raise ValueError(timestamp)
+            except ValueError:
+                logger.warning(f"拒绝签名时间戳无效的请求: {self.address_string()}")
+                return False
+            expected = "sha256=" + hmac.new(key.encode(), timestamp.encode() + b"." + body, hashlib.sha256).hexdigest()
+            if not hmac.compare_digest(self.headers.get('X-EDR-Signature', ''), expected):
+                logger.warning(f"拒绝签名错误的请求: {self.address_string()}")
+                return False
+        return True
     
     def _handle_edr_alert(self, parsed_url):
         """处理EDR告警 (GET方式)"""
@@ -176,18 +212,19 @@ class EDRAlertHandler(BaseHTTPRequestHandler):
             logger.error(f"处理EDR告警失败: {e}")
             self._send_error_response(500, f"处理告警失败: {str(e)}")
     
-    def _handle_edr_alert_post(self):
+    def _handle_edr_alert_post(self, body):
         """处理EDR告警 (POST方式)"""
         try:
-            content_length = int(self.headers.get('Content-Length', 0))
-            post_data = self.rfile.read(content_length).decode('utf-8')
-            
             # 解析JSON数据
-            alert_data = json.loads(post_data)
+            alert_data = json.loads(body.decode('utf-8'))
             alert_type = alert_data.get('type', 'info')
             message = alert_data.get('message', '未知告警')
             
             self._process_alert(alert_type, message)
+            # 被修改的文本文件附带与备份的unified diff
+            if alert_data.get('diff'):
+                logger.warning(f"文件差异 {alert_data.get('path', '')}:\n{alert_data['diff']}")
+
             
             # 返回成功响应
             self._send_json_response(200, {
@@ -199,6 +236,24 @@ class EDRAlertHandler(BaseHTTPRequestHandler):
             logger.error(f"处理POST告警失败: {e}")
             self._send_error_response(500, f"处理告警失败: {str(e)}")
     
+    def _handle_heartbeat(self, body):
+        """处理EDR心跳 (周期统计)"""
+        try:
+            heartbeat = json.loads(body.decode('utf-8'))
+            interval = heartbeat.get('interval', {})
+
+            logger.info(
+                f"EDR心跳 [{heartbeat.get('hostname', '未知主机')}] "
+                f"新增: {interval.get('created', 0)}, 修改: {interval.get('modified', 0)}, "
+                f"删除: {interval.get('deleted', 0)}, 权限变更: {interval.get('permission_changed', 0)}"
+            )
+
+            self._send_json_response(200, {"status": "success"})
+
+        except Exception as e:
+            logger.error(f"处理心跳失败: {e}")
+            self._send_error_response(500, f"处理心跳失败: {str(e)}")
+
     def _process_alert(self, alert_type, message):
         """处理告警逻辑"""
         self.notifier.alert_count += 1
@@ -281,11 +336,15 @@ def main():
                        help="禁用告警音效")
     parser.add_argument("--test", action="store_true",
                        help="发送测试通知")
+    parser.add_argument("--token",
+                       help="只接受带有 Authorization: Bearer <令牌> 的告警, 与edr的-webhook-token一致")
+    parser.add_argument("--hmac-key",
+                       help="校验告警的HMAC-SHA256签名, 与edr的-webhook-hmac-key一致")
     
     args = parser.parse_args()
     
     # 创建通知器
-    notifier = EDRNotifier(sound_enabled=not args.no_sound)
+    notifier = EDRNotifier(sound_enabled=not args.no_sound, token=args.token, hmac_key=args.hmac_key)
     
     # 测试模式
     if args.test:
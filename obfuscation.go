@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"os"
+	"regexp"
+	"strings"
+)
+
+// obfuscationScanSize 计算混淆评分时读取的最大字节数
+const obfuscationScanSize = 256 * 1024
+
+// obfuscationSign 一项混淆特征: 匹配次数达到min时计分
+type obfuscationSign struct {
+	name   string
+	re     *regexp.Regexp
+	min    int
+	weight int
+}
+
+// decodeFuncs PHP中常用于还原混淆载荷的函数
+const decodeFuncs = `(?:gzinflate|gzuncompress|gzdecode|str_rot13|base64_decode|strrev|convert_uudecode|hex2bin|rawurldecode)`
+
+var obfuscationSigns = []obfuscationSign{
+	// 长base64块: 压缩或加密后编码的载荷
+	{"base64_blob", regexp.MustCompile(`[A-Za-z0-9+/]{200,}={0,2}`), 1, 3},
+	// eval(gzinflate(base64_decode(...)))这类解码链
+	{"decode_chain", regexp.MustCompile(`(?i)` + decodeFuncs + `\s*\(\s*` + decodeFuncs + `\s*\(`), 1, 4},
+	{"eval_decoded", regexp.MustCompile(`(?i)\b(?:eval|assert)\s*\(\s*` + decodeFuncs + `\s*\(`), 1, 4},
+	// chr(101).chr(118)...拼接出函数名
+	{"chr_concat", regexp.MustCompile(`(?i)chr\s*\(\s*\d+\s*\)\s*\.`), 8, 3},
+	// "\x65\x76\x61\x6c"等转义字符串
+	{"escaped_string", regexp.MustCompile(`(?:\\x[0-9a-fA-F]{2}|\\[0-7]{3}){8,}`), 1, 2},
+	// $a='as'.'sert'; $a(...) 字符串拼接出的函数名
+	{"string_split", regexp.MustCompile(`(?:['"][a-z_]{1,4}['"]\s*\.\s*){2,}['"][a-z_]{1,4}['"]`), 1, 2},
+	{"preg_replace_e", regexp.MustCompile(`(?i)preg_replace\s*\(\s*['"][/#~][^'"]*[/#~][a-z]*e[a-z]*['"]`), 1, 3},
+	{"create_function", regexp.MustCompile(`(?i)\bcreate_function\s*\(`), 1, 2},
+}
+
+// obfuscationReport 文件的熵和混淆特征评分
+type obfuscationReport struct {
+	entropy float64
+	score   int
+	signs   []string
+}
+
+// analyzeObfuscation 计算脚本文件的熵和混淆评分: 高熵和每项命中的混淆特征各计分
+func analyzeObfuscation(filePath string) (obfuscationReport, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return obfuscationReport{}, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, obfuscationScanSize))
+	if err != nil {
+		return obfuscationReport{}, err
+	}
+
+	report := obfuscationReport{entropy: math.Round(entropy(data)*100) / 100}
+	if report.entropy > scoreEntropyThreshold {
+		report.score += 3
+		report.signs = append(report.signs, fmt.Sprintf("high_entropy(%.2f)", report.entropy))
+	}
+	for _, sign := range obfuscationSigns {
+		matches := sign.re.FindAllIndex(data, sign.min)
+		if len(matches) < sign.min {
+			continue
+		}
+		report.score += sign.weight
+		report.signs = append(report.signs, sign.name)
+	}
+	return report, nil
+}
+
+// obfuscationOf 新增/被修改的脚本文件的混淆评分, 不是脚本或已关闭时返回零值
+func (dm *DirectoryMonitor) obfuscationOf(filePath string) obfuscationReport {
+	if dm.obfuscationThreshold <= 0 || !dm.isScriptFile(filePath) {
+		return obfuscationReport{}
+	}
+	report, err := analyzeObfuscation(filePath)
+	if err != nil {
+		return obfuscationReport{}
+	}
+	return report
+}
+
+// tag 告警消息中附带的评分, 没有命中任何特征时为空
+func (r obfuscationReport) tag() string {
+	if r.score == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" [混淆评分: %d (%s)]", r.score, strings.Join(r.signs, ", "))
+}
+
+// obfuscationLevel 评分达到-obfuscation-threshold时把告警提升为critical
+func (dm *DirectoryMonitor) obfuscationLevel(r obfuscationReport, level string) string {
+	if dm.obfuscationThreshold > 0 && r.score >= dm.obfuscationThreshold {
+		return "critical"
+	}
+	return level
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// pause 暂停目录和快照检测, 基线保持不变; 已暂停时返回false
+func (dm *DirectoryMonitor) pause() bool {
+	dm.pauseMu.Lock()
+	defer dm.pauseMu.Unlock()
+
+	if dm.paused.Load() {
+		return false
+	}
+	dm.paused.Store(true)
+	dm.pausedAt = time.Now()
+	logWarn("检测已暂停，期间的文件变化不会被告警或还原")
+	dm.audit("pause", dm.watchDir, "")
+	return true
+}
+
+// resume 恢复检测; rebaseline为true时先按当前内容重建基线, 接受暂停期间的修改,
+// 否则暂停期间的修改会在恢复后被还原. 未暂停时返回false
+func (dm *DirectoryMonitor) resume(rebaseline bool) (bool, error) {
+	dm.pauseMu.Lock()
+	defer dm.pauseMu.Unlock()
+
+	if !dm.paused.Load() {
+		return false, nil
+	}
+	// 重建基线期间保持暂停, 避免监控goroutine把刚修改的文件还原
+	if rebaseline {
+		if _, err := dm.rebuildBaseline(); err != nil {
+			return false, fmt.Errorf("重建基线失败，检测保持暂停: %v", err)
+		}
+	}
+	dm.paused.Store(false)
+	logSuccess(fmt.Sprintf("检测已恢复 (暂停了 %v)", time.Since(dm.pausedAt).Round(time.Second)))
+	dm.audit("resume", dm.watchDir, fmt.Sprintf("rebaseline=%v", rebaseline))
+	return true, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// permissionChanges 描述权限、所有者和文件属性的变化, 没有变化时返回空
+func permissionChanges(old, new FileInfo) []string {
+	var changes []string
+	if old.Mode != new.Mode {
+		changes = append(changes, fmt.Sprintf("权限 %v -> %v", old.Mode, new.Mode))
+	}
+	if old.Uid != new.Uid || old.Gid != new.Gid {
+		changes = append(changes, fmt.Sprintf("所有者 %d:%d -> %d:%d", old.Uid, old.Gid, new.Uid, new.Gid))
+	}
+	if old.Owner != new.Owner {
+		changes = append(changes, fmt.Sprintf("所有者 %s -> %s", old.Owner, new.Owner))
+	}
+	if old.Attributes != new.Attributes {
+		changes = append(changes, fmt.Sprintf("文件属性 %#x -> %#x", old.Attributes, new.Attributes))
+	}
+	return changes
+}
+
+// checkPermissionChange 只有权限/所有者/属性/扩展属性变化(chmod 777, chmod +x, chown, setfacl)而内容未变时,
+// 告警permission_tampering并原地恢复, 不再隔离和重写内容. 返回true表示已处理
+func (dm *DirectoryMonitor) checkPermissionChange(filePath string, baselineInfo, currentInfo FileInfo, xattrsChanged bool) bool {
+	if currentInfo.Size != baselineInfo.Size || dm.mtimeChanged(currentInfo, baselineInfo) {
+		return false
+	}
+	changes := permissionChanges(baselineInfo, currentInfo)
+	if xattrsChanged {
+		changes = append(changes, "扩展属性/ACL")
+	}
+	if len(changes) == 0 || !dm.matchesBaseline(filePath, baselineInfo) {
+		return false
+	}
+
+	policy := dm.policyFor(filePath)
+	detail := alertDetail{Path: filePath, Old: &baselineInfo, New: &currentInfo, Action: actionResetPerms}
+	if policy == policyAlert {
+		detail.Action = ""
+	}
+	dm.alertFile("warning", "permission_tampering",
+		fmt.Sprintf("检测到文件权限被篡改(内容未变): %s (%s)", filepath.Base(filePath), strings.Join(changes, ", ")), detail)
+	dm.stats.countChange(changePermission)
+
+	switch {
+	case policy == policyAlert:
+		dm.acceptChange(filePath)
+	case dm.dryRun:
+		dm.acceptDryRun(filePath, policy)
+	default:
+		if err := dm.resetPermissions(filePath, baselineInfo); err != nil {
+			logError(fmt.Sprintf("恢复文件权限失败 %s: %v", filePath, err))
+		}
+	}
+	return true
+}
+
+// resetPermissions 按基线原地恢复权限、所有者、文件属性和扩展属性, 不重写内容
+func (dm *DirectoryMonitor) resetPermissions(filePath string, baselineInfo FileInfo) error {
+	backupPath, err := dm.backupPathFor(filePath)
+	if err != nil {
+		return err
+	}
+
+	dm.unhardenFile(filePath)
+	if err := makeWritable(filePath); err != nil {
+		logDebug(fmt.Sprintf("清除文件只读属性失败 %s: %v", filePath, err))
+	}
+	if err := copyXattrs(backupPath, filePath); err != nil {
+		logWarn(fmt.Sprintf("恢复扩展属性失败 %s: %v", filePath, err))
+	}
+	if err := dm.restoreFileAttributes(filePath, baselineInfo); err != nil {
+		return err
+	}
+	dm.hardenFile(filePath)
+
+	// 恢复属性会改变ctime
+	if info, err := dm.getFileInfo(filePath); err == nil {
+		baselineInfo.Ctime = info.Ctime
+		dm.setBaseline(filePath, baselineInfo)
+	}
+
+	logSuccess(fmt.Sprintf("文件权限已恢复: %s (%v)", filePath, baselineInfo.Mode))
+	dm.recordFlap(filePath)
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// phpIniTimeout php --ini的最长执行时间
+const phpIniTimeout = 10 * time.Second
+
+// phpFpmConfigGlobs php --ini只报告CLI的配置, php-fpm的配置按常见安装路径查找
+var phpFpmConfigGlobs = []string{
+	"/etc/php/*/fpm/php.ini",
+	"/etc/php/*/fpm/php-fpm.conf",
+	"/etc/php-fpm.conf",
+	"/usr/local/etc/php-fpm.conf",
+	"/usr/local/php/etc/php-fpm.conf",
+}
+
+// phpFpmPoolGlobs php-fpm的pool配置目录
+var phpFpmPoolGlobs = []string{
+	"/etc/php/*/fpm/pool.d",
+	"/etc/php/*/fpm/conf.d",
+	"/etc/php-fpm.d",
+	"/usr/local/etc/php-fpm.d",
+}
+
+// phpConfigLocations 解析php --ini的输出, 返回加载的配置文件和额外ini的扫描目录
+func phpConfigLocations() ([]string, []string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), phpIniTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "php", "--ini").Output()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var files, dirs []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if value == "" || value == "(none)" {
+			continue
+		}
+
+		switch strings.TrimSpace(key) {
+		case "Loaded Configuration File":
+			files = append(files, value)
+		case "Scan for additional .ini files in":
+			// 可以是以:分隔的多个目录
+			dirs = append(dirs, filepath.SplitList(value)...)
+		}
+	}
+	return files, dirs, nil
+}
+
+// parseIniSettings 解析ini内容中的配置项, 同名配置以最后一次出现为准, 键统一为小写
+func parseIniSettings(data []byte) map[string]string {
+	settings := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if i := strings.Index(value, " ;"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		settings[strings.ToLower(strings.TrimSpace(key))] = strings.Trim(value, `"'`)
+	}
+	return settings
+}
+
+func iniEnabled(value string) bool {
+	switch strings.ToLower(value) {
+	case "1", "on", "yes", "true":
+		return true
+	}
+	return false
+}
+
+func iniList(value string) map[string]bool {
+	items := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items[strings.ToLower(item)] = true
+		}
+	}
+	return items
+}
+
+// dangerousPHPChanges 比较修改前后的配置, 返回新引入的危险设置; before为nil时视为全新的配置文件
+func dangerousPHPChanges(before, after []byte) []string {
+	old, current := parseIniSettings(before), parseIniSettings(after)
+	var findings []string
+
+	for _, key := range []string{"allow_url_include", "enable_dl"} {
+		if iniEnabled(current[key]) && !iniEnabled(old[key]) {
+			findings = append(findings, fmt.Sprintf("%s = %s", key, current[key]))
+		}
+	}
+
+	// auto_prepend_file/auto_append_file会在每个请求前后包含指定文件, 常用于持久化webshell
+	for _, key := range []string{"auto_prepend_file", "auto_append_file"} {
+		if value := current[key]; value != "" && value != "none" && value != old[key] {
+			findings = append(findings, fmt.Sprintf("%s = %s", key, value))
+		}
+	}
+
+	if removed := removedItems(iniList(old["disable_functions"]), iniList(current["disable_functions"])); len(removed) > 0 {
+		findings = append(findings, fmt.Sprintf("disable_functions移除了: %s", strings.Join(removed, ",")))
+	}
+
+	if old["open_basedir"] != "" && current["open_basedir"] != old["open_basedir"] {
+		findings = append(findings, fmt.Sprintf("open_basedir: %s -> %s", old["open_basedir"], current["open_basedir"]))
+	}
+	return findings
+}
+
+func removedItems(before, after map[string]bool) []string {
+	var removed []string
+	for item := range before {
+		if !after[item] {
+			removed = append(removed, item)
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// startPHPConfigMonitor 监控php --ini发现的配置文件和php-fpm配置, restorePHPConfig为false时只告警
+func (dm *DirectoryMonitor) startPHPConfigMonitor() {
+	group := newSnapshotGroup("PHP配置", "php_config_modified", "warning", dm.restorePHPConfig)
+	group.inspect = func(filePath string, before, after []byte) {
+		if findings := dangerousPHPChanges(before, after); len(findings) > 0 {
+			dm.alert("critical", "php_dangerous_setting",
+				fmt.Sprintf("检测到PHP配置引入危险设置: %s (%s)", filePath, strings.Join(findings, "; ")))
+		}
+	}
+
+	files, dirs, err := phpConfigLocations()
+	if err != nil {
+		logWarn(fmt.Sprintf("执行php --ini失败, 只监控php-fpm的常见配置路径: %v", err))
+	}
+	for _, pattern := range phpFpmConfigGlobs {
+		matches, _ := filepath.Glob(pattern)
+		files = append(files, matches...)
+	}
+	for _, pattern := range phpFpmPoolGlobs {
+		matches, _ := filepath.Glob(pattern)
+		dirs = append(dirs, matches...)
+	}
+
+	for _, filePath := range files {
+		group.watchFile(dm, filePath, "php_config_modified")
+	}
+	for _, dir := range dirs {
+		group.watchDir(dm, dir, "php_config_modified")
+	}
+
+	if len(group.paths()) == 0 {
+		logWarn("未发现PHP配置文件, 跳过PHP配置监控")
+		return
+	}
+
+	mode := "只告警"
+	if dm.restorePHPConfig {
+		mode = "告警并复原"
+	}
+	logInfo(fmt.Sprintf("PHP配置监控已启动(%s), 共 %d 个文件", mode, len(group.paths())))
+
+	dm.runPeriodic(snapshotCheckInterval, func() { dm.checkSnapshotGroup(group) })
+}
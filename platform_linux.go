@@ -0,0 +1,168 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// oNoFollow 复制隔离文件时拒绝跟随符号链接
+const oNoFollow = syscall.O_NOFOLLOW
+
+// platformInfo stat结果中与平台相关的元数据
+type platformInfo struct {
+	Ino        uint64
+	Ctime      int64
+	Uid        uint32
+	Gid        uint32
+	Owner      string
+	Attributes uint32
+}
+
+// platformStat 从stat结果中提取inode、ctime和所有者
+func platformStat(path string, info os.FileInfo) platformInfo {
+	var p platformInfo
+	if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+		p.Ino = sys.Ino
+		p.Ctime = sys.Ctim.Nano()
+		p.Uid, p.Gid = sys.Uid, sys.Gid
+	}
+	return p
+}
+
+// ownerIDs 返回文件的uid和gid
+func ownerIDs(info os.FileInfo) (uint32, uint32) {
+	if sys, ok := info.Sys().(*syscall.Stat_t); ok {
+		return sys.Uid, sys.Gid
+	}
+	return 0, 0
+}
+
+// setOwner 恢复文件所有者, 不跟随符号链接; owner只在Windows上使用
+func setOwner(path string, uid, gid uint32, owner string) error {
+	return os.Lchown(path, int(uid), int(gid))
+}
+
+// setFileAttributes Linux上没有Windows文件属性, 不做处理
+func setFileAttributes(path string, attrs uint32) error {
+	return nil
+}
+
+// makeWritable Linux上root可以直接覆盖只读文件, 不做处理
+func makeWritable(path string) error {
+	return nil
+}
+
+const (
+	// fsIocGetflags/fsIocSetflags 即FS_IOC_GETFLAGS/FS_IOC_SETFLAGS, 参数类型为long, 编码中的大小随字长变化
+	fsIocGetflags = 0x80006601 | unsafe.Sizeof(uintptr(0))<<16
+	fsIocSetflags = 0x40006602 | unsafe.Sizeof(uintptr(0))<<16
+	// fsImmutableFl chattr +i
+	fsImmutableFl = 0x00000010
+)
+
+// setImmutable 设置或清除文件的不可变属性(chattr +i/-i), 需要CAP_LINUX_IMMUTABLE;
+// 不可变的文件即使root也不能修改、删除或重命名, 除非先清除该属性
+func setImmutable(path string, on bool) error {
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var flags int32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), fsIocGetflags, uintptr(unsafe.Pointer(&flags))); errno != 0 {
+		return errno
+	}
+	if on {
+		flags |= fsImmutableFl
+	} else {
+		flags &^= fsImmutableFl
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), fsIocSetflags, uintptr(unsafe.Pointer(&flags))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// readXattrs 读取文件的所有扩展属性
+func readXattrs(path string) (map[string][]byte, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil {
+		if err == syscall.ENOTSUP {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, size)
+	if size, err = syscall.Listxattr(path, buf); err != nil {
+		return nil, err
+	}
+
+	attrs := make(map[string][]byte)
+	for _, name := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		if name == "" {
+			continue
+		}
+		n, err := syscall.Getxattr(path, name, nil)
+		if err != nil {
+			continue
+		}
+		value := make([]byte, n)
+		if n, err = syscall.Getxattr(path, name, value); err != nil {
+			continue
+		}
+		attrs[name] = value[:n]
+	}
+	return attrs, nil
+}
+
+func setXattr(path, name string, value []byte) error {
+	return syscall.Setxattr(path, name, value, 0)
+}
+
+func removeXattr(path, name string) error {
+	return syscall.Removexattr(path, name)
+}
+
+// hasFileCapability 文件是否设置了capabilities(setcap), 不跟随符号链接的调用方需先确认是普通文件
+func hasFileCapability(path string) bool {
+	n, err := syscall.Getxattr(path, capabilityXattr, nil)
+	return err == nil && n > 0
+}
+
+// hookCommand 通过sh -c执行钩子命令, 命令在独立的进程组中运行
+func hookCommand(command string) *exec.Cmd {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd
+}
+
+// killHook 终止钩子命令的整个进程组, 避免sh的子进程继续占用stderr管道导致等待不返回
+func killHook(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// handlePauseSignals SIGUSR1暂停检测, SIGUSR2恢复检测; 用于授权的手工修补期间
+func (dm *DirectoryMonitor) handlePauseSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGUSR1 {
+				dm.pause()
+			} else if _, err := dm.resume(dm.rebaselineOnResume); err != nil {
+				logError(err.Error())
+			}
+		}
+	}()
+}
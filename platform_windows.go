@@ -0,0 +1,219 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modadvapi32 = syscall.NewLazyDLL("advapi32.dll")
+	modkernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+	procGetSecurityInfo              = modadvapi32.NewProc("GetSecurityInfo")
+	procSetNamedSecurityInfoW        = modadvapi32.NewProc("SetNamedSecurityInfoW")
+	procGetFileInformationByHandleEx = modkernel32.NewProc("GetFileInformationByHandleEx")
+)
+
+const (
+	seFileObject             = 1
+	ownerSecurityInformation = 0x1
+	fileBasicInfoClass       = 0
+	fileReadAttributes       = 0x80
+	readControl              = 0x20000
+	fileFlagOpenReparsePoint = 0x00200000
+
+	// settableAttributes SetFileAttributes能够设置的属性, 目录/重解析点等由系统维护
+	settableAttributes = syscall.FILE_ATTRIBUTE_READONLY | syscall.FILE_ATTRIBUTE_HIDDEN |
+		syscall.FILE_ATTRIBUTE_SYSTEM | syscall.FILE_ATTRIBUTE_ARCHIVE | 0x100 | 0x1000 | 0x2000
+	// blockingAttributes 导致os.Create覆盖失败的属性
+	blockingAttributes = syscall.FILE_ATTRIBUTE_READONLY | syscall.FILE_ATTRIBUTE_HIDDEN | syscall.FILE_ATTRIBUTE_SYSTEM
+
+	// filetimeEpochDiff 1601-01-01到1970-01-01之间的100纳秒数
+	filetimeEpochDiff = 116444736000000000
+)
+
+// oNoFollow Windows上没有O_NOFOLLOW, 复制前已用Lstat确认是普通文件
+const oNoFollow = 0
+
+// platformInfo stat结果中与平台相关的元数据
+type platformInfo struct {
+	Ino        uint64
+	Ctime      int64
+	Uid        uint32
+	Gid        uint32
+	Owner      string
+	Attributes uint32
+}
+
+// fileBasicInfo FILE_BASIC_INFO, 时间为FILETIME格式
+type fileBasicInfo struct {
+	CreationTime   int64
+	LastAccessTime int64
+	LastWriteTime  int64
+	ChangeTime     int64
+	FileAttributes uint32
+	_              uint32
+}
+
+// platformStat 打开文件句柄读取NTFS文件索引(作为inode)、ChangeTime(作为ctime)、属性和所有者SID
+func platformStat(path string, info os.FileInfo) platformInfo {
+	var p platformInfo
+	if data, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		p.Attributes = data.FileAttributes
+		p.Ctime = data.LastWriteTime.Nanoseconds()
+	}
+
+	pathp, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return p
+	}
+	flags := uint32(syscall.FILE_FLAG_BACKUP_SEMANTICS)
+	if info.Mode()&os.ModeSymlink != 0 {
+		flags |= fileFlagOpenReparsePoint
+	}
+	h, err := syscall.CreateFile(pathp, fileReadAttributes|readControl,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING, flags, 0)
+	if err != nil {
+		return p
+	}
+	defer syscall.CloseHandle(h)
+
+	var byHandle syscall.ByHandleFileInformation
+	if syscall.GetFileInformationByHandle(h, &byHandle) == nil {
+		p.Ino = uint64(byHandle.FileIndexHigh)<<32 | uint64(byHandle.FileIndexLow)
+	}
+
+	// ChangeTime与Linux的ctime一样无法通过SetFileTime伪造
+	var basic fileBasicInfo
+	r, _, _ := procGetFileInformationByHandleEx.Call(uintptr(h), fileBasicInfoClass,
+		uintptr(unsafe.Pointer(&basic)), unsafe.Sizeof(basic))
+	if r != 0 {
+		p.Ctime = (basic.ChangeTime - filetimeEpochDiff) * 100
+		p.Attributes = basic.FileAttributes
+	}
+
+	p.Owner = ownerSID(h)
+	return p
+}
+
+// ownerSID 返回文件所有者的SID字符串, 例如S-1-5-32-544
+func ownerSID(h syscall.Handle) string {
+	var owner *syscall.SID
+	var sd uintptr
+	r, _, _ := procGetSecurityInfo.Call(uintptr(h), seFileObject, ownerSecurityInformation,
+		uintptr(unsafe.Pointer(&owner)), 0, 0, 0, uintptr(unsafe.Pointer(&sd)))
+	if r != 0 {
+		return ""
+	}
+	defer syscall.LocalFree(syscall.Handle(sd))
+
+	sid, err := owner.String()
+	if err != nil {
+		return ""
+	}
+	return sid
+}
+
+// ownerIDs Windows上没有uid/gid
+func ownerIDs(info os.FileInfo) (uint32, uint32) {
+	return 0, 0
+}
+
+// setOwner 按SID恢复文件所有者, 需要SeRestorePrivilege(管理员); uid/gid在Windows上忽略
+func setOwner(path string, uid, gid uint32, owner string) error {
+	if owner == "" {
+		return nil
+	}
+	sid, err := syscall.StringToSid(owner)
+	if err != nil {
+		return err
+	}
+	pathp, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+
+	r, _, _ := procSetNamedSecurityInfoW.Call(uintptr(unsafe.Pointer(pathp)), seFileObject,
+		ownerSecurityInformation, uintptr(unsafe.Pointer(sid)), 0, 0, 0)
+	if r != 0 {
+		return syscall.Errno(r)
+	}
+	return nil
+}
+
+// setFileAttributes 恢复只读/隐藏/系统等文件属性
+func setFileAttributes(path string, attrs uint32) error {
+	attrs &= settableAttributes
+	if attrs == 0 {
+		return nil
+	}
+	pathp, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+	return syscall.SetFileAttributes(pathp, attrs)
+}
+
+// makeWritable 清除只读/隐藏/系统属性, 这些属性会使覆盖写入失败, 还原后按基线重新设置
+func makeWritable(path string) error {
+	pathp, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+	attrs, err := syscall.GetFileAttributes(pathp)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if attrs&blockingAttributes == 0 {
+		return nil
+	}
+	return syscall.SetFileAttributes(pathp, attrs&^blockingAttributes)
+}
+
+// setImmutable Windows上没有与chattr +i对应的属性
+func setImmutable(path string, on bool) error {
+	return errors.New("Windows上不支持不可变属性")
+}
+
+// readXattrs Windows上不记录扩展属性
+func readXattrs(path string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+func setXattr(path, name string, value []byte) error {
+	return nil
+}
+
+func removeXattr(path, name string) error {
+	return nil
+}
+
+// hasFileCapability Windows上没有文件capabilities
+func hasFileCapability(path string) bool {
+	return false
+}
+
+// hookCommand 通过cmd /C执行钩子命令
+func hookCommand(command string) *exec.Cmd {
+	return exec.Command("cmd", "/C", command)
+}
+
+// killHook 终止钩子命令及其子进程
+func killHook(cmd *exec.Cmd) {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run(); err != nil {
+		cmd.Process.Kill()
+	}
+}
+
+// handlePauseSignals Windows上没有SIGUSR1/SIGUSR2, 通过-repl或控制API暂停/恢复
+func (dm *DirectoryMonitor) handlePauseSignals() {}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 文件变化的处理方式, 由-policy按路径规则指定
+const (
+	// policyAlert 只告警, 以变化后的状态作为新基线
+	policyAlert = "alert"
+	// policyRestore 从备份还原, 不保留篡改后的内容; 新增文件直接删除
+	policyRestore = "restore"
+	// policyIsolate 默认: 新增文件隔离, 被修改的文件隔离后还原
+	policyIsolate = "isolate"
+	// policyDelete 新增文件直接删除不留证据, 被修改的文件直接还原
+	policyDelete = "delete"
+)
+
+// actionPolicy 一条处理策略: 与-x相同写法的路径规则和处理方式
+type actionPolicy struct {
+	rule   excludeRule
+	action string
+}
+
+// parsePolicies 解析"规则=处理方式"的逗号分隔列表, 例如 *.log=alert,uploads/*.php=delete,index.php=restore
+func parsePolicies(value string) ([]actionPolicy, error) {
+	var policies []actionPolicy
+	for _, item := range parseList(value) {
+		sep := strings.LastIndex(item, "=")
+		if sep <= 0 {
+			return nil, fmt.Errorf("无效的处理策略: %s", item)
+		}
+
+		action := strings.TrimSpace(item[sep+1:])
+		switch action {
+		case policyAlert, policyRestore, policyIsolate, policyDelete:
+		default:
+			return nil, fmt.Errorf("无效的处理方式 %s, 可选: alert, restore, isolate, delete", item)
+		}
+		rule, err := parsePathRule(strings.TrimSpace(item[:sep]))
+		if err != nil {
+			return nil, fmt.Errorf("无效的策略规则: %v", err)
+		}
+		policies = append(policies, actionPolicy{rule: rule, action: action})
+	}
+	return policies, nil
+}
+
+// policyFor 返回文件适用的处理方式: 第一条匹配的策略, 没有匹配时为isolate
+func (dm *DirectoryMonitor) policyFor(filePath string) string {
+	if len(dm.policies) == 0 {
+		return policyIsolate
+	}
+
+	_, rel, err := dm.relToRoot(filePath)
+	if err != nil {
+		return policyIsolate
+	}
+	rel = filepath.ToSlash(rel)
+	for _, policy := range dm.policies {
+		if policy.rule.match(rel) {
+			return policy.action
+		}
+	}
+	return policyIsolate
+}
+
+// policyDetailAction 告警中记录的处理方式
+func policyDetailAction(policy string, created bool) string {
+	switch {
+	case policy == policyAlert:
+		return ""
+	case created && policy == policyIsolate:
+		return actionIsolate
+	case created:
+		return actionDelete
+	case policy == policyIsolate:
+		return actionIsolateRestore
+	}
+	return actionRestore
+}
+
+// acceptChange 只告警的文件: 以当前状态作为新基线(不更新备份), 同一次变化只告警一次; 文件已不存在时从基线中移除
+func (dm *DirectoryMonitor) acceptChange(filePath string) {
+	info, err := dm.hashedFileInfo(filePath)
+	if err != nil {
+		dm.deleteBaseline(filePath)
+		return
+	}
+	dm.setBaseline(filePath, info)
+}
+
+// deleteFile 直接删除新增文件, 不保留到隔离目录
+func (dm *DirectoryMonitor) deleteFile(filePath string) error {
+	if err := os.Remove(filePath); err != nil {
+		return fmt.Errorf("删除文件失败: %v", err)
+	}
+
+	logSuccess(fmt.Sprintf("新增文件已删除: %s", filePath))
+	dm.recordFlap(filePath)
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// polyglotScanSize 检查图片中嵌入脚本时读取的最大字节数, EXIF/注释段通常位于文件开头
+	polyglotScanSize = 1 << 20
+	// polyglotCacheSize 检查结果缓存的文件数上限, 超过时清空
+	polyglotCacheSize = 8192
+)
+
+// imageMagic 图片扩展名对应的文件头
+var imageMagic = map[string][][]byte{
+	".jpg":  {{0xFF, 0xD8, 0xFF}},
+	".jpeg": {{0xFF, 0xD8, 0xFF}},
+	".png":  {{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'}},
+	".gif":  {[]byte("GIF87a"), []byte("GIF89a")},
+	".bmp":  {[]byte("BM")},
+	".ico":  {{0x00, 0x00, 0x01, 0x00}},
+	".webp": {[]byte("RIFF")},
+}
+
+// embeddedScriptPattern 图片中嵌入的服务端脚本; 只匹配足够长的特征, 避免压缩数据中偶然出现的<?和<%
+var embeddedScriptPattern = regexp.MustCompile(`(?i)<\?php|<\?=\s*[$@(]|<script\s+language\s*=\s*["']?php|<%@\s*page|<%\s*(eval|execute|response\.write)|<jsp:`)
+
+// polyglotResult 按大小和修改时间缓存的检查结果
+type polyglotResult struct {
+	size    int64
+	modTime int64
+	finding string
+}
+
+// sniffPolyglot 检查图片文件中的脚本代码, 返回描述; 没有发现时返回空
+func sniffPolyglot(filePath string) string {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, polyglotScanSize))
+	if err != nil {
+		return ""
+	}
+
+	loc := embeddedScriptPattern.FindIndex(data)
+	if loc == nil {
+		return ""
+	}
+	script := strings.TrimSpace(string(data[loc[0]:loc[1]]))
+
+	ext := strings.ToLower(filepath.Ext(filePath))
+	for _, magic := range imageMagic[ext] {
+		if bytes.HasPrefix(data, magic) {
+			return fmt.Sprintf("图片中嵌入了脚本代码 %s (偏移 %d)", script, loc[0])
+		}
+	}
+	return fmt.Sprintf("内容不是%s图片, 包含脚本代码 %s (偏移 %d)", ext, script, loc[0])
+}
+
+// isPolyglotCandidate 是否需要检查嵌入脚本的图片扩展名
+func (dm *DirectoryMonitor) isPolyglotCandidate(filePath string) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	for _, candidate := range dm.polyglotExts {
+		if ext == strings.ToLower(candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// polyglotFinding 返回图片文件中发现的脚本代码, 按大小和修改时间缓存, 文件没有变化时不重复读取
+func (dm *DirectoryMonitor) polyglotFinding(filePath string, info os.FileInfo) string {
+	if !dm.isPolyglotCandidate(filePath) {
+		return ""
+	}
+
+	size, modTime := info.Size(), info.ModTime().UnixNano()
+	dm.polyglotMu.Lock()
+	cached, ok := dm.polyglotCache[filePath]
+	dm.polyglotMu.Unlock()
+	if ok && cached.size == size && cached.modTime == modTime {
+		return cached.finding
+	}
+
+	finding := sniffPolyglot(filePath)
+	dm.polyglotMu.Lock()
+	if len(dm.polyglotCache) >= polyglotCacheSize {
+		dm.polyglotCache = make(map[string]polyglotResult)
+	}
+	dm.polyglotCache[filePath] = polyglotResult{size: size, modTime: modTime, finding: finding}
+	dm.polyglotMu.Unlock()
+	return finding
+}
+
+// polyglotFileFinding 与polyglotFinding相同, 自行获取文件信息
+func (dm *DirectoryMonitor) polyglotFileFinding(filePath string) string {
+	info, err := os.Lstat(filePath)
+	if err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+	return dm.polyglotFinding(filePath, info)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// preset 内置的参数组合, values返回参数名到取值的映射, 可以按当前系统探测路径
+type preset struct {
+	desc   string
+	values func() map[string]string
+}
+
+// phpSessionDirs 各发行版PHP默认的session.save_path
+var phpSessionDirs = []string{"/var/lib/php/sessions", "/var/lib/php/session", "/var/lib/php5"}
+
+// firstExistingDir 返回第一个存在的目录, 都不存在时返回空
+func firstExistingDir(dirs []string) string {
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+	}
+	return ""
+}
+
+var presets = map[string]preset{
+	"session-tmp": {
+		desc: "PHP session目录和/tmp, /var/tmp, /dev/shm只告警监控并扫描文件内容",
+		values: func() map[string]string {
+			values := map[string]string{"watch-temp": "true", "temp-scan": "true"}
+			if dir := firstExistingDir(phpSessionDirs); dir != "" {
+				values["session-dir"] = dir
+			}
+			return values
+		},
+	},
+	"tomcat": {
+		desc: "监控Tomcat的webapps, work和conf目录",
+		values: func() map[string]string {
+			home := detectTomcatHome()
+			if home == "" {
+				logWarn(fmt.Sprintf("未找到Tomcat目录(CATALINA_BASE, CATALINA_HOME, %s), 请用-tomcat-home指定", strings.Join(tomcatHomes, ", ")))
+				return nil
+			}
+			return map[string]string{
+				"tomcat-home": home,
+				"m":           filepath.Join(home, "webapps"),
+				"e":           ".jsp,.jspx,.jspf,.war,.class,.jar,.xml",
+			}
+		},
+	},
+	"webserver": {
+		desc: "监控并复原nginx/apache配置, 检查通过后重新加载; 关联默认位置的访问日志",
+		values: func() map[string]string {
+			values := map[string]string{"webserver-monitor": "true", "restore-webserver": "true"}
+			test, reload := detectWebserverCommands()
+			if reload != "" {
+				values["webserver-test-cmd"] = test
+				values["webserver-reload-cmd"] = reload
+			}
+			var logs []string
+			for _, path := range accessLogPaths {
+				if _, err := os.Stat(path); err == nil {
+					logs = append(logs, path)
+				}
+			}
+			if len(logs) > 0 {
+				values["access-log"] = strings.Join(logs, ",")
+			}
+			return values
+		},
+	},
+}
+
+// presetNames 可用预设的名称, 用于错误提示
+func presetNames() string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// applyPresets 按-preset填充参数, 与配置文件相同只填充命令行和配置文件中都没有指定的参数
+func applyPresets(names []string) error {
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	for _, name := range names {
+		p, ok := presets[name]
+		if !ok {
+			return fmt.Errorf("未知的预设: %s (可选: %s)", name, presetNames())
+		}
+
+		var applied []string
+		for key, value := range p.values() {
+			if explicit[key] {
+				continue
+			}
+			if err := flag.Set(key, value); err != nil {
+				return fmt.Errorf("预设%s的参数%s无效: %v", name, key, err)
+			}
+			applied = append(applied, fmt.Sprintf("-%s=%s", key, value))
+		}
+		sort.Strings(applied)
+		logInfo(fmt.Sprintf("已应用预设%s(%s): %s", name, p.desc, strings.Join(applied, " ")))
+	}
+	return nil
+}
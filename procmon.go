@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// procScanInterval 遍历/proc的间隔
+	procScanInterval = 2 * time.Second
+	// procChainDepth 告警中父进程链的最大层数
+	procChainDepth = 8
+	// procCmdlineMax 告警中命令行的最大字符数
+	procCmdlineMax = 512
+)
+
+// procInfo /proc/<pid>中与可疑进程判断相关的信息
+type procInfo struct {
+	pid   int
+	ppid  int
+	uid   string
+	name  string
+	start string
+}
+
+// readProcInfo 读取/proc/<pid>/status和stat; 进程已退出时返回错误
+func readProcInfo(pid int) (procInfo, error) {
+	info := procInfo{pid: pid}
+	status, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return info, err
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		switch key {
+		case "Name":
+			info.name = fields[0]
+		case "PPid":
+			info.ppid, _ = strconv.Atoi(fields[0])
+		case "Uid":
+			// 实际uid, 与ps的USER列一致
+			info.uid = fields[0]
+		}
+	}
+
+	// 进程启动时间(stat第22个字段)用于区分复用的pid; comm中可能含有空格和括号, 从最后一个')'之后开始计数
+	if stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid)); err == nil {
+		if i := strings.LastIndexByte(string(stat), ')'); i >= 0 {
+			if fields := strings.Fields(string(stat[i+1:])); len(fields) > 19 {
+				info.start = fields[19]
+			}
+		}
+	}
+	return info, nil
+}
+
+// procExeName 进程可执行文件的文件名, 读取/proc/<pid>/exe失败时(内核线程等)使用status中的Name
+func procExeName(info procInfo) string {
+	if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", info.pid)); err == nil {
+		return filepath.Base(strings.TrimSuffix(exe, " (deleted)"))
+	}
+	return info.name
+}
+
+// procCmdline 进程命令行, 参数以空格连接
+func procCmdline(pid int) string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return ""
+	}
+	cmdline := strings.TrimSpace(strings.ReplaceAll(string(data), "\x00", " "))
+	return truncateMessage(cmdline, procCmdlineMax)
+}
+
+// baseProcName 去掉进程名末尾的版本号, 使python3.11, php8.1等与配置中的python, php匹配
+func baseProcName(name string) string {
+	return strings.TrimRight(strings.ToLower(name), "0123456789.-")
+}
+
+// listPids 列出/proc中的所有进程号
+func listPids() ([]int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, entry := range entries {
+		if pid, err := strconv.Atoi(entry.Name()); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+	return pids, nil
+}
+
+// resolveUids 把-proc-users中的用户名转换为uid, 数字直接作为uid; 不存在的用户忽略
+func resolveUids(users []string) map[string]string {
+	entries := make(map[string][]string)
+	if data, err := os.ReadFile(passwdFile); err == nil {
+		entries = passwdEntries(data)
+	}
+
+	uids := make(map[string]string)
+	for _, user := range users {
+		if _, err := strconv.Atoi(user); err == nil {
+			uids[user] = user
+		} else if fields, ok := entries[user]; ok {
+			uids[fields[2]] = user
+		}
+	}
+	return uids
+}
+
+// parentChain 告警中的父进程链, 例如 "1234 bash <- 1200 php-fpm8.1 <- 1 systemd"
+func parentChain(info procInfo) string {
+	var chain []string
+	for i := 0; i < procChainDepth && info.ppid > 0; i++ {
+		parent, err := readProcInfo(info.ppid)
+		if err != nil {
+			break
+		}
+		chain = append(chain, fmt.Sprintf("%d %s", parent.pid, procExeName(parent)))
+		info = parent
+	}
+	return strings.Join(chain, " <- ")
+}
+
+// startProcMonitor 定期遍历/proc, Web服务用户(-proc-users)运行shell、解释器和网络工具(-proc-names)时
+// 告警suspicious_process并附带命令行和父进程链; procKill为true时结束该进程
+func (dm *DirectoryMonitor) startProcMonitor() {
+	if _, err := listPids(); err != nil {
+		logWarn(fmt.Sprintf("无法读取/proc, 跳过进程监控: %v", err))
+		return
+	}
+
+	uids := resolveUids(dm.procUsers)
+	if len(uids) == 0 {
+		logWarn(fmt.Sprintf("-proc-users中的用户都不存在, 跳过进程监控: %s", strings.Join(dm.procUsers, ", ")))
+		return
+	}
+	names := make(map[string]bool)
+	for _, name := range dm.procNames {
+		names[baseProcName(name)] = true
+	}
+
+	users := make([]string, 0, len(uids))
+	for uid, user := range uids {
+		users = append(users, fmt.Sprintf("%s(%s)", user, uid))
+	}
+	sort.Strings(users)
+	mode := "只告警"
+	if dm.procKill {
+		mode = "告警并结束进程"
+	}
+	logInfo(fmt.Sprintf("进程监控已启动(%s), 用户: %s, 检查间隔: %v", mode, strings.Join(users, ", "), procScanInterval))
+
+	// alerted 已告警的进程, 以pid和启动时间区分复用的pid
+	alerted := make(map[int]string)
+
+	dm.runPeriodic(procScanInterval, func() {
+		pids, err := listPids()
+		if err != nil {
+			logError(fmt.Sprintf("读取/proc失败: %v", err))
+			return
+		}
+
+		alive := make(map[int]bool, len(pids))
+		for _, pid := range pids {
+			alive[pid] = true
+			if pid == os.Getpid() {
+				continue
+			}
+			info, err := readProcInfo(pid)
+			if err != nil {
+				continue
+			}
+			user, ok := uids[info.uid]
+			if !ok {
+				continue
+			}
+			exe := procExeName(info)
+			if !names[baseProcName(exe)] && !names[baseProcName(info.name)] {
+				continue
+			}
+			if start, ok := alerted[pid]; ok && start == info.start {
+				continue
+			}
+			alerted[pid] = info.start
+			dm.handleSuspiciousProcess(info, user, exe)
+		}
+
+		for pid := range alerted {
+			if !alive[pid] {
+				delete(alerted, pid)
+			}
+		}
+	})
+}
+
+// handleSuspiciousProcess 告警Web服务用户启动的可疑进程, 开启-proc-kill时结束该进程
+func (dm *DirectoryMonitor) handleSuspiciousProcess(info procInfo, user, exe string) {
+	cmdline := procCmdline(info.pid)
+	detail := alertDetail{}
+	if dm.procKill {
+		detail.Action = actionKill
+	}
+	dm.alertFile("critical", "suspicious_process",
+		fmt.Sprintf("检测到Web服务用户%s启动可疑进程: pid=%d %s, 命令行: %s, 父进程链: %s",
+			user, info.pid, exe, cmdline, parentChain(info)), detail)
+
+	if dm.procKill {
+		dm.killProcess(info.pid, exe, fmt.Sprintf("user=%s cmdline=%s", user, cmdline))
+	}
+}
+
+// killProcess 结束(SIGKILL)告警的进程并记录到audit.log, dry-run模式下跳过; 不会结束EDR自身
+func (dm *DirectoryMonitor) killProcess(pid int, exe, detail string) {
+	if dm.dryRun || pid == os.Getpid() {
+		return
+	}
+	proc, err := os.FindProcess(pid)
+	if err == nil {
+		err = proc.Kill()
+	}
+	if err != nil {
+		logError(fmt.Sprintf("结束进程失败 pid=%d: %v", pid, err))
+		return
+	}
+	logSuccess(fmt.Sprintf("已结束可疑进程: pid=%d %s", pid, exe))
+	dm.audit("process_killed", exe, fmt.Sprintf("pid=%d %s", pid, detail))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// progressInterval 备份进度的刷新间隔
+	progressInterval = 500 * time.Millisecond
+	// progressWindow 计算备份速率的滑动窗口
+	progressWindow = 2 * time.Second
+)
+
+// progressSample 某一时刻已复制的字节数
+type progressSample struct {
+	at    time.Time
+	bytes int64
+}
+
+// backupProgress 初始备份期间在stderr上原地刷新的进度条
+type backupProgress struct {
+	totalFiles int
+	totalBytes int64
+	doneFiles  atomic.Int64
+	copied     *atomic.Int64
+	startBytes int64
+	samples    []progressSample
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// stderrIsTerminal 判断stderr是否为终端, 重定向到文件或管道时不显示进度
+func stderrIsTerminal() bool {
+	info, err := os.Stderr.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func newBackupProgress(totalFiles int, totalBytes int64, copied *atomic.Int64) *backupProgress {
+	return &backupProgress{
+		totalFiles: totalFiles,
+		totalBytes: totalBytes,
+		copied:     copied,
+		startBytes: copied.Load(),
+		samples:    []progressSample{{at: time.Now()}},
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+func (p *backupProgress) start() {
+	go func() {
+		defer close(p.done)
+
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				p.render()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// finish 停止刷新并清除进度行, 之后输出的完成信息会覆盖该行
+func (p *backupProgress) finish() {
+	close(p.stop)
+	<-p.done
+	fmt.Fprint(os.Stderr, "\r\033[K")
+}
+
+// rate 根据最近progressWindow内的采样计算速率(bytes/s)
+func (p *backupProgress) rate(now time.Time, copied int64) float64 {
+	p.samples = append(p.samples, progressSample{at: now, bytes: copied})
+
+	cutoff := now.Add(-progressWindow)
+	first := 0
+	for first < len(p.samples)-1 && p.samples[first].at.Before(cutoff) {
+		first++
+	}
+	p.samples = p.samples[first:]
+
+	oldest := p.samples[0]
+	elapsed := now.Sub(oldest.at).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(copied-oldest.bytes) / elapsed
+}
+
+func (p *backupProgress) render() {
+	copied := p.copied.Load() - p.startBytes
+	rate := p.rate(time.Now(), copied)
+
+	remaining := "未知"
+	if rate > 0 {
+		left := p.totalBytes - copied
+		if left < 0 {
+			left = 0
+		}
+		remaining = (time.Duration(float64(left)/rate) * time.Second).Round(time.Second).String()
+	}
+
+	fmt.Fprintf(os.Stderr, "\r\033[K备份中: %d/%d 文件 (%.1f MB/s, 预计剩余: %s)",
+		p.doneFiles.Load(), p.totalFiles, rate/1024/1024, remaining)
+}
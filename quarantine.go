@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// previewLimit 隔离文件预览的最大字节数
+const previewLimit = 64 * 1024
+
+// highlightHints 扩展名到前端语法高亮class的映射
+var highlightHints = map[string]string{
+	".php":   "language-php",
+	".phtml": "language-php",
+	".jsp":   "language-java",
+	".jspx":  "language-java",
+	".asp":   "language-vbscript",
+	".aspx":  "language-csharp",
+	".js":    "language-javascript",
+	".py":    "language-python",
+	".sh":    "language-bash",
+	".html":  "language-html",
+}
+
+// isolatedTarget 返回隔离目标路径: 在隔离目录中保持相对监控根目录的路径(多个根目录时位于各自的子目录),
+// 只告警目录(临时目录等)中的文件按绝对路径放在_external/下; 重名时在扩展名前加上时间戳
+func (dm *DirectoryMonitor) isolatedTarget(filePath string) string {
+	// Windows盘符中的冒号不能出现在路径中间, C:\x 放在 _external\C\x
+	volume := filepath.VolumeName(filePath)
+	target := filepath.Join(dm.isolateDir, "_external", strings.TrimSuffix(volume, ":"), filePath[len(volume):])
+	if root, rel, err := dm.relToRoot(filePath); err == nil {
+		target = filepath.Join(root.isolateDir, rel)
+	}
+
+	if _, err := os.Lstat(target); os.IsNotExist(err) {
+		return target
+	}
+	ext := filepath.Ext(target)
+	stamp := time.Now().Format("20060102_150405.000000")
+	return strings.TrimSuffix(target, ext) + "." + stamp + ext
+}
+
+// quarantinePath 把URL中的文件名解析为隔离目录内的路径, 拒绝目录穿越;
+// 多个监控根目录时文件名带有根目录的子目录前缀, 例如var_www_html/xxx
+func (dm *DirectoryMonitor) quarantinePath(name string) (string, error) {
+	if name == "" || name != filepath.Clean(name) || filepath.IsAbs(name) ||
+		name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("无效的文件名: %s", name)
+	}
+
+	filePath := filepath.Join(dm.isolateDir, name)
+	if !dm.isRegularFile(filePath) {
+		return "", fmt.Errorf("隔离文件不存在: %s", name)
+	}
+	return filePath, nil
+}
+
+// readPreview 读取隔离文件的前previewLimit字节, 返回内容, 是否文本, 是否被截断
+func readPreview(filePath string) ([]byte, bool, bool, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, false, false, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, previewLimit+1))
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	truncated := len(data) > previewLimit
+	if truncated {
+		data = data[:previewLimit]
+	}
+
+	mime := http.DetectContentType(data)
+	isText := strings.HasPrefix(mime, "text/") ||
+		(utf8.Valid(data) && !strings.ContainsRune(string(data), 0))
+	return data, isText, truncated, nil
+}
+
+func highlightHint(name string) string {
+	lower := strings.ToLower(name)
+	for ext, hint := range highlightHints {
+		if strings.HasSuffix(lower, ext) || strings.Contains(lower, ext+"_") {
+			return hint
+		}
+	}
+	return "language-plaintext"
+}
+
+func (dm *DirectoryMonitor) listQuarantine() ([]string, error) {
+	var names []string
+	err := filepath.Walk(dm.isolateDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && !isSidecar(path) {
+			name, _ := filepath.Rel(dm.isolateDir, path)
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// handleQuarantineAPI GET /api/quarantine 列出隔离文件, GET /api/quarantine/{filename}/preview 预览内容,
+// GET /api/quarantine/{filename}/diff 二进制文件的字节级差异
+func (dm *DirectoryMonitor) handleQuarantineAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/quarantine"), "/")
+	if rest == "" {
+		names, err := dm.listQuarantine()
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, names)
+		return
+	}
+
+	if strings.HasSuffix(rest, "/diff") {
+		dm.handleQuarantineDiff(w, strings.TrimSuffix(rest, "/diff"))
+		return
+	}
+
+	if !strings.HasSuffix(rest, "/preview") {
+		writeJSONError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	filePath, err := dm.quarantinePath(strings.TrimSuffix(rest, "/preview"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	data, isText, truncated, err := readPreview(filePath)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Preview-Truncated", fmt.Sprint(truncated))
+	if isText {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, html.EscapeString(string(data)))
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(data)
+	}
+}
+
+// handleQuarantinePage GET /quarantine/{filename} 在<pre>中展示隔离文件, 二进制文件以hexdump展示
+func (dm *DirectoryMonitor) handleQuarantinePage(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/quarantine"), "/")
+	filePath, err := dm.quarantinePath(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	data, isText, truncated, err := readPreview(filePath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	content, hint := string(data), highlightHint(name)
+	if !isText {
+		content, hint = hex.Dump(data), "language-hexdump"
+	}
+
+	note := ""
+	if truncated {
+		note = fmt.Sprintf("<p>仅显示前 %d 字节</p>", previewLimit)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>隔离文件 - %s</title></head>
+<body>
+<h3>%s</h3>
+%s<pre><code class="%s">%s</code></pre>
+</body>
+</html>
+`, html.EscapeString(name), html.EscapeString(name), note, hint, html.EscapeString(content))
+}
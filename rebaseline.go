@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// handleRebaselineSignal SIGHUP按当前内容重建整棵目录树的备份和基线
+func (dm *DirectoryMonitor) handleRebaselineSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		for range signals {
+			logInfo("收到SIGHUP，重建基线")
+			if _, err := dm.rebaseline(nil); err != nil {
+				logError(fmt.Sprintf("重建基线失败: %v", err))
+			}
+		}
+	}()
+}
+
+// rebaseline 接受已部署的合法修改: 没有指定路径时重建整棵目录树, 否则只重建指定的文件或目录
+func (dm *DirectoryMonitor) rebaseline(paths []string) (int, error) {
+	if len(paths) == 0 {
+		return dm.rebuildBaseline()
+	}
+
+	total := 0
+	for _, input := range paths {
+		count, err := dm.rebaselinePath(input)
+		if err != nil {
+			return total, fmt.Errorf("%s: %v", input, err)
+		}
+		total += count
+	}
+	logSuccess(fmt.Sprintf("基线已按当前内容更新: %s，共 %d 个文件", strings.Join(paths, ", "), total))
+	return total, nil
+}
+
+// rebaselinePath 重新备份并记录一个文件或目录树的当前状态; 路径已不存在时视为确认删除,
+// 从基线中移除, 之后不再还原
+func (dm *DirectoryMonitor) rebaselinePath(input string) (int, error) {
+	path, err := dm.monitoredPath(input)
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		dm.forgetTree(path)
+		dm.audit("rebaseline", path, "deleted")
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if !info.IsDir() {
+		if err := dm.rebaselineFile(path); err != nil {
+			return 0, err
+		}
+		dm.audit("rebaseline", path, "file")
+		return 1, nil
+	}
+
+	current := make(map[string]bool)
+	visited := make(map[string]bool)
+	err = filepath.Walk(path, func(dir string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if dm.isExcluded(dir) {
+			return filepath.SkipDir
+		}
+
+		files, _, symlinks, specials, err := dm.readDirectory(dir)
+		if err != nil {
+			return err
+		}
+		dm.recordSymlinks(symlinks)
+		dm.recordSpecialFiles(specials)
+		dm.recordDirInfo(dir)
+		visited[dir] = true
+
+		for _, filePath := range files {
+			if err := dm.rebaselineFile(filePath); err != nil {
+				return err
+			}
+			current[filePath] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// 已删除的子目录确认删除, 不再重建
+	for _, dir := range dm.directoryList() {
+		if withinDir(dir, path) && !visited[dir] && !dm.dirRules[dir].alertOnly() {
+			dm.forgetTree(dir)
+		}
+	}
+
+	dm.mu.Lock()
+	for filePath := range dm.baseline {
+		if withinDir(filePath, path) && !current[filePath] && !dm.dirRules[filepath.Dir(filePath)].alertOnly() {
+			delete(dm.baseline, filePath)
+		}
+	}
+	dm.mu.Unlock()
+	dm.markManifestDirty()
+
+	// 新目录中的文件已记入基线, 纳入监控后不会再按新增文件处理
+	dm.addDirectoryTree(path)
+	dm.audit("rebaseline", path, fmt.Sprintf("%d files", len(current)))
+	return len(current), nil
+}
+
+// forgetTree 从文件和目录基线中移除path及其下的所有内容, 这些目录在下次检查结束后从扫描调度中移除
+func (dm *DirectoryMonitor) forgetTree(path string) {
+	dm.mu.Lock()
+	for filePath := range dm.baseline {
+		if withinDir(filePath, path) {
+			delete(dm.baseline, filePath)
+		}
+	}
+	dm.mu.Unlock()
+
+	dm.dirMu.Lock()
+	var dirs []string
+	for dir := range dm.knownDirs {
+		if withinDir(dir, path) {
+			dirs = append(dirs, dir)
+		}
+	}
+	for dir := range dm.dirBaseline {
+		if withinDir(dir, path) {
+			delete(dm.dirBaseline, dir)
+		}
+	}
+	dm.dirMu.Unlock()
+	dm.markManifestDirty()
+
+	for _, dir := range dirs {
+		dm.forgetDirectory(dir)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const replHelp = "可用命令: status | rebuild | rebaseline [path...] | pause | resume [revert] | suppress <path> | unsuppress <path> | " +
+	"lockout <path> <duration> | list-quarantine | unisolate <isolated-file> | restore <path> | help"
+
+// startREPL 从标准输入读取运维命令, 与监控goroutine并发执行, 每条命令输出一行结果
+func (dm *DirectoryMonitor) startREPL() {
+	go func() {
+		logInfo("交互命令已启用, 输入help查看可用命令")
+
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			fmt.Println(dm.execCommand(strings.Fields(line)))
+		}
+		if err := scanner.Err(); err != nil {
+			logError(fmt.Sprintf("读取标准输入失败: %v", err))
+		}
+	}()
+}
+
+// execCommand 执行一条交互命令并返回结果
+func (dm *DirectoryMonitor) execCommand(args []string) string {
+	usage := func(format string) string { return "用法: " + format }
+
+	switch args[0] {
+	case "help":
+		return replHelp
+
+	case "status":
+		dm.mu.RLock()
+		files := len(dm.baseline)
+		dm.mu.RUnlock()
+		return fmt.Sprintf("基线文件: %d, 检查: %d, 告警: %d, 还原: %d, 隔离: %d, 豁免中: %d, 暂停: %v",
+			files, dm.stats.checks.Load(), dm.stats.alerts.Load(),
+			dm.stats.restores.Load(), dm.stats.isolations.Load(), len(dm.listLockouts()), dm.paused.Load())
+
+	case "pause":
+		if !dm.pause() {
+			return "检测已处于暂停状态"
+		}
+		return "检测已暂停"
+
+	case "resume":
+		// resume revert: 不重建基线, 恢复后还原暂停期间的修改
+		rebaseline := dm.rebaselineOnResume
+		if len(args) > 1 && args[1] == "revert" {
+			rebaseline = false
+		}
+		resumed, err := dm.resume(rebaseline)
+		if err != nil {
+			return err.Error()
+		}
+		if !resumed {
+			return "检测未暂停"
+		}
+		return "检测已恢复"
+
+	case "rebaseline":
+		count, err := dm.rebaseline(args[1:])
+		if err != nil {
+			return fmt.Sprintf("更新基线失败: %v", err)
+		}
+		return fmt.Sprintf("基线已更新, 共 %d 个文件", count)
+
+	case "rebuild":
+		count, err := dm.rebuildBaseline()
+		if err != nil {
+			return fmt.Sprintf("重建基线失败: %v", err)
+		}
+		return fmt.Sprintf("基线已重建, 共 %d 个文件", count)
+
+	case "suppress", "unsuppress":
+		if len(args) != 2 {
+			return usage(args[0] + " <path>")
+		}
+		filePath, err := dm.monitoredPath(args[1])
+		if err != nil {
+			return err.Error()
+		}
+		if args[0] == "suppress" {
+			dm.suppress(filePath)
+		} else {
+			dm.unsuppress(filePath)
+		}
+		dm.audit(args[0], filePath, "repl")
+		return fmt.Sprintf("%s: %s", args[0], filePath)
+
+	case "lockout":
+		if len(args) != 3 {
+			return usage("lockout <path> <duration>")
+		}
+		duration, err := time.ParseDuration(args[2])
+		if err != nil || duration <= 0 {
+			return fmt.Sprintf("无效的时长: %s", args[2])
+		}
+		filePath, err := dm.lockoutFile(args[1], duration)
+		if err != nil {
+			return err.Error()
+		}
+		return fmt.Sprintf("已豁免 %s 至 %s", filePath, time.Now().Add(duration).Format("15:04:05"))
+
+	case "list-quarantine":
+		names, err := dm.listQuarantine()
+		if err != nil {
+			return fmt.Sprintf("读取隔离目录失败: %v", err)
+		}
+		if len(names) == 0 {
+			return "隔离目录为空"
+		}
+		return strings.Join(names, " ")
+
+	case "unisolate":
+		if len(args) != 2 {
+			return usage("unisolate <isolated-file>")
+		}
+		origin, err := dm.unisolate(args[1])
+		if err != nil {
+			return fmt.Sprintf("还原隔离文件失败: %v", err)
+		}
+		return fmt.Sprintf("已还原到 %s", origin)
+
+	case "restore":
+		if len(args) != 2 {
+			return usage("restore <path>")
+		}
+		filePath, err := dm.monitoredPath(args[1])
+		if err != nil {
+			return err.Error()
+		}
+		if err := dm.restoreFile(filePath); err != nil {
+			return fmt.Sprintf("还原失败: %v", err)
+		}
+		dm.audit("restore", filePath, "repl")
+		return fmt.Sprintf("已还原: %s", filePath)
+	}
+
+	return fmt.Sprintf("未知命令: %s (%s)", args[0], replHelp)
+}
+
+func (dm *DirectoryMonitor) unsuppress(filePath string) {
+	dm.suppressMu.Lock()
+	delete(dm.suppressed, filePath)
+	dm.suppressMu.Unlock()
+}
+
+// rebuildBaseline 以监控目录当前内容重建备份和基线, 用于授权的批量修改之后
+func (dm *DirectoryMonitor) rebuildBaseline() (int, error) {
+	current := make(map[string]bool)
+	for _, dir := range dm.directoryList() {
+		files, _, symlinks, specials, err := dm.readDirectory(dir)
+		if os.IsNotExist(err) && !dm.dirRules[dir].alertOnly() {
+			dm.forgetTree(dir)
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		dm.recordSymlinks(symlinks)
+		dm.recordSpecialFiles(specials)
+		dm.recordDirInfo(dir)
+
+		for _, filePath := range files {
+			if err := dm.rebaselineFile(filePath); err != nil {
+				return 0, err
+			}
+			current[filePath] = true
+		}
+	}
+
+	dm.mu.Lock()
+	for filePath := range dm.baseline {
+		if !current[filePath] && !dm.dirRules[filepath.Dir(filePath)].alertOnly() {
+			delete(dm.baseline, filePath)
+		}
+	}
+	dm.mu.Unlock()
+	dm.markManifestDirty()
+
+	logSuccess(fmt.Sprintf("基线已按当前内容重建，共 %d 个文件", len(current)))
+	dm.audit("rebuild", dm.watchDir, fmt.Sprintf("%d files", len(current)))
+	return len(current), nil
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 回滚报告中每个路径的处理结果
+const (
+	rollbackUnchanged  = "unchanged"
+	rollbackReplaced   = "replaced"
+	rollbackCreated    = "created"
+	rollbackAttributes = "attributes"
+	rollbackMovedAway  = "moved_away"
+	rollbackFailed     = "failed"
+)
+
+// rollbackEntry 回滚报告中的一项
+type rollbackEntry struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// rollbackReport 一次回滚的完整报告, -report时写为JSON
+type rollbackReport struct {
+	Backup    string          `json:"backup"`
+	WatchDirs []string        `json:"watch_dirs"`
+	DryRun    bool            `json:"dry_run"`
+	MovedTo   string          `json:"moved_to,omitempty"`
+	StartedAt string          `json:"started_at"`
+	Entries   []rollbackEntry `json:"entries"`
+}
+
+func (r *rollbackReport) add(path, action, detail string) {
+	r.Entries = append(r.Entries, rollbackEntry{Path: path, Action: action, Detail: detail})
+	if action != rollbackUnchanged {
+		logInfo(fmt.Sprintf("[%s] %s %s", action, path, detail))
+	}
+}
+
+func (r *rollbackReport) count(action string) int {
+	n := 0
+	for _, entry := range r.Entries {
+		if entry.Action == action {
+			n++
+		}
+	}
+	return n
+}
+
+// rollback 按选定的备份快照还原整个监控目录
+type rollback struct {
+	dm       *DirectoryMonitor
+	manifest *baselineManifest
+	report   *rollbackReport
+	// movedDir 多出的文件和目录移到这里, 不直接删除
+	movedDir  string
+	dryRun    bool
+	keepExtra bool
+}
+
+func runRollback(args []string) int {
+	fs := flag.NewFlagSet("rollback", flag.ExitOnError)
+	backupDir := fs.String("b", "", "要回滚到的备份目录 (例如: /tmp/edr_workspace/backup_20250821_143022 或 backup_latest)")
+	baseDir := fs.String("base", "", "基础目录, 不指定-b时回滚到其中最近的备份(优先使用backup_latest链接)")
+	watchDir := fs.String("m", "", "要还原的监控目录, 多个用逗号分隔; 备份中有manifest.json时可省略, 默认还原清单中的全部目录")
+	extensions := fs.String("e", "", "备份中没有manifest.json时使用的扩展名过滤, 与备份时的-e一致")
+	dryRun := fs.Bool("dry-run", false, "只输出报告, 不修改任何文件")
+	keepExtra := fs.Bool("keep-extra", false, "保留备份中没有的文件和目录; 默认移到基础目录下的rollback_<时间戳>/")
+	reportPath := fs.String("report", "", "把回滚报告以JSON写入该文件")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: edr rollback -b <备份目录>|-base <基础目录> [-m <监控目录>] [-dry-run] [-keep-extra] [-report report.json]")
+		fmt.Fprintln(os.Stderr, "按备份快照还原所有文件、目录、权限和所有者; 正在运行的实例应先暂停(pause), 回滚后再恢复")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if (*backupDir == "" && *baseDir == "") || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	if *backupDir == "" {
+		dir, err := latestBackupDir(*baseDir)
+		if err != nil {
+			logError(fmt.Sprintf("查找最近的备份失败: %v", err))
+			return 1
+		}
+		logInfo(fmt.Sprintf("使用最近的备份: %s", dir))
+		*backupDir = dir
+	}
+
+	rb, err := newRollback(*backupDir, parseList(*watchDir), parseExtensions(*extensions))
+	if err != nil {
+		logError(err.Error())
+		return 1
+	}
+	rb.dryRun, rb.keepExtra = *dryRun, *keepExtra
+	rb.report.DryRun = *dryRun
+
+	rb.run()
+
+	report := rb.report
+	mode := ""
+	if rb.dryRun {
+		mode = "(dry-run, 未修改)"
+	}
+	logSuccess(fmt.Sprintf("回滚完成%s:  替换 %d, 新建 %d, 恢复属性 %d, 未变化 %d, 移走 %d, 失败 %d",
+		mode,
+
+		report.count(rollbackReplaced), report.count(rollbackCreated), report.count(rollbackAttributes),
+		report.count(rollbackUnchanged), report.count(rollbackMovedAway), report.count(rollbackFailed)))
+	if report.count(rollbackMovedAway) > 0 && !rb.dryRun {
+		logInfo(fmt.Sprintf("多出的文件已移到: %s", rb.movedDir))
+	}
+
+	if *reportPath != "" {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		if err := os.WriteFile(*reportPath, append(data, '\n'), 0600); err != nil {
+			logError(fmt.Sprintf("写入回滚报告失败: %v", err))
+			return 1
+		}
+		logInfo(fmt.Sprintf("回滚报告: %s", *reportPath))
+	}
+
+	if report.count(rollbackFailed) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// newRollback 解析备份目录: 有清单时按清单中的监控范围和属性还原, 没有时只能按备份文件自身的属性还原单个监控目录
+func newRollback(backupDir string, watchDirs, extensions []string) (*rollback, error) {
+	backupDir, err := filepath.Abs(backupDir)
+	if err != nil {
+		return nil, err
+	}
+	if resolved, err := filepath.EvalSymlinks(backupDir); err == nil {
+		backupDir = resolved
+	}
+	if info, err := os.Stat(backupDir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("备份目录不存在: %s", backupDir)
+	}
+	for i, dir := range watchDirs {
+		if watchDirs[i], err = filepath.Abs(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	config := MonitorConfig{WatchDirs: watchDirs, BaseDir: filepath.Dir(backupDir), Extensions: extensions}
+	manifest, err := readManifest(backupDir)
+	switch {
+	case err == nil:
+		config.WatchDirs = manifest.Scope.WatchDirs
+		config.Extensions = manifest.Scope.Extensions
+		if config.Excludes, err = parseExcludes(strings.Join(manifest.Scope.Excludes, ",")); err != nil {
+			return nil, err
+		}
+	case os.IsNotExist(err):
+		manifest = nil
+		if len(watchDirs) != 1 {
+			return nil, fmt.Errorf("备份中没有%s, 必须用-m指定一个监控目录", manifestName)
+		}
+		logWarn(fmt.Sprintf("备份中没有%s, 按备份文件自身的属性还原, 不处理多出的文件和空目录", manifestName))
+	default:
+		return nil, err
+	}
+
+	stamp := time.Now().Format("20060102_150405")
+	dm := NewDirectoryMonitor(config)
+	dm.backupDir = backupDir
+	dm.roots = newWatchRoots(config.WatchDirs, backupDir, "")
+
+	// -m只还原清单中的部分监控目录
+	if manifest != nil && len(watchDirs) > 0 {
+		var selected []watchRoot
+		for _, dir := range watchDirs {
+			root := dm.rootFor(dir)
+			if root == nil || root.dir != dir {
+				return nil, fmt.Errorf("备份中没有该监控目录: %s (备份包含: %v)", dir, config.WatchDirs)
+			}
+			selected = append(selected, *root)
+		}
+		dm.roots = selected
+	}
+
+	return &rollback{
+		dm:       dm,
+		manifest: manifest,
+		movedDir: filepath.Join(filepath.Dir(backupDir), "rollback_"+stamp),
+		report: &rollbackReport{
+			Backup:    backupDir,
+			WatchDirs: dm.rootDirs(),
+			StartedAt: time.Now().Format(time.RFC3339),
+		},
+	}, nil
+}
+
+func (rb *rollback) run() {
+	for _, root := range rb.dm.roots {
+		if rb.manifest != nil {
+			rb.restoreDirs(root)
+			if !rb.keepExtra {
+				rb.moveExtras(root)
+			}
+			rb.restoreFilesFromManifest(root)
+			rb.restoreSymlinks(root)
+		} else {
+			rb.restoreFilesFromBackup(root)
+		}
+	}
+}
+
+// restoreDirs 按清单重建目录层级并恢复权限和所有者, 父目录先于子目录
+func (rb *rollback) restoreDirs(root watchRoot) {
+	var dirs []string
+	for dir := range rb.manifest.Dirs {
+		if withinDir(dir, root.dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		want := rb.manifest.Dirs[dir]
+		mode := os.FileMode(want.Mode)
+		info, err := os.Lstat(dir)
+		switch {
+		case err == nil && info.IsDir():
+			uid, gid := ownerIDs(info)
+			current := info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+			if current == mode&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky) && uid == want.Uid && gid == want.Gid {
+				continue
+			}
+			rb.report.add(dir+"/", rollbackAttributes, fmt.Sprintf("%04o -> %04o", unixMode(current), unixMode(mode)))
+		case err == nil:
+			// 同名的文件或符号链接占据了目录的位置
+			if !rb.moveAway(dir) {
+				continue
+			}
+			rb.report.add(dir+"/", rollbackCreated, "")
+		default:
+			rb.report.add(dir+"/", rollbackCreated, "")
+		}
+
+		if rb.dryRun {
+			continue
+		}
+		if err := os.MkdirAll(dir, mode.Perm()); err != nil {
+			rb.report.add(dir+"/", rollbackFailed, err.Error())
+			continue
+		}
+		if err := setOwner(dir, want.Uid, want.Gid, ""); err != nil {
+			logDebug(fmt.Sprintf("设置目录所有者失败 %s: %v", dir, err))
+		}
+		if err := os.Chmod(dir, mode); err != nil {
+			rb.report.add(dir+"/", rollbackFailed, err.Error())
+		}
+	}
+}
+
+// moveExtras 把备份中没有的被监控文件、符号链接和目录移走
+func (rb *rollback) moveExtras(root watchRoot) {
+	var extras []string
+	filepath.Walk(root.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == root.dir {
+			return nil
+		}
+		if rb.dm.isExcluded(path) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case info.IsDir():
+			if _, ok := rb.manifest.Dirs[path]; !ok {
+				extras = append(extras, path)
+				return filepath.SkipDir
+			}
+		case info.Mode()&os.ModeSymlink != 0:
+			if _, ok := rb.manifest.Symlinks[path]; !ok {
+				extras = append(extras, path)
+			}
+		case info.Mode().IsRegular():
+			if _, ok := rb.manifest.Files[path]; !ok && rb.dm.shouldMonitorFile(path) {
+				extras = append(extras, path)
+			}
+		}
+		return nil
+	})
+
+	for _, path := range extras {
+		rb.moveAway(path)
+	}
+}
+
+// moveAway 把路径移到movedDir下保持相对路径, 返回是否成功
+func (rb *rollback) moveAway(path string) bool {
+	volume := filepath.VolumeName(path)
+	target := filepath.Join(rb.movedDir, strings.TrimSuffix(volume, ":"), path[len(volume):])
+	if rb.dryRun {
+		rb.report.add(path, rollbackMovedAway, "")
+		return true
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		rb.report.add(path, rollbackFailed, err.Error())
+		return false
+	}
+	if err := moveFile(path, target); err != nil {
+		rb.report.add(path, rollbackFailed, err.Error())
+		return false
+	}
+	rb.report.add(path, rollbackMovedAway, target)
+	return true
+}
+
+func (rb *rollback) restoreFilesFromManifest(root watchRoot) {
+	var files []string
+	for path := range rb.manifest.Files {
+		if withinDir(path, root.dir) {
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+
+	for _, path := range files {
+		backupPath, err := rb.dm.backupPathFor(path)
+		if err != nil {
+			rb.report.add(path, rollbackFailed, err.Error())
+			continue
+		}
+		rb.restoreFile(path, backupPath, rb.manifest.Files[path].fileInfo(path))
+	}
+}
+
+// restoreFilesFromBackup 没有清单时遍历备份目录, 备份文件在备份时保留了原文件的属性
+func (rb *rollback) restoreFilesFromBackup(root watchRoot) {
+	filepath.Walk(root.backupDir, func(backupPath string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root.backupDir, backupPath)
+		if err != nil || rel == manifestName || rel == manifestJSONLName {
+			return nil
+		}
+
+		path := filepath.Join(root.dir, rel)
+		want, err := rb.dm.hashedFileInfo(backupPath)
+		if err != nil {
+			rb.report.add(path, rollbackFailed, err.Error())
+			return nil
+		}
+		want.Path = path
+		if !rb.dryRun {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				rb.report.add(path, rollbackFailed, err.Error())
+				return nil
+			}
+		}
+		rb.restoreFile(path, backupPath, want)
+		return nil
+	})
+}
+
+// restoreFile 比较当前文件与期望的内容和属性, 内容不同时从备份复制到临时文件再rename覆盖
+// (不跟随攻击者放置的符号链接), 最后恢复权限、所有者和修改时间
+func (rb *rollback) restoreFile(path, backupPath string, want FileInfo) {
+	action := rollbackUnchanged
+	detail := ""
+
+	info, err := os.Lstat(path)
+	switch {
+	case os.IsNotExist(err):
+		action = rollbackCreated
+	case err != nil:
+		rb.report.add(path, rollbackFailed, err.Error())
+		return
+	case !info.Mode().IsRegular():
+		// 目录或符号链接占据了文件的位置
+		if !rb.moveAway(path) {
+			return
+		}
+		action = rollbackCreated
+	default:
+		if hash, err := hashFile(path); err != nil || hash != want.Hash {
+			action = rollbackReplaced
+			detail = fmt.Sprintf("%d -> %d bytes", info.Size(), want.Size)
+		} else if current, err := rb.dm.getFileInfo(path); err != nil ||
+			current.Mode != want.Mode || current.Uid != want.Uid || current.Gid != want.Gid {
+			action = rollbackAttributes
+			detail = fmt.Sprintf("%v -> %v, %d:%d -> %d:%d", current.Mode, want.Mode, current.Uid, current.Gid, want.Uid, want.Gid)
+		}
+	}
+
+	if action == rollbackUnchanged || rb.dryRun {
+		rb.report.add(path, action, detail)
+		return
+	}
+
+	if action != rollbackAttributes {
+		if err := replaceWithBackup(path, backupPath); err != nil {
+			rb.report.add(path, rollbackFailed, err.Error())
+			return
+		}
+	}
+	if err := copyXattrs(backupPath, path); err != nil {
+		logWarn(fmt.Sprintf("恢复扩展属性失败 %s: %v", path, err))
+	}
+	if err := rb.dm.restoreFileAttributes(path, want); err != nil {
+		rb.report.add(path, rollbackFailed, err.Error())
+		return
+	}
+	rb.report.add(path, action, detail)
+}
+
+// replaceWithBackup 把备份复制到目标目录中的临时文件, 再rename覆盖目标
+func replaceWithBackup(path, backupPath string) error {
+	src, err := os.Open(backupPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".edr-rollback-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	makeWritable(path)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// restoreSymlinks 重建清单中记录的符号链接, 指向被修改的链接先移走
+func (rb *rollback) restoreSymlinks(root watchRoot) {
+	var links []string
+	for link := range rb.manifest.Symlinks {
+		if withinDir(link, root.dir) {
+			links = append(links, link)
+		}
+	}
+	sort.Strings(links)
+
+	for _, link := range links {
+		target := rb.manifest.Symlinks[link]
+		if current, err := os.Readlink(link); err == nil && current == target {
+			rb.report.add(link, rollbackUnchanged, "")
+			continue
+		}
+
+		action := rollbackCreated
+		if _, err := os.Lstat(link); err == nil {
+			if !rb.moveAway(link) {
+				continue
+			}
+			action = rollbackReplaced
+		}
+		if !rb.dryRun {
+			if err := os.Symlink(target, link); err != nil {
+				rb.report.add(link, rollbackFailed, err.Error())
+				continue
+			}
+		}
+		rb.report.add(link, action, "-> "+target)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// watchRoot 一个监控根目录; 多个根目录时各自在备份/隔离目录下使用独立的子目录
+type watchRoot struct {
+	dir        string
+	label      string
+	backupDir  string
+	isolateDir string
+}
+
+// rootLabel 由根目录路径生成子目录名, 例如/var/www/html -> var_www_html
+func rootLabel(dir string) string {
+	label := strings.ReplaceAll(strings.Trim(filepath.ToSlash(dir), "/."), "/", "_")
+	if label == "" {
+		return "root"
+	}
+	return label
+}
+
+// newWatchRoots 只有一个根目录时沿用原有布局, 备份和隔离文件直接放在backup_/isolate_目录下
+func newWatchRoots(dirs []string, backupDir, isolateDir string) []watchRoot {
+	roots := make([]watchRoot, 0, len(dirs))
+	used := make(map[string]bool)
+	for _, dir := range dirs {
+		root := watchRoot{dir: filepath.Clean(dir), backupDir: backupDir, isolateDir: isolateDir}
+		if len(dirs) > 1 {
+			root.label = rootLabel(root.dir)
+			for i := 2; used[root.label]; i++ {
+				root.label = fmt.Sprintf("%s_%d", rootLabel(root.dir), i)
+			}
+			used[root.label] = true
+			root.backupDir = filepath.Join(backupDir, root.label)
+			root.isolateDir = filepath.Join(isolateDir, root.label)
+		}
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// validateRoots 根目录之间不能互相包含, 否则同一目录会被重复监控
+func validateRoots(dirs []string) error {
+	for i, a := range dirs {
+		absA, err := filepath.Abs(a)
+		if err != nil {
+			return err
+		}
+		for _, b := range dirs[i+1:] {
+			absB, err := filepath.Abs(b)
+			if err != nil {
+				return err
+			}
+			if withinDir(absA, absB) || withinDir(absB, absA) {
+				return fmt.Errorf("监控目录不能互相包含: %s, %s", a, b)
+			}
+		}
+	}
+	return nil
+}
+
+// rootFor 返回路径所属的监控根目录, 不在任何根目录内(例如只告警目录)时返回nil
+func (dm *DirectoryMonitor) rootFor(path string) *watchRoot {
+	for i := range dm.roots {
+		if withinDir(path, dm.roots[i].dir) {
+			return &dm.roots[i]
+		}
+	}
+	return nil
+}
+
+// rootDirs 返回所有监控根目录
+func (dm *DirectoryMonitor) rootDirs() []string {
+	dirs := make([]string, len(dm.roots))
+	for i, root := range dm.roots {
+		dirs[i] = root.dir
+	}
+	return dirs
+}
+
+// relToRoot 返回路径所属的根目录和相对路径, 用于计算备份路径和目录模式匹配
+func (dm *DirectoryMonitor) relToRoot(path string) (*watchRoot, string, error) {
+	root := dm.rootFor(path)
+	if root == nil {
+		return nil, "", fmt.Errorf("路径不在监控目录内: %s", path)
+	}
+	rel, err := filepath.Rel(root.dir, path)
+	if err != nil {
+		return nil, "", err
+	}
+	return root, rel, nil
+}
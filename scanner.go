@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// scanLimit 特征扫描读取的最大字节数, 一句话木马通常很短, 大文件只扫描开头
+const scanLimit = 1024 * 1024
+
+// signature 一条webshell特征规则
+type signature struct {
+	Lang    string
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// builtinSignatures 内置特征, 按语言分组; generic组对所有文件生效
+var builtinSignatures = map[string][]struct{ name, pattern string }{
+	"php": {
+		{"php_eval_request", `(?i)\b(eval|assert)\s*\(\s*(\$_(GET|POST|REQUEST|COOKIE|SERVER|FILES)|\$\{?["']?_(GET|POST|REQUEST)|stripslashes\s*\(\s*\$_|urldecode\s*\(\s*\$_)`},
+		{"php_exec_request", `(?i)\b(system|exec|passthru|shell_exec|popen|proc_open|pcntl_exec)\s*\(\s*\$_(GET|POST|REQUEST|COOKIE|SERVER)`},
+		{"php_eval_decode", `(?i)\b(eval|assert)\s*\(\s*(base64_decode|gzinflate|gzuncompress|gzdecode|str_rot13|hex2bin)\s*\(`},
+		{"php_variable_function", `\$_(GET|POST|REQUEST|COOKIE)\s*\[[^\]]+\]\s*\(\s*\$_(GET|POST|REQUEST|COOKIE)`},
+		{"php_create_function", `(?i)\bcreate_function\s*\(`},
+		{"php_preg_replace_e", `(?i)preg_replace\s*\(\s*['"][/#~|!@].*[/#~|!@][a-z]*e[a-z]*['"]`},
+		{"php_callback_request", `(?i)\b(array_map|call_user_func(_array)?|usort|uasort|array_filter|register_shutdown_function)\s*\(\s*\$_(GET|POST|REQUEST|COOKIE)`},
+		{"php_backtick_request", "`\\s*\\$_(GET|POST|REQUEST|COOKIE)"},
+		{"php_behinder", `(?i)openssl_decrypt\s*\(.*php://input|\$_SESSION\s*\[\s*['"]k['"]\s*\]`},
+	},
+	"jsp": {
+		{"jsp_runtime_exec", `Runtime\.getRuntime\(\)\.exec\s*\(`},
+		{"jsp_process_builder", `new\s+ProcessBuilder\s*\(`},
+		{"jsp_define_class", `(?s)ClassLoader.*defineClass\s*\(`},
+	},
+	"asp": {
+		{"asp_eval_request", `(?i)\b(eval|execute)\s*\(?\s*request\s*[\.(]`},
+		{"aspx_process_start", `(?i)Process\.Start\s*\(`},
+	},
+	"generic": {
+		{"generic_chopper", `(?i)\b(eval|assert|exec)\s*\(\s*(request|\$_POST)\s*[\[\(]\s*["']?[a-z0-9_]{1,10}["']?\s*[\]\)]\s*\)`},
+	},
+}
+
+// signatureLangs 扩展名到特征组的映射, 未列出的扩展名扫描所有组
+var signatureLangs = map[string]string{
+	".php": "php", ".php3": "php", ".php4": "php", ".php5": "php", ".php7": "php",
+	".phtml": "php", ".pht": "php", ".inc": "php",
+	".jsp": "jsp", ".jspx": "jsp", ".jspf": "jsp",
+	".asp": "asp", ".aspx": "asp", ".asa": "asp", ".ashx": "asp", ".cer": "asp",
+}
+
+// signatureScanner 按语言分组的特征集合
+type signatureScanner struct {
+	groups map[string][]signature
+}
+
+// newSignatureScanner 加载内置特征, rulesFile非空时追加其中的自定义规则
+func newSignatureScanner(rulesFile string) (*signatureScanner, error) {
+	s := &signatureScanner{groups: make(map[string][]signature)}
+	for lang, rules := range builtinSignatures {
+		for _, rule := range rules {
+			s.add(signature{Lang: lang, Name: rule.name, Pattern: regexp.MustCompile(rule.pattern)})
+		}
+	}
+
+	if rulesFile != "" {
+		if err := s.load(rulesFile); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *signatureScanner) add(sig signature) {
+	s.groups[sig.Lang] = append(s.groups[sig.Lang], sig)
+}
+
+// load 读取规则文件, 每行"语言 规则名 正则", 语言为php/jsp/asp/generic或任意自定义组名; #开头为注释
+func (s *signatureScanner) load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("打开特征规则文件失败: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return fmt.Errorf("特征规则第%d行格式错误, 应为: 语言 规则名 正则", lineNo)
+		}
+		// 正则中可能含有空格, 取规则名之后的全部内容
+		pattern := strings.TrimSpace(line[strings.Index(line, fields[1])+len(fields[1]):])
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("特征规则第%d行正则无效: %v", lineNo, err)
+		}
+		s.add(signature{Lang: fields[0], Name: fields[1], Pattern: re})
+	}
+	return scanner.Err()
+}
+
+func (s *signatureScanner) count() int {
+	total := 0
+	for _, group := range s.groups {
+		total += len(group)
+	}
+	return total
+}
+
+// rulesFor 返回适用于该文件的特征: 已知扩展名使用对应语言组和generic组, 其他文件使用全部规则
+func (s *signatureScanner) rulesFor(filePath string) []signature {
+	lang, ok := signatureLangs[strings.ToLower(filepath.Ext(filePath))]
+	if !ok {
+		var all []signature
+		for _, group := range s.groups {
+			all = append(all, group...)
+		}
+		return all
+	}
+	return append(append([]signature(nil), s.groups[lang]...), s.groups["generic"]...)
+}
+
+// scan 扫描文件开头scanLimit字节, 返回命中的第一条规则
+func (s *signatureScanner) scan(filePath string) (signature, bool) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return signature{}, false
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, scanLimit))
+	if err != nil {
+		return signature{}, false
+	}
+
+	for _, sig := range s.rulesFor(filePath) {
+		if sig.Pattern.Match(data) {
+			return sig, true
+		}
+	}
+	return signature{}, false
+}
+
+// confirmWebshell 在隔离/还原前扫描文件内容, 命中特征时告警confirmed_webshell, 返回命中的规则
+func (dm *DirectoryMonitor) confirmWebshell(filePath string) []string {
+	sig, ok := dm.scanner.scan(filePath)
+	if !ok {
+		return nil
+	}
+	dm.alertFile("critical", "confirmed_webshell",
+		fmt.Sprintf("确认为webshell: %s (命中规则: %s/%s)", filePath, sig.Lang, sig.Name),
+		alertDetail{Path: filePath})
+	return []string{"signature:" + sig.Lang + "/" + sig.Name}
+}
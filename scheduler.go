@@ -0,0 +1,296 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// slowCycleWarnInterval 扫描周期过慢警告的最小间隔, 避免持续过载时刷屏
+const slowCycleWarnInterval = time.Minute
+
+// scanTask 调度队列中的一个目录, 到期后交给worker检查
+type scanTask struct {
+	dir      string
+	interval time.Duration
+	due      time.Time
+	index    int // 在堆中的位置, -1表示正在检查
+}
+
+// scanHeap 按到期时间排序的最小堆
+type scanHeap []*scanTask
+
+func (h scanHeap) Len() int           { return len(h) }
+func (h scanHeap) Less(i, j int) bool { return h[i].due.Before(h[j].due) }
+
+func (h scanHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *scanHeap) Push(x interface{}) {
+	task := x.(*scanTask)
+	task.index = len(*h)
+	*h = append(*h, task)
+}
+
+func (h *scanHeap) Pop() interface{} {
+	old := *h
+	task := old[len(old)-1]
+	old[len(old)-1] = nil
+	task.index = -1
+	*h = old[:len(old)-1]
+	return task
+}
+
+// scanScheduler 用固定数量的worker检查所有目录, 代替每个目录一个goroutine和ticker:
+// 调度goroutine把到期的目录放入扫描队列, worker检查完成后按目录的间隔重新排期.
+// 同一目录同时只会被一个worker检查, 检查期间收到的inotify事件在结束后立即补查一次
+type scanScheduler struct {
+	queue   chan string
+	wakeCh  chan struct{}
+	workers int
+
+	mu      sync.Mutex
+	heap    scanHeap
+	tasks   map[string]*scanTask
+	pending map[string]bool
+
+	// 扫描周期: 从周期开始到所有目录各检查一次的时间
+	cycleStart     time.Time
+	cycleRemaining map[string]bool
+	lastCycle      time.Duration
+	maxCycle       time.Duration
+	cycles         int64
+	lastSlowWarn   time.Time
+}
+
+func newScanScheduler(workers int) *scanScheduler {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &scanScheduler{
+		queue:          make(chan string, workers),
+		wakeCh:         make(chan struct{}, 1),
+		workers:        workers,
+		tasks:          make(map[string]*scanTask),
+		pending:        make(map[string]bool),
+		cycleRemaining: make(map[string]bool),
+	}
+}
+
+// add 把目录加入调度, 首次检查在一个间隔之后; 已在调度中的目录忽略
+func (s *scanScheduler) add(dir string, interval time.Duration) {
+	s.addAt(dir, interval, time.Now().Add(interval))
+}
+
+// addAt 把目录加入调度, 首次检查在due时刻
+func (s *scanScheduler) addAt(dir string, interval time.Duration, due time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tasks[dir]; ok {
+		return
+	}
+	task := &scanTask{dir: dir, interval: interval, due: due}
+	s.tasks[dir] = task
+	heap.Push(&s.heap, task)
+	if s.cycleStart.IsZero() {
+		s.cycleStart = time.Now()
+	}
+	s.cycleRemaining[dir] = true
+	notify(s.wakeCh)
+}
+
+// wake 目录有inotify事件时立即检查; 正在检查中的目录在本次检查结束后补查
+func (s *scanScheduler) wake(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.wakeLocked(dir)
+}
+
+// wakeAll inotify事件队列溢出时立即检查所有目录
+func (s *scanScheduler) wakeAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for dir := range s.tasks {
+		s.wakeLocked(dir)
+	}
+}
+
+func (s *scanScheduler) wakeLocked(dir string) {
+	task, ok := s.tasks[dir]
+	if !ok {
+		return
+	}
+	if task.index < 0 {
+		s.pending[dir] = true
+		return
+	}
+	task.due = time.Now()
+	heap.Fix(&s.heap, task.index)
+	notify(s.wakeCh)
+}
+
+func (s *scanScheduler) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.tasks)
+}
+
+// dispatchScans 把到期的目录放入扫描队列, 没有到期的目录时睡眠到最近的到期时间
+func (dm *DirectoryMonitor) dispatchScans(s *scanScheduler) {
+	defer dm.wg.Done()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		wait := time.Hour
+		if len(s.heap) > 0 {
+			wait = time.Until(s.heap[0].due)
+		}
+		if len(s.heap) > 0 && wait <= 0 {
+			task := heap.Pop(&s.heap).(*scanTask)
+			s.mu.Unlock()
+
+			select {
+			case s.queue <- task.dir:
+			case <-dm.ctx.Done():
+				return
+			}
+			continue
+		}
+		s.mu.Unlock()
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wakeCh:
+		case <-dm.ctx.Done():
+			return
+		}
+	}
+}
+
+// scanWorker 从扫描队列中取目录检查, 完成后重新排期
+func (dm *DirectoryMonitor) scanWorker(s *scanScheduler) {
+	defer dm.wg.Done()
+
+	for {
+		select {
+		case dir := <-s.queue:
+			dm.checkDirectoryChanges(dir)
+			// 运行期间新建的目录被删除后不再监控; 只告警目录不在目录树中, 始终保留
+			dm.finishScan(s, dir, dm.isKnownDir(dir) || dm.dirRules[dir].alertOnly())
+		case <-dm.ctx.Done():
+			return
+		}
+	}
+}
+
+// finishScan 目录检查完成: 仍在监控的目录按间隔重新排期, 并更新扫描周期计时
+func (dm *DirectoryMonitor) finishScan(s *scanScheduler, dir string, keep bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task := s.tasks[dir]
+	if keep {
+		task.due = time.Now().Add(task.interval)
+		if s.pending[dir] {
+			task.due = time.Now()
+		}
+		heap.Push(&s.heap, task)
+		// 调度goroutine可能在堆为空时进入了长时间睡眠
+		notify(s.wakeCh)
+	} else {
+		delete(s.tasks, dir)
+	}
+	delete(s.pending, dir)
+
+	delete(s.cycleRemaining, dir)
+	if len(s.cycleRemaining) > 0 {
+		return
+	}
+	dm.completeCycleLocked(s)
+}
+
+// completeCycleLocked 所有目录各检查一次后记录周期耗时, 明显超过最长检查间隔时说明worker不够用
+func (dm *DirectoryMonitor) completeCycleLocked(s *scanScheduler) {
+	now := time.Now()
+	elapsed := now.Sub(s.cycleStart)
+	s.lastCycle = elapsed
+	if elapsed > s.maxCycle {
+		s.maxCycle = elapsed
+	}
+	s.cycles++
+
+	var longest time.Duration
+	for dir, task := range s.tasks {
+		s.cycleRemaining[dir] = true
+		if task.interval > longest {
+			longest = task.interval
+		}
+	}
+	s.cycleStart = now
+
+	if s.cycles == 1 {
+		logInfo(fmt.Sprintf("首轮扫描完成: %d 个目录, 耗时 %v, worker: %d",
+			len(s.tasks), elapsed.Round(time.Millisecond), s.workers))
+		return
+	}
+	if elapsed > 2*longest && now.Sub(s.lastSlowWarn) > slowCycleWarnInterval {
+		s.lastSlowWarn = now
+		logWarn(fmt.Sprintf("扫描周期耗时 %v, 超过最长检查间隔 %v 的两倍, 考虑增加-scan-workers (当前 %d)",
+			elapsed.Round(time.Millisecond), longest, s.workers))
+	}
+}
+
+// cycleStats 返回最近一次和最长的扫描周期耗时
+func (s *scanScheduler) cycleStats() (last, longest time.Duration, cycles int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastCycle, s.maxCycle, s.cycles
+}
+
+// startScanWorkers 启动调度goroutine和固定数量的扫描worker
+func (dm *DirectoryMonitor) startScanWorkers() {
+	dm.wg.Add(1 + dm.scheduler.workers)
+	go dm.dispatchScans(dm.scheduler)
+	for i := 0; i < dm.scheduler.workers; i++ {
+		go dm.scanWorker(dm.scheduler)
+	}
+	logInfo(fmt.Sprintf("扫描worker: %d 个, 目录: %d 个", dm.scheduler.workers, dm.scheduler.len()))
+}
+
+// scheduleDirectory 把目录加入扫描调度; inotify模式下注册事件监听, 成功时轮询只作为兜底
+func (dm *DirectoryMonitor) scheduleDirectory(dirPath string, interval time.Duration) {
+	dm.scheduler.add(dirPath, dm.watchInterval(dirPath, interval))
+}
+
+// scheduleNewDirectory 运行中新发现的目录: 注册监听后立即检查一次, 注册前已写入的文件不必等到兜底轮询
+func (dm *DirectoryMonitor) scheduleNewDirectory(dirPath string, interval time.Duration) {
+	dm.scheduler.addAt(dirPath, dm.watchInterval(dirPath, interval), time.Now())
+}
+
+// watchInterval 注册目录的inotify监听, 成功时检查间隔放宽到兜底轮询间隔
+func (dm *DirectoryMonitor) watchInterval(dirPath string, interval time.Duration) time.Duration {
+	if dm.watchDirEvents(dirPath) && interval < inotifySafetyInterval {
+		interval = inotifySafetyInterval
+	}
+	return interval
+}
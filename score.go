@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 组合评分的指标名
+const (
+	indicatorNewFile         = "new_file"
+	indicatorHighEntropy     = "high_entropy"
+	indicatorLongLine        = "long_line"
+	indicatorDoubleExtension = "double_extension"
+	indicatorSUID            = "suid"
+	indicatorWebshellPattern = "webshell_pattern"
+)
+
+// scoreEntropyThreshold 组合评分中high_entropy指标的熵阈值, 低于临时目录的阈值以覆盖base64编码的载荷
+const scoreEntropyThreshold = 5.8
+
+// scoreIndicators 指标的检查顺序, 同时也是告警中分项的显示顺序
+var scoreIndicators = []string{
+	indicatorNewFile,
+	indicatorHighEntropy,
+	indicatorLongLine,
+	indicatorDoubleExtension,
+	indicatorSUID,
+	indicatorWebshellPattern,
+}
+
+// defaultScoreWeights 各指标的默认分值, 单个指标不足以达到默认阈值10
+var defaultScoreWeights = map[string]int{
+	indicatorNewFile:         2,
+	indicatorHighEntropy:     4,
+	indicatorLongLine:        3,
+	indicatorDoubleExtension: 5,
+	indicatorSUID:            5,
+	indicatorWebshellPattern: 6,
+}
+
+// parseScoreWeights 解析"指标=分值"的逗号分隔列表, 未指定的指标使用默认分值
+func parseScoreWeights(value string) (map[string]int, error) {
+	weights := make(map[string]int, len(defaultScoreWeights))
+	for name, weight := range defaultScoreWeights {
+		weights[name] = weight
+	}
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		sep := strings.Index(item, "=")
+		if sep <= 0 {
+			return nil, fmt.Errorf("无效的评分项: %s", item)
+		}
+		name := strings.TrimSpace(item[:sep])
+		if _, ok := defaultScoreWeights[name]; !ok {
+			return nil, fmt.Errorf("未知的评分指标: %s", name)
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(item[sep+1:]))
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("无效的分值: %s", item)
+		}
+		weights[name] = weight
+	}
+	return weights, nil
+}
+
+// indicatorPresent 判断单个指标在该文件上是否成立
+func (dm *DirectoryMonitor) indicatorPresent(name, filePath string, info FileInfo, created bool) bool {
+	switch name {
+	case indicatorNewFile:
+		return created
+	case indicatorHighEntropy:
+		score, err := fileEntropy(filePath)
+		return err == nil && score > scoreEntropyThreshold
+	case indicatorLongLine:
+		return dm.maxLineLength > 0 && checkLineLengths(filePath, dm.maxLineLength)
+	case indicatorDoubleExtension:
+		_, ok := dm.doubleExtension(filePath)
+		return ok
+	case indicatorSUID:
+		return info.Mode&(os.ModeSetuid|os.ModeSetgid) != 0
+	case indicatorWebshellPattern:
+		_, ok := dm.scanner.scan(filePath)
+		return ok
+	}
+	return false
+}
+
+// checkCombinedScore 累加文件命中的各项指标分值, 达到阈值时告警combined_indicator
+func (dm *DirectoryMonitor) checkCombinedScore(filePath string, info FileInfo, created bool) {
+	if dm.scoreThreshold <= 0 {
+		return
+	}
+
+	total := 0
+	var breakdown []string
+	for _, name := range scoreIndicators {
+		weight := dm.scoreWeights[name]
+		if weight == 0 || !dm.indicatorPresent(name, filePath, info, created) {
+			continue
+		}
+		total += weight
+		breakdown = append(breakdown, fmt.Sprintf("%s=%d", name, weight))
+	}
+
+	if total < dm.scoreThreshold {
+		return
+	}
+
+	dm.alert("critical", "combined_indicator",
+		fmt.Sprintf("检测到多项可疑特征同时出现: %s (总分: %d, 阈值: %d, 分项: %s)",
+			filePath, total, dm.scoreThreshold, strings.Join(breakdown, ", ")))
+}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// serverMaxBody 单个上报请求体的大小上限, 告警中的diff可能较大
+	serverMaxBody = 4 << 20
+	// serverReplayWindow 签名时间戳允许的偏差, 窗口内重复的签名视为重放
+	serverReplayWindow = 5 * time.Minute
+	// serverRecentLimit 内存中保留、供汇总页面和查询接口使用的最近告警和事件数
+	serverRecentLimit = 2000
+	// serverOfflineCheck 检查主机心跳超时的间隔
+	serverOfflineCheck = 10 * time.Second
+)
+
+// serverRecord records.jsonl中的一条记录: 告警(alert), 处理动作(event), 心跳(heartbeat)或主机上下线(status)
+type serverRecord struct {
+	Time    string          `json:"time"`
+	Host    string          `json:"host"`
+	Addr    string          `json:"addr"`
+	Kind    string          `json:"kind"`
+	Level   string          `json:"level,omitempty"`
+	Event   string          `json:"event,omitempty"`
+	Message string          `json:"message,omitempty"`
+	Path    string          `json:"path,omitempty"`
+	Action  string          `json:"action,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// serverHost 一台主机上agent的汇总状态, 以主机名和来源地址区分同名的靶机
+type serverHost struct {
+	Name      string          `json:"name"`
+	Addr      string          `json:"addr"`
+	FirstSeen string          `json:"first_seen"`
+	LastSeen  string          `json:"last_seen"`
+	Online    bool            `json:"online"`
+	Alerts    int             `json:"alerts"`
+	Critical  int             `json:"critical"`
+	Events    int             `json:"events"`
+	LastAlert string          `json:"last_alert,omitempty"`
+	Heartbeat json.RawMessage `json:"heartbeat,omitempty"`
+
+	lastSeen time.Time
+}
+
+func (h *serverHost) key() string {
+	return h.Name + "/" + h.Addr
+}
+
+// edrServer 中央服务器(edr server): 接收各主机agent的告警、心跳和处理动作并写入records.jsonl,
+// 重启时重放该文件恢复主机状态; 提供汇总页面和查询接口
+type edrServer struct {
+	token        string
+	hmacKey      string
+	offlineAfter time.Duration
+	path         string
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	hosts  map[string]*serverHost
+	recent []serverRecord
+	// signatures 重放窗口内见过的签名及其时间戳
+	signatures map[string]int64
+}
+
+func newEdrServer(dataDir, token, hmacKey string, offlineAfter time.Duration) (*edrServer, error) {
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, fmt.Errorf("创建数据目录失败: %v", err)
+	}
+	s := &edrServer{
+		token:        token,
+		hmacKey:      hmacKey,
+		offlineAfter: offlineAfter,
+		path:         filepath.Join(dataDir, "records.jsonl"),
+		hosts:        make(map[string]*serverHost),
+		signatures:   make(map[string]int64),
+	}
+	if err := s.load(); err != nil {
+		return nil, fmt.Errorf("读取%s失败: %v", s.path, err)
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	s.file = f
+
+	// 重启前已超时的主机不再告警下线
+	now := time.Now()
+	for _, h := range s.hosts {
+		h.Online = now.Sub(h.lastSeen) < s.offlineAfter
+	}
+	return s, nil
+}
+
+// load 重放records.jsonl, 恢复主机状态和最近的告警
+func (s *edrServer) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		s.size += int64(len(line))
+		var record serverRecord
+		if len(line) > 0 && json.Unmarshal(line, &record) == nil {
+			s.apply(record)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// apply 按一条记录更新主机状态和最近记录, 调用方持有锁(或处于加载阶段)
+func (s *edrServer) apply(record serverRecord) {
+	at, _ := time.Parse(time.RFC3339, record.Time)
+	key := record.Host + "/" + record.Addr
+	h, ok := s.hosts[key]
+	if !ok {
+		h = &serverHost{Name: record.Host, Addr: record.Addr, FirstSeen: record.Time}
+		s.hosts[key] = h
+	}
+	if record.Kind != "status" {
+		h.LastSeen, h.lastSeen, h.Online = record.Time, at, true
+	}
+
+	switch record.Kind {
+	case "heartbeat":
+		h.Heartbeat = record.Data
+		return
+	case "alert":
+		h.Alerts++
+		if record.Level == "critical" {
+			h.Critical++
+		}
+		h.LastAlert = record.Message
+	case "event":
+		h.Events++
+	}
+	s.recent = append(s.recent, record)
+	if len(s.recent) > 2*serverRecentLimit {
+		s.recent = append([]serverRecord(nil), s.recent[len(s.recent)-serverRecentLimit:]...)
+	}
+}
+
+// store 追加一条记录并更新状态; 文件超过eventCompactSize时轮转为records.jsonl.1
+func (s *edrServer) store(record serverRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.size+int64(len(line)) > eventCompactSize {
+		s.file.Close()
+		if err := os.Rename(s.path, s.path+".1"); err != nil {
+			logWarn(fmt.Sprintf("轮转%s失败: %v", s.path, err))
+		}
+		f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		s.file, s.size = f, 0
+	}
+	if _, err := s.file.Write(line); err != nil {
+		return err
+	}
+	s.size += int64(len(line))
+	s.apply(record)
+	return nil
+}
+
+// authorize 校验agent的Bearer令牌和HMAC签名(与-webhook-token/-webhook-hmac-key一致),
+// 签名的时间戳必须在serverReplayWindow内, 且同一签名只接受一次
+func (s *edrServer) authorize(r *http.Request, body []byte) error {
+	if s.token != "" && !hmac.Equal([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.token)) {
+		return errors.New("令牌错误")
+	}
+	if s.hmacKey == "" {
+		return nil
+	}
+
+	timestamp := r.Header.Get("X-EDR-Timestamp")
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("缺少签名时间戳")
+	}
+	now := time.Now().Unix()
+	if d := time.Duration(now-ts) * time.Second; d > serverReplayWindow || d < -serverReplayWindow {
+		return fmt.Errorf("签名时间戳超出允许范围: %s", timestamp)
+	}
+	signature := r.Header.Get("X-EDR-Signature")
+	if !hmac.Equal([]byte(signature), []byte(webhookSignature(s.hmacKey, timestamp, body))) {
+		return errors.New("签名错误")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sig, seen := range s.signatures {
+		if time.Duration(now-seen)*time.Second > 2*serverReplayWindow {
+			delete(s.signatures, sig)
+		}
+	}
+	if _, ok := s.signatures[signature]; ok {
+		return errors.New("重放的请求")
+	}
+	s.signatures[signature] = ts
+	return nil
+}
+
+// readAgentRequest 读取并认证agent的POST请求, 失败时已写入响应
+func (s *edrServer) readAgentRequest(w http.ResponseWriter, r *http.Request) ([]byte, string, bool) {
+	if r.Method != http.MethodPost {
+		// 旧版agent的GET上报(-api-get)没有签名, 中央服务器不接受
+		writeJSONError(w, http.StatusGone, "只接受JSON POST上报, 请去掉agent的-api-get参数")
+		return nil, "", false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, serverMaxBody))
+	if err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return nil, "", false
+	}
+	addr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		addr = r.RemoteAddr
+	}
+	if err := s.authorize(r, body); err != nil {
+		logWarn(fmt.Sprintf("拒绝来自%s的上报(%s): %v", addr, r.URL.Path, err))
+		writeJSONError(w, http.StatusUnauthorized, "认证失败")
+		return nil, "", false
+	}
+	return body, addr, true
+}
+
+func (s *edrServer) respond(w http.ResponseWriter, err error) {
+	if err != nil {
+		logError(fmt.Sprintf("写入记录失败: %v", err))
+		writeJSONError(w, http.StatusInternalServerError, "写入记录失败")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleAlert POST /api/agent/edr-alert, 请求体为agent的alertPayload
+func (s *edrServer) handleAlert(w http.ResponseWriter, r *http.Request) {
+	body, addr, ok := s.readAgentRequest(w, r)
+	if !ok {
+		return
+	}
+	var alert alertPayload
+	if err := json.Unmarshal(body, &alert); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "无效的告警: "+err.Error())
+		return
+	}
+	message := alert.FullMessage
+	if message == "" {
+		message = alert.Message
+	}
+	record := serverRecord{
+		Time: time.Now().Format(time.RFC3339), Host: alert.Hostname, Addr: addr, Kind: "alert",
+		Level: alert.Type, Event: alert.Event, Message: message, Path: alert.Path, Action: alert.Action, Data: body,
+	}
+	logAlert(fmt.Sprintf("[%s %s] %s", alert.Hostname, addr, message))
+	s.respond(w, s.store(record))
+}
+
+// handleHeartbeat POST /api/agent/edr-heartbeat, 请求体为agent的运行统计
+func (s *edrServer) handleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	body, addr, ok := s.readAgentRequest(w, r)
+	if !ok {
+		return
+	}
+	var heartbeat struct {
+		Hostname string `json:"hostname"`
+	}
+	if err := json.Unmarshal(body, &heartbeat); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "无效的心跳: "+err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	h, known := s.hosts[heartbeat.Hostname+"/"+addr]
+	back := known && !h.Online
+	s.mu.Unlock()
+	if !known {
+		logInfo(fmt.Sprintf("新的agent上线: %s (%s)", heartbeat.Hostname, addr))
+	} else if back {
+		logSuccess(fmt.Sprintf("agent恢复心跳: %s (%s)", heartbeat.Hostname, addr))
+	}
+	s.respond(w, s.store(serverRecord{
+		Time: time.Now().Format(time.RFC3339), Host: heartbeat.Hostname, Addr: addr, Kind: "heartbeat", Data: body,
+	}))
+}
+
+// handleEvents POST /api/agent/edr-events, 请求体为 {"hostname": ..., "events": [audit.log记录...]}
+func (s *edrServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	body, addr, ok := s.readAgentRequest(w, r)
+	if !ok {
+		return
+	}
+	var batch struct {
+		Hostname string            `json:"hostname"`
+		Events   []json.RawMessage `json:"events"`
+	}
+	if err := json.Unmarshal(body, &batch); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "无效的事件: "+err.Error())
+		return
+	}
+	for _, raw := range batch.Events {
+		var entry map[string]string
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			continue
+		}
+		err := s.store(serverRecord{
+			Time: time.Now().Format(time.RFC3339), Host: batch.Hostname, Addr: addr, Kind: "event", Level: "info",
+			Event: entry["action"], Message: entry["detail"], Path: entry["path"], Data: raw,
+		})
+		if err != nil {
+			s.respond(w, err)
+			return
+		}
+	}
+	s.respond(w, nil)
+}
+
+// authorizeView 查看接口使用与agent相同的令牌, 可以放在Authorization头或token查询参数中(浏览器访问)
+func (s *edrServer) authorizeView(w http.ResponseWriter, r *http.Request) bool {
+	if s.token == "" {
+		return true
+	}
+	given := r.URL.Query().Get("token")
+	if given == "" {
+		given = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+	if !hmac.Equal([]byte(given), []byte(s.token)) {
+		writeJSONError(w, http.StatusUnauthorized, "需要令牌")
+		return false
+	}
+	return true
+}
+
+// hostList 按名称排序的主机状态快照
+func (s *edrServer) hostList() []serverHost {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hosts := make([]serverHost, 0, len(s.hosts))
+	for _, h := range s.hosts {
+		hosts = append(hosts, *h)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].key() < hosts[j].key() })
+	return hosts
+}
+
+// records 返回最近的告警和事件(新的在前), host和kind为空表示不过滤
+func (s *edrServer) records(host, kind string, limit int) []serverRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []serverRecord
+	for i := len(s.recent) - 1; i >= 0 && len(result) < limit; i-- {
+		record := s.recent[i]
+		if (host == "" || record.Host == host) && (kind == "" || record.Kind == kind) {
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
+// handleHosts GET /api/hosts
+func (s *edrServer) handleHosts(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeView(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.hostList())
+}
+
+// handleRecords GET /api/records?host=&kind=alert|event|status&limit=100
+func (s *edrServer) handleRecords(w http.ResponseWriter, r *http.Request) {
+	if !s.authorizeView(w, r) {
+		return
+	}
+	query := r.URL.Query()
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+	writeJSON(w, http.StatusOK, s.records(query.Get("host"), query.Get("kind"), limit))
+}
+
+// handlePage GET / 所有主机的汇总页面, 每10秒刷新
+func (s *edrServer) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorizeView(w, r) {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("<table border=\"1\" cellspacing=\"0\" cellpadding=\"4\">\n<tr><th>主机</th><th>地址</th><th>状态</th><th>最后心跳</th><th>告警</th><th>critical</th><th>处理动作</th><th>最近告警</th></tr>\n")
+	for _, h := range s.hostList() {
+		status := "<b style=\"color:red\">离线</b>"
+		if h.Online {
+			status = "在线"
+		}
+		fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%d</td><td>%d</td><td>%d</td><td>%s</td></tr>\n",
+			html.EscapeString(h.Name), html.EscapeString(h.Addr), status, html.EscapeString(h.LastSeen),
+			h.Alerts, h.Critical, h.Events, html.EscapeString(truncateMessage(h.LastAlert, 120)))
+	}
+	b.WriteString("</table>\n<h3>最近的告警和事件</h3>\n<table border=\"1\" cellspacing=\"0\" cellpadding=\"4\">\n<tr><th>时间</th><th>主机</th><th>级别</th><th>事件</th><th>路径</th><th>处理</th><th>消息</th></tr>\n")
+	for _, record := range s.records("", "", 200) {
+		level := html.EscapeString(record.Level)
+		if record.Level == "critical" {
+			level = "<b style=\"color:red\">critical</b>"
+		}
+		fmt.Fprintf(&b, "<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+			html.EscapeString(record.Time), html.EscapeString(record.Host+" "+record.Addr), level,
+			html.EscapeString(record.Event), html.EscapeString(record.Path), html.EscapeString(record.Action),
+			html.EscapeString(truncateMessage(record.Message, 300)))
+	}
+	b.WriteString("</table>\n")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta http-equiv="refresh" content="10"><title>EDR汇总</title></head>
+<body>
+<h3>主机 (%s)</h3>
+%s</body>
+</html>
+`, time.Now().Format("2006-01-02 15:04:05"), b.String())
+}
+
+// checkOffline 心跳超过offlineAfter未更新的主机告警agent_offline: agent可能被攻击者结束, 或靶机已宕机
+func (s *edrServer) checkOffline() {
+	now := time.Now()
+	var offline []serverRecord
+	s.mu.Lock()
+	for _, h := range s.hosts {
+		if h.Online && now.Sub(h.lastSeen) >= s.offlineAfter {
+			h.Online = false
+			offline = append(offline, serverRecord{
+				Time: now.Format(time.RFC3339), Host: h.Name, Addr: h.Addr, Kind: "status", Level: "critical",
+				Event: "agent_offline", Message: fmt.Sprintf("agent心跳超时: %s (%s), 最后上报: %s", h.Name, h.Addr, h.LastSeen),
+			})
+		}
+	}
+	s.mu.Unlock()
+
+	for _, record := range offline {
+		logAlert(record.Message)
+		if err := s.store(record); err != nil {
+			logError(fmt.Sprintf("写入记录失败: %v", err))
+		}
+	}
+}
+
+// runServer edr server: 接收各主机agent(-a指向本服务)上报的告警、心跳和处理动作, 汇总展示
+func runServer(args []string) int {
+	fs := flag.NewFlagSet("server", flag.ExitOnError)
+	listen := fs.String("listen", "0.0.0.0:8080", "监听地址, agent的-a指向该地址")
+	dataDir := fs.String("data", "edr-server", "数据目录, 记录写入其中的records.jsonl")
+	token := fs.String("token", "", "agent上报和查看接口使用的令牌, 与agent的-webhook-token一致, @文件 表示从文件读取")
+	hmacKey := fs.String("hmac-key", "", "校验agent请求签名的密钥, 与agent的-webhook-hmac-key一致, @文件 表示从文件读取")
+	tlsCert := fs.String("tls-cert", "", "HTTPS证书(PEM), 与-tls-key一起指定时使用HTTPS")
+	tlsKey := fs.String("tls-key", "", "HTTPS私钥(PEM)")
+	offlineAfter := fs.Duration("offline-after", 3*time.Minute, "主机超过该时间没有任何上报时告警agent_offline, 应大于agent的-stats-interval")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: edr server [-listen 0.0.0.0:8080] [-data edr-server] -token <令牌> [-hmac-key <密钥>] [-tls-cert cert.pem -tls-key key.pem]")
+		fmt.Fprintln(os.Stderr, "汇总各主机agent的告警、心跳和处理动作; agent使用 -a <地址> -webhook-token <令牌> [-webhook-hmac-key <密钥>] -stream-events")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	secrets := []*string{token, hmacKey}
+	for _, secret := range secrets {
+		value, err := readSecret(*secret)
+		if err != nil {
+			logError(fmt.Sprintf("读取令牌/密钥失败: %v", err))
+			return 1
+		}
+		*secret = value
+	}
+	if *token == "" && *hmacKey == "" {
+		logError("必须指定-token或-hmac-key, 中央服务器不接受未认证的上报")
+		return 2
+	}
+	if (*tlsCert == "") != (*tlsKey == "") {
+		logError("-tls-cert和-tls-key需要同时指定")
+		return 2
+	}
+	if *token == "" {
+		logWarn("未指定-token, 汇总页面和查询接口没有认证")
+	}
+
+	server, err := newEdrServer(*dataDir, *token, *hmacKey, *offlineAfter)
+	if err != nil {
+		logError(err.Error())
+		return 1
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/agent/edr-alert", server.handleAlert)
+	mux.HandleFunc("/api/agent/edr-heartbeat", server.handleHeartbeat)
+	mux.HandleFunc("/api/agent/edr-events", server.handleEvents)
+	mux.HandleFunc("/api/hosts", server.handleHosts)
+	mux.HandleFunc("/api/records", server.handleRecords)
+	mux.HandleFunc("/", server.handlePage)
+
+	go func() {
+		for range time.Tick(serverOfflineCheck) {
+			server.checkOffline()
+		}
+	}()
+
+	scheme := "http"
+	if *tlsCert != "" {
+		scheme = "https"
+	}
+	logInfo(fmt.Sprintf("中央服务器已启动: %s://%s, 数据: %s, 已知主机 %d 台", scheme, *listen, server.path, len(server.hosts)))
+	httpServer := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	if *tlsCert != "" {
+		err = httpServer.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	logError(fmt.Sprintf("中央服务器退出: %v", err))
+	return 1
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// serverConfigNames 目录级的Web服务器/PHP配置文件: 可以让图片等任意扩展名作为脚本执行,
+// 或通过auto_prepend_file在每个请求前包含webshell, 即使只监控.php也必须检查
+var serverConfigNames = map[string]bool{
+	".htaccess":  true,
+	".user.ini":  true,
+	"php.ini":    true,
+	"web.config": true,
+}
+
+// serverConfigMaxSize 检查内容的配置文件大小上限
+const serverConfigMaxSize = 1 << 20
+
+// htaccessDirective .htaccess中的一条危险指令
+type htaccessDirective struct {
+	re   *regexp.Regexp
+	desc string
+}
+
+var htaccessDirectives = []htaccessDirective{
+	{regexp.MustCompile(`(?i)^\s*AddType\s+application/x-httpd-(php|cgi)`), "AddType把其他扩展名作为PHP执行"},
+	{regexp.MustCompile(`(?i)^\s*AddHandler\s+\S*(php|cgi-script|fcgid-script)`), "AddHandler把其他扩展名作为脚本执行"},
+	{regexp.MustCompile(`(?i)^\s*SetHandler\s+\S*(php|cgi-script|fcgid-script|server-status|server-info)`), "SetHandler强制作为脚本执行"},
+	{regexp.MustCompile(`(?i)^\s*php_(value|admin_value)\s+(auto_prepend_file|auto_append_file|include_path)\b`), "php_value修改自动包含文件"},
+	{regexp.MustCompile(`(?i)^\s*php_(flag|admin_flag|value)\s+(engine|allow_url_include)\s+(on|1)`), "php_flag开启PHP引擎/远程包含"},
+	{regexp.MustCompile(`(?i)^\s*Options\s+.*\+?ExecCGI`), "Options开启ExecCGI"},
+	{regexp.MustCompile(`(?i)^\s*(ErrorDocument\s+\d+|Action\s+\S+)\s+.*\.(php|phtml|cgi)`), "请求转发到脚本"},
+}
+
+// webConfigPattern IIS web.config中注册处理程序或开启脚本执行的配置
+var webConfigPattern = regexp.MustCompile(`(?i)<(handlers|add\s+[^>]*(scriptProcessor|modules\s*=\s*"(FastCgiModule|CgiModule|IsapiModule))|httpHandlers)`)
+
+// isServerConfigFile 文件名是否为目录级的Web服务器/PHP配置文件
+func isServerConfigFile(filePath string) bool {
+	return serverConfigNames[strings.ToLower(filepath.Base(filePath))]
+}
+
+// serverConfigFindings 检查配置文件中可用于执行webshell的指令, 返回命中的描述
+func serverConfigFindings(filePath string) []string {
+	info, err := os.Stat(filePath)
+	if err != nil || info.Size() > serverConfigMaxSize {
+		return nil
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil
+	}
+
+	switch strings.ToLower(filepath.Base(filePath)) {
+	case ".user.ini", "php.ini":
+		return dangerousPHPChanges(nil, data)
+	case "web.config":
+		if webConfigPattern.Match(data) {
+			return []string{"注册了脚本处理程序"}
+		}
+		return nil
+	}
+
+	var findings []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		for _, directive := range htaccessDirectives {
+			if directive.re.MatchString(line) {
+				findings = append(findings, fmt.Sprintf("%s: %s", directive.desc, strings.TrimSpace(line)))
+				break
+			}
+		}
+	}
+	return findings
+}
+
+// serverConfigTags 告警消息中附带的危险指令
+func serverConfigTags(filePath string) string {
+	findings := serverConfigFindings(filePath)
+	if len(findings) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" [危险指令: %s]", strings.Join(findings, "; "))
+}
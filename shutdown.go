@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// handleShutdownSignals 收到SIGINT/SIGTERM时取消ctx, 各goroutine完成当前一轮检查(包括正在进行的
+// 复制和告警发送)后退出; 再次收到信号则立即退出
+func (dm *DirectoryMonitor) handleShutdownSignals() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+		logWarn(fmt.Sprintf("收到信号 %v，等待进行中的检查完成后退出 (再次发送信号强制退出)", sig))
+		dm.cancel()
+
+		<-signals
+		logError("强制退出")
+		os.Exit(1)
+	}()
+}
+
+// stopping 是否已开始退出
+func (dm *DirectoryMonitor) stopping() bool {
+	return dm.ctx.Err() != nil
+}
+
+// printSummary 退出前打印本次运行的汇总
+func (dm *DirectoryMonitor) printSummary() {
+	dm.mu.RLock()
+	files := len(dm.baseline)
+	dm.mu.RUnlock()
+
+	fmt.Printf("%s========================================%s\n", ColorBlue, ColorReset)
+	logInfo(fmt.Sprintf("运行时长: %v", time.Since(dm.startTime).Round(time.Second)))
+	logInfo(fmt.Sprintf("监控文件: %d，监控目录: %d", files, len(dm.directoryList())))
+	logInfo(fmt.Sprintf("检查次数: %d，告警: %d，还原: %d，隔离: %d",
+		dm.stats.checks.Load(), dm.stats.alerts.Load(),
+		dm.stats.restores.Load(), dm.stats.isolations.Load()))
+	fmt.Printf("%s========================================%s\n", ColorBlue, ColorReset)
+	logSuccess("EDR监控已退出")
+}
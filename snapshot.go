@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// snapshotCheckInterval 快照文件组的检查间隔
+const snapshotCheckInterval = time.Second
+
+// fileSnapshot 单个文件的内存快照, 用于监控目录之外的配置文件和系统文件
+type fileSnapshot struct {
+	info    FileInfo
+	hash    string
+	content []byte
+}
+
+// snapshotGroup 一组按内存快照比对的文件, 由单独的goroutine定期检查
+type snapshotGroup struct {
+	name    string // 日志中显示的分组名
+	event   string // 文件变化时的告警事件
+	level   string
+	restore bool // 变化后是否用快照复原
+	files   map[string]*fileSnapshot
+	mu      sync.Mutex
+
+	// dirs 每次检查时重新扫描的目录, 其中新出现的文件告警newEvent并加入快照
+	dirs     []string
+	newEvent string
+	// optional 可能尚不存在的单个文件, 出现时同样告警newEvent
+	optional []string
+	// denied 记录无权读取的目录, 避免每次检查重复输出警告
+	denied map[string]bool
+	// inspect 内容变化或新增文件时的额外检查, before为nil表示新增文件
+	inspect func(filePath string, before, after []byte)
+	// afterRestore 一次检查中复原或隔离了文件后调用一次, 例如让服务重新加载配置
+	afterRestore func()
+}
+
+func newSnapshotGroup(name, event, level string, restore bool) *snapshotGroup {
+	return &snapshotGroup{
+		name:    name,
+		event:   event,
+		level:   level,
+		restore: restore,
+		files:   make(map[string]*fileSnapshot),
+		denied:  make(map[string]bool),
+	}
+}
+
+// watchDir 把目录中现有的文件加入快照, 之后新出现的文件告警newEvent
+func (g *snapshotGroup) watchDir(dm *DirectoryMonitor, dir, newEvent string) {
+	g.dirs = append(g.dirs, dir)
+	g.newEvent = newEvent
+	for _, filePath := range g.listDir(dir) {
+		if err := g.add(dm, filePath); err != nil {
+			logWarn(fmt.Sprintf("读取%s失败 %s: %v", g.name, filePath, err))
+		}
+	}
+}
+
+// watchFile 监控单个文件; 文件尚不存在时, 之后被创建同样告警newEvent
+func (g *snapshotGroup) watchFile(dm *DirectoryMonitor, filePath, newEvent string) {
+	g.optional = append(g.optional, filePath)
+	g.newEvent = newEvent
+	if err := g.add(dm, filePath); err != nil && !os.IsNotExist(err) {
+		logWarn(fmt.Sprintf("读取%s失败 %s: %v", g.name, filePath, err))
+	}
+}
+
+// candidates 返回dirs中现有的文件和已存在的optional文件
+func (g *snapshotGroup) candidates(dm *DirectoryMonitor) []string {
+	var files []string
+	for _, dir := range g.dirs {
+		files = append(files, g.listDir(dir)...)
+	}
+	for _, filePath := range g.optional {
+		if dm.isRegularFile(filePath) {
+			files = append(files, filePath)
+		}
+	}
+	return files
+}
+
+// listDir 列出目录第一层的常规文件; 目录不存在或无权读取时返回空
+func (g *snapshotGroup) listDir(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsPermission(err) && !g.denied[dir] {
+			g.denied[dir] = true
+			logWarn(fmt.Sprintf("无权读取%s目录, 跳过: %s", g.name, dir))
+		}
+		return nil
+	}
+	delete(g.denied, dir)
+
+	var files []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return files
+}
+
+// scanNewFiles 告警新出现的文件(即使是空文件); 需要复原的分组隔离该文件, 否则记入快照.
+// 返回是否隔离了文件
+func (dm *DirectoryMonitor) scanNewFiles(g *snapshotGroup) bool {
+	isolated := false
+	for _, filePath := range g.candidates(dm) {
+		if g.get(filePath) != nil {
+			continue
+		}
+
+		snapshot, err := takeSnapshot(dm, filePath)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logError(fmt.Sprintf("读取%s失败 %s: %v", g.name, filePath, err))
+			}
+			continue
+		}
+		dm.alert(g.level, g.newEvent, fmt.Sprintf("检测到新增%s: %s (大小: %d bytes)",
+			g.name, filePath, snapshot.info.Size))
+		if g.inspect != nil {
+			g.inspect(filePath, nil, snapshot.content)
+		}
+
+		if g.restore && !dm.dryRun {
+			if err := dm.isolateFile(filePath, isolateReason{Event: g.newEvent}); err != nil {
+				logError(fmt.Sprintf("隔离新增%s失败: %v", g.name, err))
+			} else {
+				isolated = true
+			}
+			continue
+		}
+		g.mu.Lock()
+		g.files[filePath] = snapshot
+		g.mu.Unlock()
+	}
+	return isolated
+}
+
+func takeSnapshot(dm *DirectoryMonitor, filePath string) (*fileSnapshot, error) {
+	info, err := dm.getFileInfo(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(content)
+	return &fileSnapshot{
+		info:    info,
+		hash:    hex.EncodeToString(sum[:]),
+		content: content,
+	}, nil
+}
+
+// add 记录文件当前内容作为快照
+func (g *snapshotGroup) add(dm *DirectoryMonitor, filePath string) error {
+	snapshot, err := takeSnapshot(dm, filePath)
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	g.files[filePath] = snapshot
+	g.mu.Unlock()
+	return nil
+}
+
+func (g *snapshotGroup) paths() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	paths := make([]string, 0, len(g.files))
+	for filePath := range g.files {
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (g *snapshotGroup) get(filePath string) *fileSnapshot {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.files[filePath]
+}
+
+// checkSnapshotGroup 比对组内文件与快照, 内容或属性变化时告警, 按配置用快照复原
+func (dm *DirectoryMonitor) checkSnapshotGroup(g *snapshotGroup) {
+	if dm.paused.Load() {
+		return
+	}
+
+	restored := dm.scanNewFiles(g)
+	defer func() {
+		if restored && g.afterRestore != nil {
+			g.afterRestore()
+		}
+	}()
+
+	for _, filePath := range g.paths() {
+		expected := g.get(filePath)
+
+		current, err := takeSnapshot(dm, filePath)
+		var detail string
+		switch {
+		case err != nil && os.IsNotExist(err):
+			detail = "文件被删除"
+		case err != nil:
+			logError(fmt.Sprintf("读取%s失败 %s: %v", g.name, filePath, err))
+			continue
+		case current.hash != expected.hash:
+			detail = fmt.Sprintf("内容被修改 (大小: %d -> %d bytes)", expected.info.Size, current.info.Size)
+		case current.info.Mode != expected.info.Mode ||
+			current.info.Uid != expected.info.Uid || current.info.Gid != expected.info.Gid:
+			detail = fmt.Sprintf("属性被修改 (权限: %v -> %v, 属主: %d:%d -> %d:%d)",
+				expected.info.Mode, current.info.Mode,
+				expected.info.Uid, expected.info.Gid, current.info.Uid, current.info.Gid)
+		default:
+			continue
+		}
+
+		dm.alert(g.level, g.event, fmt.Sprintf("检测到%s变化: %s %s", g.name, filePath, detail))
+		if g.inspect != nil && current != nil && current.hash != expected.hash {
+			g.inspect(filePath, expected.content, current.content)
+		}
+
+		if !g.restore || dm.dryRun {
+			// 只告警: 以当前状态作为新快照, 避免重复告警
+			g.mu.Lock()
+			if current != nil {
+				g.files[filePath] = current
+			} else {
+				delete(g.files, filePath)
+			}
+			g.mu.Unlock()
+			continue
+		}
+
+		if err := dm.restoreSnapshot(filePath, expected); err != nil {
+			logError(fmt.Sprintf("还原%s失败 %s: %v", g.name, filePath, err))
+		} else {
+			logSuccess(fmt.Sprintf("%s已还原: %s", g.name, filePath))
+			restored = true
+		}
+	}
+}
+
+func (dm *DirectoryMonitor) restoreSnapshot(filePath string, snapshot *fileSnapshot) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filePath, snapshot.content, snapshot.info.Mode.Perm()); err != nil {
+		return err
+	}
+	return dm.restoreFileAttributes(filePath, snapshot.info)
+}
+
+// protectConfigFiles 把EDR自身的配置文件纳入保护: 启动时写入一份只读的不可变备份,
+// 之后任何修改都告警config_tampered并用内存中的内容复原, 防止攻击者借修改配置绕过监控
+func (dm *DirectoryMonitor) protectConfigFiles(paths []string) (*snapshotGroup, error) {
+	group := newSnapshotGroup("EDR配置文件", "config_tampered", "critical", true)
+	protectedDir := filepath.Join(dm.baseDir, "protected_"+time.Now().Format("20060102_150405"))
+
+	for _, filePath := range paths {
+		if err := group.add(dm, filePath); err != nil {
+			return nil, err
+		}
+
+		if err := dm.makeWorkspaceDir(protectedDir); err != nil {
+			return nil, err
+		}
+		backupPath := filepath.Join(protectedDir, filepath.Base(filePath))
+		if err := os.WriteFile(backupPath, group.get(filePath).content, 0400); err != nil {
+			return nil, err
+		}
+	}
+	return group, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// specialFileTypes 命名管道、unix socket和设备文件, Web目录中出现时几乎都是攻击者的通信设施
+const specialFileTypes = os.ModeNamedPipe | os.ModeSocket | os.ModeDevice | os.ModeCharDevice | os.ModeIrregular
+
+// specialFileType 告警消息中的文件类型
+func specialFileType(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeNamedPipe != 0:
+		return "命名管道(FIFO)"
+	case mode&os.ModeSocket != 0:
+		return "unix socket"
+	case mode&os.ModeCharDevice != 0:
+		return "字符设备"
+	case mode&os.ModeDevice != 0:
+		return "块设备"
+	}
+	return "特殊文件"
+}
+
+// recordSpecialFiles 把目录中现有的特殊文件及其类型记入基线, 之后只有新增或类型改变的会告警
+func (dm *DirectoryMonitor) recordSpecialFiles(specials []string) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	for _, path := range specials {
+		if info, err := os.Lstat(path); err == nil {
+			dm.specialFiles[path] = info.Mode().Type()
+		}
+	}
+}
+
+// checkSpecialFiles 检查目录中的命名管道、unix socket和设备文件: 反弹shell和端口复用常用
+// mkfifo/socket文件做中转, 基线中没有的告警special_file, 开启-remove-special-files时删除
+func (dm *DirectoryMonitor) checkSpecialFiles(dirPath string, specials []string) {
+	present := make(map[string]bool)
+	for _, path := range specials {
+		present[path] = true
+		if dm.isLockedOut(path) || dm.isSuppressed(path) || dm.isExcluded(path) {
+			continue
+		}
+
+		info, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+		mode := info.Mode().Type()
+
+		dm.mu.RLock()
+		known, ok := dm.specialFiles[path]
+		dm.mu.RUnlock()
+		if ok && known == mode {
+			continue
+		}
+
+		remove := dm.removeSpecialFiles && !dm.dryRun
+		detail := alertDetail{Path: path}
+		if dm.removeSpecialFiles {
+			detail.Action = actionDelete
+		}
+		dm.alertFile("critical", "special_file",
+			fmt.Sprintf("检测到Web目录中新增%s: %s，可能是反弹shell或后门的通信管道", specialFileType(mode), path), detail)
+		dm.stats.countChange(changeCreated)
+
+		if remove {
+			if err := os.Remove(path); err != nil {
+				logError(fmt.Sprintf("删除特殊文件失败 %s: %v", path, err))
+				continue
+			}
+			delete(present, path)
+			logSuccess(fmt.Sprintf("特殊文件已删除: %s", path))
+			dm.audit("special_file_removed", path, specialFileType(mode))
+			continue
+		}
+
+		// 只告警时记录当前类型, 避免每次检查重复告警
+		dm.mu.Lock()
+		dm.specialFiles[path] = mode
+		dm.mu.Unlock()
+		dm.markManifestDirty()
+	}
+
+	// 已不存在的特殊文件从基线中移除, 重新创建时再次告警
+	dm.mu.Lock()
+	for path := range dm.specialFiles {
+		if filepath.Dir(path) == dirPath && !present[path] {
+			delete(dm.specialFiles, path)
+			dm.markManifestDirty()
+		}
+	}
+	dm.mu.Unlock()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 变化类型, 用于按周期分组统计
+const (
+	changeCreated = iota
+	changeModified
+	changeDeleted
+	changePermission
+)
+
+// intervalStats 一个汇总周期内按类型分组的变化次数, 每次汇总后重置
+type intervalStats struct {
+	Created    int64 `json:"created"`
+	Modified   int64 `json:"modified"`
+	Deleted    int64 `json:"deleted"`
+	Permission int64 `json:"permission_changed"`
+}
+
+func (s intervalStats) String() string {
+	return fmt.Sprintf("新增: %d, 修改: %d, 删除: %d, 权限变更: %d",
+		s.Created, s.Modified, s.Deleted, s.Permission)
+}
+
+// monitorStats 运行期间的累计计数
+type monitorStats struct {
+	checks     atomic.Int64
+	alerts     atomic.Int64
+	restores   atomic.Int64
+	isolations atomic.Int64
+
+	mu       sync.Mutex
+	interval intervalStats
+	// alertsByType和latency供/metrics导出, 同样由mu保护
+	alertsByType map[alertKey]int64
+	latency      checkLatency
+}
+
+func (s *monitorStats) countChange(kind int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch kind {
+	case changeCreated:
+		s.interval.Created++
+	case changeModified:
+		s.interval.Modified++
+	case changeDeleted:
+		s.interval.Deleted++
+	case changePermission:
+		s.interval.Permission++
+	}
+}
+
+// resetInterval 取出当前周期的统计并清零
+func (s *monitorStats) resetInterval() intervalStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := s.interval
+	s.interval = intervalStats{}
+	return current
+}
+
+// reportStats 打印周期统计, 配置了API时同时发送心跳
+func (dm *DirectoryMonitor) reportStats() {
+	interval := dm.stats.resetInterval()
+
+	logInfo(fmt.Sprintf("运行统计 - 检查: %d, 告警: %d, 还原: %d, 隔离: %d",
+		dm.stats.checks.Load(), dm.stats.alerts.Load(),
+		dm.stats.restores.Load(), dm.stats.isolations.Load()))
+	logInfo(fmt.Sprintf("本周期变化 - %s", interval))
+	if last, longest, cycles := dm.scheduler.cycleStats(); cycles > 0 {
+		logInfo(fmt.Sprintf("扫描周期 - 最近: %v, 最长: %v, 目录: %d, worker: %d",
+			last.Round(time.Millisecond), longest.Round(time.Millisecond),
+			dm.scheduler.len(), dm.scheduler.workers))
+	}
+
+	dm.sendHeartbeat(interval)
+}
+
+func (dm *DirectoryMonitor) sendHeartbeat(interval intervalStats) {
+	if dm.apiEndpoint == "" {
+		return
+	}
+
+	hostname, _ := os.Hostname()
+	payload, _ := json.Marshal(map[string]interface{}{
+		"hostname":   hostname,
+		"timestamp":  time.Now().Unix(),
+		"watch_dir":  dm.watchDir,
+		"watch_dirs": dm.rootDirs(),
+		"checks":     dm.stats.checks.Load(),
+		"alerts":     dm.stats.alerts.Load(),
+		"restores":   dm.stats.restores.Load(),
+		"isolations": dm.stats.isolations.Load(),
+		"interval":   interval,
+	})
+
+	req, err := http.NewRequest(http.MethodPost, apiBaseURL(dm.apiEndpoint)+"/api/agent/edr-heartbeat", bytes.NewReader(payload))
+	if err != nil {
+		logError(fmt.Sprintf("心跳发送失败: %v", err))
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	dm.signRequest(req, payload)
+
+	resp, err := dm.webhookClient.Do(req)
+	if err != nil {
+		logError(fmt.Sprintf("心跳发送失败: %v", err))
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		logError(fmt.Sprintf("心跳响应异常: HTTP %d", resp.StatusCode))
+	}
+}
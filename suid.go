@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// suidScanInterval 遍历SUID/SGID和capabilities的间隔, /usr下文件较多, 不宜太频繁
+	suidScanInterval = 30 * time.Second
+	// capabilityXattr 保存文件capabilities的扩展属性
+	capabilityXattr = "security.capability"
+)
+
+// suidSkipDirs 遍历时跳过的虚拟文件系统
+var suidSkipDirs = map[string]bool{"/proc": true, "/sys": true, "/dev": true, "/run": true}
+
+// privilegedFile 带有SUID/SGID位或capabilities的文件
+type privilegedFile struct {
+	mode os.FileMode
+	caps bool
+}
+
+// flags 告警消息中的特权标记
+func (p privilegedFile) flags() []string {
+	var flags []string
+	if p.mode&os.ModeSetuid != 0 {
+		flags = append(flags, "suid")
+	}
+	if p.mode&os.ModeSetgid != 0 {
+		flags = append(flags, "sgid")
+	}
+	if p.caps {
+		flags = append(flags, "capabilities")
+	}
+	return flags
+}
+
+// gained 相对基线新增的特权标记
+func (p privilegedFile) gained(old privilegedFile) privilegedFile {
+	return privilegedFile{
+		mode: p.mode &^ old.mode & (os.ModeSetuid | os.ModeSetgid),
+		caps: p.caps && !old.caps,
+	}
+}
+
+func (p privilegedFile) empty() bool {
+	return p.mode&(os.ModeSetuid|os.ModeSetgid) == 0 && !p.caps
+}
+
+// scanPrivilegedFiles 遍历-suid-roots, 返回其中带有SUID/SGID位或capabilities的普通文件;
+// 不跟随符号链接, 跳过/proc等虚拟文件系统和本程序的工作目录
+func (dm *DirectoryMonitor) scanPrivilegedFiles() map[string]privilegedFile {
+	files := make(map[string]privilegedFile)
+	for _, root := range dm.suidRoots {
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				if path != root && (suidSkipDirs[path] || withinDir(path, dm.baseDir)) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+
+			file := privilegedFile{mode: info.Mode() & (os.ModeSetuid | os.ModeSetgid), caps: hasFileCapability(path)}
+			if !file.empty() {
+				files[path] = file
+			}
+			return nil
+		})
+	}
+	return files
+}
+
+// stripPrivileges 清除文件新增的SUID/SGID位和capabilities, 基线中原有的特权位保留
+func stripPrivileges(path string, gained privilegedFile) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("不是普通文件")
+	}
+	if info.Mode()&gained.mode != 0 {
+		if err := os.Chmod(path, info.Mode()&^gained.mode); err != nil {
+			return err
+		}
+	}
+	if gained.caps && hasFileCapability(path) {
+		if err := removeXattr(path, capabilityXattr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startSuidMonitor 以启动时-suid-roots下的SUID/SGID文件和带capabilities的文件为基线,
+// 之后新出现的(包括已有文件新增了特权位)告警new_privileged_binary; stripSuid为true时清除特权位
+func (dm *DirectoryMonitor) startSuidMonitor() {
+	baseline := dm.scanPrivilegedFiles()
+	mode := "只告警"
+	if dm.stripSuid {
+		mode = "告警并清除"
+	}
+	logInfo(fmt.Sprintf("SUID/capabilities监控已启动(%s), 目录: %s, 当前 %d 个特权文件, 检查间隔: %v",
+		mode, strings.Join(dm.suidRoots, ", "), len(baseline), suidScanInterval))
+
+	// alerted 已告警且新增的特权位仍在的文件, 清除后再次设置会重新告警
+	alerted := make(map[string]privilegedFile)
+
+	dm.runPeriodic(suidScanInterval, func() {
+		current := dm.scanPrivilegedFiles()
+
+		paths := make([]string, 0, len(current))
+		for path := range current {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		seen := make(map[string]bool)
+		for _, path := range paths {
+			gained := current[path].gained(baseline[path])
+			if gained.empty() {
+				continue
+			}
+			seen[path] = true
+			if prev, ok := alerted[path]; ok && prev == gained {
+				continue
+			}
+			alerted[path] = gained
+			dm.handlePrivilegedFile(path, gained)
+		}
+		for path := range alerted {
+			if !seen[path] {
+				delete(alerted, path)
+			}
+		}
+	})
+}
+
+// handlePrivilegedFile 告警新出现的特权文件, 开启-strip-suid时清除新增的特权位
+func (dm *DirectoryMonitor) handlePrivilegedFile(path string, gained privilegedFile) {
+	flags := strings.Join(gained.flags(), "+")
+	detail := alertDetail{Path: path}
+	if dm.stripSuid {
+		detail.Action = actionStripSuid
+	}
+	dm.alertFile("critical", "new_privileged_binary",
+		fmt.Sprintf("检测到新的特权文件: %s (%s)，可能是提权后门", path, flags), detail)
+
+	if !dm.stripSuid || dm.dryRun {
+		return
+	}
+	if err := stripPrivileges(path, gained); err != nil {
+		logError(fmt.Sprintf("清除特权位失败 %s: %v", path, err))
+		return
+	}
+	logSuccess(fmt.Sprintf("已清除特权位(%s): %s", flags, path))
+	dm.audit("suid_stripped", path, flags)
+}
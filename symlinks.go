@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// recordSymlinks 把目录中现有的符号链接及其指向记入基线, 之后只有新增或指向被修改的链接会告警
+func (dm *DirectoryMonitor) recordSymlinks(links []string) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	for _, link := range links {
+		if target, err := os.Readlink(link); err == nil {
+			dm.symlinks[link] = target
+		}
+	}
+}
+
+// checkSymlinks 检查目录中的符号链接: 攻击者可以用 ln -s /etc/passwd leak.php 之类的链接读取任意文件,
+// 新增或指向被修改的链接按symlinkAction告警、隔离或删除
+func (dm *DirectoryMonitor) checkSymlinks(dirPath string, links []string) {
+	present := make(map[string]bool)
+	for _, link := range links {
+		present[link] = true
+		if dm.isLockedOut(link) || dm.isSuppressed(link) || dm.isExcluded(link) {
+			continue
+		}
+
+		target, err := os.Readlink(link)
+		if err != nil {
+			continue
+		}
+
+		dm.mu.RLock()
+		known, ok := dm.symlinks[link]
+		dm.mu.RUnlock()
+		if ok && known == target {
+			continue
+		}
+
+		reason := isolateReason{Event: "new_symlink"}
+		if ok {
+			reason.Event = "symlink_modified"
+			dm.alert("critical", "symlink_modified",
+				fmt.Sprintf("符号链接指向被修改: %s -> %s (原指向: %s)", link, target, known))
+		} else {
+			dm.alert("critical", "new_symlink", fmt.Sprintf("检测到新增符号链接: %s -> %s", link, target))
+			dm.stats.countChange(changeCreated)
+		}
+
+		action := dm.symlinkAction
+		if dm.dryRun {
+			action = "alert"
+		}
+		switch action {
+		case "isolate":
+			if err := dm.isolateFile(link, reason); err != nil {
+				logError(fmt.Sprintf("隔离符号链接失败: %v", err))
+				continue
+			}
+			delete(present, link)
+		case "delete":
+			if err := os.Remove(link); err != nil {
+				logError(fmt.Sprintf("删除符号链接失败 %s: %v", link, err))
+				continue
+			}
+			delete(present, link)
+			logSuccess(fmt.Sprintf("符号链接已删除: %s", link))
+		default:
+			// 只告警时记录当前指向, 避免每次检查重复告警
+			dm.mu.Lock()
+			dm.symlinks[link] = target
+			dm.mu.Unlock()
+			dm.markManifestDirty()
+		}
+	}
+
+	// 已不存在的链接从基线中移除, 重新创建时再次告警
+	dm.mu.Lock()
+	for link := range dm.symlinks {
+		if filepath.Dir(link) == dirPath && !present[link] {
+			delete(dm.symlinks, link)
+			dm.markManifestDirty()
+		}
+	}
+	dm.mu.Unlock()
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// diffContextLines unified diff中每处变化前后保留的上下文行数
+	diffContextLines = 3
+	// maxDiffLines 告警中diff的最大行数, 超出部分截断
+	maxDiffLines = 200
+	// maxDiffCells 逐行比较的LCS表大小上限, 超出时把中间不同的部分整体按替换处理
+	maxDiffCells = 4 << 20
+)
+
+// diffOp 逐行比较的一个结果: ' '未变, '-'只在旧文件中, '+'只在新文件中
+type diffOp struct {
+	kind byte
+	line string
+}
+
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// diffLineOps 先去掉公共的首尾行(注入的payload通常只改动文件中的一小段), 中间部分用LCS比较
+func diffLineOps(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, lcsDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+func lcsDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	var ops []diffOp
+	if n*m > maxDiffCells {
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+		return ops
+	}
+
+	// lcs[i*(m+1)+j] 为a[i:]与b[j:]的最长公共子序列长度
+	lcs := make([]int32, (n+1)*(m+1))
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j+1] + 1
+			} else if lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1] {
+				lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j]
+			} else {
+				lcs[i*(m+1)+j] = lcs[i*(m+1)+j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// hunkStart unified diff中块的起始行号, 块在该文件中没有行时按惯例为前一行
+func hunkStart(line, count int) int {
+	if count == 0 {
+		return line - 1
+	}
+	return line
+}
+
+// unifiedDiff 生成两个文本之间的unified diff, 内容相同时返回空字符串; 超过maxDiffLines行时截断
+func unifiedDiff(oldName, newName string, old, new []byte) string {
+	ops := diffLineOps(splitLines(old), splitLines(new))
+
+	// 每个操作在旧/新文件中对应的行号(从1开始)
+	oldLines, newLines := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	oldLine, newLine := 1, 1
+	for i, op := range ops {
+		oldLines[i], newLines[i] = oldLine, newLine
+		if op.kind != '+' {
+			oldLine++
+		}
+		if op.kind != '-' {
+			newLine++
+		}
+	}
+	oldLines[len(ops)], newLines[len(ops)] = oldLine, newLine
+
+	var b strings.Builder
+	written := 0
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// 相邻两处变化之间的上下文不超过两倍时合并为一个块
+		start := i - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i + 1
+		for j := i + 1; j < len(ops) && j-end <= 2*diffContextLines; j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			}
+		}
+		stop := end + diffContextLines
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		oldCount, newCount := 0, 0
+		for _, op := range ops[start:stop] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n",
+			hunkStart(oldLines[start], oldCount), oldCount, hunkStart(newLines[start], newCount), newCount)
+
+		for _, op := range ops[start:stop] {
+			if written >= maxDiffLines {
+				fmt.Fprintf(&b, "... (超过 %d 行, 已截断)\n", maxDiffLines)
+				return b.String()
+			}
+			b.WriteByte(op.kind)
+			b.WriteString(op.line)
+			b.WriteByte('\n')
+			written++
+		}
+		i = stop
+	}
+	return b.String()
+}
+
+// readForTextDiff 读取参与文本比较的文件, 超过大小上限时返回错误
+func readForTextDiff(filePath string, maxSize int64) ([]byte, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxSize {
+		return nil, fmt.Errorf("文件过大: %d bytes", info.Size())
+	}
+	return os.ReadFile(filePath)
+}
+
+// textChangeDiff 被修改的文本文件相对备份的unified diff; 二进制文件、超过-diff-max-size或没有备份时返回空字符串
+func (dm *DirectoryMonitor) textChangeDiff(filePath string) string {
+	if dm.diffMaxSize <= 0 {
+		return ""
+	}
+	root, rel, err := dm.relToRoot(filePath)
+	if err != nil {
+		return ""
+	}
+
+	current, err := readForTextDiff(filePath, dm.diffMaxSize)
+	if err != nil {
+		return ""
+	}
+	original, err := readForTextDiff(filepath.Join(root.backupDir, rel), dm.diffMaxSize)
+	if err != nil {
+		return ""
+	}
+	if isBinaryContent(current) || isBinaryContent(original) {
+		return ""
+	}
+
+	rel = filepath.ToSlash(rel)
+	return unifiedDiff("backup/"+rel, "current/"+rel, original, current)
+}
+
+// colorizeDiff 文本日志中删除的行标红, 新增的行标绿
+func colorizeDiff(diff string) string {
+	lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+			lines[i] = ColorBold + line + ColorReset
+		case strings.HasPrefix(line, "@@"):
+			lines[i] = ColorCyan + line + ColorReset
+		case strings.HasPrefix(line, "-"):
+			lines[i] = ColorRed + line + ColorReset
+		case strings.HasPrefix(line, "+"):
+			lines[i] = ColorGreen + line + ColorReset
+		}
+	}
+	return strings.Join(lines, "\n")
+}
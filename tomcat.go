@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tomcatScanInterval webapps和work目录的检查间隔
+const tomcatScanInterval = 5 * time.Second
+
+// tomcatHomes 常见的CATALINA_BASE位置, 环境变量CATALINA_BASE/CATALINA_HOME优先
+var tomcatHomes = []string{
+	"/usr/local/tomcat",
+	"/opt/tomcat",
+	"/var/lib/tomcat10",
+	"/var/lib/tomcat9",
+	"/var/lib/tomcat8",
+	"/var/lib/tomcat",
+}
+
+// detectTomcatHome 返回第一个包含webapps目录的Tomcat目录, 找不到时返回空
+func detectTomcatHome() string {
+	candidates := append([]string{os.Getenv("CATALINA_BASE"), os.Getenv("CATALINA_HOME")}, tomcatHomes...)
+	for _, home := range candidates {
+		if home == "" {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(home, "webapps")); err == nil && info.IsDir() {
+			return home
+		}
+	}
+	return ""
+}
+
+// unmangleJasper 还原Jasper生成类名/包名时的转义: 非Java标识符字符写为_xxxx(4位十六进制),
+// 以数字开头的名字前加_
+func unmangleJasper(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '_' && i+5 <= len(name) {
+			if code, err := strconv.ParseUint(name[i+1:i+5], 16, 16); err == nil {
+				b.WriteRune(rune(code))
+				i += 4
+				continue
+			}
+		}
+		b.WriteByte(name[i])
+	}
+	result := b.String()
+	if len(result) > 1 && result[0] == '_' && result[1] >= '0' && result[1] <= '9' {
+		result = result[1:]
+	}
+	return result
+}
+
+// jspSourceFor 根据work目录中编译出的类文件推算对应的JSP路径; 不是JSP类(内部类、tag文件等)时返回false.
+// 类文件位于 work/<Engine>/<Host>/<应用>/org/apache/jsp/<目录>/<名字>_jsp.class, 应用ROOT以外对应webapps/<应用>
+func jspSourceFor(webapps, workApp, classPath string) ([]string, bool) {
+	rel, err := filepath.Rel(filepath.Join(workApp, "org", "apache", "jsp"), classPath)
+	if err != nil || strings.HasPrefix(rel, "..") || strings.Contains(rel, "$") {
+		return nil, false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if parts[0] == "tag" {
+		return nil, false
+	}
+
+	base := strings.TrimSuffix(parts[len(parts)-1], ".class")
+	var suffixes []string
+	switch {
+	case strings.HasSuffix(base, "_jspx"):
+		base, suffixes = strings.TrimSuffix(base, "_jspx"), []string{".jspx"}
+	case strings.HasSuffix(base, "_jsp"):
+		base, suffixes = strings.TrimSuffix(base, "_jsp"), []string{".jsp", ".jspf"}
+	default:
+		return nil, false
+	}
+
+	dirs := make([]string, 0, len(parts)-1)
+	for _, part := range parts[:len(parts)-1] {
+		dirs = append(dirs, unmangleJasper(part))
+	}
+	docBase := filepath.Join(webapps, filepath.Base(workApp))
+	var sources []string
+	for _, suffix := range suffixes {
+		sources = append(sources, filepath.Join(docBase, filepath.Join(dirs...), unmangleJasper(base)+suffix))
+	}
+	return sources, true
+}
+
+// orphanJSPClasses 返回work目录中找不到对应JSP源文件的编译类: JSP被访问编译后删除源文件,
+// 或者直接写入类文件, 都是常见的内存马和隐藏后门手法
+func orphanJSPClasses(home string) map[string]string {
+	webapps := filepath.Join(home, "webapps")
+	orphans := make(map[string]string)
+	apps, _ := filepath.Glob(filepath.Join(home, "work", "*", "*", "*"))
+	for _, app := range apps {
+		filepath.Walk(filepath.Join(app, "org", "apache", "jsp"), func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || !strings.HasSuffix(path, ".class") {
+				return nil
+			}
+			sources, ok := jspSourceFor(webapps, app, path)
+			if !ok {
+				return nil
+			}
+			for _, source := range sources {
+				if _, err := os.Stat(source); err == nil {
+					return nil
+				}
+			}
+			orphans[path] = sources[0]
+			return nil
+		})
+	}
+	return orphans
+}
+
+// listWebapps 返回webapps目录第一层的WAR包和应用目录
+func listWebapps(webapps string) map[string]bool {
+	apps := make(map[string]bool)
+	entries, err := os.ReadDir(webapps)
+	if err != nil {
+		return apps
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.EqualFold(filepath.Ext(entry.Name()), ".war") {
+			apps[filepath.Join(webapps, entry.Name())] = true
+		}
+	}
+	return apps
+}
+
+// startTomcatMonitor 监控Tomcat(-tomcat-home): webapps下新部署的WAR包和应用目录告警tomcat_new_webapp,
+// work下没有对应JSP源文件的编译类告警tomcat_orphan_jsp_class; conf下的tomcat-users.xml, server.xml等
+// 以及conf/Catalina/localhost中的部署描述符逐行告警变化并用启动时的内容复原, 新增的描述符移入隔离目录
+func (dm *DirectoryMonitor) startTomcatMonitor() {
+	webapps := filepath.Join(dm.tomcatHome, "webapps")
+	if info, err := os.Stat(webapps); err != nil || !info.IsDir() {
+		logWarn(fmt.Sprintf("Tomcat目录中没有webapps, 跳过Tomcat监控: %s", dm.tomcatHome))
+		return
+	}
+
+	conf := newSnapshotGroup("Tomcat配置", "tomcat_conf_modified", "critical", true)
+	conf.inspect = func(filePath string, before, after []byte) {
+		dm.alertLineChanges(filePath, before, after)
+	}
+	conf.watchDir(dm, filepath.Join(dm.tomcatHome, "conf"), "tomcat_conf_created")
+	descriptors, _ := filepath.Glob(filepath.Join(dm.tomcatHome, "conf", "*", "*"))
+	for _, dir := range descriptors {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			conf.watchDir(dm, dir, "tomcat_conf_created")
+		}
+	}
+
+	// webapps已在监控目录中时由目录监控处理新增的WAR和应用目录
+	watchWebapps := dm.rootFor(webapps) == nil
+	apps := listWebapps(webapps)
+	orphans := orphanJSPClasses(dm.tomcatHome)
+	if len(orphans) > 0 {
+		paths := make([]string, 0, len(orphans))
+		for path := range orphans {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		dm.alert("warning", "tomcat_orphan_jsp_class",
+			fmt.Sprintf("启动时work目录中已有 %d 个找不到JSP源文件的编译类: %s", len(paths), strings.Join(paths, ", ")))
+	}
+	logInfo(fmt.Sprintf("Tomcat监控已启动: %s, 当前 %d 个应用, %d 个配置文件", dm.tomcatHome, len(apps), len(conf.paths())))
+
+	dm.runPeriodic(snapshotCheckInterval, func() { dm.checkSnapshotGroup(conf) })
+
+	dm.runPeriodic(tomcatScanInterval, func() {
+		if watchWebapps {
+			current := listWebapps(webapps)
+			for app := range current {
+				if apps[app] {
+					continue
+				}
+				kind := "应用目录"
+				if strings.EqualFold(filepath.Ext(app), ".war") {
+					kind = "WAR包"
+				}
+				dm.alertFile("critical", "tomcat_new_webapp",
+					fmt.Sprintf("检测到Tomcat新部署的%s: %s，可能是通过manager或热部署上传的webshell", kind, app),
+					alertDetail{Path: app})
+			}
+			apps = current
+		}
+
+		current := orphanJSPClasses(dm.tomcatHome)
+		for path, source := range current {
+			if _, ok := orphans[path]; ok {
+				continue
+			}
+			dm.alertFile("critical", "tomcat_orphan_jsp_class",
+				fmt.Sprintf("检测到work目录中没有对应JSP源文件的编译类: %s (应为 %s)，JSP可能已被删除而仍驻留在内存中", path, source),
+				alertDetail{Path: path})
+		}
+		orphans = current
+	})
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// prepareUnisolate 读取隔离文件的元数据, 确认原路径可用, 并在隔离目录中先恢复属主、权限和修改时间,
+// 这样移回原路径后属性立即与基线一致
+func prepareUnisolate(isolatedPath string) (*isolateMeta, error) {
+	meta, err := readIsolateMeta(isolatedPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Lstat(meta.OriginalPath); err == nil {
+		return nil, fmt.Errorf("原路径已存在: %s", meta.OriginalPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(meta.OriginalPath), 0755); err != nil {
+		return nil, fmt.Errorf("创建原目录失败: %v", err)
+	}
+
+	// 先chown再chmod, chown会清除setuid/setgid位
+	if err := setOwner(isolatedPath, meta.Uid, meta.Gid, meta.Owner); err != nil {
+		logWarn(fmt.Sprintf("恢复所有者失败 %s: %v", isolatedPath, err))
+	}
+	if meta.Type == "symlink" {
+		return meta, nil
+	}
+
+	mode, err := parseUnixMode(meta.Mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(isolatedPath, mode); err != nil {
+		return nil, fmt.Errorf("恢复权限失败: %v", err)
+	}
+	if modTime, err := time.Parse(time.RFC3339Nano, meta.ModTime); err == nil {
+		if err := os.Chtimes(isolatedPath, modTime, modTime); err != nil {
+			logWarn(fmt.Sprintf("恢复修改时间失败 %s: %v", isolatedPath, err))
+		}
+	}
+	if err := setFileAttributes(isolatedPath, meta.Attributes); err != nil {
+		logWarn(fmt.Sprintf("恢复文件属性失败 %s: %v", isolatedPath, err))
+	}
+	return meta, nil
+}
+
+// finishUnisolate 把隔离文件移回原路径并删除元数据文件
+func finishUnisolate(isolatedPath string, meta *isolateMeta) error {
+	if err := moveFile(isolatedPath, meta.OriginalPath); err != nil {
+		return fmt.Errorf("移回原路径失败: %v", err)
+	}
+	if err := os.Remove(isolatedPath + metaSuffix); err != nil {
+		logWarn(fmt.Sprintf("删除隔离元数据失败: %v", err))
+	}
+	return nil
+}
+
+// unisolate 把误报的隔离文件移回原路径并加入基线; 移动前先写入基线, 避免监控goroutine把它当作新增文件再次隔离
+// input可以是绝对路径, 也可以是list-quarantine中列出的相对隔离目录的名称
+func (dm *DirectoryMonitor) unisolate(input string) (string, error) {
+	if path, err := dm.quarantinePath(input); err == nil {
+		input = path
+	}
+	isolatedPath, err := filepath.Abs(input)
+	if err != nil {
+		return "", err
+	}
+	baseDir, err := filepath.Abs(dm.baseDir)
+	if err != nil {
+		return "", err
+	}
+	if !withinDir(isolatedPath, baseDir) {
+		return "", fmt.Errorf("不是隔离目录中的文件: %s", input)
+	}
+
+	meta, err := prepareUnisolate(isolatedPath)
+	if err != nil {
+		return "", err
+	}
+
+	monitored := meta.Type == "file" && dm.rootFor(meta.OriginalPath) != nil && dm.shouldMonitorFile(meta.OriginalPath)
+	if monitored {
+		info, err := dm.hashedFileInfo(isolatedPath)
+		if err != nil {
+			return "", err
+		}
+		info.Path = meta.OriginalPath
+		dm.setBaseline(meta.OriginalPath, info)
+	}
+
+	if err := finishUnisolate(isolatedPath, meta); err != nil {
+		if monitored {
+			dm.deleteBaseline(meta.OriginalPath)
+		}
+		return "", err
+	}
+
+	if monitored {
+		if err := dm.backupFile(meta.OriginalPath); err != nil {
+			logWarn(fmt.Sprintf("备份还原的文件失败 %s: %v", meta.OriginalPath, err))
+		}
+	}
+	if meta.Type == "directory" {
+		dm.addDirectoryTree(meta.OriginalPath)
+	}
+
+	logSuccess(fmt.Sprintf("隔离文件已还原: %s -> %s", isolatedPath, meta.OriginalPath))
+	dm.audit("unisolate", meta.OriginalPath, isolatedPath)
+	return meta.OriginalPath, nil
+}
+
+// handleUnisolate POST /api/unisolate?path=<隔离文件路径> 把误报的隔离文件移回原路径并加入基线
+func (dm *DirectoryMonitor) handleUnisolate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+
+	origin, err := dm.unisolate(r.URL.Query().Get("path"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"status": "success",
+		"path":   origin,
+	})
+}
+
+// runUnisolate 子命令: edr unisolate [-control addr] <隔离文件>...
+// 指定-control时交给正在运行的实例处理(同时加入其基线), 否则离线移回原路径
+func runUnisolate(args []string) int {
+	fs := flag.NewFlagSet("unisolate", flag.ExitOnError)
+	control := fs.String("control", "", "正在运行的实例的控制API地址 (例如: 127.0.0.1:9090)")
+	token := fs.String("control-token", "", "控制API的令牌, 与运行中实例的-control-token一致, @文件 表示从文件读取")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: edr unisolate [-control 127.0.0.1:9090 -control-token <令牌>] <隔离文件>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	secret, err := readSecret(*token)
+	if err != nil {
+		logError(fmt.Sprintf("读取控制API令牌失败: %v", err))
+		return 1
+	}
+
+	failed := 0
+	for _, input := range fs.Args() {
+		isolatedPath, err := filepath.Abs(input)
+		if err != nil {
+			logError(err.Error())
+			failed++
+			continue
+		}
+
+		if *control != "" {
+			err = unisolateRemote(*control, secret, isolatedPath)
+		} else {
+			var meta *isolateMeta
+			if meta, err = prepareUnisolate(isolatedPath); err == nil {
+				err = finishUnisolate(isolatedPath, meta)
+			}
+			if err == nil {
+				logSuccess(fmt.Sprintf("隔离文件已还原: %s -> %s (运行中的实例不知道该文件, 请用-control或之后执行rebaseline)",
+					isolatedPath, meta.OriginalPath))
+			}
+		}
+		if err != nil {
+			logError(fmt.Sprintf("%s: %v", input, err))
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func unisolateRemote(addr, token, isolatedPath string) error {
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%s/api/unisolate?path=%s", addr, url.QueryEscape(isolatedPath)), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("控制API返回 %s: %s", resp.Status, body)
+	}
+	logSuccess(fmt.Sprintf("已由运行中的实例还原: %s", body))
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// watchedFilesDir 备份目录下保存-file文件副本的子目录, 按绝对路径排列
+const watchedFilesDir = "_files"
+
+// startFileMonitor 单独监控-file指定的文件(例如/etc/nginx/nginx.conf, /var/spool/cron/root), 不监控其所在目录:
+// 启动时的内容作为基线并在备份目录下保存一份副本, 之后修改或删除告警watched_file_modified并复原,
+// 启动时不存在、之后被创建的告警watched_file_created并移入隔离目录
+func (dm *DirectoryMonitor) startFileMonitor() {
+	group := newSnapshotGroup("单独监控文件", "watched_file_modified", "critical", true)
+
+	copyDir := filepath.Join(dm.backupDir, watchedFilesDir)
+	for _, filePath := range dm.watchFiles {
+		if dm.rootFor(filePath) != nil {
+			logWarn(fmt.Sprintf("%s 已在监控目录中, 不再单独监控", filePath))
+			continue
+		}
+		group.watchFile(dm, filePath, "watched_file_created")
+
+		snapshot := group.get(filePath)
+		if snapshot == nil {
+			logWarn(fmt.Sprintf("单独监控的文件不存在, 出现后告警: %s", filePath))
+			continue
+		}
+		backupPath := filepath.Join(copyDir, strings.TrimPrefix(filePath, filepath.VolumeName(filePath)))
+		if err := dm.makeWorkspaceDir(filepath.Dir(backupPath)); err != nil {
+			logWarn(fmt.Sprintf("保存文件副本失败 %s: %v", filePath, err))
+			continue
+		}
+		if err := os.WriteFile(backupPath, snapshot.content, 0400); err != nil {
+			logWarn(fmt.Sprintf("保存文件副本失败 %s: %v", filePath, err))
+		}
+	}
+
+	logInfo(fmt.Sprintf("单独监控 %d 个文件: %s, 副本: %s",
+		len(group.paths()), strings.Join(group.paths(), ", "), copyDir))
+
+	dm.runPeriodic(snapshotCheckInterval, func() { dm.checkSnapshotGroup(group) })
+}
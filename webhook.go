@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// alertDetail 告警涉及的文件及其变化前后的元数据, 随webhook一起上报
+type alertDetail struct {
+	Path string
+	Old  *FileInfo
+	New  *FileInfo
+	// Action 告警后采取的处理动作(isolate/restore/isolate+restore), 为空表示只告警
+	Action string
+	// Diff 被修改的文本文件相对备份的unified diff
+	Diff string
+	// Obfuscation/Entropy 脚本文件的混淆评分和熵
+	Obfuscation int
+	Entropy     float64
+	// Requests 新增文件之前访问日志中的请求(-access-log)
+	Requests []accessRequest
+}
+
+// fileMeta FileInfo在webhook中的JSON表示
+type fileMeta struct {
+	Size    int64  `json:"size"`
+	ModTime string `json:"mtime"`
+	Mode    string `json:"mode"`
+	Uid     uint32 `json:"uid"`
+	Gid     uint32 `json:"gid"`
+	Inode   uint64 `json:"inode"`
+	Hash    string `json:"hash,omitempty"`
+}
+
+// alertPayload webhook的JSON请求体; message按-max-alert-msg-len截断供通知展示, full_message为完整消息
+type alertPayload struct {
+	Type        string    `json:"type"`
+	Event       string    `json:"event"`
+	Message     string    `json:"message"`
+	FullMessage string    `json:"full_message"`
+	Path        string    `json:"path,omitempty"`
+	Old         *fileMeta `json:"old,omitempty"`
+	New         *fileMeta `json:"new,omitempty"`
+	Action      string    `json:"action,omitempty"`
+	Diff        string    `json:"diff,omitempty"`
+	Obfuscation int       `json:"obfuscation_score,omitempty"`
+	Entropy     float64   `json:"entropy,omitempty"`
+	Hash        string    `json:"hash,omitempty"`
+	Hostname    string    `json:"hostname"`
+	Timestamp   int64     `json:"timestamp"`
+
+	// Requests 新增文件之前访问日志中的请求
+	Requests []accessRequest `json:"requests,omitempty"`
+}
+
+func newFileMeta(info *FileInfo) *fileMeta {
+	if info == nil {
+		return nil
+	}
+	return &fileMeta{
+		Size:    info.Size,
+		ModTime: time.Unix(0, info.ModTime).Format(time.RFC3339),
+		Mode:    fmt.Sprintf("%04o", info.Mode.Perm()),
+		Uid:     info.Uid,
+		Gid:     info.Gid,
+		Inode:   info.Inode,
+		Hash:    info.Hash,
+	}
+}
+
+func (dm *DirectoryMonitor) sendAPIAlert(alertType, event, message string, detail alertDetail) {
+	dirURLs := dm.dirAlertURLs(detail.Path)
+	if dm.webhookURL == "" && len(dirURLs) == 0 {
+		return
+	}
+
+	if dm.webhookGet && dm.webhookURL != "" {
+		dm.sendGetAlert(alertType, event, message)
+		if len(dirURLs) == 0 {
+			return
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	payload := alertPayload{
+		Type:        alertType,
+		Event:       event,
+		Message:     truncateMessage(message, dm.maxAlertMsgLen),
+		FullMessage: message,
+		Path:        detail.Path,
+		Old:         newFileMeta(detail.Old),
+		New:         newFileMeta(detail.New),
+		Action:      detail.Action,
+		Diff:        detail.Diff,
+		Obfuscation: detail.Obfuscation,
+		Entropy:     detail.Entropy,
+		Requests:    detail.Requests,
+
+		Hostname:  hostname,
+		Timestamp: time.Now().Unix(),
+	}
+	// 告警在隔离/还原之前发出, 此时文件仍是攻击者写入的内容
+	if detail.Path != "" {
+		if hash, err := hashFile(detail.Path); err == nil {
+			payload.Hash = hash
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logError(fmt.Sprintf("序列化告警失败: %v", err))
+		return
+	}
+
+	if dm.webhookURL != "" && !dm.webhookGet {
+		dm.enqueueAlert(queuedAlert{
+			Method:      http.MethodPost,
+			URL:         dm.webhookURL,
+			ContentType: dm.webhookContentType,
+			Body:        body,
+			Message:     message,
+		})
+	}
+	// directories中配置的端点与-a相同, 接收JSON
+	for _, u := range dirURLs {
+		dm.enqueueAlert(queuedAlert{
+			Method:      http.MethodPost,
+			URL:         u,
+			ContentType: "application/json",
+			Body:        body,
+			Message:     message,
+		})
+	}
+}
+
+// streamEvent 把一条audit.log记录上报到edr server的/api/agent/edr-events(-stream-events), 与告警共用发送队列和重试
+func (dm *DirectoryMonitor) streamEvent(action string, record []byte) {
+	if !dm.streamEvents || dm.apiEndpoint == "" {
+		return
+	}
+	hostname, _ := os.Hostname()
+	body, err := json.Marshal(map[string]interface{}{
+		"hostname":  hostname,
+		"timestamp": time.Now().Unix(),
+		"events":    []json.RawMessage{record},
+	})
+	if err != nil {
+		logError(fmt.Sprintf("序列化事件失败: %v", err))
+		return
+	}
+
+	dm.enqueueAlert(queuedAlert{
+		Method:      http.MethodPost,
+		URL:         apiBaseURL(dm.apiEndpoint) + "/api/agent/edr-events",
+		ContentType: "application/json",
+		Body:        body,
+		Message:     "处理动作 " + action,
+	})
+}
+
+// sendGetAlert 兼容旧版接收端的GET上报, 消息放在查询参数中
+func (dm *DirectoryMonitor) sendGetAlert(alertType, event, message string) {
+	// 完整消息已在本地日志中打印, 上报时截断以免超出服务端URL长度限制
+	apiURL := fmt.Sprintf("%s?type=%s&event=%s&message=%s",
+		dm.webhookURL, alertType, url.QueryEscape(event),
+		url.QueryEscape(truncateMessage(message, dm.maxAlertMsgLen)))
+
+	dm.enqueueAlert(queuedAlert{Method: http.MethodGet, URL: apiURL, Message: message})
+}
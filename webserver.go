@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// webserverHookTimeout 配置检查和重新加载命令的最长执行时间
+const webserverHookTimeout = 30 * time.Second
+
+// webserverConfDirs nginx和apache常见的配置目录, 包括各子目录(conf.d, sites-enabled, mods-enabled等)
+var webserverConfDirs = []string{
+	"/etc/nginx",
+	"/usr/local/nginx/conf",
+	"/etc/apache2",
+	"/etc/httpd",
+	"/usr/local/apache2/conf",
+}
+
+// webserverDirectives nginx/apache主配置中可用于转发请求、执行代码或暴露文件的指令, nginx一行可以写多条指令,
+// 按语句边界匹配; .htaccess中的危险指令(htaccessDirectives)同样适用于apache主配置
+var webserverDirectives = []htaccessDirective{
+	{regexp.MustCompile(`(^|[;{}])\s*proxy_pass\s`), "proxy_pass反向代理到其他地址"},
+	{regexp.MustCompile(`(^|[;{}])\s*location\s`), "新增location块"},
+	{regexp.MustCompile(`(^|[;{}])\s*(fastcgi|uwsgi|scgi)_pass\s`), "把请求交给脚本解释器执行"},
+	{regexp.MustCompile(`(^|[;{}])\s*alias\s`), "alias映射其他目录"},
+	{regexp.MustCompile(`(^|[;{}])\s*\w+_by_lua(_block|_file)?\b`), "执行Lua代码"},
+	{regexp.MustCompile(`(^|[;{}])\s*autoindex\s+on`), "开启目录列表"},
+	{regexp.MustCompile(`(?i)^\s*ProxyPass(Match)?\s`), "ProxyPass反向代理到其他地址"},
+	{regexp.MustCompile(`(?i)^\s*RewriteRule\s.*\[[^\]]*\bP\b`), "RewriteRule代理到其他地址"},
+	{regexp.MustCompile(`(?i)^\s*(ScriptAlias(Match)?|Alias(Match)?)\s`), "Alias/ScriptAlias映射其他目录"},
+	{regexp.MustCompile(`(?i)^\s*LoadModule\s+(cgid?|proxy\w*|lua|php\w*)_module\b`), "加载CGI/代理/脚本模块"},
+}
+
+// webserverFindings 返回修改后新增的行中命中危险指令的描述
+func webserverFindings(before, after []byte) []string {
+	added, _ := diffLines(before, after)
+	var findings []string
+	for _, line := range added {
+		var descs []string
+		for _, list := range [][]htaccessDirective{webserverDirectives, htaccessDirectives} {
+			for _, d := range list {
+				if d.re.MatchString(line) {
+					descs = append(descs, d.desc)
+				}
+			}
+		}
+		if len(descs) > 0 {
+			findings = append(findings, fmt.Sprintf("%s: %s", strings.Join(descs, ", "), strings.TrimSpace(redactLine(line))))
+		}
+	}
+	return findings
+}
+
+// webserverSubdirs 返回配置目录及其所有子目录
+func webserverSubdirs(root string) []string {
+	var dirs []string
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	return dirs
+}
+
+// detectWebserverCommands 按已安装的nginx/apache推断配置检查和重新加载命令, 用于-preset webserver
+func detectWebserverCommands() (string, string) {
+	var tests, reloads []string
+	if _, err := exec.LookPath("nginx"); err == nil {
+		tests = append(tests, "nginx -t")
+		reloads = append(reloads, "nginx -s reload")
+	}
+	for _, ctl := range []string{"apache2ctl", "apachectl"} {
+		if _, err := exec.LookPath(ctl); err == nil {
+			tests = append(tests, ctl+" -t")
+			reloads = append(reloads, ctl+" graceful")
+			break
+		}
+	}
+	return strings.Join(tests, " && "), strings.Join(reloads, " && ")
+}
+
+// reloadWebserver 复原配置后先执行-webserver-test-cmd检查配置, 通过后执行-webserver-reload-cmd,
+// 使Web服务器丢弃攻击者已经加载的配置
+func (dm *DirectoryMonitor) reloadWebserver() {
+	if dm.webserverReloadCmd == "" {
+		return
+	}
+	if dm.webserverTestCmd != "" {
+		if stderr, err := runHook(dm.webserverTestCmd, webserverHookTimeout); err != nil {
+			logError(fmt.Sprintf("Web服务器配置检查未通过, 不执行重新加载: %v (%s)", err, stderr))
+			return
+		}
+	}
+	stderr, err := runHook(dm.webserverReloadCmd, webserverHookTimeout)
+	if err != nil {
+		logError(fmt.Sprintf("重新加载Web服务器失败: %v (%s)", err, stderr))
+		return
+	}
+	logSuccess(fmt.Sprintf("已重新加载Web服务器: %s", dm.webserverReloadCmd))
+	dm.audit("webserver_reloaded", dm.webserverReloadCmd, dm.webserverTestCmd)
+}
+
+// startWebserverMonitor 监控nginx/apache配置目录及其子目录: 变化时逐行告警, 新增行中的proxy_pass,
+// location, CGI/脚本处理等危险指令告警webserver_dangerous_directive; restoreWebserver为true时复原
+// 并隔离新增的配置文件, 之后按-webserver-test-cmd和-webserver-reload-cmd重新加载
+func (dm *DirectoryMonitor) startWebserverMonitor() {
+	group := newSnapshotGroup("Web服务器配置", "webserver_config_modified", "critical", dm.restoreWebserver)
+	group.inspect = func(filePath string, before, after []byte) {
+		dm.alertLineChanges(filePath, before, after)
+		if findings := webserverFindings(before, after); len(findings) > 0 {
+			dm.alert("critical", "webserver_dangerous_directive",
+				fmt.Sprintf("检测到Web服务器配置引入危险指令: %s (%s)", filePath, strings.Join(findings, "; ")))
+		}
+	}
+	group.afterRestore = dm.reloadWebserver
+
+	var roots []string
+	for _, root := range webserverConfDirs {
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			continue
+		}
+		roots = append(roots, root)
+		for _, dir := range webserverSubdirs(root) {
+			group.watchDir(dm, dir, "webserver_config_created")
+		}
+	}
+	if len(roots) == 0 {
+		logWarn(fmt.Sprintf("未发现nginx/apache配置目录(%s), 跳过Web服务器配置监控", strings.Join(webserverConfDirs, ", ")))
+		return
+	}
+
+	mode := "只告警"
+	if dm.restoreWebserver {
+		mode = "告警并复原"
+	}
+	logInfo(fmt.Sprintf("Web服务器配置监控已启动(%s): %s, 共 %d 个文件", mode, strings.Join(roots, ", "), len(group.paths())))
+
+	dm.runPeriodic(snapshotCheckInterval, func() { dm.checkSnapshotGroup(group) })
+}
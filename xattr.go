@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// xattrDigest 扩展属性(包括POSIX ACL system.posix_acl_*和security.*标签)的摘要, 记录在基线中; 没有扩展属性时为空
+func xattrDigest(attrs map[string][]byte) string {
+	if len(attrs) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write(attrs[name])
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fileXattrDigest 读取文件当前扩展属性的摘要, 读取失败时按没有扩展属性处理
+func fileXattrDigest(path string) string {
+	attrs, err := readXattrs(path)
+	if err != nil {
+		return ""
+	}
+	return xattrDigest(attrs)
+}
+
+// copyXattrs 让dst的扩展属性与src完全一致: 设置src中的所有属性, 删除dst中多出的属性.
+// 备份时从原文件复制到备份, 还原时从备份复制回原文件
+func copyXattrs(src, dst string) error {
+	want, err := readXattrs(src)
+	if err != nil {
+		return fmt.Errorf("读取扩展属性失败: %v", err)
+	}
+	have, err := readXattrs(dst)
+	if err != nil {
+		return fmt.Errorf("读取扩展属性失败: %v", err)
+	}
+
+	var failed []string
+	for name := range have {
+		if _, ok := want[name]; !ok {
+			if err := removeXattr(dst, name); err != nil {
+				failed = append(failed, name)
+			}
+		}
+	}
+	for name, value := range want {
+		if current, ok := have[name]; ok && string(current) == string(value) {
+			continue
+		}
+		if err := setXattr(dst, name, value); err != nil {
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("设置扩展属性失败: %v", failed)
+	}
+	return nil
+}
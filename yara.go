@@ -0,0 +1,694 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// yaraScanLimit YARA匹配读取的最大字节数, filesize条件仍使用文件的实际大小
+	yaraScanLimit = 16 * 1024 * 1024
+	// yaraMaxMatches 每个特征串最多记录的命中位置数, 与YARA的默认上限相同
+	yaraMaxMatches = 1000000
+)
+
+// YARA规则的纯Go实现, 只支持AWD规则集中常用的子集:
+//   - strings: 文本串(nocase/wide/ascii/fullword), 十六进制串(??通配、半字节通配、[n-m]跳转), 正则(/.../is)
+//   - condition: and/or/not/括号, $a, $a at N, $a in (x..y), #a、@a[i]、filesize和uint8/16/32(be)、int8/16/32(be)
+//     组成的算术表达式与比较, any/all/N of them, any/all/N of ($a, $b*)
+// 不支持的语法(模块、for循环、xor/base64修饰符等)所在的规则文件会被跳过并给出警告
+
+// hexToken 十六进制串中的一个字节(带掩码)或一段跳转
+type hexToken struct {
+	value, mask      byte
+	jump             bool
+	minJump, maxJump int
+}
+
+// yaraText 文本串的一种编码形式
+type yaraText struct {
+	data []byte
+	wide bool
+}
+
+// yaraString strings段中的一条特征
+type yaraString struct {
+	id       string
+	texts    []yaraText // 文本串的各种编码形式(ascii/wide)
+	nocase   bool
+	fullword bool
+	re       *regexp.Regexp
+	hex      []hexToken
+}
+
+// yaraCtx 条件求值时的上下文: 每个特征串命中的偏移(升序)和读取的文件内容
+type yaraCtx struct {
+	offsets  map[string][]int
+	data     []byte
+	filesize int64
+}
+
+type yaraCond func(ctx *yaraCtx) bool
+
+// yaraRule 一条编译后的YARA规则
+type yaraRule struct {
+	name    string
+	file    string
+	strings []*yaraString
+	cond    yaraCond
+}
+
+// yaraMatch 一条命中的规则及其命中的特征串
+type yaraMatch struct {
+	Rule    string
+	Strings []string
+}
+
+func (m yaraMatch) String() string {
+	if len(m.Strings) == 0 {
+		return m.Rule
+	}
+	return fmt.Sprintf("%s [%s]", m.Rule, strings.Join(m.Strings, ", "))
+}
+
+// loadYaraRules 加载目录中所有.yar/.yara文件, 无法解析的文件跳过并告警
+func loadYaraRules(dir string) ([]*yaraRule, error) {
+	var files []string
+	for _, pattern := range []string{"*.yar", "*.yara"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("目录中没有.yar/.yara规则文件: %s", dir)
+	}
+	sort.Strings(files)
+
+	var rules []*yaraRule
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			logWarn(fmt.Sprintf("读取YARA规则失败 %s: %v", file, err))
+			continue
+		}
+		parsed, err := parseYara(string(data))
+		if err != nil {
+			logWarn(fmt.Sprintf("跳过YARA规则文件 %s: %v", filepath.Base(file), err))
+			continue
+		}
+		for _, rule := range parsed {
+			rule.file = filepath.Base(file)
+		}
+		rules = append(rules, parsed...)
+	}
+	return rules, nil
+}
+
+// yaraParser 基于游标的规则解析器
+type yaraParser struct {
+	src string
+	pos int
+}
+
+func (p *yaraParser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.src[:p.pos], "\n") + 1
+	return fmt.Errorf("第%d行: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skipSpace 跳过空白和注释
+func (p *yaraParser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch {
+		case unicode.IsSpace(rune(p.src[p.pos])):
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], "//"):
+			if end := strings.IndexByte(p.src[p.pos:], '\n'); end >= 0 {
+				p.pos += end
+			} else {
+				p.pos = len(p.src)
+			}
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			if end := strings.Index(p.src[p.pos+2:], "*/"); end >= 0 {
+				p.pos += end + 4
+			} else {
+				p.pos = len(p.src)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *yaraParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '*' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// word 读取标识符, 包括$开头的特征串名
+func (p *yaraParser) word() string {
+	p.skipSpace()
+	start := p.pos
+	if p.pos < len(p.src) && (p.src[p.pos] == '$' || p.src[p.pos] == '#') {
+		p.pos++
+	}
+	for p.pos < len(p.src) && isIdentChar(p.src[p.pos]) {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *yaraParser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("缺少'%c'", c)
+	}
+	p.pos++
+	return nil
+}
+
+// quoted 读取双引号字符串并处理转义
+func (p *yaraParser) quoted() (string, error) {
+	if err := p.expect('"'); err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		p.pos++
+		switch c {
+		case '"':
+			return buf.String(), nil
+		case '\\':
+			if p.pos >= len(p.src) {
+				break
+			}
+			esc := p.src[p.pos]
+			p.pos++
+			switch esc {
+			case 'n':
+				buf.WriteByte('\n')
+			case 't':
+				buf.WriteByte('\t')
+			case 'r':
+				buf.WriteByte('\r')
+			case 'x':
+				if p.pos+2 > len(p.src) {
+					return "", p.errorf("无效的转义")
+				}
+				v, err := strconv.ParseUint(p.src[p.pos:p.pos+2], 16, 8)
+				if err != nil {
+					return "", p.errorf("无效的转义: \\x%s", p.src[p.pos:p.pos+2])
+				}
+				buf.WriteByte(byte(v))
+				p.pos += 2
+			default:
+				buf.WriteByte(esc)
+			}
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return "", p.errorf("字符串未结束")
+}
+
+func parseYara(src string) ([]*yaraRule, error) {
+	p := &yaraParser{src: src}
+	var rules []*yaraRule
+	for p.peek() != 0 {
+		switch kw := p.word(); kw {
+		case "import":
+			module, _ := p.quoted()
+			return nil, p.errorf("不支持模块: %s", module)
+		case "include":
+			return nil, p.errorf("不支持include")
+		case "private", "global":
+			continue
+		case "rule":
+			rule, err := p.rule()
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, rule)
+		default:
+			return nil, p.errorf("无法识别的内容: %q", kw)
+		}
+	}
+	return rules, nil
+}
+
+func (p *yaraParser) rule() (*yaraRule, error) {
+	rule := &yaraRule{name: p.word()}
+	if rule.name == "" {
+		return nil, p.errorf("缺少规则名")
+	}
+	// 标签不参与匹配
+	if p.peek() == ':' {
+		p.pos++
+		for p.peek() != '{' && p.peek() != 0 {
+			p.word()
+		}
+	}
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+
+	for {
+		section := p.word()
+		if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+		switch section {
+		case "meta":
+			if err := p.meta(); err != nil {
+				return nil, err
+			}
+		case "strings":
+			if err := p.stringDefs(rule); err != nil {
+				return nil, err
+			}
+		case "condition":
+			end := strings.IndexByte(p.src[p.pos:], '}')
+			if end < 0 {
+				return nil, p.errorf("规则%s缺少'}'", rule.name)
+			}
+			cond, err := parseYaraCondition(p.src[p.pos:p.pos+end], rule)
+			if err != nil {
+				return nil, p.errorf("规则%s的condition: %v", rule.name, err)
+			}
+			rule.cond = cond
+			p.pos += end + 1
+			return rule, nil
+		default:
+			return nil, p.errorf("规则%s中未知的段: %q", rule.name, section)
+		}
+	}
+}
+
+// atSection 判断游标处是否为下一个段(strings:/condition:)
+func (p *yaraParser) atSection() bool {
+	p.skipSpace()
+	for _, name := range []string{"strings", "condition"} {
+		rest := strings.TrimLeft(strings.TrimPrefix(p.src[p.pos:], name), " \t")
+		if strings.HasPrefix(p.src[p.pos:], name) && strings.HasPrefix(rest, ":") {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *yaraParser) meta() error {
+	for !p.atSection() {
+		if p.word() == "" {
+			return p.errorf("meta格式错误")
+		}
+		if err := p.expect('='); err != nil {
+			return err
+		}
+		if p.peek() == '"' {
+			if _, err := p.quoted(); err != nil {
+				return err
+			}
+		} else if p.word() == "" {
+			return p.errorf("meta格式错误")
+		}
+	}
+	return nil
+}
+
+func (p *yaraParser) stringDefs(rule *yaraRule) error {
+	anonymous := 0
+	for !p.atSection() {
+		id := p.word()
+		if !strings.HasPrefix(id, "$") {
+			return p.errorf("特征串名必须以$开头: %q", id)
+		}
+		if id == "$" {
+			anonymous++
+			id = fmt.Sprintf("$_anon%d", anonymous)
+		}
+		if err := p.expect('='); err != nil {
+			return err
+		}
+
+		s := &yaraString{id: id}
+		var text string
+		var err error
+		switch p.peek() {
+		case '"':
+			text, err = p.quoted()
+		case '{':
+			s.hex, err = p.hexString()
+		case '/':
+			s.re, err = p.regex()
+		default:
+			err = p.errorf("无效的特征串: %s", id)
+		}
+		if err != nil {
+			return err
+		}
+
+		ascii, wide := false, false
+		for {
+			save := p.pos
+			switch mod := p.word(); mod {
+			case "nocase":
+				s.nocase = true
+			case "wide":
+				wide = true
+			case "ascii":
+				ascii = true
+			case "fullword":
+				s.fullword = true
+			case "private":
+				// 只影响输出, 不影响是否命中
+			case "":
+				goto done
+			default:
+				if strings.HasPrefix(mod, "$") || p.atSectionAt(save) {
+					p.pos = save
+					goto done
+				}
+				return p.errorf("不支持的修饰符: %s", mod)
+			}
+		}
+	done:
+		if s.re == nil && s.hex == nil {
+			if ascii || !wide {
+				s.texts = append(s.texts, yaraText{data: []byte(text)})
+			}
+			if wide {
+				s.texts = append(s.texts, yaraText{data: wideBytes(text), wide: true})
+			}
+			if s.nocase {
+				for i := range s.texts {
+					s.texts[i].data = bytes.ToLower(s.texts[i].data)
+				}
+			}
+		}
+		rule.strings = append(rule.strings, s)
+	}
+	return nil
+}
+
+func (p *yaraParser) atSectionAt(pos int) bool {
+	save := p.pos
+	p.pos = pos
+	at := p.atSection()
+	p.pos = save
+	return at
+}
+
+// wideBytes 把ASCII文本转换为UTF-16LE
+func wideBytes(text string) []byte {
+	out := make([]byte, 0, len(text)*2)
+	for i := 0; i < len(text); i++ {
+		out = append(out, text[i], 0)
+	}
+	return out
+}
+
+func (p *yaraParser) regex() (*regexp.Regexp, error) {
+	p.pos++ // 起始的/
+	start := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] != '/' {
+		if p.src[p.pos] == '\\' {
+			p.pos++
+		}
+		p.pos++
+	}
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("正则未结束")
+	}
+	pattern := p.src[start:p.pos]
+	p.pos++
+
+	flags := ""
+	for p.pos < len(p.src) && (p.src[p.pos] == 'i' || p.src[p.pos] == 's') {
+		flags += string(p.src[p.pos])
+		p.pos++
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, p.errorf("正则无效: %v", err)
+	}
+	return re, nil
+}
+
+func (p *yaraParser) hexString() ([]hexToken, error) {
+	p.pos++ // 起始的{
+	end := strings.IndexByte(p.src[p.pos:], '}')
+	if end < 0 {
+		return nil, p.errorf("十六进制串未结束")
+	}
+	body := strings.Join(strings.Fields(p.src[p.pos:p.pos+end]), "")
+	p.pos += end + 1
+
+	var tokens []hexToken
+	for i := 0; i < len(body); {
+		switch {
+		case body[i] == '[':
+			close := strings.IndexByte(body[i:], ']')
+			if close < 0 {
+				return nil, p.errorf("跳转未结束")
+			}
+			jump, err := parseHexJump(body[i+1 : i+close])
+			if err != nil {
+				return nil, p.errorf("%v", err)
+			}
+			tokens = append(tokens, jump)
+			i += close + 1
+		case body[i] == '(':
+			return nil, p.errorf("不支持十六进制串中的分支")
+		case i+2 <= len(body):
+			tok, err := parseHexByte(body[i : i+2])
+			if err != nil {
+				return nil, p.errorf("%v", err)
+			}
+			tokens = append(tokens, tok)
+			i += 2
+		default:
+			return nil, p.errorf("十六进制串格式错误")
+		}
+	}
+	if len(tokens) == 0 || tokens[0].jump || tokens[len(tokens)-1].jump {
+		return nil, p.errorf("十六进制串不能为空或以跳转开头/结尾")
+	}
+	return tokens, nil
+}
+
+// parseHexByte 解析一个字节, 支持??和半字节通配(4?、?A)
+func parseHexByte(pair string) (hexToken, error) {
+	var tok hexToken
+	for i, shift := range []uint{4, 0} {
+		c := pair[i]
+		if c == '?' {
+			continue
+		}
+		v, err := strconv.ParseUint(string(c), 16, 8)
+		if err != nil {
+			return tok, fmt.Errorf("无效的十六进制字节: %s", pair)
+		}
+		tok.value |= byte(v) << shift
+		tok.mask |= 0xF << shift
+	}
+	return tok, nil
+}
+
+// parseHexJump 解析[n]、[n-m]、[n-]和[-]形式的跳转
+func parseHexJump(spec string) (hexToken, error) {
+	tok := hexToken{jump: true, maxJump: -1}
+	low, high, ranged := strings.Cut(spec, "-")
+	var err error
+	if low != "" {
+		if tok.minJump, err = strconv.Atoi(low); err != nil {
+			return tok, fmt.Errorf("无效的跳转: [%s]", spec)
+		}
+	}
+	switch {
+	case !ranged:
+		tok.maxJump = tok.minJump
+	case high != "":
+		if tok.maxJump, err = strconv.Atoi(high); err != nil || tok.maxJump < tok.minJump {
+			return tok, fmt.Errorf("无效的跳转: [%s]", spec)
+		}
+	}
+	return tok, nil
+}
+
+// hexMatchAt 判断十六进制串是否从data[pos]开始匹配, 返回匹配结束的位置; 跳转通过回溯处理
+func hexMatchAt(data []byte, pos int, tokens []hexToken) (int, bool) {
+	for i, tok := range tokens {
+		if tok.jump {
+			max := tok.maxJump
+			if max < 0 || pos+max > len(data) {
+				max = len(data) - pos
+			}
+			for skip := tok.minJump; skip <= max; skip++ {
+				if end, ok := hexMatchAt(data, pos+skip, tokens[i+1:]); ok {
+					return end, true
+				}
+			}
+			return 0, false
+		}
+		if pos >= len(data) || data[pos]&tok.mask != tok.value {
+			return 0, false
+		}
+		pos++
+	}
+	return pos, true
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// fullwordAt fullword要求命中的前后都不是字母数字; wide串的前一个字符在两个字节之前
+func fullwordAt(data []byte, start, end int, wide bool) bool {
+	before := start - 1
+	if wide {
+		before = start - 2
+	}
+	if before >= 0 && isAlnum(data[before]) {
+		return false
+	}
+	return end >= len(data) || !isAlnum(data[end])
+}
+
+// offsets 返回特征串在数据中所有命中的起始偏移(升序), fullword不满足的命中不计入
+func (s *yaraString) offsets(data, lower []byte) []int {
+	var offsets []int
+	add := func(start, end int, wide bool) bool {
+		if !s.fullword || fullwordAt(data, start, end, wide) {
+			offsets = append(offsets, start)
+		}
+		return len(offsets) < yaraMaxMatches
+	}
+
+	switch {
+	case s.re != nil:
+		for _, loc := range s.re.FindAllIndex(data, -1) {
+			if !add(loc[0], loc[1], false) {
+				break
+			}
+		}
+		return offsets
+	case s.hex != nil:
+		for i := range data {
+			if end, ok := hexMatchAt(data, i, s.hex); ok && !add(i, end, false) {
+				break
+			}
+		}
+		return offsets
+	}
+
+	haystack := data
+	if s.nocase {
+		haystack = lower
+	}
+	for _, text := range s.texts {
+		for pos := 0; pos < len(haystack); {
+			i := bytes.Index(haystack[pos:], text.data)
+			if i < 0 {
+				break
+			}
+			start := pos + i
+			if !add(start, start+len(text.data), text.wide) {
+				break
+			}
+			pos = start + 1
+		}
+	}
+	if len(s.texts) > 1 {
+		sort.Ints(offsets)
+	}
+	return offsets
+}
+
+// match 对文件内容求值, 命中时返回命中的特征串名
+func (r *yaraRule) match(data []byte, filesize int64) (yaraMatch, bool) {
+	ctx := &yaraCtx{offsets: make(map[string][]int), data: data, filesize: filesize}
+	var lower []byte
+	var matched []string
+	for _, s := range r.strings {
+		if s.nocase && lower == nil {
+			lower = bytes.ToLower(data)
+		}
+		if offsets := s.offsets(data, lower); len(offsets) > 0 {
+			ctx.offsets[s.id] = offsets
+			matched = append(matched, s.id)
+		}
+	}
+
+	if !r.cond(ctx) {
+		return yaraMatch{}, false
+	}
+	return yaraMatch{Rule: r.name, Strings: matched}, true
+}
+
+// matchYara 用加载的YARA规则匹配文件, 返回所有命中的规则
+func (dm *DirectoryMonitor) matchYara(filePath string) []yaraMatch {
+	if len(dm.yaraRules) == 0 {
+		return nil
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil
+	}
+	data, err := io.ReadAll(io.LimitReader(f, yaraScanLimit))
+	if err != nil {
+		return nil
+	}
+
+	var matches []yaraMatch
+	for _, rule := range dm.yaraRules {
+		if m, ok := rule.match(data, info.Size()); ok {
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// checkYara 新增/被修改的文件命中YARA规则时告警yara_match, 消息中包含规则名和命中的特征串; 返回命中的规则名
+func (dm *DirectoryMonitor) checkYara(filePath string) []string {
+	matches := dm.matchYara(filePath)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(matches))
+	rules := make([]string, len(matches))
+	for i, m := range matches {
+		names[i] = m.String()
+		rules[i] = "yara:" + m.Rule
+	}
+	dm.alertFile("critical", "yara_match",
+		fmt.Sprintf("文件命中YARA规则: %s (%s)", filePath, strings.Join(names, "; ")),
+		alertDetail{Path: filePath})
+	return rules
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// yaraMatches 编译只有一条规则的规则文件并对data求值
+func yaraMatches(t *testing.T, src string, data string) bool {
+	t.Helper()
+	rules, err := parseYara(src)
+	if err != nil {
+		t.Fatalf("解析规则失败: %v\n%s", err, src)
+	}
+	if len(rules) != 1 {
+		t.Fatalf("应解析出1条规则, 实际 %d 条", len(rules))
+	}
+	_, ok := rules[0].match([]byte(data), int64(len(data)))
+	return ok
+}
+
+type yaraCase struct {
+	name string
+	data string
+	want bool
+}
+
+func runYaraCases(t *testing.T, src string, cases []yaraCase) {
+	t.Helper()
+	for _, c := range cases {
+		if got := yaraMatches(t, src, c.data); got != c.want {
+			t.Errorf("%s: 期望 %v, 实际 %v\n规则: %s", c.name, c.want, got, src)
+		}
+	}
+}
+
+func TestYaraTextStrings(t *testing.T) {
+	runYaraCases(t, `rule r { strings: $a = "eval(" condition: $a }`, []yaraCase{
+		{"命中", "<?php eval($_POST[1]);", true},
+		{"大小写不同", "<?php EVAL($_POST[1]);", false},
+	})
+	runYaraCases(t, `rule r { strings: $a = "eval(" nocase condition: $a }`, []yaraCase{
+		{"nocase", "<?php EvAl($_POST[1]);", true},
+	})
+	runYaraCases(t, `rule r { strings: $a = "cmd" wide condition: $a }`, []yaraCase{
+		{"wide命中UTF-16LE", "c\x00m\x00d\x00", true},
+		{"wide不命中ascii", "cmd", false},
+	})
+	runYaraCases(t, `rule r { strings: $a = "cmd" wide ascii condition: $a }`, []yaraCase{
+		{"ascii", "cmd", true},
+		{"wide", "c\x00m\x00d\x00", true},
+	})
+	runYaraCases(t, `rule r { strings: $a = "a\x41\"b\\" condition: $a }`, []yaraCase{
+		{"转义", `aA"b\`, true},
+	})
+}
+
+func TestYaraFullword(t *testing.T) {
+	runYaraCases(t, `rule r { strings: $a = "system" fullword condition: $a }`, []yaraCase{
+		{"单独出现", "<?php system($c);", true},
+		{"开头和结尾", "system", true},
+		{"前面有字母", "filesystem(", false},
+		{"后面有数字", "system2(", false},
+		{"另一处单独出现", "filesystem; system(", true},
+	})
+	runYaraCases(t, `rule r { strings: $a = "cmd" wide fullword condition: $a }`, []yaraCase{
+		{"wide单独出现", " \x00c\x00m\x00d\x00 \x00", true},
+		{"wide前面有字母", "x\x00c\x00m\x00d\x00", false},
+	})
+	runYaraCases(t, `rule r { strings: $a = /ev[a]l/ fullword condition: $a }`, []yaraCase{
+		{"正则单独出现", "(eval)", true},
+		{"正则前面有字母", "medieval", false},
+	})
+}
+
+func TestYaraHexStrings(t *testing.T) {
+	runYaraCases(t, `rule r { strings: $a = { 3C 3F 70 68 70 } condition: $a }`, []yaraCase{
+		{"精确匹配", "xx<?php", true},
+		{"不匹配", "<?PHP", false},
+	})
+	runYaraCases(t, `rule r { strings: $a = { 4D ?? 90 4? ?1 } condition: $a }`, []yaraCase{
+		{"通配", "M\xff\x90\x4a\x31", true},
+		{"半字节不符", "M\xff\x90\x5a\x31", false},
+	})
+	runYaraCases(t, `rule r { strings: $a = { 61 [2-4] 62 } condition: $a }`, []yaraCase{
+		{"跳转下限", "a12b", true},
+		{"跳转上限", "a1234b", true},
+		{"跳转过短", "a1b", false},
+		{"跳转过长", "a12345b", false},
+	})
+	runYaraCases(t, `rule r { strings: $a = { 61 [-] 62 } condition: $a }`, []yaraCase{
+		{"任意跳转", "a" + strings.Repeat("x", 100) + "b", true},
+	})
+}
+
+func TestYaraRegexStrings(t *testing.T) {
+	runYaraCases(t, `rule r { strings: $a = /assert\s*\(\s*\$_(GET|POST)/ condition: $a }`, []yaraCase{
+		{"命中", "assert ( $_POST['x'])", true},
+		{"不命中", "assert($x)", false},
+	})
+	runYaraCases(t, `rule r { strings: $a = /base64_decode.+eval/is condition: $a }`, []yaraCase{
+		{"i和s标志", "BASE64_DECODE(\n)EVAL", true},
+	})
+}
+
+func TestYaraConditions(t *testing.T) {
+	const strs = `strings: $a = "aaa" $b = "bbb" $c1 = "c1" $c2 = "c2" `
+	rule := func(cond string) string { return "rule r { " + strs + "condition: " + cond + " }" }
+
+	cases := []struct {
+		cond string
+		data string
+		want bool
+	}{
+		{"$a and $b", "aaa bbb", true},
+		{"$a and $b", "aaa", false},
+		{"$a or $b", "bbb", true},
+		{"not $a", "bbb", true},
+		{"not ($a or $b)", "aaa", false},
+		{"($a or $b) and not $c1", "bbb", true},
+		{"#a == 2", "aaa aaa", true},
+		{"#a == 2", "aaaa", true},
+		{"#a > 1", "aaa", false},
+		{"filesize < 1KB", "aaa", true},
+		{"filesize > 1KB", "aaa", false},
+		{"filesize == 0x3", "aaa", true},
+		{"any of them", "c2", true},
+		{"all of them", "aaa bbb c1", false},
+		{"all of them", "aaa bbb c1 c2", true},
+		{"2 of them", "aaa c1", true},
+		{"none of them", "xyz", true},
+		{"all of ($c*)", "c1 c2", true},
+		{"all of ($c*)", "c1", false},
+		{"any of ($a, $c*)", "c2", true},
+		{"true", "", true},
+		{"false or $a", "aaa", true},
+	}
+	for _, c := range cases {
+		if got := yaraMatches(t, rule(c.cond), c.data); got != c.want {
+			t.Errorf("condition %q, 数据 %q: 期望 %v, 实际 %v", c.cond, c.data, c.want, got)
+		}
+	}
+}
+
+func TestYaraOffsetConditions(t *testing.T) {
+	const strs = `strings: $php = "<?php" $e = "eval" `
+	rule := func(cond string) string { return "rule r { " + strs + "condition: " + cond + " }" }
+	const data = "<?php eval(1); eval(2);"
+
+	cases := []struct {
+		cond string
+		want bool
+	}{
+		{"$php at 0", true},
+		{"$e at 0", false},
+		{"$e at 6", true},
+		{"$e at 2 + 4", true},
+		{"$e in (0..5)", false},
+		{"$e in (0..6)", true},
+		{"$e in (filesize - 10..filesize)", true},
+		{"$e in (filesize - 3..filesize)", false},
+		{"@e[1] == 6", true},
+		{"@e == 6", true},
+		{"@e[2] == 15", true},
+		{"@e[3] == 15", false},
+		{"@e[2] - @e[1] == 9", true},
+		{"(@e[2] - @e[1]) \\ 3 == 3", true},
+		{"@e[2] % 4 == 3", true},
+		{"$php at 0 and $e in (0..100)", true},
+		{"uint8(0) == 0x3C", true},
+		{"uint16(0) == 0x3F3C", true},
+		{"uint16be(0) == 0x3C3F", true},
+		{"uint32(1) == 0x7068703F", true},
+		{"uint32be(0) == 0x3C3F7068", true},
+		{"int8(0) == 60", true},
+		{"uint32(filesize) == 0", false},
+		{"not (uint32(filesize) == 0)", true},
+		{"(filesize - 3) \\ 2 == 10", true},
+		{"-1 < 0", true},
+	}
+	for _, c := range cases {
+		if got := yaraMatches(t, rule(c.cond), data); got != c.want {
+			t.Errorf("condition %q: 期望 %v, 实际 %v", c.cond, c.want, got)
+		}
+	}
+
+	// 负数在int系列中按有符号解析
+	if !yaraMatches(t, `rule r { condition: int16(0) == -2 and uint16(0) == 0xFFFE }`, "\xfe\xff") {
+		t.Error("int16应按有符号解析")
+	}
+}
+
+func TestYaraRulesAndModifiers(t *testing.T) {
+	rules, err := parseYara(`
+/* 多条规则, 带标签和meta */
+private rule first : webshell php {
+	meta:
+		author = "0RAYS"
+		score = 80
+	strings:
+		$ = "anon1"
+		$ = "anon2" private
+	condition:
+		all of them
+}
+global rule second { condition: filesize < 10MB }
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[0].name != "first" || rules[1].name != "second" {
+		t.Fatalf("规则解析错误: %+v", rules)
+	}
+	m, ok := rules[0].match([]byte("anon1 anon2"), 11)
+	if !ok || m.String() != "first [$_anon1, $_anon2]" {
+		t.Errorf("匿名特征串: %v %v", m, ok)
+	}
+}
+
+func TestYaraUnsupportedSyntax(t *testing.T) {
+	for _, src := range []string{
+		`import "pe" rule r { condition: pe.number_of_sections > 1 }`,
+		`include "other.yar"`,
+		`rules r { condition: true }`,
+		`rule r { strings: $a = "x" xor condition: $a }`,
+		`rule r { strings: $a = "x" condition: for any i in (1..#a): (@a[i] > 0) }`,
+		`rule r { strings: $a = { 61 ( 62 | 63 ) } condition: $a }`,
+		`rule r { condition: $missing }`,
+		`rule r { strings: $a = "x" condition: $a at }`,
+		`rule r { strings: $a = "x" condition: $a in (0 5) }`,
+		`rule r { strings: $a = "x" condition: @a[1 == 0 }`,
+		`rule r { strings: $a = /unterminated condition: $a }`,
+	} {
+		if _, err := parseYara(src); err == nil {
+			t.Errorf("应拒绝不支持或错误的语法: %s", src)
+		}
+	}
+}
+
+func TestLoadYaraRulesSkipsBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"good.yar":  `rule good { strings: $a = "eval" condition: $a }`,
+		"bad.yara":  `import "pe" rule bad { condition: true }`,
+		"other.txt": `rule ignored { condition: true }`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rules, err := loadYaraRules(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].name != "good" || rules[0].file != "good.yar" {
+		t.Errorf("应只加载good.yar中的规则, 实际: %+v", rules)
+	}
+	if _, err := loadYaraRules(t.TempDir()); err == nil {
+		t.Error("没有规则文件时应报错")
+	}
+}
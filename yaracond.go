@@ -0,0 +1,550 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// condParser YARA条件表达式的递归下降解析器
+type condParser struct {
+	tokens []string
+	pos    int
+	rule   *yaraRule
+}
+
+// yaraExpr 条件中的整数表达式; 读取越界、下标超出命中次数等情况下值未定义, 相关的比较不成立
+type yaraExpr func(ctx *yaraCtx) (int64, bool)
+
+// tokenizeCondition 把条件切分为标识符/数字、括号、逗号、范围(..)、算术和比较运算符
+func tokenizeCondition(src string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.ContainsRune("(),[]+-*\\%", rune(c)):
+			tokens = append(tokens, string(c))
+			i++
+		case strings.HasPrefix(src[i:], ".."):
+			tokens = append(tokens, "..")
+			i += 2
+		case strings.ContainsRune("<>=!", rune(c)):
+			op := string(c)
+			if i+1 < len(src) && src[i+1] == '=' {
+				op += "="
+			}
+			if op == "=" || op == "!" {
+				return nil, fmt.Errorf("无效的运算符: %s", op)
+			}
+			tokens = append(tokens, op)
+			i += len(op)
+		case c == '$' || c == '#' || c == '@' || isIdentChar(c):
+			// *只在$a*这样的特征串通配中属于名字, 其他位置是乘号
+			start := i
+			i++
+			for i < len(src) && isIdentChar(src[i]) && (src[i] != '*' || c == '$') {
+				i++
+			}
+			tokens = append(tokens, src[start:i])
+		default:
+			return nil, fmt.Errorf("不支持的语法: %q", src[i:])
+		}
+	}
+	return tokens, nil
+}
+
+func parseYaraCondition(src string, rule *yaraRule) (yaraCond, error) {
+	tokens, err := tokenizeCondition(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("条件为空")
+	}
+
+	p := &condParser{tokens: tokens, rule: rule}
+	cond, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("不支持的语法: %s", strings.Join(p.tokens[p.pos:], " "))
+	}
+	return cond, nil
+}
+
+func (p *condParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *condParser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *condParser) or() (yaraCond, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" {
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(ctx *yaraCtx) bool { return l(ctx) || right(ctx) }
+	}
+	return left, nil
+}
+
+func (p *condParser) and() (yaraCond, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" {
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(ctx *yaraCtx) bool { return l(ctx) && right(ctx) }
+	}
+	return left, nil
+}
+
+func (p *condParser) unary() (yaraCond, error) {
+	if p.peek() == "not" {
+		p.pos++
+		inner, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx *yaraCtx) bool { return !inner(ctx) }, nil
+	}
+	return p.primary()
+}
+
+// isExprOperator 判断是否为跟在整数表达式之后的运算符, 用于区分布尔括号和算术括号
+func isExprOperator(tok string) bool {
+	switch tok {
+	case "<", "<=", ">", ">=", "==", "!=", "+", "-", "*", "\\", "%", "..":
+		return true
+	}
+	return false
+}
+
+func (p *condParser) primary() (yaraCond, error) {
+	tok := p.peek()
+	switch {
+	case tok == "(":
+		// 先按布尔表达式解析, 不成立时回退按(filesize - 1) > 10这样的算术比较解析
+		save := p.pos
+		p.pos++
+		inner, err := p.or()
+		if err == nil && p.next() == ")" && !isExprOperator(p.peek()) {
+			return inner, nil
+		}
+		p.pos = save
+		return p.comparison()
+	case tok == "true" || tok == "false":
+		p.pos++
+		value := tok == "true"
+		return func(*yaraCtx) bool { return value }, nil
+	case strings.HasPrefix(tok, "$"):
+		p.pos++
+		ids, err := p.resolve(tok)
+		if err != nil {
+			return nil, err
+		}
+		return p.stringCondition(ids[0])
+	case tok == "any" || tok == "all" || tok == "none":
+		return p.quantifier()
+	}
+
+	if p.pos+1 < len(p.tokens) && p.tokens[p.pos+1] == "of" {
+		return p.quantifier()
+	}
+	return p.comparison()
+}
+
+// resolve 把特征串名(支持$a*通配)解析为规则中的特征串id
+func (p *condParser) resolve(name string) ([]string, error) {
+	var ids []string
+	wildcard := strings.HasSuffix(name, "*")
+	prefix := strings.TrimSuffix(name, "*")
+	for _, s := range p.rule.strings {
+		if s.id == name || wildcard && strings.HasPrefix(s.id, prefix) {
+			ids = append(ids, s.id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("未定义的特征串: %s", name)
+	}
+	return ids, nil
+}
+
+// quantifier 解析 any/all/none/N of them 和 any/all/none/N of ($a, $b*)
+func (p *condParser) quantifier() (yaraCond, error) {
+	quant := p.next()
+	if p.next() != "of" {
+		return nil, fmt.Errorf("%s之后缺少of", quant)
+	}
+
+	var ids []string
+	if p.peek() == "them" {
+		p.pos++
+		for _, s := range p.rule.strings {
+			ids = append(ids, s.id)
+		}
+	} else {
+		if p.next() != "(" {
+			return nil, fmt.Errorf("of之后应为them或特征串列表")
+		}
+		for {
+			matched, err := p.resolve(p.next())
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, matched...)
+			if sep := p.next(); sep == ")" {
+				break
+			} else if sep != "," {
+				return nil, fmt.Errorf("特征串列表格式错误")
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("规则没有定义特征串")
+	}
+
+	need := 0
+	switch quant {
+	case "any":
+		need = 1
+	case "all":
+		need = len(ids)
+	case "none":
+	default:
+		n, err := strconv.Atoi(quant)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("无效的数量: %s", quant)
+		}
+		need = n
+	}
+
+	return func(ctx *yaraCtx) bool {
+		hits := 0
+		for _, id := range ids {
+			if len(ctx.offsets[id]) > 0 {
+				hits++
+			}
+		}
+		if quant == "none" {
+			return hits == 0
+		}
+		return hits >= need
+	}, nil
+}
+
+// stringCondition 解析$a, $a at N和$a in (x..y)
+func (p *condParser) stringCondition(id string) (yaraCond, error) {
+	switch p.peek() {
+	case "at":
+		p.pos++
+		at, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx *yaraCtx) bool {
+			n, ok := at(ctx)
+			if !ok {
+				return false
+			}
+			for _, offset := range ctx.offsets[id] {
+				if int64(offset) == n {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case "in":
+		p.pos++
+		if p.next() != "(" {
+			return nil, fmt.Errorf("in之后缺少'('")
+		}
+		low, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ".." {
+			return nil, fmt.Errorf("范围应为(起始..结束)")
+		}
+		high, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("缺少')'")
+		}
+		return func(ctx *yaraCtx) bool {
+			lo, ok1 := low(ctx)
+			hi, ok2 := high(ctx)
+			if !ok1 || !ok2 {
+				return false
+			}
+			for _, offset := range ctx.offsets[id] {
+				if int64(offset) >= lo && int64(offset) <= hi {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+	return func(ctx *yaraCtx) bool { return len(ctx.offsets[id]) > 0 }, nil
+}
+
+// comparison 解析两个整数表达式之间的比较
+func (p *condParser) comparison() (yaraCond, error) {
+	left, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	op := p.next()
+	right, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+
+	var cmp func(a, b int64) bool
+	switch op {
+	case "<":
+		cmp = func(a, b int64) bool { return a < b }
+	case "<=":
+		cmp = func(a, b int64) bool { return a <= b }
+	case ">":
+		cmp = func(a, b int64) bool { return a > b }
+	case ">=":
+		cmp = func(a, b int64) bool { return a >= b }
+	case "==":
+		cmp = func(a, b int64) bool { return a == b }
+	case "!=":
+		cmp = func(a, b int64) bool { return a != b }
+	default:
+		return nil, fmt.Errorf("不支持的运算符: %q", op)
+	}
+	return func(ctx *yaraCtx) bool {
+		a, ok1 := left(ctx)
+		b, ok2 := right(ctx)
+		return ok1 && ok2 && cmp(a, b)
+	}, nil
+}
+
+// expr 解析加减
+func (p *condParser) expr() (yaraExpr, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "+" || p.peek() == "-" {
+		op := p.next()
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = arith(left, right, func(a, b int64) (int64, bool) {
+			if op == "+" {
+				return a + b, true
+			}
+			return a - b, true
+		})
+	}
+	return left, nil
+}
+
+// term 解析乘、除(\)和取余
+func (p *condParser) term() (yaraExpr, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "*" || p.peek() == "\\" || p.peek() == "%" {
+		op := p.next()
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		left = arith(left, right, func(a, b int64) (int64, bool) {
+			switch {
+			case op == "*":
+				return a * b, true
+			case b == 0:
+				return 0, false
+			case op == "%":
+				return a % b, true
+			}
+			return a / b, true
+		})
+	}
+	return left, nil
+}
+
+func arith(left, right yaraExpr, op func(a, b int64) (int64, bool)) yaraExpr {
+	return func(ctx *yaraCtx) (int64, bool) {
+		a, ok1 := left(ctx)
+		b, ok2 := right(ctx)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		return op(a, b)
+	}
+}
+
+// yaraIntReaders uint8/16/32(be)和int8/16/32(be)读取的字节数和是否有符号
+var yaraIntReaders = map[string]struct {
+	size   int
+	signed bool
+}{
+	"uint8": {1, false}, "uint16": {2, false}, "uint32": {4, false},
+	"int8": {1, true}, "int16": {2, true}, "int32": {4, true},
+}
+
+func (p *condParser) operand() (yaraExpr, error) {
+	tok := p.next()
+	switch {
+	case tok == "(":
+		inner, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("缺少')'")
+		}
+		return inner, nil
+	case tok == "-":
+		inner, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx *yaraCtx) (int64, bool) {
+			n, ok := inner(ctx)
+			return -n, ok
+		}, nil
+	case tok == "filesize":
+		return func(ctx *yaraCtx) (int64, bool) { return ctx.filesize, true }, nil
+	case strings.HasPrefix(tok, "#"):
+		ids, err := p.resolve("$" + tok[1:])
+		if err != nil {
+			return nil, err
+		}
+		return func(ctx *yaraCtx) (int64, bool) { return int64(len(ctx.offsets[ids[0]])), true }, nil
+	case strings.HasPrefix(tok, "@"):
+		return p.offsetOperand(tok)
+	}
+
+	if reader, ok := yaraIntReaders[strings.TrimSuffix(tok, "be")]; ok {
+		if p.next() != "(" {
+			return nil, fmt.Errorf("%s之后缺少'('", tok)
+		}
+		offset, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("缺少')'")
+		}
+		bigEndian := strings.HasSuffix(tok, "be")
+		return func(ctx *yaraCtx) (int64, bool) {
+			off, ok := offset(ctx)
+			if !ok {
+				return 0, false
+			}
+			return readYaraInt(ctx.data, off, reader.size, reader.signed, bigEndian)
+		}, nil
+	}
+
+	n, err := parseYaraNumber(tok)
+	if err != nil {
+		return nil, err
+	}
+	return func(*yaraCtx) (int64, bool) { return n, true }, nil
+}
+
+// offsetOperand 解析@a[i]: 第i次命中的偏移(从1开始), 省略[i]时为第一次命中
+func (p *condParser) offsetOperand(tok string) (yaraExpr, error) {
+	ids, err := p.resolve("$" + tok[1:])
+	if err != nil {
+		return nil, err
+	}
+	index := yaraExpr(func(*yaraCtx) (int64, bool) { return 1, true })
+	if p.peek() == "[" {
+		p.pos++
+		if index, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if p.next() != "]" {
+			return nil, fmt.Errorf("缺少']'")
+		}
+	}
+	return func(ctx *yaraCtx) (int64, bool) {
+		i, ok := index(ctx)
+		offsets := ctx.offsets[ids[0]]
+		if !ok || i < 1 || i > int64(len(offsets)) {
+			return 0, false
+		}
+		return int64(offsets[i-1]), true
+	}, nil
+}
+
+// readYaraInt 读取文件中offset处的整数, 默认小端; 超出读取范围时未定义
+func readYaraInt(data []byte, offset int64, size int, signed, bigEndian bool) (int64, bool) {
+	if offset < 0 || offset+int64(size) > int64(len(data)) {
+		return 0, false
+	}
+	b := data[offset : offset+int64(size)]
+	order := binary.ByteOrder(binary.LittleEndian)
+	if bigEndian {
+		order = binary.BigEndian
+	}
+	switch size {
+	case 1:
+		if signed {
+			return int64(int8(b[0])), true
+		}
+		return int64(b[0]), true
+	case 2:
+		if signed {
+			return int64(int16(order.Uint16(b))), true
+		}
+		return int64(order.Uint16(b)), true
+	}
+	if signed {
+		return int64(int32(order.Uint32(b))), true
+	}
+	return int64(order.Uint32(b)), true
+}
+
+// parseYaraNumber 解析十进制/十六进制数字, 支持KB和MB后缀
+func parseYaraNumber(tok string) (int64, error) {
+	multiplier := int64(1)
+	if strings.HasSuffix(tok, "KB") {
+		tok, multiplier = strings.TrimSuffix(tok, "KB"), 1024
+	} else if strings.HasSuffix(tok, "MB") {
+		tok, multiplier = strings.TrimSuffix(tok, "MB"), 1024*1024
+	}
+	n, err := strconv.ParseInt(tok, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("不支持的语法: %s", tok)
+	}
+	return n * multiplier, nil
+}